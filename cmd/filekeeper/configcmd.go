@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"filekeeper/internal/config"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runConfig implements "filekeeper config": print, explain, schema and migrate.
+// It returns the process exit code.
+func runConfig(args []string) int {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config <command> [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  print                  Print the effective configuration with defaults applied\n")
+		fmt.Fprintf(os.Stderr, "  explain                Describe each key and where its value came from\n")
+		fmt.Fprintf(os.Stderr, "  schema                 Print a JSON Schema for editor validation\n")
+		fmt.Fprintf(os.Stderr, "  migrate                Rewrite backup_path and remote_backup into the list keys\n")
+		fmt.Fprintf(os.Stderr, "\nRun '%s config <command> -h' for the options of a command.\n", os.Args[0])
+	}
+	if len(args) == 0 {
+		usage()
+		return 2
+	}
+
+	switch args[0] {
+	case "print":
+		return runConfigPrint(args[1:])
+	case "explain":
+		return runConfigExplain(args[1:])
+	case "schema":
+		return runConfigSchema(args[1:])
+	case "migrate":
+		return runConfigMigrate(args[1:])
+	case "-h", "--help", "help":
+		usage()
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown config command %q\n\n", args[0])
+		usage()
+		return 2
+	}
+}
+
+// configFlags returns a flag set with the --config option.
+func configFlags(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet("config "+name, flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	fs.StringVar(configPath, "c", "config.json", "Path to configuration file (shorthand)")
+	return fs, configPath
+}
+
+// runConfigPrint prints the effective configuration.
+func runConfigPrint(args []string) int {
+	fs, configPath := configFlags("print")
+	format := fs.String("format", "", "Output format: json, yaml or toml (default: format of the file)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config print [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print the configuration as a cycle uses it: the file with environment overrides,\n")
+		fmt.Fprintf(os.Stderr, "defaults applied, and backup_path and remote_backup merged into the lists.\n")
+		fmt.Fprintf(os.Stderr, "Secrets and values from ${VAR} references are shown as [redacted].\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+		fmt.Fprintf(os.Stderr, "      --format string    Output format: json, yaml or toml (default: format of the file)\n")
+	}
+	_ = fs.Parse(args)
+
+	outFormat := config.FormatFor(*configPath)
+	if *format != "" {
+		outFormat = config.Format(strings.ToLower(*format))
+		if outFormat != config.FormatJSON && outFormat != config.FormatYAML && outFormat != config.FormatTOML {
+			fmt.Fprintf(os.Stderr, "Invalid format %q: use json, yaml or toml\n", *format)
+			return 2
+		}
+	}
+
+	cfg, origin, err := config.LoadConfigWithOrigin(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	out, err := config.EncodeRedacted(cfg, origin, outFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding config: %v\n", err)
+		return 1
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+// runConfigExplain lists every key with its effective value, its source and its meaning.
+func runConfigExplain(args []string) int {
+	fs, configPath := configFlags("explain")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config explain [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "List each key with its effective value, where the value came from (the file,\n")
+		fmt.Fprintf(os.Stderr, "an environment variable or the default) and what it means. Secrets and values\n")
+		fmt.Fprintf(os.Stderr, "from ${VAR} references are shown as [redacted].\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+	}
+	_ = fs.Parse(args)
+
+	cfg, origin, err := config.LoadConfigWithOrigin(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+
+	// Values are looked up by key path in the JSON form of the effective configuration
+	var tree map[string]interface{}
+	data, err := config.Redact(cfg, origin)
+	if err == nil {
+		err = json.Unmarshal(data, &tree)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding config: %v\n", err)
+		return 1
+	}
+
+	fields := config.Fields()
+	replaced := make(map[string][]string) // Key -> older keys merged into it
+	for _, f := range fields {
+		if f.Deprecated != "" {
+			replaced[f.Deprecated] = append(replaced[f.Deprecated], f.Path)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tDESCRIPTION")
+	for _, f := range fields {
+		if f.IsItem() || f.Type == "section" {
+			continue
+		}
+
+		source := origin.Source(f.Path)
+		for _, old := range replaced[f.Path] {
+			switch {
+			case !origin.IsSet(old):
+			case origin.IsSet(f.Path):
+				source += fmt.Sprintf(", %s from %s", old, origin.Source(old))
+			default:
+				source = fmt.Sprintf("%s from %s", old, origin.Source(old))
+			}
+		}
+
+		value := "-"
+		if f.Deprecated != "" {
+			if origin.IsSet(f.Path) {
+				value = "(merged into " + f.Deprecated + ")"
+			}
+		} else if v, ok := lookupPath(tree, f.Path); ok {
+			encoded, _ := json.Marshal(v)
+			value = string(encoded)
+		}
+
+		desc := f.Description
+		if f.Deprecated != "" {
+			desc += "; use " + f.Deprecated
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Path, value, source, desc)
+	}
+	if err := w.Flush(); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// lookupPath returns the value at a dotted key path in a decoded JSON tree.
+func lookupPath(tree map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = tree
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, value != nil
+}
+
+// runConfigSchema prints the JSON Schema of the configuration.
+func runConfigSchema(args []string) int {
+	fs := flag.NewFlagSet("config schema", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config schema\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Print a JSON Schema of the configuration for editor validation of JSON and YAML files.\n")
+	}
+	_ = fs.Parse(args)
+
+	out, err := json.MarshalIndent(config.Schema(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding schema: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(out))
+	return 0
+}
+
+// runConfigMigrate rewrites older keys into their current form.
+func runConfigMigrate(args []string) int {
+	fs, configPath := configFlags("migrate")
+	write := fs.Bool("write", false, "Rewrite the configuration file in place")
+	fs.BoolVar(write, "w", false, "Rewrite the configuration file in place (shorthand)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s config migrate [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Rewrite backup_path and remote_backup into backup_paths and remote_backups.\n")
+		fmt.Fprintf(os.Stderr, "The result is printed unless --write is given; changes are listed on stderr.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+		fmt.Fprintf(os.Stderr, "  -w, --write            Rewrite the configuration file in place\n")
+	}
+	_ = fs.Parse(args)
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading config: %v\n", err)
+		return 1
+	}
+	out, changes, err := config.Migrate(data, config.FormatFor(*configPath))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error migrating config: %s: %v\n", *configPath, err)
+		return 1
+	}
+
+	if len(changes) == 0 {
+		fmt.Fprintln(os.Stderr, "Configuration is up to date")
+		if !*write {
+			os.Stdout.Write(out)
+		}
+		return 0
+	}
+	for _, change := range changes {
+		fmt.Fprintf(os.Stderr, "%s\n", change)
+	}
+
+	if !*write {
+		os.Stdout.Write(out)
+		return 0
+	}
+	info, err := os.Stat(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing config: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(*configPath, out, info.Mode().Perm()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing config: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Rewrote %s\n", *configPath)
+	return 0
+}
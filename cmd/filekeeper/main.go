@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"filekeeper/internal/backup"
 	"filekeeper/internal/config"
 	"filekeeper/internal/logger"
+	"filekeeper/internal/notify"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -22,6 +24,20 @@ var (
 )
 
 func main() {
+	// Subcommands have their own flags
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "undelete":
+			os.Exit(runUndelete(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		case "plan":
+			os.Exit(runPlan(os.Args[2:]))
+		case "apply":
+			os.Exit(runApply(os.Args[2:]))
+		}
+	}
+
 	// Define flags
 	configPath := flag.String("config", "config.json", "Path to configuration file")
 	flag.StringVar(configPath, "c", "config.json", "Path to configuration file (shorthand)")
@@ -40,9 +56,22 @@ func main() {
 
 	validate := flag.Bool("validate", false, "Validate configuration and exit")
 
+	force := flag.Bool("force", false, "Override safety limits for the first cycle")
+
+	reportPath := flag.String("report", "", "Write a JSON report of each cycle to this file, - for stdout")
+
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s undelete [options] [pattern...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s config <print|explain|schema|migrate> [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s plan [-o plan.json] [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s apply --plan plan.json [options]\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "Filekeeper - Automatic file backup and pruning service\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  undelete               Restore pruned files from the trash (see undelete -h)\n")
+		fmt.Fprintf(os.Stderr, "  config                 Print, explain, validate against a schema or migrate the configuration\n")
+		fmt.Fprintf(os.Stderr, "  plan                   Write the actions of a cycle as JSON without changing anything\n")
+		fmt.Fprintf(os.Stderr, "  apply                  Execute a reviewed plan, skipping files changed since planning\n\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
 		fmt.Fprintf(os.Stderr, "  -1, --once             Run once and exit (no loop)\n")
@@ -50,14 +79,27 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  -v, --verbose          Enable verbose/debug logging\n")
 		fmt.Fprintf(os.Stderr, "  -V, --version          Show version and exit\n")
 		fmt.Fprintf(os.Stderr, "      --validate         Validate configuration and exit\n")
+		fmt.Fprintf(os.Stderr, "      --force            Override safety limits for the first cycle\n")
+		fmt.Fprintf(os.Stderr, "      --report string    Write a JSON report of each cycle to this file, - for stdout\n")
 		fmt.Fprintf(os.Stderr, "  -h, --help             Show this help message\n")
 		fmt.Fprintf(os.Stderr, "\nExamples:\n")
 		fmt.Fprintf(os.Stderr, "  %s --config /etc/filekeeper/config.json\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --once --dry-run\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  %s --validate --config new-config.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --once --report /var/lib/filekeeper/report.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "\nExit codes with --once:\n")
+		fmt.Fprintf(os.Stderr, "  0  success            1  cycle stopped early    2  partial failure\n")
+		fmt.Fprintf(os.Stderr, "  3  threshold exceeded 4  configuration error\n")
 	}
 
-	flag.Parse()
+	// Usage errors exit like configuration errors, not with the flag package's 2
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(exitSuccess)
+		}
+		os.Exit(exitConfigError)
+	}
 
 	// Handle version flag
 	if *version {
@@ -66,20 +108,28 @@ func main() {
 	}
 
 	// Load configuration
+	startedAt := time.Now()
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		if *reportPath != "" && !*validate {
+			report := backup.NewReport(nil, err, startedAt)
+			report.Status = backup.StatusConfigError
+			if err := writeReport(*reportPath, report); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+			}
+		}
+		os.Exit(exitConfigError)
 	}
 
 	// Handle validate flag
 	if *validate {
 		if err := cfg.Validate(); err != nil {
 			fmt.Fprintf(os.Stderr, "Configuration invalid: %v\n", err)
-			os.Exit(1)
+			os.Exit(exitConfigError)
 		}
 		fmt.Println("Configuration is valid")
-		os.Exit(0)
+		os.Exit(exitSuccess)
 	}
 
 	// Override log level if verbose
@@ -87,17 +137,27 @@ func main() {
 		cfg.LogLevel = "debug"
 	}
 
-	// Initialize logger
+	// Initialize logger; a report on stdout moves the logs to stderr
 	log := logger.New(cfg.LogLevel, cfg.LogFormat)
+	if *reportPath == "-" {
+		log = logger.NewTo(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	}
 
 	if *dryRun {
 		log.Info("running in dry-run mode - no changes will be made")
 	}
 
+	// Initialize notifications
+	notifier, err := notify.New(cfg.GetNotifyConfig(), log)
+	if err != nil {
+		log.Error("failed to initialize notifications", slog.String("error", err.Error()))
+		os.Exit(exitConfigError)
+	}
+
 	log.Info("filekeeper started",
 		slog.String("version", Version),
-		slog.Float64("prune_after_hours", float64(cfg.PruneAfterHours)),
-		slog.Int("run_interval_seconds", cfg.RunInterval),
+		slog.Duration("prune_after", cfg.GetPruneAfter()),
+		slog.Duration("run_interval", cfg.GetRunInterval()),
 		slog.String("target_folder", cfg.TargetFolder),
 		slog.Bool("backup_enabled", cfg.EnableBackup),
 		slog.Bool("dry_run", *dryRun),
@@ -124,6 +184,7 @@ func main() {
 	// Create run options
 	opts := &backup.RunOptions{
 		DryRun: *dryRun,
+		Force:  *force,
 	}
 
 	// Run the service
@@ -134,6 +195,12 @@ func main() {
 			return
 		default:
 			result, err := backup.RunBackup(ctx, cfg, opts, log)
+			report := backup.NewReport(result, err, startedAt)
+			report.TargetFolder = cfg.TargetFolder
+			report.DryRun = *dryRun
+
+			// --force is a one-off override; later cycles are guarded again
+			opts.Force = false
 
 			// Log result summary
 			if result != nil {
@@ -143,6 +210,8 @@ func main() {
 						slog.Int("failed", result.Failed),
 						slog.Int("backed_up", result.BackedUp),
 						slog.Int("pruned", result.Pruned),
+						slog.Int("in_use", result.InUse),
+						slog.Int("outbox_pending", result.OutboxPending),
 						slog.Float64("failure_rate_percent", result.FailureRate()),
 					)
 				} else if result.Succeeded > 0 || result.Pruned > 0 {
@@ -150,7 +219,13 @@ func main() {
 						slog.Int("succeeded", result.Succeeded),
 						slog.Int("backed_up", result.BackedUp),
 						slog.Int("pruned", result.Pruned),
+						slog.Int("in_use", result.InUse),
+						slog.Int("truncated", result.Truncated),
+						slog.Int64("truncated_bytes", result.TruncatedBytes),
+						slog.Int("dirs_removed", result.DirsRemoved),
+						slog.Int("trash_purged", result.TrashPurged),
 						slog.Int64("total_bytes", result.TotalBytes),
+						slog.Int("outbox_pending", result.OutboxPending),
 					)
 				}
 			}
@@ -159,15 +234,30 @@ func main() {
 				// Don't log context cancellation as an error
 				if ctx.Err() != nil {
 					log.Info("backup interrupted by shutdown")
+				} else if errors.Is(err, backup.ErrSafetyLimit) {
+					log.Error("backup cycle aborted before pruning, run once with --force to override",
+						slog.String("error", err.Error()),
+					)
 				} else {
 					log.Error("backup cycle failed", slog.String("error", err.Error()))
 				}
 			}
 
+			// Send notifications unless the cycle was cut short by shutdown
+			if ctx.Err() == nil && !*dryRun {
+				notifier.Observe(context.Background(), cycleOutcome(result, err))
+			}
+
+			if *reportPath != "" {
+				if err := writeReport(*reportPath, report); err != nil {
+					log.Error("failed to write report", slog.String("error", err.Error()))
+				}
+			}
+
 			// If running once, exit after first cycle
 			if *once {
-				if err != nil && ctx.Err() == nil {
-					os.Exit(1)
+				if code := exitCode(report.Status); code != exitSuccess {
+					os.Exit(code)
 				}
 				log.Info("single run complete, exiting")
 				return
@@ -178,9 +268,26 @@ func main() {
 			case <-ctx.Done():
 				log.Info("shutdown complete")
 				return
-			case <-time.After(time.Duration(cfg.RunInterval) * time.Second):
-				// Continue to next iteration
+			case <-time.After(cfg.GetRunInterval()):
+				startedAt = time.Now()
 			}
 		}
 	}
 }
+
+// cycleOutcome summarizes a backup cycle for the notifier.
+func cycleOutcome(result *backup.Result, err error) notify.Cycle {
+	c := notify.Cycle{
+		Err:               err,
+		Failed:            err != nil,
+		ThresholdExceeded: errors.Is(err, backup.ErrThresholdExceeded),
+		SafetyLimit:       errors.Is(err, backup.ErrSafetyLimit),
+		ArchivesFailed:    errors.Is(err, backup.ErrAllArchivesFailed),
+	}
+	if result != nil {
+		c.Result = result
+		c.Failed = c.Failed || result.HasErrors()
+		c.RemoteFailures = result.RemoteFailed
+	}
+	return c
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/backup"
+	"filekeeper/internal/config"
+	"filekeeper/internal/logger"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runPlan implements "filekeeper plan": it writes the actions of a cycle as
+// JSON without changing anything. It returns the process exit code.
+func runPlan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	fs.StringVar(configPath, "c", "config.json", "Path to configuration file (shorthand)")
+	output := fs.String("output", "-", "Write the plan to this file, - for stdout")
+	fs.StringVar(output, "o", "-", "Write the plan to this file (shorthand)")
+	verbose := fs.Bool("verbose", false, "Enable verbose/debug logging")
+	fs.BoolVar(verbose, "v", false, "Enable verbose logging (shorthand)")
+	force := fs.Bool("force", false, "Plan past safety limits")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s plan [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Compute what a cycle would back up, archive, copy, truncate and prune, and\n")
+		fmt.Fprintf(os.Stderr, "write it as JSON for review. Nothing is changed; logs go to stderr.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+		fmt.Fprintf(os.Stderr, "  -o, --output string    Write the plan to this file, - for stdout (default \"-\")\n")
+		fmt.Fprintf(os.Stderr, "  -v, --verbose          Enable verbose/debug logging\n")
+		fmt.Fprintf(os.Stderr, "      --force            Plan past safety limits\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s plan -o plan.json\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s apply --plan plan.json\n", os.Args[0])
+	}
+	_ = fs.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return exitConfigError
+	}
+	if *verbose {
+		cfg.LogLevel = "debug"
+	}
+	log := logger.NewTo(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	plan, _, err := backup.BuildPlan(ctx, cfg, &backup.RunOptions{Force: *force}, log)
+	if err != nil {
+		if errors.Is(err, backup.ErrSafetyLimit) {
+			fmt.Fprintf(os.Stderr, "Error planning: %v; use --force to plan anyway\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error planning: %v\n", err)
+		}
+		return 1
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding plan: %v\n", err)
+		return 1
+	}
+	data = append(data, '\n')
+	if *output == "-" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing plan: %v\n", err)
+		return 1
+	}
+
+	t := plan.Totals
+	fmt.Fprintf(os.Stderr, "Plan: %d files (%d bytes), %d backups, %d archives, %d remote copies, %d truncations, %d prunes (%d bytes freed)\n",
+		t.Files, t.Bytes, t.Backups, t.Archives, t.RemoteCopies, t.Truncates, t.Prunes, t.FreedBytes)
+	return 0
+}
+
+// runApply implements "filekeeper apply": it executes a plan written by
+// "filekeeper plan". It returns the process exit code.
+func runApply(args []string) int {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	fs.StringVar(configPath, "c", "config.json", "Path to configuration file (shorthand)")
+	planPath := fs.String("plan", "", "Plan file written by the plan command")
+	reportPath := fs.String("report", "", "Write a JSON report to this file, - for stdout")
+	verbose := fs.Bool("verbose", false, "Enable verbose/debug logging")
+	fs.BoolVar(verbose, "v", false, "Enable verbose logging (shorthand)")
+	force := fs.Bool("force", false, "Apply past safety limits")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s apply --plan file [options]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Execute a plan written by the plan command. The plan is refused if the\n")
+		fmt.Fprintf(os.Stderr, "configuration changed since planning; a file that changed since planning is\n")
+		fmt.Fprintf(os.Stderr, "left untouched and reported.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "      --plan string      Plan file written by the plan command\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+		fmt.Fprintf(os.Stderr, "  -v, --verbose          Enable verbose/debug logging\n")
+		fmt.Fprintf(os.Stderr, "      --force            Apply past safety limits\n")
+		fmt.Fprintf(os.Stderr, "      --report string    Write a JSON report to this file, - for stdout\n")
+		fmt.Fprintf(os.Stderr, "\nExit codes are those of a cycle run with --once.\n")
+	}
+	_ = fs.Parse(args)
+
+	if *planPath == "" {
+		fmt.Fprintln(os.Stderr, "Missing --plan")
+		fs.Usage()
+		return exitConfigError
+	}
+	plan, err := backup.ReadPlan(*planPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading plan: %v\n", err)
+		return 1
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return exitConfigError
+	}
+	if *verbose {
+		cfg.LogLevel = "debug"
+	}
+	log := logger.New(cfg.LogLevel, cfg.LogFormat)
+	if *reportPath == "-" {
+		log = logger.NewTo(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	startedAt := time.Now()
+	result, err := backup.ApplyPlan(ctx, cfg, plan, &backup.RunOptions{Force: *force}, log)
+	report := backup.NewReport(result, err, startedAt)
+	report.TargetFolder = cfg.TargetFolder
+	if *reportPath != "" {
+		if err := writeReport(*reportPath, report); err != nil {
+			log.Error("failed to write report", slog.String("error", err.Error()))
+		}
+	}
+	if err != nil {
+		log.Error("apply failed", slog.String("error", err.Error()))
+		return exitCode(report.Status)
+	}
+	if result.HasErrors() || result.RemoteFailed > 0 {
+		log.Warn("plan applied with errors",
+			slog.Int("succeeded", result.Succeeded),
+			slog.Int("failed", result.Failed),
+			slog.Int("backed_up", result.BackedUp),
+			slog.Int("pruned", result.Pruned),
+			slog.Int("remote_failed", result.RemoteFailed),
+			slog.Int("outbox_pending", result.OutboxPending),
+		)
+		return exitCode(report.Status)
+	}
+	log.Info("plan applied",
+		slog.Int("backed_up", result.BackedUp),
+		slog.Int("pruned", result.Pruned),
+		slog.Int("truncated", result.Truncated),
+		slog.Int64("total_bytes", result.TotalBytes),
+	)
+	return 0
+}
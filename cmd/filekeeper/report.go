@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"filekeeper/internal/backup"
+	"os"
+	"path/filepath"
+)
+
+// Exit codes of a cycle run with --once, plan and apply.
+const (
+	exitSuccess           = 0 // Every file was processed, or the cycle was interrupted by shutdown
+	exitFailure           = 1 // The cycle stopped early, for example at a safety limit
+	exitPartialFailure    = 2 // Some files or remote copies failed
+	exitThresholdExceeded = 3 // The cycle stopped at error_threshold_percent
+	exitConfigError       = 4 // The configuration or command line is invalid
+)
+
+// exitCode returns the exit code for the status of a cycle.
+func exitCode(status backup.Status) int {
+	switch status {
+	case backup.StatusPartialFailure:
+		return exitPartialFailure
+	case backup.StatusThresholdExceeded:
+		return exitThresholdExceeded
+	case backup.StatusConfigError:
+		return exitConfigError
+	case backup.StatusFailed:
+		return exitFailure
+	default:
+		return exitSuccess
+	}
+}
+
+// writeReport writes a cycle report as JSON to path, or to stdout if path is "-".
+// Files are replaced atomically, so a reader never sees a partial report.
+func writeReport(path string, report *backup.Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".filekeeper-report-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"filekeeper/internal/config"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/trash"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runUndelete implements "filekeeper undelete": it lists the trash or restores
+// trashed files to their original paths. It returns the process exit code.
+func runUndelete(args []string) int {
+	fs := flag.NewFlagSet("undelete", flag.ExitOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	fs.StringVar(configPath, "c", "config.json", "Path to configuration file (shorthand)")
+	list := fs.Bool("list", false, "List trashed files instead of restoring them")
+	fs.BoolVar(list, "l", false, "List trashed files (shorthand)")
+	batchName := fs.String("batch", "", "Only use files from this trash batch")
+	overwrite := fs.Bool("overwrite", false, "Replace files that exist at the original path")
+	dryRun := fs.Bool("dry-run", false, "Show what would be restored without doing it")
+	fs.BoolVar(dryRun, "n", false, "Show what would be restored (shorthand)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s undelete [options] [pattern...]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Restore pruned files from the trash directory. Patterns are matched against\n")
+		fmt.Fprintf(os.Stderr, "paths relative to target_folder like rule globs; without patterns every file\n")
+		fmt.Fprintf(os.Stderr, "is restored. A file trashed more than once is restored from its newest batch.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fmt.Fprintf(os.Stderr, "  -c, --config string    Path to configuration file (default \"config.json\")\n")
+		fmt.Fprintf(os.Stderr, "  -l, --list             List trashed files instead of restoring them\n")
+		fmt.Fprintf(os.Stderr, "      --batch string     Only use files from this trash batch\n")
+		fmt.Fprintf(os.Stderr, "      --overwrite        Replace files that exist at the original path\n")
+		fmt.Fprintf(os.Stderr, "  -n, --dry-run          Show what would be restored without doing it\n")
+		fmt.Fprintf(os.Stderr, "\nExamples:\n")
+		fmt.Fprintf(os.Stderr, "  %s undelete --list\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s undelete 'app/*.log'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s undelete --batch 20260918T020000Z\n", os.Args[0])
+	}
+	_ = fs.Parse(args)
+
+	patterns := fs.Args()
+	for _, p := range patterns {
+		if err := rules.ValidateGlob(p); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid pattern %q: %v\n", p, err)
+			return 1
+		}
+	}
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	bin := trash.New(cfg.GetTrashConfig(), cfg.TargetFolder)
+	if bin == nil {
+		fmt.Fprintln(os.Stderr, "Trash is not enabled in the configuration")
+		return 1
+	}
+
+	entries, err := bin.List()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading trash: %v\n", err)
+		return 1
+	}
+
+	// Entries are newest first, so the first entry for a path is its newest copy
+	seen := make(map[string]bool)
+	var selected []trash.Entry
+	for _, e := range entries {
+		if *batchName != "" && e.Batch != *batchName {
+			continue
+		}
+		if !matchesAny(patterns, e.RelPath) || seen[e.RelPath] {
+			continue
+		}
+		seen[e.RelPath] = true
+		selected = append(selected, e)
+	}
+
+	if *list {
+		for _, e := range selected {
+			fmt.Printf("%s  %s  %10d  %s\n", e.Batch, e.Deleted.Local().Format("2006-01-02 15:04:05"), e.Size, e.RelPath)
+		}
+		return 0
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("No matching files in the trash")
+		return 0
+	}
+
+	failed := 0
+	for _, e := range selected {
+		if *dryRun {
+			fmt.Printf("[DRY-RUN] would restore %s (batch %s)\n", e.RelPath, e.Batch)
+			continue
+		}
+		dest, err := bin.Restore(e, *overwrite)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore %s: %v\n", e.RelPath, err)
+			failed++
+			continue
+		}
+		fmt.Printf("restored %s\n", dest)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d files could not be restored\n", failed, len(selected))
+		return 1
+	}
+	return 0
+}
+
+// matchesAny reports whether relPath matches one of the patterns, or true if there are none.
+func matchesAny(patterns []string, relPath string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if rules.MatchGlob(p, relPath) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,10 +4,15 @@ import (
 	"archive/tar"
 	"archive/zip"
 	"compress/gzip"
+	"context"
+	"filekeeper/pkg/metadata"
+	"filekeeper/pkg/ratelimit"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -35,6 +40,22 @@ type Config struct {
 	Enabled bool    `json:"enabled"`
 	Format  Format  `json:"format"`   // tar, tar.gz, zip
 	GroupBy GroupBy `json:"group_by"` // daily, weekly, monthly
+
+	// Header normalization. Entries are always written in name order.
+	Reproducible  bool   `json:"reproducible"`    // Normalize headers so identical inputs give byte-identical archives
+	UID           *int   `json:"uid,omitempty"`   // Owner uid recorded in tar headers (reproducible default: 0)
+	GID           *int   `json:"gid,omitempty"`   // Owner gid recorded in tar headers (reproducible default: 0)
+	Uname         string `json:"uname,omitempty"` // Owner user name recorded in tar headers
+	Gname         string `json:"gname,omitempty"` // Owner group name recorded in tar headers
+	ModeMask      string `json:"mode_mask"`       // Octal mask applied to entry modes, e.g. "0644"
+	ZeroGzipMtime bool   `json:"zero_gzip_mtime"` // Write 0 instead of the period start to the gzip header
+
+	// PreserveMetadata records access times and extended attributes in tar entries (PAX format).
+	// Zip entries carry only the mode and modification time.
+	PreserveMetadata bool `json:"preserve_metadata"`
+
+	// FollowLinks archives the content symlinks point to instead of the links themselves.
+	FollowLinks bool `json:"follow_links"`
 }
 
 // DefaultConfig returns the default archive configuration.
@@ -66,9 +87,34 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("unknown group_by value: %s (supported: daily, weekly, monthly)", c.GroupBy)
 	}
 
+	if c.UID != nil && *c.UID < 0 {
+		return fmt.Errorf("uid must not be negative, got %d", *c.UID)
+	}
+	if c.GID != nil && *c.GID < 0 {
+		return fmt.Errorf("gid must not be negative, got %d", *c.GID)
+	}
+	if _, err := c.modeMask(); err != nil {
+		return err
+	}
+	if c.Reproducible && c.PreserveMetadata {
+		return fmt.Errorf("reproducible archives cannot preserve file metadata")
+	}
+
 	return nil
 }
 
+// modeMask parses ModeMask. It returns 0 if no mask is configured.
+func (c *Config) modeMask() (os.FileMode, error) {
+	if c.ModeMask == "" {
+		return 0, nil
+	}
+	mask, err := strconv.ParseUint(c.ModeMask, 8, 32)
+	if err != nil || mask > 07777 {
+		return 0, fmt.Errorf("mode_mask must be an octal permission mask such as \"0644\", got: %s", c.ModeMask)
+	}
+	return os.FileMode(mask), nil
+}
+
 // ExtensionFor returns the file extension for the given format.
 func ExtensionFor(format Format) string {
 	switch format {
@@ -102,12 +148,31 @@ func GenerateArchiveName(t time.Time, groupBy GroupBy, format Format) string {
 	return "backup-" + datePart + ExtensionFor(format)
 }
 
+// PeriodStart returns the start of the period containing t, in t's location.
+// Weeks start on Monday, matching ISO week numbering.
+func PeriodStart(t time.Time, groupBy GroupBy) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch groupBy {
+	case GroupByWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case GroupByMonthly:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
 // Result contains archive creation statistics.
+// FilesArchived and TotalSize count only the files added in this call;
+// entries carried over from an existing archive are counted in MergedEntries.
 type Result struct {
 	ArchivePath   string
 	FilesArchived int
 	TotalSize     int64
 	ArchiveSize   int64
+	MergedEntries int   // Entries copied from an existing archive for the same period
+	PreviousSize  int64 // Size of the existing archive before merging (0 if new)
 }
 
 // CompressionRatio returns the compression ratio as a percentage.
@@ -122,6 +187,10 @@ func (r *Result) CompressionRatio() float64 {
 type Creator struct {
 	config    *Config
 	outputDir string
+
+	ctx   context.Context
+	read  *ratelimit.Limiter // Limits reads of source files (nil = unlimited)
+	write *ratelimit.Limiter // Limits writes of the archive (nil = unlimited)
 }
 
 // NewCreator creates a new archive creator.
@@ -132,11 +201,20 @@ func NewCreator(cfg *Config, outputDir string) *Creator {
 	return &Creator{
 		config:    cfg,
 		outputDir: outputDir,
+		ctx:       context.Background(),
 	}
 }
 
+// WithLimits makes the creator read no faster than read and write no faster than
+// write allows. Waiting for a limiter stops with the context's error if ctx is done.
+func (c *Creator) WithLimits(ctx context.Context, read, write *ratelimit.Limiter) *Creator {
+	c.ctx, c.read, c.write = ctx, read, write
+	return c
+}
+
 // CreateArchive creates an archive from the given files.
 // The files map contains source paths as keys and archive paths (relative) as values.
+// If an archive for the same period already exists, its entries are merged into the new archive.
 func (c *Creator) CreateArchive(files map[string]string, archiveTime time.Time) (*Result, error) {
 	if len(files) == 0 {
 		return &Result{}, nil
@@ -160,39 +238,160 @@ func (c *Creator) CreateArchive(files map[string]string, archiveTime time.Time)
 		return nil, fmt.Errorf("create archive directory: %w", err)
 	}
 
+	// An archive for the same period may exist from an earlier cycle; its entries are kept
+	existing := ""
+	var previousSize int64
+	if info, err := os.Stat(archivePath); err == nil {
+		existing = archivePath
+		previousSize = info.Size()
+	}
+
+	// Write to a temporary file so a failure never leaves a truncated archive behind
+	tmpPath := archivePath + ".tmp"
+
 	var result *Result
 	var err error
 
 	switch format {
 	case FormatTar:
-		result, err = c.createTarArchive(archivePath, files, false)
+		result, err = c.createTarArchive(tmpPath, existing, files, false, archiveTime)
 	case FormatTarGz:
-		result, err = c.createTarArchive(archivePath, files, true)
+		result, err = c.createTarArchive(tmpPath, existing, files, true, archiveTime)
 	case FormatZip:
-		result, err = c.createZipArchive(archivePath, files)
+		result, err = c.createZipArchive(tmpPath, existing, files)
 	default:
-		result, err = c.createTarArchive(archivePath, files, true)
+		result, err = c.createTarArchive(tmpPath, existing, files, true, archiveTime)
 	}
 
 	if err != nil {
+		os.Remove(tmpPath)
 		return nil, err
 	}
 
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("finalize archive: %w", err)
+	}
+
 	result.ArchivePath = archivePath
+	result.PreviousSize = previousSize
 	return result, nil
 }
 
-// createTarArchive creates a tar or tar.gz archive.
-func (c *Creator) createTarArchive(archivePath string, files map[string]string, compress bool) (*Result, error) {
+// CopyArchive copies an archive made by CreateArchive in another directory into the
+// output directory, instead of building it again from the files. Like CreateArchive it
+// writes a temporary file first. The copy gets the modification time of the original,
+// so that InSync recognizes both as the same archive in later cycles.
+func (c *Creator) CopyArchive(src *Result) (*Result, error) {
+	srcInfo, err := os.Stat(src.ArchivePath)
+	if err != nil {
+		return nil, fmt.Errorf("stat archive: %w", err)
+	}
+	if err := os.MkdirAll(c.outputDir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("create archive directory: %w", err)
+	}
+
+	archivePath := filepath.Join(c.outputDir, filepath.Base(src.ArchivePath))
+	var previousSize int64
+	if info, err := os.Stat(archivePath); err == nil {
+		previousSize = info.Size()
+	}
+
+	tmpPath := archivePath + ".tmp"
+	if err := c.copyFile(src.ArchivePath, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Chtimes(tmpPath, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("set archive time: %w", err)
+	}
+	if err := os.Rename(tmpPath, archivePath); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("finalize archive: %w", err)
+	}
+
+	result := *src
+	result.ArchivePath = archivePath
+	result.ArchiveSize = srcInfo.Size()
+	result.PreviousSize = previousSize
+	return &result, nil
+}
+
+// copyFile copies src to dest, limited like the creator's other reads and writes.
+func (c *Creator) copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("create archive file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(ratelimit.NewWriter(c.ctx, out, c.write), ratelimit.NewReader(c.ctx, in, c.read)); err != nil {
+		return fmt.Errorf("copy archive: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("close archive file: %w", err)
+	}
+	return nil
+}
+
+// InSync reports whether two archives of the same period, described by their state
+// before a cycle, hold the same entries: both are missing (nil), or both have the same
+// size and modification time, as an archive and its copy from CopyArchive do.
+// Merging the same files into archives that are in sync gives the same archive.
+func InSync(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// entry is a file to be added to an archive.
+type entry struct {
+	src  string // Source path on disk
+	name string // Slash-separated path inside the archive
+}
+
+// fileKey identifies a file by device and inode.
+type fileKey struct {
+	dev, ino uint64
+}
+
+// sortedEntries returns the files ordered by archive path, so archives do not depend on map order.
+func sortedEntries(files map[string]string) []entry {
+	entries := make([]entry, 0, len(files))
+	for src, archPath := range files {
+		entries = append(entries, entry{src: src, name: filepath.ToSlash(archPath)})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries
+}
+
+// createTarArchive creates a tar or tar.gz archive with entries sorted by name.
+// If existing is set, its entries are merged in name order unless a new file replaces them.
+func (c *Creator) createTarArchive(archivePath, existing string, files map[string]string, compress bool, archiveTime time.Time) (*Result, error) {
 	file, err := os.Create(archivePath)
 	if err != nil {
 		return nil, fmt.Errorf("create archive file: %w", err)
 	}
 	defer file.Close()
 
-	var writer io.WriteCloser = file
+	out := ratelimit.NewWriter(c.ctx, file, c.write)
+	writer := out
+	var gzWriter *gzip.Writer
 	if compress {
-		gzWriter := gzip.NewWriter(file)
+		gzWriter = gzip.NewWriter(out)
+		if !c.config.ZeroGzipMtime {
+			gzWriter.ModTime = PeriodStart(archiveTime, c.config.GroupBy)
+		}
 		defer gzWriter.Close()
 		writer = gzWriter
 	}
@@ -201,46 +400,80 @@ func (c *Creator) createTarArchive(archivePath string, files map[string]string,
 	defer tarWriter.Close()
 
 	result := &Result{}
-
-	for srcPath, archPath := range files {
-		info, err := os.Stat(srcPath)
+	entries := sortedEntries(files)
+	replaced := archivePaths(files)
+	links := make(map[fileKey]string)
+
+	// Existing entries are read in order and interleaved with the new, sorted entries
+	next := func() (*tar.Header, error) { return nil, nil }
+	var tarReader *tar.Reader
+	if existing != "" {
+		reader, closeFn, err := openTar(existing, compress)
 		if err != nil {
-			return nil, fmt.Errorf("stat file %s: %w", srcPath, err)
+			return nil, fmt.Errorf("merge existing archive: %w", err)
 		}
-
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return nil, fmt.Errorf("create tar header for %s: %w", srcPath, err)
+		defer closeFn()
+		tarReader = reader
+		next = func() (*tar.Header, error) {
+			for {
+				header, err := tarReader.Next()
+				if err == io.EOF {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, fmt.Errorf("merge existing archive: read tar header: %w", err)
+				}
+				if !replaced[filepath.ToSlash(header.Name)] {
+					return header, nil
+				}
+			}
 		}
+	}
 
-		// Use the archive path (relative path within archive)
-		header.Name = archPath
-
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return nil, fmt.Errorf("write tar header for %s: %w", srcPath, err)
-		}
+	old, err := next()
+	if err != nil {
+		return nil, err
+	}
 
-		if !info.IsDir() {
-			srcFile, err := os.Open(srcPath)
-			if err != nil {
-				return nil, fmt.Errorf("open file %s: %w", srcPath, err)
+	i := 0
+	for old != nil || i < len(entries) {
+		if old != nil && (i >= len(entries) || old.Name < entries[i].name) {
+			c.normalizeTarHeader(old)
+			if err := tarWriter.WriteHeader(old); err != nil {
+				return nil, fmt.Errorf("write tar header for %s: %w", old.Name, err)
 			}
-
-			if _, err := io.Copy(tarWriter, srcFile); err != nil {
-				srcFile.Close()
-				return nil, fmt.Errorf("write file %s to tar: %w", srcPath, err)
+			if _, err := io.Copy(tarWriter, tarReader); err != nil {
+				return nil, fmt.Errorf("merge existing archive: copy %s: %w", old.Name, err)
 			}
-			srcFile.Close()
+			result.MergedEntries++
+			if old, err = next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
+		size, err := c.writeTarEntry(tarWriter, entries[i], links)
+		if err != nil {
+			return nil, err
+		}
+		if size >= 0 {
 			result.FilesArchived++
-			result.TotalSize += info.Size()
+			result.TotalSize += size
 		}
+		i++
 	}
 
 	// Close writers to flush data
-	tarWriter.Close()
-	if compress {
-		writer.Close()
+	if err := tarWriter.Close(); err != nil {
+		return nil, fmt.Errorf("close tar writer: %w", err)
+	}
+	if gzWriter != nil {
+		if err := gzWriter.Close(); err != nil {
+			return nil, fmt.Errorf("close gzip writer: %w", err)
+		}
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("sync archive: %w", err)
 	}
 
 	// Get archive size
@@ -253,60 +486,142 @@ func (c *Creator) createTarArchive(archivePath string, files map[string]string,
 	return result, nil
 }
 
-// createZipArchive creates a zip archive.
-func (c *Creator) createZipArchive(archivePath string, files map[string]string) (*Result, error) {
+// writeTarEntry writes a single file to the tar archive.
+// Symlinks are stored as TypeSymlink, and further names of a hardlinked file as TypeLink
+// entries pointing to the first name, which links records.
+// It returns the size of the file's content, or -1 for directories.
+func (c *Creator) writeTarEntry(tw *tar.Writer, e entry, links map[fileKey]string) (int64, error) {
+	info, err := c.stat(e.src)
+	if err != nil {
+		return 0, fmt.Errorf("stat file %s: %w", e.src, err)
+	}
+
+	var linkTarget string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if linkTarget, err = os.Readlink(e.src); err != nil {
+			return 0, fmt.Errorf("read symlink %s: %w", e.src, err)
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, linkTarget)
+	if err != nil {
+		return 0, fmt.Errorf("create tar header for %s: %w", e.src, err)
+	}
+
+	// Use the archive path (relative path within archive)
+	header.Name = e.name
+	if info.Mode().IsRegular() {
+		if key, ok := hardlinkID(info); ok {
+			if first, seen := links[key]; seen {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				links[key] = e.name
+			}
+		}
+	}
+	if c.config.PreserveMetadata && header.Typeflag == tar.TypeReg {
+		if err := addTarMetadata(header, e.src); err != nil {
+			return 0, err
+		}
+	}
+	c.normalizeTarHeader(header)
+
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, fmt.Errorf("write tar header for %s: %w", e.src, err)
+	}
+
+	switch {
+	case info.IsDir():
+		return -1, nil
+	case header.Typeflag != tar.TypeReg:
+		return 0, nil
+	}
+
+	srcFile, err := os.Open(e.src)
+	if err != nil {
+		return 0, fmt.Errorf("open file %s: %w", e.src, err)
+	}
+	defer srcFile.Close()
+
+	if _, err := io.Copy(tw, ratelimit.NewReader(c.ctx, srcFile, c.read)); err != nil {
+		return 0, fmt.Errorf("write file %s to tar: %w", e.src, err)
+	}
+
+	return info.Size(), nil
+}
+
+// stat returns the info of an archive source, following symlinks only if configured.
+func (c *Creator) stat(path string) (os.FileInfo, error) {
+	if c.config.FollowLinks {
+		return os.Stat(path)
+	}
+	return os.Lstat(path)
+}
+
+// createZipArchive creates a zip archive with entries sorted by name.
+// If existing is set, its entries are merged in name order unless a new file replaces them.
+func (c *Creator) createZipArchive(archivePath, existing string, files map[string]string) (*Result, error) {
 	file, err := os.Create(archivePath)
 	if err != nil {
 		return nil, fmt.Errorf("create archive file: %w", err)
 	}
 	defer file.Close()
 
-	zipWriter := zip.NewWriter(file)
+	zipWriter := zip.NewWriter(ratelimit.NewWriter(c.ctx, file, c.write))
 	defer zipWriter.Close()
 
 	result := &Result{}
+	entries := sortedEntries(files)
+	replaced := archivePaths(files)
 
-	for srcPath, archPath := range files {
-		info, err := os.Stat(srcPath)
+	var old []*zip.File
+	if existing != "" {
+		reader, err := zip.OpenReader(existing)
 		if err != nil {
-			return nil, fmt.Errorf("stat file %s: %w", srcPath, err)
-		}
-
-		if info.IsDir() {
-			continue
+			return nil, fmt.Errorf("merge existing archive: %w", err)
 		}
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return nil, fmt.Errorf("create zip header for %s: %w", srcPath, err)
+		defer reader.Close()
+		for _, f := range reader.File {
+			if !replaced[filepath.ToSlash(f.Name)] {
+				old = append(old, f)
+			}
 		}
+		sort.SliceStable(old, func(i, j int) bool {
+			return old[i].Name < old[j].Name
+		})
+	}
 
-		// Use the archive path and set compression
-		header.Name = archPath
-		header.Method = zip.Deflate
-
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			return nil, fmt.Errorf("create zip entry for %s: %w", srcPath, err)
+	i, j := 0, 0
+	for j < len(old) || i < len(entries) {
+		if j < len(old) && (i >= len(entries) || old[j].Name < entries[i].name) {
+			if err := zipWriter.Copy(old[j]); err != nil {
+				return nil, fmt.Errorf("merge existing archive: copy %s: %w", old[j].Name, err)
+			}
+			result.MergedEntries++
+			j++
+			continue
 		}
 
-		srcFile, err := os.Open(srcPath)
+		size, err := c.writeZipEntry(zipWriter, entries[i])
 		if err != nil {
-			return nil, fmt.Errorf("open file %s: %w", srcPath, err)
+			return nil, err
 		}
-
-		if _, err := io.Copy(writer, srcFile); err != nil {
-			srcFile.Close()
-			return nil, fmt.Errorf("write file %s to zip: %w", srcPath, err)
+		if size >= 0 {
+			result.FilesArchived++
+			result.TotalSize += size
 		}
-		srcFile.Close()
-
-		result.FilesArchived++
-		result.TotalSize += info.Size()
+		i++
 	}
 
 	// Close zip writer to flush data
-	zipWriter.Close()
+	if err := zipWriter.Close(); err != nil {
+		return nil, fmt.Errorf("close zip writer: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("sync archive: %w", err)
+	}
 
 	// Get archive size
 	archInfo, err := os.Stat(archivePath)
@@ -318,6 +633,89 @@ func (c *Creator) createZipArchive(archivePath string, files map[string]string)
 	return result, nil
 }
 
+// writeZipEntry writes a single file to the zip archive.
+// It returns the size of the file's content, or -1 for skipped directories.
+func (c *Creator) writeZipEntry(zw *zip.Writer, e entry) (int64, error) {
+	info, err := c.stat(e.src)
+	if err != nil {
+		return 0, fmt.Errorf("stat file %s: %w", e.src, err)
+	}
+
+	if info.IsDir() {
+		return -1, nil
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return 0, fmt.Errorf("create zip header for %s: %w", e.src, err)
+	}
+
+	// Use the archive path and set compression
+	header.Name = e.name
+	header.Method = zip.Deflate
+	c.normalizeZipHeader(header)
+
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return 0, fmt.Errorf("create zip entry for %s: %w", e.src, err)
+	}
+
+	// Zip stores a symlink as an entry whose content is the link target
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(e.src)
+		if err != nil {
+			return 0, fmt.Errorf("read symlink %s: %w", e.src, err)
+		}
+		if _, err := io.WriteString(writer, target); err != nil {
+			return 0, fmt.Errorf("write symlink %s to zip: %w", e.src, err)
+		}
+		return 0, nil
+	}
+
+	srcFile, err := os.Open(e.src)
+	if err != nil {
+		return 0, fmt.Errorf("open file %s: %w", e.src, err)
+	}
+	defer srcFile.Close()
+
+	if _, err := io.Copy(writer, ratelimit.NewReader(c.ctx, srcFile, c.read)); err != nil {
+		return 0, fmt.Errorf("write file %s to zip: %w", e.src, err)
+	}
+
+	return info.Size(), nil
+}
+
+// archivePaths returns the set of archive entry names for the given files.
+func archivePaths(files map[string]string) map[string]bool {
+	names := make(map[string]bool, len(files))
+	for _, archPath := range files {
+		names[filepath.ToSlash(archPath)] = true
+	}
+	return names
+}
+
+// openTar opens a tar or tar.gz archive for reading.
+func openTar(archivePath string, compressed bool) (*tar.Reader, func(), error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !compressed {
+		return tar.NewReader(file), func() { file.Close() }, nil
+	}
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("create gzip reader: %w", err)
+	}
+	return tar.NewReader(gzReader), func() {
+		gzReader.Close()
+		file.Close()
+	}, nil
+}
+
 // ExtractArchive extracts an archive to the given directory.
 func ExtractArchive(archivePath, destDir string) error {
 	ext := strings.ToLower(filepath.Ext(archivePath))
@@ -374,6 +772,20 @@ func extractTar(archivePath, destDir string, compressed bool) error {
 			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
 				return fmt.Errorf("create directory %s: %w", target, err)
 			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return fmt.Errorf("create parent directory for %s: %w", target, err)
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return fmt.Errorf("create symlink %s: %w", target, err)
+			}
+		case tar.TypeLink:
+			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+				return fmt.Errorf("create parent directory for %s: %w", target, err)
+			}
+			if err := os.Link(filepath.Join(destDir, header.Linkname), target); err != nil {
+				return fmt.Errorf("create hardlink %s: %w", target, err)
+			}
 		case tar.TypeReg:
 			if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
 				return fmt.Errorf("create parent directory for %s: %w", target, err)
@@ -388,7 +800,13 @@ func extractTar(archivePath, destDir string, compressed bool) error {
 				outFile.Close()
 				return fmt.Errorf("write file %s: %w", target, err)
 			}
-			outFile.Close()
+			if err := outFile.Close(); err != nil {
+				return fmt.Errorf("close file %s: %w", target, err)
+			}
+
+			if err := metadata.Apply(target, tarMetadata(header)); err != nil {
+				return fmt.Errorf("restore metadata: %w", err)
+			}
 		}
 	}
 
@@ -425,6 +843,18 @@ func extractZip(archivePath, destDir string) error {
 			return fmt.Errorf("open zip entry %s: %w", file.Name, err)
 		}
 
+		if file.Mode()&os.ModeSymlink != 0 {
+			linkTarget, err := io.ReadAll(srcFile)
+			srcFile.Close()
+			if err != nil {
+				return fmt.Errorf("read zip entry %s: %w", file.Name, err)
+			}
+			if err := os.Symlink(string(linkTarget), target); err != nil {
+				return fmt.Errorf("create symlink %s: %w", target, err)
+			}
+			continue
+		}
+
 		destFile, err := os.Create(target)
 		if err != nil {
 			srcFile.Close()
@@ -438,7 +868,14 @@ func extractZip(archivePath, destDir string) error {
 		}
 
 		srcFile.Close()
-		destFile.Close()
+		if err := destFile.Close(); err != nil {
+			return fmt.Errorf("close file %s: %w", target, err)
+		}
+
+		// Zip entries carry no owner, so only the mode and modification time are restored
+		if err := metadata.Apply(target, metadata.FromFileInfo(file.FileInfo())); err != nil {
+			return fmt.Errorf("restore metadata: %w", err)
+		}
 	}
 
 	return nil
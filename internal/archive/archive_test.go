@@ -1,6 +1,12 @@
 package archive
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"filekeeper/pkg/metadata"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -59,6 +65,28 @@ func TestGenerateArchiveName(t *testing.T) {
 	}
 }
 
+func TestPeriodStart(t *testing.T) {
+	// Saturday
+	testTime := time.Date(2026, 1, 24, 15, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		groupBy  GroupBy
+		expected time.Time
+	}{
+		{GroupByDaily, time.Date(2026, 1, 24, 0, 0, 0, 0, time.UTC)},
+		{GroupByWeekly, time.Date(2026, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{GroupByMonthly, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.groupBy), func(t *testing.T) {
+			if got := PeriodStart(testTime, tt.groupBy); !got.Equal(tt.expected) {
+				t.Errorf("PeriodStart() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestConfigValidate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -95,6 +123,26 @@ func TestConfigValidate(t *testing.T) {
 			config:  &Config{Enabled: true, Format: FormatTarGz, GroupBy: "yearly"},
 			wantErr: true,
 		},
+		{
+			name:    "valid mode_mask",
+			config:  &Config{Enabled: true, Format: FormatTarGz, ModeMask: "0644"},
+			wantErr: false,
+		},
+		{
+			name:    "invalid mode_mask",
+			config:  &Config{Enabled: true, Format: FormatTarGz, ModeMask: "rw-r--r--"},
+			wantErr: true,
+		},
+		{
+			name:    "reproducible with preserved metadata",
+			config:  &Config{Enabled: true, Format: FormatTar, Reproducible: true, PreserveMetadata: true},
+			wantErr: true,
+		},
+		{
+			name:    "negative uid",
+			config:  &Config{Enabled: true, Format: FormatTar, UID: intPtr(-1)},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -411,3 +459,474 @@ func TestCompressionRatio(t *testing.T) {
 		t.Errorf("CompressionRatio() with zero = %.1f, want 100.0", result2.CompressionRatio())
 	}
 }
+
+func TestCreateArchiveMergesExisting(t *testing.T) {
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			srcDir := t.TempDir()
+			outDir := t.TempDir()
+
+			write := func(name, content string) string {
+				path := filepath.Join(srcDir, name)
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("Failed to create %s: %v", name, err)
+				}
+				return path
+			}
+			first := write("first.log", "first cycle")
+			second := write("second.log", "second cycle")
+
+			creator := NewCreator(&Config{Enabled: true, Format: format, GroupBy: GroupByDaily}, outDir)
+			archiveTime := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+
+			if _, err := creator.CreateArchive(map[string]string{first: "first.log"}, archiveTime); err != nil {
+				t.Fatalf("First CreateArchive failed: %v", err)
+			}
+
+			// A later cycle for the same day adds to the existing archive
+			result, err := creator.CreateArchive(map[string]string{second: "second.log"}, archiveTime.Add(5*time.Hour))
+			if err != nil {
+				t.Fatalf("Second CreateArchive failed: %v", err)
+			}
+			if result.FilesArchived != 1 || result.MergedEntries != 1 {
+				t.Errorf("Expected 1 new file and 1 merged entry, got %d and %d", result.FilesArchived, result.MergedEntries)
+			}
+			if result.PreviousSize == 0 {
+				t.Error("Expected PreviousSize of the existing archive to be recorded")
+			}
+
+			extractDir := t.TempDir()
+			if err := ExtractArchive(result.ArchivePath, extractDir); err != nil {
+				t.Fatalf("ExtractArchive failed: %v", err)
+			}
+			for name, want := range map[string]string{"first.log": "first cycle", "second.log": "second cycle"} {
+				got, err := os.ReadFile(filepath.Join(extractDir, name))
+				if err != nil {
+					t.Errorf("Expected %s in merged archive: %v", name, err)
+					continue
+				}
+				if string(got) != want {
+					t.Errorf("%s: expected %q, got %q", name, want, got)
+				}
+			}
+
+			// No temporary files are left behind
+			leftovers, _ := filepath.Glob(filepath.Join(outDir, "*.tmp"))
+			if len(leftovers) != 0 {
+				t.Errorf("Expected no temporary files, got %v", leftovers)
+			}
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// fileChecksum returns the sha256 of the file at path.
+func fileChecksum(t *testing.T, path string) [sha256.Size]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+	return sha256.Sum256(data)
+}
+
+func TestCreateArchiveReproducible(t *testing.T) {
+	for _, format := range []Format{FormatTar, FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			srcDir := t.TempDir()
+			modTime := time.Date(2026, 2, 3, 8, 0, 0, 0, time.UTC)
+			files := make(map[string]string)
+			for _, name := range []string{"c.log", "a.log", "sub/b.log"} {
+				path := filepath.Join(srcDir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("Failed to create directory: %v", err)
+				}
+				if err := os.WriteFile(path, []byte("content of "+name), 0640); err != nil {
+					t.Fatalf("Failed to create %s: %v", name, err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatalf("Failed to set times: %v", err)
+				}
+				files[path] = name
+			}
+
+			cfg := &Config{Enabled: true, Format: format, GroupBy: GroupByDaily, Reproducible: true}
+			archiveTime := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+
+			first, err := NewCreator(cfg, t.TempDir()).CreateArchive(files, archiveTime)
+			if err != nil {
+				t.Fatalf("First CreateArchive failed: %v", err)
+			}
+
+			// Reading the files changes their access time, which must not leak into the archive
+			for path := range files {
+				if err := os.Chtimes(path, time.Now(), modTime); err != nil {
+					t.Fatalf("Failed to set times: %v", err)
+				}
+			}
+
+			second, err := NewCreator(cfg, t.TempDir()).CreateArchive(files, archiveTime.Add(time.Hour))
+			if err != nil {
+				t.Fatalf("Second CreateArchive failed: %v", err)
+			}
+
+			if fileChecksum(t, first.ArchivePath) != fileChecksum(t, second.ArchivePath) {
+				t.Error("Expected identical archives for identical inputs")
+			}
+		})
+	}
+}
+
+func TestCreateArchiveNormalizesHeaders(t *testing.T) {
+	srcDir := t.TempDir()
+	path := filepath.Join(srcDir, "app.log")
+	if err := os.WriteFile(path, []byte("log line"), 0755); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chmod(path, 0755); err != nil {
+		t.Fatalf("Failed to chmod file: %v", err)
+	}
+
+	cfg := &Config{
+		Enabled:       true,
+		Format:        FormatTarGz,
+		GroupBy:       GroupByDaily,
+		UID:           intPtr(1000),
+		GID:           intPtr(1000),
+		Uname:         "app",
+		Gname:         "app",
+		ModeMask:      "0644",
+		ZeroGzipMtime: true,
+	}
+	result, err := NewCreator(cfg, t.TempDir()).CreateArchive(map[string]string{path: "app.log"}, time.Now())
+	if err != nil {
+		t.Fatalf("CreateArchive failed: %v", err)
+	}
+
+	file, err := os.Open(result.ArchivePath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Failed to read gzip header: %v", err)
+	}
+	defer gzReader.Close()
+	if !gzReader.ModTime.IsZero() {
+		t.Errorf("Expected zero gzip mtime, got %v", gzReader.ModTime)
+	}
+
+	header, err := tar.NewReader(gzReader).Next()
+	if err != nil && err != io.EOF {
+		t.Fatalf("Failed to read tar header: %v", err)
+	}
+	if header.Uid != 1000 || header.Gid != 1000 || header.Uname != "app" || header.Gname != "app" {
+		t.Errorf("Expected owner app 1000:1000, got %s %d:%s %d", header.Uname, header.Uid, header.Gname, header.Gid)
+	}
+	if header.Mode&0777 != 0644 {
+		t.Errorf("Expected mode 0644, got %o", header.Mode&0777)
+	}
+}
+
+func TestCreateArchivePreservesMetadata(t *testing.T) {
+	srcDir := t.TempDir()
+	path := filepath.Join(srcDir, "app.log")
+	if err := os.WriteFile(path, []byte("log line"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	want := &metadata.Metadata{
+		Mode:  0640,
+		UID:   -1,
+		GID:   -1,
+		Atime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Mtime: time.Date(2026, 1, 1, 1, 2, 3, 0, time.UTC),
+	}
+	if err := metadata.Apply(path, want); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	before, err := metadata.Read(path)
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+
+	for _, format := range []Format{FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			cfg := &Config{Enabled: true, Format: format, GroupBy: GroupByDaily, PreserveMetadata: true}
+			result, err := NewCreator(cfg, t.TempDir()).CreateArchive(map[string]string{path: "app.log"}, time.Now())
+			if err != nil {
+				t.Fatalf("CreateArchive failed: %v", err)
+			}
+
+			extractDir := t.TempDir()
+			if err := ExtractArchive(result.ArchivePath, extractDir); err != nil {
+				t.Fatalf("ExtractArchive failed: %v", err)
+			}
+
+			got, err := metadata.Read(filepath.Join(extractDir, "app.log"))
+			if err != nil {
+				t.Fatalf("Failed to read restored metadata: %v", err)
+			}
+			if got.Mode != want.Mode {
+				t.Errorf("mode: got %v, want %v", got.Mode, want.Mode)
+			}
+			if !got.Mtime.Equal(want.Mtime) {
+				t.Errorf("mtime: got %v, want %v", got.Mtime, want.Mtime)
+			}
+
+			// Zip entries carry only the mode and modification time
+			if format == FormatZip {
+				return
+			}
+			if !got.Atime.Equal(want.Atime) {
+				t.Errorf("atime: got %v, want %v", got.Atime, want.Atime)
+			}
+			if got.UID != before.UID || got.GID != before.GID {
+				t.Errorf("owner: got %d:%d, want %d:%d", got.UID, got.GID, before.UID, before.GID)
+			}
+		})
+	}
+}
+
+func TestTarMetadataXattrs(t *testing.T) {
+	header := &tar.Header{
+		Name:     "app.log",
+		Mode:     0644,
+		Typeflag: tar.TypeReg,
+		PAXRecords: map[string]string{
+			paxXattrPrefix + "user.origin": "host-a",
+			"comment":                      "not an xattr",
+		},
+	}
+
+	m := tarMetadata(header)
+	if len(m.Xattrs) != 1 || string(m.Xattrs["user.origin"]) != "host-a" {
+		t.Errorf("Expected xattr user.origin=host-a, got %v", m.Xattrs)
+	}
+}
+
+func TestCreateTarArchiveLinks(t *testing.T) {
+	srcDir := t.TempDir()
+	data := filepath.Join(srcDir, "data.log")
+	if err := os.WriteFile(data, []byte("shared content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	hardlink := filepath.Join(srcDir, "hardlink.log")
+	if err := os.Link(data, hardlink); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+	symlink := filepath.Join(srcDir, "symlink.log")
+	if err := os.Symlink("data.log", symlink); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	files := map[string]string{data: "data.log", hardlink: "hardlink.log", symlink: "symlink.log"}
+	cfg := &Config{Enabled: true, Format: FormatTar, GroupBy: GroupByDaily}
+	result, err := NewCreator(cfg, t.TempDir()).CreateArchive(files, time.Now())
+	if err != nil {
+		t.Fatalf("CreateArchive failed: %v", err)
+	}
+
+	file, err := os.Open(result.ArchivePath)
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	types := make(map[string]*tar.Header)
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Failed to read tar header: %v", err)
+		}
+		types[header.Name] = header
+	}
+
+	if h := types["data.log"]; h == nil || h.Typeflag != tar.TypeReg {
+		t.Errorf("Expected data.log as a regular file, got %+v", h)
+	}
+	if h := types["hardlink.log"]; h == nil || h.Typeflag != tar.TypeLink || h.Linkname != "data.log" {
+		t.Errorf("Expected hardlink.log as a hardlink to data.log, got %+v", h)
+	}
+	if h := types["symlink.log"]; h == nil || h.Typeflag != tar.TypeSymlink || h.Linkname != "data.log" {
+		t.Errorf("Expected symlink.log as a symlink to data.log, got %+v", h)
+	}
+
+	extractDir := t.TempDir()
+	if err := ExtractArchive(result.ArchivePath, extractDir); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(extractDir, "symlink.log")); err != nil || target != "data.log" {
+		t.Errorf("Expected restored symlink to data.log, got %q (%v)", target, err)
+	}
+	a, _ := os.Stat(filepath.Join(extractDir, "data.log"))
+	b, _ := os.Stat(filepath.Join(extractDir, "hardlink.log"))
+	if a == nil || b == nil || !os.SameFile(a, b) {
+		t.Error("Expected restored hardlink to share data.log's inode")
+	}
+}
+
+func TestCreateArchiveFollowLinks(t *testing.T) {
+	srcDir := t.TempDir()
+	data := filepath.Join(srcDir, "data.log")
+	if err := os.WriteFile(data, []byte("linked content"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	symlink := filepath.Join(srcDir, "symlink.log")
+	if err := os.Symlink(data, symlink); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	for _, format := range []Format{FormatTarGz, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			cfg := &Config{Enabled: true, Format: format, GroupBy: GroupByDaily, FollowLinks: true}
+			result, err := NewCreator(cfg, t.TempDir()).CreateArchive(map[string]string{symlink: "symlink.log"}, time.Now())
+			if err != nil {
+				t.Fatalf("CreateArchive failed: %v", err)
+			}
+
+			extractDir := t.TempDir()
+			if err := ExtractArchive(result.ArchivePath, extractDir); err != nil {
+				t.Fatalf("ExtractArchive failed: %v", err)
+			}
+			restored := filepath.Join(extractDir, "symlink.log")
+			if info, err := os.Lstat(restored); err != nil || !info.Mode().IsRegular() {
+				t.Fatalf("Expected a regular file with the link's content: %v", err)
+			}
+			if got, _ := os.ReadFile(restored); string(got) != "linked content" {
+				t.Errorf("Expected linked content, got %q", got)
+			}
+		})
+	}
+}
+
+func TestCreateZipArchiveSymlink(t *testing.T) {
+	srcDir := t.TempDir()
+	symlink := filepath.Join(srcDir, "symlink.log")
+	if err := os.Symlink("data.log", symlink); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg := &Config{Enabled: true, Format: FormatZip, GroupBy: GroupByDaily, Reproducible: true}
+	result, err := NewCreator(cfg, t.TempDir()).CreateArchive(map[string]string{symlink: "symlink.log"}, time.Now())
+	if err != nil {
+		t.Fatalf("CreateArchive failed: %v", err)
+	}
+
+	extractDir := t.TempDir()
+	if err := ExtractArchive(result.ArchivePath, extractDir); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(extractDir, "symlink.log")); err != nil || target != "data.log" {
+		t.Errorf("Expected restored symlink to data.log, got %q (%v)", target, err)
+	}
+}
+
+func TestCopyArchive(t *testing.T) {
+	srcDir := t.TempDir()
+	firstDir := t.TempDir()
+	secondDir := filepath.Join(t.TempDir(), "nested")
+
+	file := filepath.Join(srcDir, "app.log")
+	if err := os.WriteFile(file, []byte(strings.Repeat("copy me\n", 200)), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	cfg := &Config{Enabled: true, Format: FormatTarGz, GroupBy: GroupByDaily}
+	archiveTime := time.Date(2026, 1, 24, 0, 0, 0, 0, time.UTC)
+	built, err := NewCreator(cfg, firstDir).CreateArchive(map[string]string{file: "app.log"}, archiveTime)
+	if err != nil {
+		t.Fatalf("CreateArchive failed: %v", err)
+	}
+
+	copied, err := NewCreator(cfg, secondDir).CopyArchive(built)
+	if err != nil {
+		t.Fatalf("CopyArchive failed: %v", err)
+	}
+	if copied.ArchivePath != filepath.Join(secondDir, filepath.Base(built.ArchivePath)) {
+		t.Errorf("Unexpected copy path %s", copied.ArchivePath)
+	}
+	if copied.FilesArchived != built.FilesArchived || copied.ArchiveSize != built.ArchiveSize {
+		t.Errorf("Expected the statistics of the original, got %+v", copied)
+	}
+
+	want, _ := os.ReadFile(built.ArchivePath)
+	got, err := os.ReadFile(copied.ArchivePath)
+	if err != nil || string(got) != string(want) {
+		t.Fatalf("Expected an identical copy, got %d bytes, %v", len(got), err)
+	}
+	if _, err := os.Stat(copied.ArchivePath + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected no temporary file to be left behind")
+	}
+
+	// The copy and the original are in sync until one of them changes
+	first, _ := os.Stat(built.ArchivePath)
+	second, _ := os.Stat(copied.ArchivePath)
+	if !InSync(first, second) || !InSync(nil, nil) || InSync(first, nil) {
+		t.Error("Expected an archive to be in sync with its copy only")
+	}
+	later := first.ModTime().Add(time.Hour)
+	if err := os.Chtimes(copied.ArchivePath, later, later); err != nil {
+		t.Fatalf("Failed to set archive time: %v", err)
+	}
+	second, _ = os.Stat(copied.ArchivePath)
+	if InSync(first, second) {
+		t.Error("Expected archives with different times not to be in sync")
+	}
+}
+
+// BenchmarkArchiveDestinations compares building an archive in each destination with
+// building it once and copying it to the others.
+func BenchmarkArchiveDestinations(b *testing.B) {
+	const destinations = 3
+	srcDir := b.TempDir()
+	files := make(map[string]string)
+	var total int64
+	for i := 0; i < 20; i++ {
+		var content strings.Builder
+		for j := 0; content.Len() < 256<<10; j++ {
+			content.WriteString("2024-01-15T10:00:00 INFO worker " + strings.Repeat("x", j%40) + " done\n")
+		}
+		name := filepath.Join(srcDir, fmt.Sprintf("app%02d.log", i))
+		if err := os.WriteFile(name, []byte(content.String()), 0644); err != nil {
+			b.Fatalf("Failed to create file: %v", err)
+		}
+		files[name] = filepath.Base(name)
+		total += int64(content.Len())
+	}
+	cfg := &Config{Enabled: true, Format: FormatTarGz, GroupBy: GroupByDaily}
+	archiveTime := time.Date(2026, 1, 24, 0, 0, 0, 0, time.UTC)
+
+	run := func(b *testing.B, copyFirst bool) {
+		b.SetBytes(total)
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			outDir := b.TempDir()
+			b.StartTimer()
+
+			var built *Result
+			for d := 0; d < destinations; d++ {
+				creator := NewCreator(cfg, filepath.Join(outDir, fmt.Sprintf("dest%d", d)))
+				var err error
+				if copyFirst && built != nil {
+					_, err = creator.CopyArchive(built)
+				} else {
+					built, err = creator.CreateArchive(files, archiveTime)
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+	b.Run("per-destination", func(b *testing.B) { run(b, false) })
+	b.Run("copy-first", func(b *testing.B) { run(b, true) })
+}
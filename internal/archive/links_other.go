@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package archive
+
+import "os"
+
+// hardlinkID is not available on this platform; hardlinked files are stored in full.
+func hardlinkID(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -0,0 +1,94 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"filekeeper/pkg/metadata"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// paxXattrPrefix is the PAX record prefix for extended attributes used by GNU tar and star.
+const paxXattrPrefix = "SCHILY.xattr."
+
+// normalizeTarHeader applies the configured owner and mode settings to a tar header.
+// In reproducible mode it also fixes the header format to PAX and drops access and
+// change times, which differ between runs even when the content does not.
+func (c *Creator) normalizeTarHeader(h *tar.Header) {
+	cfg := c.config
+
+	if cfg.Reproducible {
+		h.Format = tar.FormatPAX
+		h.AccessTime = time.Time{}
+		h.ChangeTime = time.Time{}
+		h.Uid, h.Gid = 0, 0
+		h.Uname, h.Gname = "", ""
+		h.Mode &= 07777
+	}
+
+	if cfg.UID != nil {
+		h.Uid = *cfg.UID
+	}
+	if cfg.GID != nil {
+		h.Gid = *cfg.GID
+	}
+	if cfg.Uname != "" {
+		h.Uname = cfg.Uname
+	}
+	if cfg.Gname != "" {
+		h.Gname = cfg.Gname
+	}
+	if mask, _ := cfg.modeMask(); mask != 0 {
+		h.Mode &= int64(mask)
+	}
+}
+
+// normalizeZipHeader applies the configured mode mask to a zip header.
+// Zip headers carry no owner, and their timestamps come from the file's modification time.
+func (c *Creator) normalizeZipHeader(h *zip.FileHeader) {
+	mode := h.Mode()
+	if c.config.Reproducible {
+		mode &= os.ModeType | 0777
+	}
+	if mask, _ := c.config.modeMask(); mask != 0 {
+		mode = mode&^0777 | mode&mask&0777
+	}
+	h.SetMode(mode)
+}
+
+// addTarMetadata records the access time and extended attributes of src in a PAX header.
+func addTarMetadata(h *tar.Header, src string) error {
+	m, err := metadata.Read(src)
+	if err != nil {
+		return fmt.Errorf("read metadata of %s: %w", src, err)
+	}
+
+	h.Format = tar.FormatPAX
+	h.AccessTime = m.Atime
+	if len(m.Xattrs) > 0 && h.PAXRecords == nil {
+		h.PAXRecords = make(map[string]string, len(m.Xattrs))
+	}
+	for name, value := range m.Xattrs {
+		h.PAXRecords[paxXattrPrefix+name] = string(value)
+	}
+	return nil
+}
+
+// tarMetadata returns the metadata recorded in a tar header.
+func tarMetadata(h *tar.Header) *metadata.Metadata {
+	m := metadata.FromFileInfo(h.FileInfo())
+	m.UID = h.Uid
+	m.GID = h.Gid
+	m.Atime = h.AccessTime
+	for key, value := range h.PAXRecords {
+		if strings.HasPrefix(key, paxXattrPrefix) {
+			if m.Xattrs == nil {
+				m.Xattrs = make(map[string][]byte)
+			}
+			m.Xattrs[strings.TrimPrefix(key, paxXattrPrefix)] = []byte(value)
+		}
+	}
+	return m
+}
@@ -2,29 +2,168 @@ package backup
 
 import (
 	"context"
+	"errors"
 	"filekeeper/internal/archive"
 	"filekeeper/internal/config"
+	"filekeeper/internal/filetime"
+	"filekeeper/internal/hooks"
+	"filekeeper/internal/inuse"
+	"filekeeper/internal/outbox"
 	"filekeeper/internal/pruner"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/trash"
 	"filekeeper/pkg/compression"
+	"filekeeper/pkg/metadata"
+	"filekeeper/pkg/ratelimit"
 	"filekeeper/pkg/utils"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"sync"
+	"sort"
 	"time"
 )
 
-// RunBackup handles the backup and pruning of log files based on the PruneAfterHours configuration.
+// RunBackup handles the backup and pruning of log files based on the prune_after configuration.
 // It accepts a context for graceful shutdown support and returns a Result with success/failure counts.
 // Individual file errors are logged but processing continues unless error threshold is exceeded.
 // If opts.DryRun is true, it shows what would be done without making changes.
+// Files are selected once, oldest first, and only files that were backed up are pruned.
+// The configured hook commands run before and after the cycle, before pruning, and
+// for each backed up file and error.
 func RunBackup(ctx context.Context, cfg *config.Config, opts *RunOptions, log *slog.Logger) (*Result, error) {
 	if opts == nil {
 		opts = &RunOptions{}
 	}
+	cycleCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	run := *opts
+	run.commands = &commandHooks{
+		runner:       hooks.New(cfg.Hooks, opts.DryRun, log),
+		ctx:          cycleCtx,
+		abort:        abort,
+		targetFolder: cfg.TargetFolder,
+	}
+	run.limits = ratelimit.New(cfg.GetRateLimitConfig())
+
+	if err := run.commands.run(cycleCtx, hooks.PreCycle, nil); err != nil {
+		return NewResult(), err
+	}
+
+	result, err := runCycle(cycleCtx, cfg, &run, log)
+
+	// A hook that aborted the cycle is reported instead of the cancellation it caused
+	if cause := context.Cause(cycleCtx); cause != nil && ctx.Err() == nil && (err == nil || errors.Is(err, context.Canceled)) {
+		err = cause
+	}
+
+	// post_cycle hooks also run after an interrupted cycle, bounded by their timeout
+	postErr := run.commands.run(context.WithoutCancel(ctx), hooks.PostCycle, summaryEnv(result, err))
+	if err == nil {
+		err = postErr
+	}
+	return result, err
+}
+
+// runCycle runs one cycle for RunBackup.
+func runCycle(ctx context.Context, cfg *config.Config, opts *RunOptions, log *slog.Logger) (*Result, error) {
 	result := NewResult()
-	pruneThreshold := time.Now().Add(-time.Duration(cfg.PruneAfterHours) * time.Hour)
+	result.onError = opts.fileError
+	now := opts.now()
+	pruneThreshold := now.Add(-cfg.GetPruneAfter())
+
+	ruleSet, err := cfg.GetRuleSet()
+	if err != nil {
+		return result, err
+	}
+
+	safetyCfg := cfg.GetSafetyConfig()
+	if !opts.Force {
+		if err := safetyCfg.CheckRoot(cfg.TargetFolder); err != nil {
+			return result, err
+		}
+	}
+
+	times, err := filetime.New(cfg.GetFileTimeConfig())
+	if err != nil {
+		return result, err
+	}
+
+	// Backup destinations are never walked, in case one sits inside the target folder
+	exclude := cfg.GetBackupPaths()
+
+	// Pruned files are moved to the trash, if enabled, which is never walked itself
+	bin := trash.New(cfg.GetTrashConfig(), cfg.TargetFolder)
+	remove := opts.Remove
+	if bin != nil {
+		exclude = append(exclude, bin.Dir())
+		remove = bin.Mover(now)
+	}
+
+	policy := pruner.Policy{
+		Threshold:      pruneThreshold,
+		Rules:          ruleSet,
+		Times:          times,
+		MaxTotalBytes:  cfg.MaxTotalBytes,
+		MinFreePercent: cfg.MinFreePercent,
+		Links:          cfg.GetLinkPolicy(),
+		CopyTruncate:   cfg.CopyTruncate,
+		Exclude:        exclude,
+		Now:            now,
+	}
+	var candidates []pruner.Candidate
+	var totalFiles int
+	if opts.plan != nil {
+		// Planned files are used as planned; files changed since planning are refused
+		var planResult *pruner.Result
+		candidates, planResult = opts.plan.candidates(cfg, ruleSet, log)
+		result.mergePrune(planResult)
+		totalFiles = opts.plan.Scanned
+	} else {
+		var selectResult *pruner.Result
+		candidates, selectResult, err = pruner.Select(ctx, cfg.TargetFolder, policy, log)
+		result.mergePrune(selectResult)
+		if err != nil {
+			return result, err
+		}
+		totalFiles = len(candidates) + selectResult.Skipped
+	}
+
+	// Files still being written are left for the next cycle. The settle wait runs on the
+	// real, monotonic clock; opts.Now only dates files and is not used for waiting.
+	inUse := inuse.New(cfg.GetInUseConfig())
+	candidates, deferred, err := inUse.Filter(ctx, candidates, time.Now(), log)
+	result.InUse += deferred
+	if err != nil {
+		return result, err
+	}
+
+	// Files that resolve outside the target folder, as through a symlinked directory, are never
+	// touched, not even with --force
+	inside := candidates[:0]
+	for _, c := range candidates {
+		if err := safetyCfg.CheckPath(cfg.TargetFolder, c.Path); err != nil {
+			log.Warn("file outside the target folder refused",
+				slog.String("path", c.Path),
+				slog.String("error", err.Error()),
+			)
+			result.AddError(c.Path, "safety", err)
+			continue
+		}
+		inside = append(inside, c)
+	}
+	candidates = inside
+
+	// Abort before anything is copied, truncated or deleted if the selection is implausibly large
+	if err := safetyCfg.Check(candidates, totalFiles); err != nil {
+		if !opts.Force {
+			return result, err
+		}
+		log.Warn("safety limit overridden by --force", slog.String("limit", err.Error()))
+	}
+	if opts.recorder != nil {
+		opts.recorder.addFiles(candidates, totalFiles)
+	}
 
 	if cfg.EnableBackup {
 		backupPaths := cfg.GetBackupPaths()
@@ -37,70 +176,190 @@ func RunBackup(ctx context.Context, cfg *config.Config, opts *RunOptions, log *s
 			}
 		}
 
+		// Destinations are reported in configuration order, including those without copies
+		for _, backupPath := range backupPaths {
+			result.destination(backupPath, false)
+		}
+		for _, remote := range remoteDestinations(cfg, opts, false) {
+			result.destination(remote.Name(), true)
+		}
+
+		// Copies that failed in earlier cycles are retried before new ones are made
+		remote, err := newRemoteCopier(cfg, opts, log, result)
+		if err != nil {
+			return result, err
+		}
+		opts.remote = remote
+		defer func() {
+			if err := remote.save(); err != nil {
+				log.Error("failed to save outbox", slog.String("error", err.Error()))
+			}
+		}()
+		// Pending copies are not part of a plan; they are retried by the next regular cycle
+		if opts.plan == nil {
+			if err := remote.drain(ctx, remoteDestinations(cfg, opts, true), remoteDestinations(cfg, opts, false)); err != nil {
+				return result, err
+			}
+		}
+
+		// Snapshots left by an earlier cycle are backed up again before anything else. A file
+		// with such a snapshot is not truncated again until it is, as both share a backup.
+		if len(backupPaths) > 0 {
+			leftovers, dirs, err := leftoverSnapshots(backupPaths[0], cfg, ruleSet, log)
+			if err != nil {
+				return result, err
+			}
+			if len(leftovers) > 0 && (opts.plan != nil || opts.recorder != nil) {
+				// They are not part of a plan; the next regular cycle backs them up
+				log.Warn("copy-truncate snapshots left by an earlier cycle are pending",
+					slog.Int("snapshots", len(leftovers)),
+				)
+				result.SnapshotPending = len(leftovers)
+			} else if len(leftovers) > 0 {
+				log.Info("backing up copy-truncate snapshots left by an earlier cycle",
+					slog.Int("snapshots", len(leftovers)),
+				)
+				if !opts.DryRun {
+					for _, dir := range dirs {
+						defer removeSnapshotDir(dir, log)
+					}
+				}
+				pending := make(map[string]bool, len(leftovers))
+				for _, c := range leftovers {
+					pending[c.Path] = true
+				}
+				for _, c := range candidates {
+					if pending[c.Path] {
+						log.Info("file kept until its earlier snapshot is backed up", slog.String("path", c.Path))
+						continue
+					}
+					leftovers = append(leftovers, c)
+				}
+				candidates = leftovers
+			}
+		}
+
+		// Copy-truncate files are snapshotted and emptied first; backups read the snapshots
+		if hasTruncate(candidates) && len(backupPaths) > 0 {
+			snapshotDir := ""
+			if !opts.DryRun {
+				snapshotDir, err = os.MkdirTemp(backupPaths[0], snapshotDirPattern)
+				if err != nil {
+					return result, fmt.Errorf("create snapshot directory: %w", err)
+				}
+				defer removeSnapshotDir(snapshotDir, log)
+			}
+			candidates, err = snapshotCandidates(ctx, candidates, snapshotDir, cfg, opts, log, result)
+			if err != nil {
+				return result, err
+			}
+		}
+
 		// If archive mode is enabled, collect files and create archive
 		if archiveCfg.Enabled {
-			err := runArchiveBackup(ctx, cfg, archiveCfg, opts, log, result, pruneThreshold)
+			archived, err := runArchiveBackup(ctx, cfg, archiveCfg, opts, log, result, candidates)
 			if err != nil {
 				return result, err
 			}
+			candidates = archived
 		} else {
-			// Regular file-by-file backup
-			err := filepath.Walk(cfg.TargetFolder, func(path string, info os.FileInfo, err error) error {
+			// Regular file-by-file backup; files whose backup failed are kept for the next cycle.
+			// Without a local backup path files are streamed to the remotes instead; they are
+			// backed up once a remote copy was delivered, which is known after the flush below.
+			backedUp := make([]pruner.Candidate, 0, len(candidates))
+			remoteOnly := len(backupPaths) == 0
+			var streamed, waiting []pruner.Candidate
+			for _, c := range candidates {
 				// Check for context cancellation before processing each file
 				select {
 				case <-ctx.Done():
-					return ctx.Err()
+					return result, ctx.Err()
 				default:
 				}
 
-				// Handle access errors - log and continue
-				if err != nil {
-					log.Warn("failed to access file",
-						slog.String("path", path),
-						slog.String("error", err.Error()),
+				// Rules may exclude files from backup; they are pruned without a copy
+				if !c.Rule.BackupEnabled() {
+					log.Debug("backup disabled by rule",
+						slog.String("path", c.Path),
+						slog.String("rule", c.Rule.DisplayName()),
 					)
-					result.AddError(path, "access", err)
-					return nil // Continue walking
+					backedUp = append(backedUp, c)
+					continue
 				}
 
-				if info.IsDir() {
-					return nil
+				// Files backed up in an earlier cycle only wait for their pending remote copies
+				if opts.remote.pending(c) {
+					if remoteOnly {
+						waiting = append(waiting, c)
+					} else {
+						backedUp = append(backedUp, c)
+					}
+					continue
 				}
 
-				if !info.ModTime().Before(pruneThreshold) {
-					result.Skipped++
-					return nil
+				if remoteOnly && !opts.DryRun {
+					if err := streamToRemotes(ctx, c, cfg, opts, log, result); err != nil {
+						return result, err
+					}
+					streamed = append(streamed, c)
+					continue
 				}
 
 				// Process file that needs backup to all destinations
-				if err := backupFileToAllDestinations(ctx, path, info, cfg, opts, log, result); err != nil {
+				destination, err := backupFileToAllDestinations(ctx, c, cfg, opts, log, result)
+				if errors.Is(err, errNotPlanned) {
+					log.Info("file kept, its backup is not in the plan", slog.String("path", c.Path))
+					continue
+				}
+				if err != nil {
 					// Check if this was a context cancellation
 					if ctx.Err() != nil {
-						return ctx.Err()
+						return result, ctx.Err()
 					}
 					// Log error but continue processing
 					log.Error("backup failed",
-						slog.String("path", path),
+						slog.String("path", c.Path),
 						slog.String("error", err.Error()),
 					)
-					result.AddError(path, "backup", err)
+					result.AddError(c.Path, "backup", err)
 
 					// Check error threshold
 					if cfg.ErrorThresholdPercent > 0 && result.FailureRate() > cfg.ErrorThresholdPercent {
-						return fmt.Errorf("error threshold exceeded: %.1f%% failures (threshold: %.1f%%)",
-							result.FailureRate(), cfg.ErrorThresholdPercent)
+						return result, fmt.Errorf("%w: %.1f%% failures (threshold: %.1f%%)",
+							ErrThresholdExceeded, result.FailureRate(), cfg.ErrorThresholdPercent)
 					}
-					return nil // Continue walking
+					continue
 				}
 
-				result.AddSuccess(info.Size())
+				result.AddSuccess(c.Info.Size())
 				result.BackedUp++
-				return nil
-			})
+				opts.backedUp(c, destination)
+				backedUp = append(backedUp, c)
+			}
 
-			if err != nil {
+			// Batched remote copies are sent before files whose copies failed are held back
+			if err := opts.remote.flush(ctx); err != nil {
 				return result, err
 			}
+			for _, c := range streamed {
+				destination := opts.remote.deliveredTo(c.Path)
+				if destination == "" {
+					log.Warn("file kept, no remote copy was delivered", slog.String("path", c.Path))
+					continue
+				}
+				result.AddSuccess(c.Info.Size())
+				result.BackedUp++
+				opts.backedUp(c, destination)
+				backedUp = append(backedUp, c)
+			}
+			for _, c := range waiting {
+				if opts.remote.deliveredTo(c.Path) == "" {
+					log.Info("file kept until a remote copy is delivered", slog.String("path", c.Path))
+					continue
+				}
+				backedUp = append(backedUp, c)
+			}
+			candidates = opts.remote.deliverable(backedUp)
 		}
 	}
 
@@ -111,210 +370,424 @@ func RunBackup(ctx context.Context, cfg *config.Config, opts *RunOptions, log *s
 	default:
 	}
 
+	// Files written to during backup would lose the new data, so check again before deleting
+	candidates, deferred, err = inUse.Filter(ctx, candidates, time.Time{}, log)
+	result.InUse += deferred
+	if err != nil {
+		return result, err
+	}
+
+	trashDir := ""
+	if bin != nil {
+		trashDir = bin.Dir()
+	}
+	if opts.recorder != nil {
+		opts.recorder.addPrunes(candidates, trashDir)
+	}
+
+	// When a plan is applied, only its prunes are made; truncations were checked before the snapshot
+	if opts.plan != nil {
+		planned := candidates[:0]
+		for _, c := range candidates {
+			if (c.Truncate && c.Source != "") || opts.allowed(pruneAction(c, trashDir), result, log) {
+				planned = append(planned, c)
+			}
+		}
+		candidates = planned
+	}
+
+	if err := opts.commands.prePrune(result, candidates); err != nil {
+		return result, err
+	}
+
 	// Call function to prune old files
-	pruneResult, err := pruner.PruneFiles(ctx, cfg.TargetFolder, pruneThreshold, cfg.ErrorThresholdPercent, opts.DryRun, log)
+	pruneResult, err := pruner.PruneCandidates(ctx, candidates, remove, opts.pruned, cfg.ErrorThresholdPercent, opts.DryRun, log)
 	if pruneResult != nil {
 		result.Pruned = pruneResult.Pruned
-		result.Failed += pruneResult.Failed
-		// Convert pruner errors to backup errors
-		for _, e := range pruneResult.Errors {
-			result.Errors = append(result.Errors, FileError{
-				Path:      e.Path,
-				Operation: e.Operation,
-				Err:       e.Err,
-			})
-		}
+		result.mergePrune(pruneResult)
 	}
 	if err != nil {
 		return result, err
 	}
 
-	return result, nil
-}
-
-// runArchiveBackup collects files and creates archives for each backup destination.
-func runArchiveBackup(ctx context.Context, cfg *config.Config, archiveCfg *archive.Config, opts *RunOptions, log *slog.Logger, result *Result, pruneThreshold time.Time) error {
-	backupPaths := cfg.GetBackupPaths()
-	remoteBackups := cfg.GetRemoteBackups()
-
-	// Collect files that need to be archived
-	filesToArchive := make(map[string]string) // source path -> relative path in archive
-	var totalSize int64
-
-	err := filepath.Walk(cfg.TargetFolder, func(path string, info os.FileInfo, err error) error {
-		// Check for context cancellation
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	// A plan covers its files only; empty directories and the trash are left for the next cycle
+	if opts.plan != nil {
+		return result, nil
+	}
 
-		// Handle access errors
+	// Remove directories left empty by pruning
+	if dirPolicy := cfg.GetDirPolicy(); dirPolicy != nil {
+		dirPolicy.Exclude = exclude
+		dirPolicy.Now = now
+		dirsResult, err := pruner.RemoveEmptyDirs(ctx, cfg.TargetFolder, *dirPolicy, opts.DryRun, log)
+		result.mergePrune(dirsResult)
 		if err != nil {
-			log.Warn("failed to access file",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-			)
-			result.AddError(path, "access", err)
-			return nil
+			return result, err
 		}
+	}
 
-		if info.IsDir() {
-			return nil
-		}
+	// Purge trash batches whose grace period has passed
+	purged, err := bin.Purge(ctx, now, opts.DryRun, log)
+	result.TrashPurged += purged
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
 
-		if !info.ModTime().Before(pruneThreshold) {
-			result.Skipped++
-			return nil
+// archiveBucket holds the files that belong to one archive period.
+type archiveBucket struct {
+	name        string
+	time        time.Time
+	files       map[string]string // source path -> relative path in archive
+	members     []pruner.Candidate
+	totalSize   int64
+	archivePath string // First archive written in this cycle
+}
+
+// runArchiveBackup groups the selected files by their own timestamp into daily, weekly or
+// monthly archives; each archive is created once and copied to every backup destination.
+// It returns the candidates that may be pruned: files of archives that were written to at
+// least one destination, plus files excluded from backup by a rule.
+func runArchiveBackup(ctx context.Context, cfg *config.Config, archiveCfg *archive.Config, opts *RunOptions, log *slog.Logger, result *Result, candidates []pruner.Candidate) ([]pruner.Candidate, error) {
+	backupPaths := cfg.GetBackupPaths()
+	remotes := remoteDestinations(cfg, opts, false)
+
+	// Bucket files by the archive period they belong to
+	var archived []pruner.Candidate
+	buckets := make(map[string]*archiveBucket)
+	for _, c := range candidates {
+		// Files excluded from backup by a rule are not archived but may still be pruned
+		if !c.Rule.BackupEnabled() {
+			archived = append(archived, c)
+			continue
 		}
 
 		// Calculate relative path for the archive
-		relPath, err := filepath.Rel(cfg.TargetFolder, path)
+		relPath, err := filepath.Rel(cfg.TargetFolder, c.Path)
 		if err != nil {
-			result.AddError(path, "path", err)
-			return nil
+			result.AddError(c.Path, "path", err)
+			continue
 		}
 
-		filesToArchive[path] = relPath
-		totalSize += info.Size()
-		return nil
-	})
-
-	if err != nil {
-		return err
+		name := archive.GenerateArchiveName(c.Time, archiveCfg.GroupBy, archiveCfg.Format)
+		b, ok := buckets[name]
+		if !ok {
+			b = &archiveBucket{name: name, time: c.Time, files: make(map[string]string)}
+			buckets[name] = b
+		}
+		b.files[c.ContentPath()] = relPath
+		b.members = append(b.members, c)
+		b.totalSize += opts.size(c)
 	}
 
-	if len(filesToArchive) == 0 {
+	if len(buckets) == 0 {
 		log.Info("no files to archive")
-		return nil
+		return archived, nil
 	}
 
-	archiveTime := time.Now()
+	names := make([]string, 0, len(buckets))
+	for name := range buckets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
 
 	// In dry-run mode, just log what would happen
 	if opts.DryRun {
-		archiveName := archive.GenerateArchiveName(archiveTime, archiveCfg.GroupBy, archiveCfg.Format)
+		for _, name := range names {
+			b := buckets[name]
+			for _, backupPath := range backupPaths {
+				archivePath := filepath.Join(backupPath, name)
+				_, statErr := os.Stat(archivePath)
+				log.Info("[DRY-RUN] would create archive",
+					slog.String("archive", archivePath),
+					slog.Int("files_count", len(b.files)),
+					slog.Int64("total_size_bytes", b.totalSize),
+					slog.String("format", string(archiveCfg.Format)),
+					slog.String("group_by", string(archiveCfg.GroupBy)),
+					slog.Bool("merge_existing", statErr == nil),
+				)
+				opts.record(archiveAction(b, backupPath, statErr == nil))
+			}
+			for _, remote := range remotes {
+				log.Info("[DRY-RUN] would copy archive to remote",
+					slog.String("archive", name),
+					slog.String("remote", remote.Name()),
+				)
+				opts.record(archiveRemoteAction(b, backupPaths, remote))
+			}
+			archived = append(archived, b.members...)
+		}
+		return archived, nil
+	}
+
+	succeeded, attempted := 0, 0
+	for _, name := range names {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		b := buckets[name]
+
+		// Create the archive once and copy it to the other backup destinations. A destination
+		// whose archive of the period differs from the first one gets its own, merged archive.
+		var archivePaths []string
+		var archiveSizes []int64
+		var built *archive.Result
+		var builtBefore os.FileInfo
+		planned := 0
 		for _, backupPath := range backupPaths {
-			archivePath := filepath.Join(backupPath, archiveName)
-			log.Info("[DRY-RUN] would create archive",
-				slog.String("archive", archivePath),
-				slog.Int("files_count", len(filesToArchive)),
-				slog.Int64("total_size_bytes", totalSize),
+			startTime := time.Now()
+			creator := archive.NewCreator(archiveCfg, backupPath).
+				WithLimits(ctx, opts.limits.ReadLimiter(), opts.limits.WriteLimiter())
+
+			// When a plan is applied, only its archives are written
+			before := archiveState(filepath.Join(backupPath, name))
+			if !opts.allowed(archiveAction(b, backupPath, before != nil), result, log) {
+				continue
+			}
+			planned++
+			var archiveResult *archive.Result
+			var err error
+			copied := built != nil && archive.InSync(builtBefore, before)
+			if copied {
+				archiveResult, err = creator.CopyArchive(built)
+			} else {
+				archiveResult, err = creator.CreateArchive(b.files, b.time)
+				if err == nil && built == nil {
+					built, builtBefore = archiveResult, before
+				}
+			}
+			if err != nil {
+				log.Error("failed to create archive",
+					slog.String("backup_path", backupPath),
+					slog.String("archive", name),
+					slog.String("error", err.Error()),
+				)
+				result.AddError(filepath.Join(backupPath, name), "archive", err)
+				result.addCopy(backupPath, false, false, 0)
+				continue
+			}
+
+			archivePaths = append(archivePaths, archiveResult.ArchivePath)
+			archiveSizes = append(archiveSizes, archiveResult.ArchiveSize)
+			result.addCopy(backupPath, false, true, archiveResult.ArchiveSize)
+
+			log.Info("created archive",
+				slog.String("archive", archiveResult.ArchivePath),
+				slog.Int("files_archived", archiveResult.FilesArchived),
+				slog.Int("merged_entries", archiveResult.MergedEntries),
+				slog.Int64("total_size_bytes", archiveResult.TotalSize),
+				slog.Int64("archive_size_bytes", archiveResult.ArchiveSize),
+				slog.Float64("compression_ratio", archiveResult.CompressionRatio()),
 				slog.String("format", string(archiveCfg.Format)),
-				slog.String("group_by", string(archiveCfg.GroupBy)),
+				slog.Bool("copied", copied),
+				slog.Duration("duration", time.Since(startTime)),
 			)
+
+			// Track archive statistics
+			result.addArchive(archiveResult)
 		}
-		for _, remote := range remoteBackups {
-			log.Info("[DRY-RUN] would copy archive to remote",
-				slog.String("remote", remote),
+
+		if planned == 0 {
+			log.Info("archive not in the plan, files kept",
+				slog.String("archive", name),
+				slog.Int("files_count", len(b.files)),
 			)
+			continue
 		}
-		return nil
-	}
+		attempted++
 
-	// Create archive for each backup destination
-	var archivePaths []string
-	for _, backupPath := range backupPaths {
-		startTime := time.Now()
-		creator := archive.NewCreator(archiveCfg, backupPath)
-
-		archiveResult, err := creator.CreateArchive(filesToArchive, archiveTime)
-		if err != nil {
-			log.Error("failed to create archive",
-				slog.String("backup_path", backupPath),
-				slog.String("error", err.Error()),
+		// Files of an archive that failed everywhere are kept for the next cycle
+		if len(archivePaths) == 0 {
+			log.Warn("archive failed for all destinations, files kept",
+				slog.String("archive", name),
+				slog.Int("files_count", len(b.files)),
 			)
-			result.AddError(backupPath, "archive", err)
 			continue
 		}
+		succeeded++
 
-		archivePaths = append(archivePaths, archiveResult.ArchivePath)
+		// Copy archive to remote destinations
+		sourcePath := archivePaths[0]
+		entry := outbox.Entry{Path: sourcePath, Source: sourcePath, RelPath: name, Archive: true}
+		for _, remote := range remotes {
+			if !opts.allowed(archiveRemoteAction(b, backupPaths, remote), result, log) {
+				continue
+			}
+			if err := opts.remote.copy(ctx, remote, entry, archiveSizes[0]); err != nil && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
 
-		log.Info("created archive",
-			slog.String("archive", archiveResult.ArchivePath),
-			slog.Int("files_archived", archiveResult.FilesArchived),
-			slog.Int64("total_size_bytes", archiveResult.TotalSize),
-			slog.Int64("archive_size_bytes", archiveResult.ArchiveSize),
-			slog.Float64("compression_ratio", archiveResult.CompressionRatio()),
-			slog.String("format", string(archiveCfg.Format)),
-			slog.Duration("duration", time.Since(startTime)),
-		)
+		// Mark all files in the archive as backed up
+		for _, c := range b.members {
+			result.AddSuccess(c.Info.Size())
+			result.BackedUp++
+			opts.backedUp(c, archivePaths[0])
+		}
 
-		// Track archive statistics
-		result.ArchiveSize = archiveResult.ArchiveSize
-		result.OriginalBytes += archiveResult.TotalSize
-		result.CompressedBytes += archiveResult.ArchiveSize
+		b.archivePath = sourcePath
 	}
 
 	// If no archives were created, return error
-	if len(archivePaths) == 0 && len(backupPaths) > 0 {
-		return fmt.Errorf("all archive creations failed")
+	if succeeded == 0 && attempted > 0 {
+		return nil, ErrAllArchivesFailed
 	}
 
-	// Copy archive to remote destinations
-	if len(remoteBackups) > 0 && len(archivePaths) > 0 {
-		sourcePath := archivePaths[0]
+	// Files stay until their archive reached every required remote; they are archived again next cycle
+	if err := opts.remote.flush(ctx); err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		b := buckets[name]
+		if b.archivePath == "" {
+			continue
+		}
+		if opts.remote.blocked(b.archivePath) {
+			log.Info("archive files kept until its remote copies are delivered",
+				slog.String("archive", name),
+				slog.Int("files_count", len(b.members)),
+			)
+			continue
+		}
+		archived = append(archived, b.members...)
+	}
 
-		for _, remote := range remoteBackups {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+	return archived, nil
+}
 
-			remoteStart := time.Now()
-			if err := utils.ExecuteRemoteCopy(sourcePath, remote); err != nil {
-				log.Warn("remote archive backup failed",
-					slog.String("source", sourcePath),
-					slog.String("remote", remote),
-					slog.String("error", err.Error()),
-				)
-				continue
-			}
+// archiveAction returns the action of writing the archive of b to backupPath.
+func archiveAction(b *archiveBucket, backupPath string, merge bool) Action {
+	return Action{
+		Type:        ActionArchive,
+		Path:        filepath.Join(backupPath, b.name),
+		Destination: backupPath,
+		Files:       memberPaths(b.members),
+		Size:        b.totalSize,
+		Merge:       merge,
+	}
+}
 
-			log.Info("copied archive to remote",
-				slog.String("source", sourcePath),
-				slog.String("remote", remote),
-				slog.Duration("duration", time.Since(remoteStart)),
-			)
-			result.RemoteCopied++
-		}
+// archiveRemoteAction returns the action of copying the archive of b to remote,
+// from the first backup path.
+func archiveRemoteAction(b *archiveBucket, backupPaths []string, remote Destination) Action {
+	source := b.name
+	if len(backupPaths) > 0 {
+		source = filepath.Join(backupPaths[0], b.name)
 	}
+	return Action{Type: ActionRemoteCopy, Path: source, Destination: remote.Name(), Size: b.totalSize}
+}
 
-	// Mark all files in the archive as backed up
-	result.BackedUp = len(filesToArchive)
-	for _, size := range getFileSizes(filesToArchive) {
-		result.AddSuccess(size)
+// archiveState returns the file info of an existing archive, or nil if there is none.
+func archiveState(path string) os.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
 	}
+	return info
+}
 
-	return nil
+// compressionFor returns the compression settings for a file, applying the rule's override if any.
+func compressionFor(cfg *config.Config, rule *rules.Rule) *compression.Config {
+	compressionCfg := cfg.GetCompressionConfig()
+	if rule == nil || rule.Compress == nil || *rule.Compress == compressionCfg.Enabled {
+		return compressionCfg
+	}
+	if !*rule.Compress {
+		return &compression.Config{Enabled: false}
+	}
+	defaults := compression.DefaultConfig()
+	return &compression.Config{
+		Enabled:   true,
+		Algorithm: compression.Gzip,
+		Level:     defaults.Level,
+	}
+}
+
+// backupAction returns the action of backing up c to finalPath.
+func backupAction(c pruner.Candidate, finalPath string, compressionCfg *compression.Config, opts *RunOptions) Action {
+	return Action{
+		Type:        ActionBackup,
+		Path:        c.Path,
+		Destination: finalPath,
+		Size:        opts.size(c),
+		Rule:        c.Rule.DisplayName(),
+		Compressed:  compressionCfg.Enabled,
+	}
+}
+
+// remoteCopyAction returns the action of copying c to remote.
+func remoteCopyAction(c pruner.Candidate, remote Destination, opts *RunOptions) Action {
+	return Action{Type: ActionRemoteCopy, Path: c.Path, Destination: remote.Name(), Size: opts.size(c), Rule: c.Rule.DisplayName()}
 }
 
-// getFileSizes returns a slice of file sizes for the given file paths.
-func getFileSizes(files map[string]string) []int64 {
-	sizes := make([]int64, 0, len(files))
-	for srcPath := range files {
-		info, err := os.Stat(srcPath)
-		if err == nil {
-			sizes = append(sizes, info.Size())
+// plannedRemotes returns the remotes that c may be copied to by the plan being applied.
+func plannedRemotes(c pruner.Candidate, remotes []Destination, opts *RunOptions, log *slog.Logger, result *Result) []Destination {
+	planned := make([]Destination, 0, len(remotes))
+	for _, remote := range remotes {
+		if opts.allowed(remoteCopyAction(c, remote, opts), result, log) {
+			planned = append(planned, remote)
 		}
 	}
-	return sizes
+	return planned
+}
+
+// streamToRemotes queues a copy of c to each remote destination, read from the file
+// itself and compressed while it is sent, for configurations without a backup path.
+// It only fails if ctx is done; failed copies are recorded by the copier.
+func streamToRemotes(ctx context.Context, c pruner.Candidate, cfg *config.Config, opts *RunOptions, log *slog.Logger, result *Result) error {
+	relPath, err := filepath.Rel(cfg.TargetFolder, c.Path)
+	if err != nil {
+		relPath = filepath.Base(c.Path)
+	}
+	entry := outbox.Entry{
+		Path:     c.Path,
+		Size:     c.Info.Size(),
+		ModTime:  c.Info.ModTime(),
+		Source:   c.ContentPath(),
+		RelPath:  relPath,
+		Streamed: true,
+	}
+	if compressionCfg := compressionFor(cfg, c.Rule); compressionCfg.Enabled {
+		entry.Compression = compressionCfg
+		entry.RelPath = compression.GetDestinationPath(relPath, compressionCfg)
+	}
+	remotes := remoteDestinations(cfg, opts, true)
+	if opts.plan != nil {
+		remotes = plannedRemotes(c, remotes, opts, log, result)
+	}
+	for _, remote := range remotes {
+		if err := opts.remote.copy(ctx, remote, entry, c.Info.Size()); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
 }
 
 // backupFileToAllDestinations handles backing up a single file to all configured destinations.
-// Local backups are performed in parallel, remote backups are performed sequentially.
-// If compression is enabled, files are compressed during backup.
-func backupFileToAllDestinations(ctx context.Context, path string, info os.FileInfo, cfg *config.Config, opts *RunOptions, log *slog.Logger, result *Result) error {
+// The file is read and compressed once for all local backups; remote copies are made
+// from the first local backup, one destination after the other.
+// It returns the path of the first local copy, which is empty in dry-run mode.
+func backupFileToAllDestinations(ctx context.Context, c pruner.Candidate, cfg *config.Config, opts *RunOptions, log *slog.Logger, result *Result) (string, error) {
+	path, info := c.Path, c.Info
+
 	// Calculate relative path to preserve directory structure
 	relPath, err := filepath.Rel(cfg.TargetFolder, path)
 	if err != nil {
-		return fmt.Errorf("calculate relative path: %w", err)
+		return "", fmt.Errorf("calculate relative path: %w", err)
 	}
 
 	backupPaths := cfg.GetBackupPaths()
-	remoteBackups := cfg.GetRemoteBackups()
-	compressionCfg := cfg.GetCompressionConfig()
+	remotes := remoteDestinations(cfg, opts, true)
+	compressionCfg := compressionFor(cfg, c.Rule)
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+	if isSymlink {
+		compressionCfg = &compression.Config{Enabled: false}
+	}
 
 	// In dry-run mode, just log what would happen
 	if opts.DryRun {
@@ -324,53 +797,106 @@ func backupFileToAllDestinations(ctx context.Context, path string, info os.FileI
 			log.Info("[DRY-RUN] would backup file",
 				slog.String("source", path),
 				slog.String("destination", finalPath),
+				slog.String("rule", c.Rule.DisplayName()),
 				slog.Int64("size_bytes", info.Size()),
 				slog.Bool("compressed", compressionCfg.Enabled),
 			)
+			opts.record(backupAction(c, finalPath, compressionCfg, opts))
 		}
-		for _, remote := range remoteBackups {
+		for _, remote := range remotes {
+			if isSymlink {
+				continue
+			}
 			log.Info("[DRY-RUN] would copy to remote",
 				slog.String("source", path),
-				slog.String("remote", remote),
+				slog.String("remote", remote.Name()),
 			)
+			opts.record(remoteCopyAction(c, remote, opts))
+		}
+		return "", nil
+	}
+
+	// When a plan is applied, only its backups and remote copies are made
+	if opts.plan != nil {
+		var planned []string
+		for _, backupPath := range backupPaths {
+			finalPath := compression.GetDestinationPath(filepath.Join(backupPath, relPath), compressionCfg)
+			if opts.allowed(backupAction(c, finalPath, compressionCfg, opts), result, log) {
+				planned = append(planned, backupPath)
+			}
+		}
+		if len(backupPaths) > 0 && len(planned) == 0 {
+			return "", errNotPlanned
+		}
+		backupPaths = planned
+		if !isSymlink {
+			remotes = plannedRemotes(c, remotes, opts, log, result)
 		}
-		return nil
 	}
 
-	// Backup to all local destinations in parallel
-	var wg sync.WaitGroup
-	errChan := make(chan error, len(backupPaths))
+	// Back up to all local destinations. The file is read and compressed once and
+	// written to every destination; a destination that fails does not stop the others.
+	type backupError struct {
+		backupPath string
+		err        error
+	}
 	type backupResult struct {
+		backupPath     string
 		destPath       string
 		compressResult *compression.Result
 	}
-	successChan := make(chan backupResult, len(backupPaths))
-
-	for _, backupPath := range backupPaths {
-		wg.Add(1)
-		go func(bp string) {
-			defer wg.Done()
+	var errs []backupError
+	var successes []backupResult
+
+	startTime := time.Now()
+	var targets, destPaths []string
+	for _, bp := range backupPaths {
+		destPath := filepath.Join(bp, relPath)
+
+		// Create parent directories if they don't exist
+		destDir := filepath.Dir(destPath)
+		if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
+			errs = append(errs, backupError{bp, fmt.Errorf("create backup directory %s: %w", destDir, err)})
+			continue
+		}
 
-			destPath := filepath.Join(bp, relPath)
+		// Preserved symlinks are recreated as links, never compressed or followed
+		if isSymlink {
+			if err := utils.CopySymlink(path, destPath); err != nil {
+				errs = append(errs, backupError{bp, fmt.Errorf("backup to %s: %w", bp, err)})
+				continue
+			}
+			log.Info("backed up symlink",
+				slog.String("source", path),
+				slog.String("destination", destPath),
+				slog.Duration("duration", time.Since(startTime)),
+			)
+			successes = append(successes, backupResult{backupPath: bp, destPath: destPath})
+			continue
+		}
+		targets = append(targets, bp)
+		destPaths = append(destPaths, destPath)
+	}
 
-			// Create parent directories if they don't exist
-			destDir := filepath.Dir(destPath)
-			if err := os.MkdirAll(destDir, os.ModePerm); err != nil {
-				errChan <- fmt.Errorf("create backup directory %s: %w", destDir, err)
-				return
+	if len(targets) > 0 {
+		// Use compression if enabled, otherwise do regular copy
+		compResult, compErrs := compression.CompressFiles(ctx, c.ContentPath(), destPaths, compressionCfg,
+			opts.limits.ReadLimiter(), opts.limits.WriteLimiter())
+		for i, bp := range targets {
+			if compErrs[i] != nil {
+				errs = append(errs, backupError{bp, fmt.Errorf("backup to %s: %w", bp, compErrs[i])})
+				continue
 			}
 
-			startTime := time.Now()
+			finalPath := compression.GetDestinationPath(destPaths[i], compressionCfg)
 
-			// Use compression if enabled, otherwise do regular copy
-			compResult, err := compression.CompressFile(path, destPath, compressionCfg)
-			if err != nil {
-				errChan <- fmt.Errorf("backup to %s: %w", bp, err)
-				return
+			if cfg.PreserveMetadata {
+				if err := metadata.Copy(c.ContentPath(), finalPath); err != nil {
+					errs = append(errs, backupError{bp, fmt.Errorf("backup to %s: %w", bp, err)})
+					continue
+				}
 			}
 
-			finalPath := compression.GetDestinationPath(destPath, compressionCfg)
-
 			// Log with compression info if enabled
 			if compressionCfg.Enabled && compResult.Algorithm != compression.None {
 				log.Info("backed up file (compressed)",
@@ -390,25 +916,24 @@ func backupFileToAllDestinations(ctx context.Context, path string, info os.FileI
 					slog.Duration("duration", time.Since(startTime)),
 				)
 			}
-			successChan <- backupResult{destPath: finalPath, compressResult: compResult}
-		}(backupPath)
+			successes = append(successes, backupResult{backupPath: bp, destPath: finalPath, compressResult: compResult})
+		}
 	}
 
-	// Wait for all local backups to complete
-	wg.Wait()
-	close(errChan)
-	close(successChan)
-
 	// Collect errors from local backups
 	var localErrors []error
-	for err := range errChan {
-		localErrors = append(localErrors, err)
+	for _, be := range errs {
+		localErrors = append(localErrors, be.err)
+		result.addCopy(be.backupPath, false, false, 0)
 	}
 
 	// Collect successful local backup results (for remote copy and compression stats)
-	var successfulResults []backupResult
-	for br := range successChan {
-		successfulResults = append(successfulResults, br)
+	for _, br := range successes {
+		written := int64(0)
+		if br.compressResult != nil {
+			written = br.compressResult.CompressedSize
+		}
+		result.addCopy(br.backupPath, false, true, written)
 
 		// Track compression statistics
 		if br.compressResult != nil && compressionCfg.Enabled {
@@ -418,11 +943,15 @@ func backupFileToAllDestinations(ctx context.Context, path string, info os.FileI
 	}
 
 	// If all local backups failed, return error
-	if len(successfulResults) == 0 && len(backupPaths) > 0 {
+	if len(successes) == 0 && len(backupPaths) > 0 {
 		if len(localErrors) > 0 {
-			return fmt.Errorf("all local backups failed: %v", localErrors[0])
+			return "", fmt.Errorf("all local backups failed: %v", localErrors[0])
 		}
-		return fmt.Errorf("all local backups failed")
+		return "", fmt.Errorf("all local backups failed")
+	}
+	destination := ""
+	if len(successes) > 0 {
+		destination = successes[0].destPath
 	}
 
 	// Log warnings for any failed local backups (but continue since at least one succeeded)
@@ -433,38 +962,33 @@ func backupFileToAllDestinations(ctx context.Context, path string, info os.FileI
 		)
 	}
 
+	// scp copies the target of a link, so preserved symlinks stay local
+	if isSymlink && len(remotes) > 0 {
+		log.Debug("symlink not copied to remote", slog.String("path", path))
+		return destination, nil
+	}
+
 	// Backup to remote destinations sequentially (to avoid bandwidth saturation)
 	// Use the first successful local backup path as the source
-	if len(remoteBackups) > 0 && len(successfulResults) > 0 {
-		sourcePath := successfulResults[0].destPath
-
-		for _, remote := range remoteBackups {
-			// Check for cancellation before each remote copy
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+	if len(remotes) > 0 && len(successes) > 0 {
+		sourcePath := successes[0].destPath
+		sourceRel, err := filepath.Rel(successes[0].backupPath, sourcePath)
+		if err != nil {
+			sourceRel = filepath.Base(sourcePath)
+		}
+		sourceSize := info.Size()
+		if cr := successes[0].compressResult; cr != nil {
+			sourceSize = cr.CompressedSize
+		}
 
-			remoteStart := time.Now()
-			if err := utils.ExecuteRemoteCopy(sourcePath, remote); err != nil {
-				// Log warning but continue with other remote destinations
-				log.Warn("remote backup failed",
-					slog.String("source", sourcePath),
-					slog.String("remote", remote),
-					slog.String("error", err.Error()),
-				)
-				continue
+		entry := outbox.Entry{Path: path, Size: info.Size(), ModTime: info.ModTime(), Source: sourcePath, RelPath: sourceRel}
+		for _, remote := range remotes {
+			// Failed copies are recorded by the copier; the other remote destinations are still tried
+			if err := opts.remote.copy(ctx, remote, entry, sourceSize); err != nil && ctx.Err() != nil {
+				return destination, ctx.Err()
 			}
-
-			log.Info("copied to remote backup",
-				slog.String("source", sourcePath),
-				slog.String("remote", remote),
-				slog.Duration("duration", time.Since(remoteStart)),
-			)
-			result.RemoteCopied++
 		}
 	}
 
-	return nil
+	return destination, nil
 }
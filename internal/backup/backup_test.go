@@ -1,13 +1,28 @@
 package backup
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/archive"
 	"filekeeper/internal/config"
+	"filekeeper/internal/duration"
+	"filekeeper/internal/hooks"
+	"filekeeper/internal/inuse"
 	"filekeeper/internal/logger"
+	"filekeeper/internal/outbox"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/safety"
+	"filekeeper/internal/trash"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -729,7 +744,7 @@ func TestRunBackupArchiveMode(t *testing.T) {
 	cfg := &config.Config{
 		PruneAfterHours: 24,
 		TargetFolder:    logDir,
-		RunInterval:     60,
+		RunInterval:     duration.Duration(time.Minute),
 		BackupPath:      backupDir,
 		EnableBackup:    true,
 		Archive: &config.ArchiveConfig{
@@ -771,6 +786,71 @@ func TestRunBackupArchiveMode(t *testing.T) {
 		result.BackedUp, result.OriginalBytes, result.ArchiveSize, result.CompressionRatio())
 }
 
+func TestRunBackupArchiveMultipleDestinations(t *testing.T) {
+	logDir := t.TempDir()
+	backupDirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	writeLog := func(name string) {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte(strings.Repeat(name+"\n", 100)), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set file time: %v", err)
+		}
+	}
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     backupDirs,
+		EnableBackup:    true,
+		Archive:         &config.ArchiveConfig{Enabled: true, Format: "tar.gz", GroupBy: "daily"},
+	}
+	archives := func() []string {
+		var data []string
+		for _, dir := range backupDirs {
+			matches, _ := filepath.Glob(filepath.Join(dir, "backup-*.tar.gz"))
+			if len(matches) != 1 {
+				t.Fatalf("Expected 1 archive in %s, got %d", dir, len(matches))
+			}
+			content, err := os.ReadFile(matches[0])
+			if err != nil {
+				t.Fatalf("Failed to read archive: %v", err)
+			}
+			data = append(data, string(content))
+		}
+		return data
+	}
+
+	// The archive is built once and copied to the other destinations
+	writeLog("first.log")
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil || result.BackedUp != 1 || len(result.Archives) != 3 {
+		t.Fatalf("Expected 1 file in 3 archives, got %+v, %v", result, err)
+	}
+	data := archives()
+	if data[1] != data[0] || data[2] != data[0] {
+		t.Fatal("Expected identical archives in every destination")
+	}
+
+	// A destination whose archive differs gets its own; the others stay copies
+	matches, _ := filepath.Glob(filepath.Join(backupDirs[2], "backup-*.tar.gz"))
+	if err := os.Remove(matches[0]); err != nil {
+		t.Fatalf("Failed to remove archive: %v", err)
+	}
+	writeLog("second.log")
+	if _, err := RunBackup(context.Background(), cfg, nil, testLogger()); err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	data = archives()
+	if data[1] != data[0] {
+		t.Error("Expected the merged archive to be copied to the second destination")
+	}
+	if data[2] == data[0] {
+		t.Error("Expected the third destination to get an archive of the new file only")
+	}
+}
+
 func TestRunBackupArchiveModeDryRun(t *testing.T) {
 	// Create temp directories
 	logDir, err := os.MkdirTemp("", "logdir")
@@ -800,7 +880,7 @@ func TestRunBackupArchiveModeDryRun(t *testing.T) {
 	cfg := &config.Config{
 		PruneAfterHours: 24,
 		TargetFolder:    logDir,
-		RunInterval:     60,
+		RunInterval:     duration.Duration(time.Minute),
 		BackupPath:      backupDir,
 		EnableBackup:    true,
 		Archive: &config.ArchiveConfig{
@@ -836,3 +916,1474 @@ func TestRunBackupArchiveModeDryRun(t *testing.T) {
 		t.Error("Source file should still exist in dry-run mode")
 	}
 }
+
+// TestRunBackupMaxTotalBytes tests that files selected by the size rule are backed up before pruning
+func TestRunBackupMaxTotalBytes(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	// Three recent 100-byte files; the folder may only hold 150 bytes
+	for i, name := range []string{"a.log", "b.log", "c.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", 100)), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		modTime := time.Now().Add(-time.Duration(3-i) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		MaxTotalBytes:   150,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		TargetFolder:    logDir,
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	if result.BackedUp != 2 || result.Pruned != 2 {
+		t.Errorf("Expected 2 backed up and 2 pruned, got %d and %d", result.BackedUp, result.Pruned)
+	}
+
+	// The two oldest files are backed up and removed, the newest stays
+	for _, name := range []string{"a.log", "b.log"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("Expected %s to be backed up: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(logDir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be pruned", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "c.log")); err != nil {
+		t.Errorf("Expected c.log to remain: %v", err)
+	}
+}
+
+// TestRunBackupKeepsFilesWhenBackupFails tests that files are not pruned if their backup failed
+func TestRunBackupKeepsFilesWhenBackupFails(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldFile := filepath.Join(logDir, "sub", "old.log")
+	if err := os.MkdirAll(filepath.Dir(oldFile), 0755); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	if err := os.WriteFile(oldFile, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(oldFile, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	// A regular file where the backup needs a directory makes the backup fail
+	if err := os.WriteFile(filepath.Join(backupDir, "sub"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create blocking file: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		TargetFolder:    logDir,
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	if result.Failed != 1 {
+		t.Errorf("Expected 1 failed file, got %d", result.Failed)
+	}
+	if result.Pruned != 0 {
+		t.Errorf("Expected no files pruned, got %d", result.Pruned)
+	}
+	if _, err := os.Stat(oldFile); err != nil {
+		t.Errorf("Expected source file to be kept after failed backup: %v", err)
+	}
+}
+
+// TestRunBackupPerPatternRules tests that rules set per-file age thresholds and backup behavior
+func TestRunBackupPerPatternRules(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	files := map[string]time.Duration{
+		"app.debug.log":    8 * time.Hour,  // debug rule: 6h, no backup
+		"audit/access.log": 48 * time.Hour, // audit rule: 90 days
+		"app.log":          48 * time.Hour, // default: 24h
+		"fresh.debug.log":  2 * time.Hour,  // debug rule, not old enough
+		"audit/old.log":    100 * 24 * time.Hour,
+	}
+	for name, age := range files {
+		path := filepath.Join(logDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	noBackup := false
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		TargetFolder:    logDir,
+		Rules: []rules.Rule{
+			{Name: "debug", Glob: "*.debug.log", PruneAfterHours: 6, Backup: &noBackup},
+			{Name: "audit", Glob: "audit/*.log", PruneAfterHours: 2160},
+		},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	if result.Pruned != 3 {
+		t.Errorf("Expected 3 files pruned, got %d", result.Pruned)
+	}
+	if result.BackedUp != 2 {
+		t.Errorf("Expected 2 files backed up, got %d", result.BackedUp)
+	}
+
+	// Debug log pruned without a backup
+	if _, err := os.Stat(filepath.Join(logDir, "app.debug.log")); !os.IsNotExist(err) {
+		t.Error("Expected app.debug.log to be pruned")
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "app.debug.log")); !os.IsNotExist(err) {
+		t.Error("Expected app.debug.log not to be backed up")
+	}
+
+	// Recent audit log kept, 100-day-old audit log backed up and pruned
+	if _, err := os.Stat(filepath.Join(logDir, "audit", "access.log")); err != nil {
+		t.Errorf("Expected audit/access.log to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "audit", "old.log")); err != nil {
+		t.Errorf("Expected audit/old.log to be backed up: %v", err)
+	}
+
+	// Default rule still applies to unmatched files
+	if _, err := os.Stat(filepath.Join(backupDir, "app.log")); err != nil {
+		t.Errorf("Expected app.log to be backed up: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "fresh.debug.log")); err != nil {
+		t.Errorf("Expected fresh.debug.log to be kept: %v", err)
+	}
+}
+
+// TestRunBackupFilenameAgeSource tests that the filename age source drives selection and archive naming
+func TestRunBackupFilenameAgeSource(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	// Freshly touched files whose names carry the date the data was written
+	for _, name := range []string{"app-2026-01-09.log", "app-2026-01-10.log"} {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+	today := "app-" + time.Now().Format("2006-01-02") + ".log"
+	if err := os.WriteFile(filepath.Join(logDir, today), []byte("today"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		AgeSource:       "filename",
+		AgeSourceLayout: "app-2006-01-02.log",
+		Archive: &config.ArchiveConfig{
+			Enabled: true,
+			Format:  "tar",
+			GroupBy: "daily",
+		},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	if result.BackedUp != 2 || result.Pruned != 2 {
+		t.Errorf("Expected 2 backed up and 2 pruned, got %d and %d", result.BackedUp, result.Pruned)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, today)); err != nil {
+		t.Errorf("Expected today's file to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "backup-2026-01-10.tar")); err != nil {
+		t.Errorf("Expected archive named after the file date: %v", err)
+	}
+}
+
+// TestRunBackupArchiveGroupsByFileDate tests that files are bucketed into archives by their own date
+func TestRunBackupArchiveGroupsByFileDate(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	writeAt := func(name string, modTime time.Time) {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	day1 := time.Date(2026, 1, 5, 12, 0, 0, 0, time.Local)
+	day2 := time.Date(2026, 1, 6, 12, 0, 0, 0, time.Local)
+	writeAt("a.log", day1)
+	writeAt("b.log", day1.Add(time.Hour))
+	writeAt("c.log", day2)
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		Archive: &config.ArchiveConfig{
+			Enabled: true,
+			Format:  "tar.gz",
+			GroupBy: "daily",
+		},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	if len(result.Archives) != 2 {
+		t.Fatalf("Expected 2 archives, got %d", len(result.Archives))
+	}
+	if result.Archives[0].FilesArchived != 2 || result.Archives[1].FilesArchived != 1 {
+		t.Errorf("Unexpected files per archive: %d and %d",
+			result.Archives[0].FilesArchived, result.Archives[1].FilesArchived)
+	}
+	if result.BackedUp != 3 || result.Pruned != 3 {
+		t.Errorf("Expected 3 backed up and 3 pruned, got %d and %d", result.BackedUp, result.Pruned)
+	}
+	for _, name := range []string{"backup-2026-01-05.tar.gz", "backup-2026-01-06.tar.gz"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("Expected archive %s: %v", name, err)
+		}
+	}
+
+	// A later cycle with another file from day 2 merges into the existing archive
+	writeAt("d.log", day2.Add(time.Hour))
+	result, err = RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("Second RunBackup failed: %v", err)
+	}
+	if len(result.Archives) != 1 || result.Archives[0].MergedEntries != 1 {
+		t.Fatalf("Expected 1 merged archive, got %+v", result.Archives)
+	}
+
+	extractDir := t.TempDir()
+	if err := archive.ExtractArchive(filepath.Join(backupDir, "backup-2026-01-06.tar.gz"), extractDir); err != nil {
+		t.Fatalf("ExtractArchive failed: %v", err)
+	}
+	for _, name := range []string{"c.log", "d.log"} {
+		if _, err := os.Stat(filepath.Join(extractDir, name)); err != nil {
+			t.Errorf("Expected %s in merged archive: %v", name, err)
+		}
+	}
+}
+
+// TestRunBackupPreservesMetadata tests that per-file backups keep the source mode and times
+func TestRunBackupPreservesMetadata(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			logDir := t.TempDir()
+			backupDir := t.TempDir()
+
+			path := filepath.Join(logDir, "old.log")
+			if err := os.WriteFile(path, []byte("old log data"), 0600); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			if err := os.Chmod(path, 0640); err != nil {
+				t.Fatalf("Failed to chmod file: %v", err)
+			}
+			oldTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+			if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+				t.Fatalf("Failed to set modification time: %v", err)
+			}
+
+			cfg := &config.Config{
+				PruneAfterHours:  24,
+				TargetFolder:     logDir,
+				BackupPath:       backupDir,
+				EnableBackup:     true,
+				PreserveMetadata: true,
+			}
+			backupName := "old.log"
+			if compress {
+				cfg.Compression = &config.CompressionConfig{Enabled: true, Algorithm: "gzip"}
+				backupName += ".gz"
+			}
+
+			if _, err := RunBackup(context.Background(), cfg, nil, testLogger()); err != nil {
+				t.Fatalf("RunBackup failed: %v", err)
+			}
+
+			info, err := os.Stat(filepath.Join(backupDir, backupName))
+			if err != nil {
+				t.Fatalf("Expected backup file: %v", err)
+			}
+			if info.Mode().Perm() != 0640 {
+				t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+			}
+			if !info.ModTime().Equal(oldTime) {
+				t.Errorf("Expected modification time %v, got %v", oldTime, info.ModTime())
+			}
+		})
+	}
+}
+
+// TestRunBackupPreservesSymlinks tests that symlinks are backed up as links and pruned without their target
+func TestRunBackupPreservesSymlinks(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+	outside := t.TempDir()
+
+	target := filepath.Join(outside, "target.log")
+	if err := os.WriteFile(target, []byte("target"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	link := filepath.Join(logDir, "link.log")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: -1, // The link was just created, so select everything
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		Links:           "preserve",
+		Compression:     &config.CompressionConfig{Enabled: true, Algorithm: "gzip"},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.BackedUp != 1 || result.Pruned != 1 {
+		t.Errorf("Expected 1 backed up and 1 pruned, got %d and %d", result.BackedUp, result.Pruned)
+	}
+
+	got, err := os.Readlink(filepath.Join(backupDir, "link.log"))
+	if err != nil || got != target {
+		t.Errorf("Expected backup symlink to %s, got %q (%v)", target, got, err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Error("Expected the symlink to be pruned")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("Expected the link target to remain: %v", err)
+	}
+}
+
+// TestRunBackupDefersFilesInUse tests that locked files are neither backed up nor pruned
+func TestRunBackupDefersFilesInUse(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"locked.log", "done.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	// The lock file itself is new, so it is not selected
+	if err := os.WriteFile(filepath.Join(logDir, "locked.log.lock"), nil, 0644); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		InUseCheck: &inuse.Config{
+			Enabled:       true,
+			SettleSeconds: 0.01,
+			LockSuffixes:  []string{".lock"},
+		},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.InUse != 1 || result.BackedUp != 1 || result.Pruned != 1 {
+		t.Errorf("Expected 1 in use, 1 backed up and 1 pruned, got %d, %d and %d", result.InUse, result.BackedUp, result.Pruned)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "locked.log")); err != nil {
+		t.Errorf("Expected locked file to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "locked.log")); !os.IsNotExist(err) {
+		t.Error("Expected locked file not to be backed up")
+	}
+}
+
+// TestRunBackupCopyTruncate tests that copy-truncate files are backed up and emptied in place
+func TestRunBackupCopyTruncate(t *testing.T) {
+	for _, archiveMode := range []bool{false, true} {
+		t.Run(fmt.Sprintf("archive=%v", archiveMode), func(t *testing.T) {
+			logDir := t.TempDir()
+			backupDir := t.TempDir()
+
+			path := filepath.Join(logDir, "app.log")
+			content := "line one\nline two\n"
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to create file: %v", err)
+			}
+			oldTime := time.Date(2026, 1, 10, 12, 0, 0, 0, time.Local)
+			if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+				t.Fatalf("Failed to set modification time: %v", err)
+			}
+
+			copyTruncate := true
+			cfg := &config.Config{
+				PruneAfterHours: 24,
+				TargetFolder:    logDir,
+				BackupPath:      backupDir,
+				EnableBackup:    true,
+				Rules: []rules.Rule{
+					{Name: "service", Glob: "app.log", PruneAfterHours: 24, CopyTruncate: &copyTruncate},
+				},
+			}
+			if archiveMode {
+				cfg.Archive = &config.ArchiveConfig{Enabled: true, Format: "tar", GroupBy: "daily"}
+			}
+
+			result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+			if err != nil {
+				t.Fatalf("RunBackup failed: %v", err)
+			}
+			if result.Truncated != 1 || result.TruncatedBytes != int64(len(content)) || result.Pruned != 1 {
+				t.Errorf("Expected 1 truncated file with %d bytes, got %d truncated, %d bytes, %d pruned",
+					len(content), result.Truncated, result.TruncatedBytes, result.Pruned)
+			}
+
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("Expected file to remain: %v", err)
+			}
+			if info.Size() != 0 {
+				t.Errorf("Expected file to be truncated, got %d bytes", info.Size())
+			}
+
+			restored := filepath.Join(backupDir, "app.log")
+			if archiveMode {
+				extractDir := t.TempDir()
+				if err := archive.ExtractArchive(filepath.Join(backupDir, "backup-2026-01-10.tar"), extractDir); err != nil {
+					t.Fatalf("ExtractArchive failed: %v", err)
+				}
+				restored = filepath.Join(extractDir, "app.log")
+			}
+			got, err := os.ReadFile(restored)
+			if err != nil {
+				t.Fatalf("Expected backup: %v", err)
+			}
+			if string(got) != content {
+				t.Errorf("Expected backup content %q, got %q", content, got)
+			}
+
+			// Snapshots are removed once backed up
+			leftovers, _ := filepath.Glob(filepath.Join(backupDir, snapshotDirPattern))
+			if len(leftovers) != 0 {
+				t.Errorf("Expected no snapshot directories, got %v", leftovers)
+			}
+		})
+	}
+}
+
+// TestRunBackupLeftoverSnapshots tests that snapshots left by an earlier cycle are backed up again
+func TestRunBackupLeftoverSnapshots(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	path := filepath.Join(logDir, "sub", "app.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("current\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	// A snapshot whose backup failed in an earlier cycle
+	snapshotDir := filepath.Join(backupDir, ".filekeeper-snapshot-1")
+	snapshot := filepath.Join(snapshotDir, "sub", "app.log.2")
+	if err := os.MkdirAll(filepath.Dir(snapshot), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(snapshot, []byte("earlier\n"), 0644); err != nil {
+		t.Fatalf("Failed to create snapshot: %v", err)
+	}
+
+	copyTruncate := true
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		Rules: []rules.Rule{
+			{Name: "service", Glob: "**/app.log", PruneAfterHours: 24, CopyTruncate: &copyTruncate},
+		},
+	}
+
+	// Plans leave the snapshot to the next regular cycle
+	plan, planResult, err := BuildPlan(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Fatalf("Expected planning to keep the snapshot: %v", err)
+	}
+	if planResult.SnapshotPending != 1 {
+		t.Errorf("Expected 1 pending snapshot, got %d", planResult.SnapshotPending)
+	}
+	if len(plan.Files) != 1 {
+		t.Errorf("Expected only the live file planned, got %+v", plan.Files)
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.BackedUp != 1 || result.Pruned != 1 || result.Truncated != 0 {
+		t.Errorf("Expected the snapshot backed up and pruned alone, got %d backed up, %d pruned, %d truncated",
+			result.BackedUp, result.Pruned, result.Truncated)
+	}
+	if got, _ := os.ReadFile(filepath.Join(backupDir, "sub", "app.log")); string(got) != "earlier\n" {
+		t.Errorf("Expected the snapshot backed up under the file's name, got %q", got)
+	}
+	if _, err := os.Stat(snapshotDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the snapshot directory to be removed, got %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "current\n" {
+		t.Errorf("Expected the live file untouched in this cycle, got %q", got)
+	}
+
+	// The next cycle truncates the live file as usual
+	result, err = RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.Truncated != 1 {
+		t.Errorf("Expected the live file truncated, got %d", result.Truncated)
+	}
+	if got, _ := os.ReadFile(filepath.Join(backupDir, "sub", "app.log")); string(got) != "current\n" {
+		t.Errorf("Expected the live file backed up, got %q", got)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(backupDir, snapshotDirPattern)); len(leftovers) != 0 {
+		t.Errorf("Expected no snapshot directories, got %v", leftovers)
+	}
+}
+
+// TestCopyTruncateKeepsWriterPosition tests that an appending writer continues at the start of the emptied file
+func TestCopyTruncateKeepsWriterPosition(t *testing.T) {
+	dir := t.TempDir()
+	snapshotDir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer writer.Close()
+	if _, err := writer.WriteString("before\n"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	snapshot, size, err := copyTruncate(path, snapshotDir, false)
+	if err != nil {
+		t.Fatalf("copyTruncate failed: %v", err)
+	}
+	if size != 7 {
+		t.Errorf("Expected 7 bytes reclaimed, got %d", size)
+	}
+
+	if _, err := writer.WriteString("after\n"); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+
+	if got, _ := os.ReadFile(snapshot); string(got) != "before\n" {
+		t.Errorf("Expected snapshot to hold the old content, got %q", got)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "after\n" {
+		t.Errorf("Expected writer to continue at the start of the file, got %q", got)
+	}
+}
+
+// TestRunBackupRemovesEmptyDirs tests that dated folders emptied by pruning are removed
+func TestRunBackupRemovesEmptyDirs(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	path := filepath.Join(logDir, "2026", "09", "15", "app.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		RemoveEmptyDirs: &config.EmptyDirsConfig{Enabled: true},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.Pruned != 1 || result.DirsRemoved != 3 {
+		t.Errorf("Expected 1 pruned file and 3 removed directories, got %d and %d", result.Pruned, result.DirsRemoved)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "2026")); !os.IsNotExist(err) {
+		t.Error("Expected the dated folders to be removed")
+	}
+	if _, err := os.Stat(logDir); err != nil {
+		t.Errorf("Expected target folder to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "2026", "09", "15", "app.log")); err != nil {
+		t.Errorf("Expected backup to keep the folder structure: %v", err)
+	}
+}
+
+func TestRunBackupMovesPrunedFilesToTrash(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	path := filepath.Join(logDir, "sub", "app.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	oldTime := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		RemoveEmptyDirs: &config.EmptyDirsConfig{Enabled: true},
+		Trash:           &trash.Config{Enabled: true},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.Pruned != 1 {
+		t.Errorf("Expected 1 pruned file, got %d", result.Pruned)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the file to be moved out of the target folder")
+	}
+
+	// The trash is neither pruned nor removed as an empty directory on the next cycle
+	result, err = RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("second RunBackup failed: %v", err)
+	}
+	if result.Pruned != 0 {
+		t.Errorf("Expected trashed files not to be selected again, got %d pruned", result.Pruned)
+	}
+
+	bin := trash.New(cfg.GetTrashConfig(), logDir)
+	entries, err := bin.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].RelPath != filepath.Join("sub", "app.log") {
+		t.Fatalf("Expected sub/app.log in the trash, got %+v", entries)
+	}
+	if _, err := bin.Restore(entries[0], false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || string(content) != "data" {
+		t.Errorf("Expected restored file, got %q (%v)", content, err)
+	}
+}
+
+func TestRunBackupSafetyLimit(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for i := 0; i < 3; i++ {
+		path := filepath.Join(logDir, fmt.Sprintf("app%d.log", i))
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPath:      backupDir,
+		EnableBackup:    true,
+		Safety:          &safety.Config{MaxFiles: 2},
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if !errors.Is(err, ErrSafetyLimit) {
+		t.Fatalf("Expected ErrSafetyLimit, got %v", err)
+	}
+	if result.BackedUp != 0 || result.Pruned != 0 {
+		t.Errorf("Expected nothing to be touched, got %d backed up and %d pruned", result.BackedUp, result.Pruned)
+	}
+	if entries, _ := os.ReadDir(logDir); len(entries) != 3 {
+		t.Errorf("Expected all 3 files to be kept, got %d", len(entries))
+	}
+
+	result, err = RunBackup(context.Background(), cfg, &RunOptions{Force: true}, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup with Force failed: %v", err)
+	}
+	if result.Pruned != 3 {
+		t.Errorf("Expected 3 pruned files with Force, got %d", result.Pruned)
+	}
+}
+
+func TestRunBackupFractionalHours(t *testing.T) {
+	logDir := t.TempDir()
+
+	for name, age := range map[string]time.Duration{"recent.log": 10 * time.Minute, "old.log": time.Hour} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		modTime := time.Now().Add(-age)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	// 0.5 hours used to be truncated to zero, pruning every file
+	cfg := &config.Config{
+		PruneAfterHours: 0.5,
+		TargetFolder:    logDir,
+	}
+
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.Pruned != 1 {
+		t.Errorf("Expected 1 pruned file, got %d", result.Pruned)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "recent.log")); err != nil {
+		t.Errorf("Expected recent.log to be kept: %v", err)
+	}
+}
+
+func TestBuildPlanAndApply(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"a.log", "b.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte("data of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "new.log"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+	}
+
+	plan, _, err := BuildPlan(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+	if plan.Scanned != 3 || len(plan.Files) != 2 {
+		t.Fatalf("Expected 2 of 3 files planned, got %d of %d", len(plan.Files), plan.Scanned)
+	}
+	if plan.Totals.Backups != 2 || plan.Totals.Prunes != 2 {
+		t.Errorf("Expected 2 backups and 2 prunes, got %+v", plan.Totals)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "a.log")); err != nil {
+		t.Fatalf("Expected planning to change nothing: %v", err)
+	}
+
+	// A file changed after planning is refused and kept
+	changed := filepath.Join(logDir, "b.log")
+	if err := os.WriteFile(changed, []byte("more data of b.log"), 0644); err != nil {
+		t.Fatalf("Failed to change file: %v", err)
+	}
+	if err := os.Chtimes(changed, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	result, err := ApplyPlan(context.Background(), cfg, plan, nil, testLogger())
+	if err != nil {
+		t.Fatalf("ApplyPlan failed: %v", err)
+	}
+	if result.BackedUp != 1 || result.Pruned != 1 {
+		t.Errorf("Expected 1 backed up and 1 pruned file, got %d and %d", result.BackedUp, result.Pruned)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0].Err, ErrFileChanged) {
+		t.Errorf("Expected one ErrFileChanged error, got %v", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "a.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected a.log to be pruned, got %v", err)
+	}
+	if _, err := os.Stat(changed); err != nil {
+		t.Errorf("Expected changed b.log to be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "b.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected changed b.log not to be backed up, got %v", err)
+	}
+}
+
+func TestApplyPlanRefusesChangedConfig(t *testing.T) {
+	logDir := t.TempDir()
+	cfg := &config.Config{PruneAfterHours: 24, TargetFolder: logDir}
+
+	plan, _, err := BuildPlan(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+
+	cfg.PruneAfterHours = 12
+	if _, err := ApplyPlan(context.Background(), cfg, plan, nil, testLogger()); !errors.Is(err, ErrPlanMismatch) {
+		t.Errorf("Expected ErrPlanMismatch, got %v", err)
+	}
+}
+
+func TestApplyPlanTakesOnlyPlannedActions(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"a.log", "b.log", "c.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte("data of "+name), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+	}
+
+	plan, _, err := BuildPlan(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+
+	// The reviewer vetoes the prune of a.log and edits the backup of b.log
+	actions := plan.Actions[:0]
+	for _, a := range plan.Actions {
+		switch {
+		case a.Type == ActionPrune && filepath.Base(a.Path) == "a.log":
+			continue
+		case a.Type == ActionBackup && filepath.Base(a.Path) == "b.log":
+			a.Size++
+		}
+		actions = append(actions, a)
+	}
+	plan.Actions = actions
+
+	result, err := ApplyPlan(context.Background(), cfg, plan, nil, testLogger())
+	if err != nil {
+		t.Fatalf("ApplyPlan failed: %v", err)
+	}
+	if result.BackedUp != 2 || result.Pruned != 1 {
+		t.Errorf("Expected 2 backed up and 1 pruned file, got %d and %d", result.BackedUp, result.Pruned)
+	}
+	if len(result.Errors) != 1 || !errors.Is(result.Errors[0].Err, ErrActionRefused) {
+		t.Errorf("Expected one ErrActionRefused error, got %v", result.Errors)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "a.log")); err != nil {
+		t.Errorf("Expected a.log to be kept without its planned prune: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "a.log")); err != nil {
+		t.Errorf("Expected a.log to be backed up: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "b.log")); err != nil {
+		t.Errorf("Expected b.log to be kept after its backup was refused: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(backupDir, "b.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected refused backup of b.log not to be made, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "c.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected c.log to be pruned, got %v", err)
+	}
+}
+
+func TestRunBackupReport(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	path := filepath.Join(logDir, "sub", "old.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("old log data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+	}
+
+	startedAt := time.Now()
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	report := NewReport(result, err, startedAt)
+	if report.Status != StatusSuccess {
+		t.Errorf("Expected status success, got %s", report.Status)
+	}
+	if len(report.Destinations) != 1 || report.Destinations[0].Succeeded != 1 || report.Destinations[0].Bytes != 12 {
+		t.Errorf("Expected 1 copy of 12 bytes to %s, got %+v", backupDir, report.Destinations)
+	}
+
+	// Errors serialize with their message
+	result.AddError(path, "backup", errors.New("disk full"))
+	data, err := json.Marshal(NewReport(result, nil, startedAt))
+	if err != nil {
+		t.Fatalf("Failed to encode report: %v", err)
+	}
+	if !strings.Contains(string(data), `{"path":"`+path+`","operation":"backup","message":"disk full"}`) {
+		t.Errorf("Expected the error to serialize with its message, got %s", data)
+	}
+	if !strings.Contains(string(data), `"status":"partial_failure"`) {
+		t.Errorf("Expected status partial_failure, got %s", data)
+	}
+}
+
+func TestCycleStatus(t *testing.T) {
+	failed := NewResult()
+	failed.AddError("a.log", "backup", errors.New("failed"))
+	remoteFailed := NewResult()
+	remoteFailed.RemoteFailed = 1
+
+	tests := []struct {
+		name   string
+		result *Result
+		err    error
+		want   Status
+	}{
+		{"success", NewResult(), nil, StatusSuccess},
+		{"file errors", failed, nil, StatusPartialFailure},
+		{"remote errors", remoteFailed, nil, StatusPartialFailure},
+		{"threshold", failed, fmt.Errorf("%w: 100%%", ErrThresholdExceeded), StatusThresholdExceeded},
+		{"safety limit", NewResult(), ErrSafetyLimit, StatusFailed},
+		{"interrupted", failed, context.Canceled, StatusInterrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CycleStatus(tt.result, tt.err); got != tt.want {
+				t.Errorf("CycleStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBackupHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use /bin/sh")
+	}
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+	hookLog := filepath.Join(t.TempDir(), "hooks.log")
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	path := filepath.Join(logDir, "old.log")
+	if err := os.WriteFile(path, []byte("old log data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	record := func(vars string) string {
+		return `echo "$FILEKEEPER_STAGE ` + vars + `" >> ` + hookLog
+	}
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+		Hooks: []hooks.Config{
+			{Stage: hooks.PostCycle, Command: record("$FILEKEEPER_STATUS $FILEKEEPER_BACKED_UP $FILEKEEPER_PRUNED")},
+			{Stage: hooks.PreCycle, Command: record("$FILEKEEPER_TARGET_FOLDER")},
+			{Stage: hooks.OnFileBackedUp, Command: record("$FILEKEEPER_PATH $FILEKEEPER_SIZE $FILEKEEPER_DESTINATION")},
+			{Stage: hooks.PrePrune, Command: record("$FILEKEEPER_PRUNE_FILES $FILEKEEPER_PRUNE_BYTES")},
+		},
+	}
+
+	if _, err := RunBackup(context.Background(), cfg, nil, testLogger()); err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	data, err := os.ReadFile(hookLog)
+	if err != nil {
+		t.Fatalf("Failed to read hook log: %v", err)
+	}
+	want := strings.Join([]string{
+		"pre_cycle " + logDir,
+		"on_file_backed_up " + path + " 12 " + filepath.Join(backupDir, "old.log"),
+		"pre_prune 1 12",
+		"post_cycle success 1 1",
+	}, "\n") + "\n"
+	if string(data) != want {
+		t.Errorf("Expected hooks to run in order:\n%s\ngot:\n%s", want, data)
+	}
+
+	// A failing pre_cycle hook with on_failure abort skips the cycle
+	newPath := filepath.Join(logDir, "again.log")
+	if err := os.WriteFile(newPath, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(newPath, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	cfg.Hooks = []hooks.Config{{Stage: hooks.PreCycle, Command: "exit 1", OnFailure: hooks.PolicyAbort}}
+	if _, err := RunBackup(context.Background(), cfg, nil, testLogger()); !errors.Is(err, hooks.ErrFailed) {
+		t.Fatalf("Expected ErrFailed, got %v", err)
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Expected file to be kept after an aborted cycle: %v", err)
+	}
+
+	// A failing per-file hook with on_failure abort stops the cycle before pruning
+	cfg.Hooks = []hooks.Config{{Stage: hooks.OnFileBackedUp, Command: "exit 1", OnFailure: hooks.PolicyAbort}}
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if !errors.Is(err, hooks.ErrFailed) {
+		t.Fatalf("Expected ErrFailed, got %v", err)
+	}
+	if CycleStatus(result, err) != StatusFailed {
+		t.Errorf("Expected status failed, got %s", CycleStatus(result, err))
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Expected file to be kept after an aborted cycle: %v", err)
+	}
+}
+
+// flakyDestination fails its copies while down is set.
+type flakyDestination struct {
+	down   bool
+	copies int
+}
+
+func (d *flakyDestination) Name() string { return "flaky" }
+
+func (d *flakyDestination) Copy(ctx context.Context, source, relPath string) error {
+	d.copies++
+	if d.down {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestRunBackupRemoteOutbox(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	path := filepath.Join(logDir, "old.log")
+	if err := os.WriteFile(path, []byte("old log data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+		RemoteRetry: &outbox.Config{
+			Attempts:       2,
+			InitialBackoff: duration.Duration(time.Millisecond),
+			Outbox:         true,
+		},
+	}
+	outboxPath := filepath.Join(backupDir, outbox.DefaultFileName)
+	dest := &flakyDestination{down: true}
+	opts := &RunOptions{Destinations: []Destination{dest}}
+
+	// The remote is down: the copy is retried, queued, and the file is kept
+	result, err := RunBackup(context.Background(), cfg, opts, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if dest.copies != 2 {
+		t.Errorf("Expected 2 tries, got %d", dest.copies)
+	}
+	if result.BackedUp != 1 || result.Pruned != 0 || result.RemoteFailed != 1 || result.Failed != 1 || result.OutboxPending != 1 {
+		t.Errorf("Expected the file backed up, kept and queued, got %+v", result)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file kept while its remote copy is pending: %v", err)
+	}
+	if _, err := os.Stat(outboxPath); err != nil {
+		t.Errorf("Expected the outbox file: %v", err)
+	}
+
+	// The remote is back: the queued copy is delivered and the file pruned without a new backup
+	dest.down = false
+	result, err = RunBackup(context.Background(), cfg, opts, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if dest.copies != 3 {
+		t.Errorf("Expected 1 more try, got %d in total", dest.copies)
+	}
+	if result.BackedUp != 0 || result.Pruned != 1 || result.RemoteCopied != 1 || result.Failed != 0 || result.OutboxPending != 0 {
+		t.Errorf("Expected the queued copy delivered and the file pruned, got %+v", result)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file pruned, got %v", err)
+	}
+	if _, err := os.Stat(outboxPath); !os.IsNotExist(err) {
+		t.Errorf("Expected the outbox file removed, got %v", err)
+	}
+}
+
+func TestRunBackupRemoteFailureKeepsFile(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	path := filepath.Join(logDir, "old.log")
+	if err := os.WriteFile(path, []byte("old log data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	// Retries without the outbox
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+		RemoteRetry: &outbox.Config{
+			Attempts:       2,
+			InitialBackoff: duration.Duration(time.Millisecond),
+		},
+	}
+	dest := &flakyDestination{down: true}
+	opts := &RunOptions{Destinations: []Destination{dest}}
+
+	result, err := RunBackup(context.Background(), cfg, opts, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.BackedUp != 1 || result.Pruned != 0 || result.RemoteFailed != 1 || result.OutboxPending != 0 {
+		t.Errorf("Expected the file backed up and kept, got %+v", result)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the file kept after its remote copy failed: %v", err)
+	}
+
+	// Once the remote is back, the next cycle backs it up again and prunes it
+	dest.down = false
+	result, err = RunBackup(context.Background(), cfg, opts, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.BackedUp != 1 || result.Pruned != 1 || result.RemoteCopied != 1 {
+		t.Errorf("Expected the file copied and pruned, got %+v", result)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the file pruned, got %v", err)
+	}
+}
+
+// batchRecorder is a BatchDestination that fails the copies of files named fail*.
+type batchRecorder struct {
+	batches [][]string
+}
+
+func (d *batchRecorder) Name() string { return "batch" }
+
+func (d *batchRecorder) Copy(ctx context.Context, source, relPath string) error {
+	return errors.New("Copy called on a batch destination")
+}
+
+func (d *batchRecorder) CopyBatch(ctx context.Context, files []BatchFile) []error {
+	var names []string
+	errs := make([]error, len(files))
+	for i, f := range files {
+		names = append(names, f.RelPath)
+		if strings.HasPrefix(f.RelPath, "fail") {
+			errs[i] = errors.New("permission denied")
+		}
+	}
+	d.batches = append(d.batches, names)
+	return errs
+}
+
+func TestRunBackupBatchDestination(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"a.log", "b.log", "fail.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		BackupPaths:     []string{backupDir},
+		EnableBackup:    true,
+		RemoteRetry: &outbox.Config{
+			Attempts:       2,
+			InitialBackoff: duration.Duration(time.Millisecond),
+			Outbox:         true,
+		},
+	}
+	dest := &batchRecorder{}
+	result, err := RunBackup(context.Background(), cfg, &RunOptions{Destinations: []Destination{dest}}, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	// All copies go out in one batch; the retry only sends the failed one
+	want := [][]string{{"a.log", "b.log", "fail.log"}, {"fail.log"}}
+	if fmt.Sprint(dest.batches) != fmt.Sprint(want) {
+		t.Errorf("Expected batches %v, got %v", want, dest.batches)
+	}
+	if result.RemoteCopied != 2 || result.RemoteFailed != 1 || result.OutboxPending != 1 || result.Pruned != 2 {
+		t.Errorf("Expected 2 copies delivered and pruned and 1 queued, got %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "fail.log")); err != nil {
+		t.Errorf("Expected the file with a failed copy kept: %v", err)
+	}
+}
+
+// streamRecorder is a BatchDestination that keeps the content of each copy.
+type streamRecorder struct {
+	name  string
+	files map[string][]byte
+}
+
+func (d *streamRecorder) Name() string { return "stream" + d.name }
+
+func (d *streamRecorder) Copy(ctx context.Context, source, relPath string) error {
+	return errors.New("Copy called on a batch destination")
+}
+
+func (d *streamRecorder) CopyBatch(ctx context.Context, files []BatchFile) []error {
+	errs := make([]error, len(files))
+	for i, f := range files {
+		if strings.HasPrefix(filepath.Base(f.RelPath), "fail") {
+			errs[i] = errors.New("permission denied")
+			continue
+		}
+		r, err := os.Open(f.Source)
+		var content io.ReadCloser = r
+		if f.Open != nil {
+			content, err = f.Open()
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		data, err := io.ReadAll(content)
+		content.Close()
+		if err == nil && f.Open != nil && int64(len(data)) != f.Size {
+			err = fmt.Errorf("got %d bytes, want %d", len(data), f.Size)
+		}
+		errs[i] = err
+		d.files[f.RelPath] = data
+	}
+	return errs
+}
+
+func TestRunBackupRemoteOnly(t *testing.T) {
+	logDir := t.TempDir()
+
+	oldTime := time.Now().Add(-48 * time.Hour)
+	content := strings.Repeat("log line\n", 100)
+	for _, name := range []string{"app.log", "fail.log"} {
+		path := filepath.Join(logDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		EnableBackup:    true,
+		Compression:     &config.CompressionConfig{Enabled: true, Algorithm: "gzip"},
+	}
+	// Compressed streams are spooled to the temporary directory once for both destinations
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	dest := &streamRecorder{files: make(map[string][]byte)}
+	second := &streamRecorder{name: "2", files: make(map[string][]byte)}
+	result, err := RunBackup(context.Background(), cfg, &RunOptions{Destinations: []Destination{dest, second}}, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+
+	// The delivered file is backed up and pruned; the other one is kept
+	if result.BackedUp != 1 || result.Pruned != 1 || result.RemoteCopied != 2 || result.RemoteFailed != 2 {
+		t.Errorf("Expected 1 file streamed twice and pruned and 1 failed, got %+v", result)
+	}
+	if string(second.files["app.log.gz"]) != string(dest.files["app.log.gz"]) {
+		t.Error("Expected the same compressed stream at both destinations")
+	}
+	if left, _ := os.ReadDir(tmpDir); len(left) != 0 {
+		t.Errorf("Expected the spooled streams removed, got %d files", len(left))
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "app.log")); !os.IsNotExist(err) {
+		t.Errorf("Expected app.log pruned, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "fail.log")); err != nil {
+		t.Errorf("Expected fail.log kept: %v", err)
+	}
+
+	data, ok := dest.files["app.log.gz"]
+	if !ok {
+		t.Fatalf("Expected app.log.gz sent, got %v", dest.files)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a gzip stream: %v", err)
+	}
+	if plain, err := io.ReadAll(zr); err != nil || string(plain) != content {
+		t.Errorf("Expected the original content, got %d bytes, %v", len(plain), err)
+	}
+}
+
+func TestRunBackupRemoteOnlyKeepsDirectories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not installed")
+	}
+
+	// The fake ssh runs the remote command locally
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nshift\nexec /bin/sh -c \"$1\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to create fake ssh: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Two files of the same name in different directories
+	logDir := t.TempDir()
+	oldTime := time.Now().Add(-48 * time.Hour)
+	for _, dir := range []string{"a", "b"} {
+		path := filepath.Join(logDir, dir, "app.log")
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("log of "+dir), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, oldTime, oldTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	remoteDir := filepath.Join(t.TempDir(), "remote")
+	cfg := &config.Config{
+		PruneAfterHours: 24,
+		TargetFolder:    logDir,
+		EnableBackup:    true,
+		RemoteBackups:   []string{"host:" + remoteDir},
+		RemoteTransfer:  config.RemoteTransferTar,
+	}
+	result, err := RunBackup(context.Background(), cfg, nil, testLogger())
+	if err != nil {
+		t.Fatalf("RunBackup failed: %v", err)
+	}
+	if result.BackedUp != 2 || result.RemoteCopied != 2 || result.Pruned != 2 {
+		t.Errorf("Expected 2 files streamed and pruned, got %+v", result)
+	}
+	for _, dir := range []string{"a", "b"} {
+		data, err := os.ReadFile(filepath.Join(remoteDir, dir, "app.log"))
+		if err != nil || string(data) != "log of "+dir {
+			t.Errorf("Expected %s/app.log on the remote side, got %q, %v", dir, data, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"context"
+	"filekeeper/internal/hooks"
+	"filekeeper/internal/pruner"
+	"strconv"
+)
+
+// commandHooks runs the hook commands of a cycle. A per-file hook with on_failure
+// abort cancels the cycle, with the hook's error as the cause.
+type commandHooks struct {
+	runner       *hooks.Runner
+	ctx          context.Context
+	abort        context.CancelCauseFunc
+	targetFolder string
+}
+
+// run runs the hooks of stage with env and the variables common to all hooks.
+func (h *commandHooks) run(ctx context.Context, stage hooks.Stage, env hooks.Env) error {
+	if h == nil || !h.runner.Has(stage) {
+		return nil
+	}
+	if env == nil {
+		env = hooks.Env{}
+	}
+	env["FILEKEEPER_TARGET_FOLDER"] = h.targetFolder
+	return h.runner.Run(ctx, stage, env)
+}
+
+// fileBackedUp runs the on_file_backed_up hooks for a file whose first local copy
+// or archive is destination.
+func (h *commandHooks) fileBackedUp(c pruner.Candidate, destination string) {
+	err := h.run(h.ctx, hooks.OnFileBackedUp, hooks.Env{
+		"FILEKEEPER_PATH":        c.Path,
+		"FILEKEEPER_SIZE":        strconv.FormatInt(c.Info.Size(), 10),
+		"FILEKEEPER_RULE":        c.Rule.DisplayName(),
+		"FILEKEEPER_DESTINATION": destination,
+	})
+	if err != nil {
+		h.abort(err)
+	}
+}
+
+// fileError runs the on_error hooks for an error recorded in the Result.
+func (h *commandHooks) fileError(e FileError) {
+	err := h.run(h.ctx, hooks.OnError, hooks.Env{
+		"FILEKEEPER_PATH":      e.Path,
+		"FILEKEEPER_OPERATION": e.Operation,
+		"FILEKEEPER_ERROR":     e.Err.Error(),
+	})
+	if err != nil {
+		h.abort(err)
+	}
+}
+
+// prePrune runs the pre_prune hooks before candidates are pruned.
+func (h *commandHooks) prePrune(result *Result, candidates []pruner.Candidate) error {
+	if len(candidates) == 0 {
+		return nil
+	}
+	var bytes int64
+	for _, c := range candidates {
+		bytes += c.Info.Size()
+	}
+	env := summaryEnv(result, nil)
+	env["FILEKEEPER_PRUNE_FILES"] = strconv.Itoa(len(candidates))
+	env["FILEKEEPER_PRUNE_BYTES"] = strconv.FormatInt(bytes, 10)
+	return h.run(h.ctx, hooks.PrePrune, env)
+}
+
+// summaryEnv returns the result summary passed to pre_prune and post_cycle hooks.
+func summaryEnv(result *Result, err error) hooks.Env {
+	env := hooks.Env{
+		"FILEKEEPER_STATUS":         string(CycleStatus(result, err)),
+		"FILEKEEPER_SUCCEEDED":      strconv.Itoa(result.Succeeded),
+		"FILEKEEPER_FAILED":         strconv.Itoa(result.Failed),
+		"FILEKEEPER_BACKED_UP":      strconv.Itoa(result.BackedUp),
+		"FILEKEEPER_PRUNED":         strconv.Itoa(result.Pruned),
+		"FILEKEEPER_TRUNCATED":      strconv.Itoa(result.Truncated),
+		"FILEKEEPER_TOTAL_BYTES":    strconv.FormatInt(result.TotalBytes, 10),
+		"FILEKEEPER_REMOTE_COPIED":  strconv.Itoa(result.RemoteCopied),
+		"FILEKEEPER_REMOTE_FAILED":  strconv.Itoa(result.RemoteFailed),
+		"FILEKEEPER_OUTBOX_PENDING": strconv.Itoa(result.OutboxPending),
+	}
+	if err != nil {
+		env["FILEKEEPER_ERROR"] = err.Error()
+	}
+	return env
+}
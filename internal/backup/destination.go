@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"context"
+	"filekeeper/internal/config"
+	"filekeeper/internal/pruner"
+	"filekeeper/pkg/ratelimit"
+	"filekeeper/pkg/utils"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// Destination receives a copy of each local backup or archive after it was written,
+// like a remote_backups entry. Copy is given the path of the local copy and its path
+// relative to the backup directory. Failed copies are counted as remote failures and
+// only keep the file from being pruned if the remote_retry outbox is enabled.
+type Destination interface {
+	Name() string
+	Copy(ctx context.Context, source, relPath string) error
+}
+
+// BatchDestination is a Destination that takes the copies of a cycle at once, for
+// example over one connection. They are queued as files are backed up and passed to
+// CopyBatch before pruning; Copy is not called. CopyBatch returns an error for each
+// file, nil for the files that were copied.
+type BatchDestination interface {
+	Destination
+	CopyBatch(ctx context.Context, files []BatchFile) []error
+}
+
+// BatchFile is a copy passed to CopyBatch, with the arguments of Copy.
+type BatchFile struct {
+	Source  string
+	RelPath string
+
+	// Open, if set, returns the content to copy, Size bytes long, in place of
+	// Source's: without a local backup path, files are read from Source itself
+	// and compressed on the fly.
+	Open func() (io.ReadCloser, error)
+	Size int64
+}
+
+// scpDestination copies to a remote_backups entry with scp.
+type scpDestination struct {
+	remote   string
+	preserve bool              // Keep mode and times with scp -p
+	limits   *ratelimit.Limits // Upload limits, applied with scp -l
+}
+
+func (d scpDestination) Name() string {
+	return d.remote
+}
+
+func (d scpDestination) Copy(ctx context.Context, source, relPath string) error {
+	return utils.ExecuteRemoteCopyLimited(source, d.remote, d.preserve, d.limits.RemoteRate(d.remote, time.Now()))
+}
+
+// tarDestination copies to a remote_backups entry as one tar stream per cycle, over
+// one ssh session.
+type tarDestination struct {
+	remote   string
+	preserve bool              // Keep mode and times on the remote side
+	limits   *ratelimit.Limits // Upload limits, applied to the stream
+}
+
+func (d tarDestination) Name() string {
+	return d.remote
+}
+
+func (d tarDestination) Copy(ctx context.Context, source, relPath string) error {
+	return d.CopyBatch(ctx, []BatchFile{{Source: source, RelPath: relPath}})[0]
+}
+
+func (d tarDestination) CopyBatch(ctx context.Context, files []BatchFile) []error {
+	remoteFiles := make([]utils.RemoteFile, len(files))
+	for i, f := range files {
+		// Files keep their relative paths, so files of the same name in different directories both arrive
+		remoteFiles[i] = utils.RemoteFile{Path: f.Source, Name: filepath.ToSlash(f.RelPath), Open: f.Open, Size: f.Size}
+	}
+	return utils.ExecuteRemoteBatch(ctx, d.remote, remoteFiles, d.preserve, func(w io.Writer) io.Writer {
+		return ratelimit.NewWriter(ctx, w, d.limits.RemoteLimiters(d.remote)...)
+	})
+}
+
+// remoteDestinations returns the remote_backups entries followed by the destinations of opts.
+// preserve keeps metadata on remote copies if preserve_metadata is set.
+func remoteDestinations(cfg *config.Config, opts *RunOptions, preserve bool) []Destination {
+	remotes := cfg.GetRemoteBackups()
+	dests := make([]Destination, 0, len(remotes)+len(opts.Destinations))
+	for _, remote := range remotes {
+		preserve := preserve && cfg.PreserveMetadata
+		if cfg.GetRemoteTransfer() == config.RemoteTransferSCP {
+			dests = append(dests, scpDestination{remote: remote, preserve: preserve, limits: opts.limits})
+		} else {
+			dests = append(dests, tarDestination{remote: remote, preserve: preserve, limits: opts.limits})
+		}
+	}
+	return append(dests, opts.Destinations...)
+}
+
+// FileEvent describes a file that was backed up or pruned.
+type FileEvent struct {
+	Path      string
+	Size      int64
+	Time      time.Time // Timestamp from the configured age source
+	Rule      string
+	Reason    string // Why the file was selected: age, max_total_bytes or min_free_percent
+	Truncated bool   // Emptied in place instead of removed (copy-truncate)
+}
+
+// Hooks are called during a cycle as files are processed. They run on the cycle's
+// goroutine, so a slow hook slows the cycle. OnFileBackedUp and OnFilePruned are not
+// called in dry-run mode.
+type Hooks struct {
+	OnFileBackedUp func(FileEvent) // After a file was copied to at least one local destination, or archived
+	OnFilePruned   func(FileEvent) // After a file was removed, moved to the trash or truncated
+	OnError        func(FileError) // For each error recorded in the Result
+}
+
+// candidateEvent returns the event of a selected file.
+func candidateEvent(c pruner.Candidate) FileEvent {
+	return FileEvent{
+		Path:      c.Path,
+		Size:      c.Info.Size(),
+		Time:      c.Time,
+		Rule:      c.Rule.DisplayName(),
+		Reason:    c.Reason,
+		Truncated: c.Truncate,
+	}
+}
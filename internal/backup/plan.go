@@ -0,0 +1,375 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/config"
+	"filekeeper/internal/pruner"
+	"filekeeper/internal/rules"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PlanVersion is the version of the plan format written by BuildPlan.
+const PlanVersion = 1
+
+// ErrPlanMismatch is returned when a plan was made for a different configuration or target folder.
+var ErrPlanMismatch = errors.New("plan does not match the configuration")
+
+// ErrFileChanged is recorded for a planned file that changed or disappeared since planning.
+var ErrFileChanged = errors.New("file changed since planning")
+
+// ErrActionRefused is recorded for an action that differs from the planned action for
+// the same file and destination.
+var ErrActionRefused = errors.New("action differs from the plan")
+
+// errNotPlanned is returned for a file none of whose local backups is in the plan being applied.
+var errNotPlanned = errors.New("backup not in the plan")
+
+// ActionType identifies what a plan action does.
+type ActionType string
+
+const (
+	ActionBackup     ActionType = "backup"      // Copy a file to a local backup destination
+	ActionArchive    ActionType = "archive"     // Create or merge an archive in a local backup destination
+	ActionRemoteCopy ActionType = "remote_copy" // Copy a backup or archive to a remote destination
+	ActionTruncate   ActionType = "truncate"    // Empty a file in place (copy-truncate)
+	ActionPrune      ActionType = "prune"       // Delete a file, or move it to the trash
+)
+
+// Plan is the set of actions a cycle would take, computed by BuildPlan and executed by ApplyPlan.
+type Plan struct {
+	Version      int        `json:"version"`
+	CreatedAt    time.Time  `json:"created_at"`
+	TargetFolder string     `json:"target_folder"`
+	ConfigDigest string     `json:"config_digest"` // SHA-256 of the effective configuration
+	Scanned      int        `json:"scanned"`       // Files found in the target folder, selected or not
+	Files        []PlanFile `json:"files"`         // Selected files, oldest first
+	Actions      []Action   `json:"actions"`
+	Totals       PlanTotals `json:"totals"`
+
+	index map[actionKey][]int // Actions by file, type and destination, built by ApplyPlan
+	taken []bool              // Actions taken by ApplyPlan
+	sizes map[string]int64    // Planned file sizes by path, built by ApplyPlan
+}
+
+// actionKey identifies the action on a file at one destination.
+type actionKey struct {
+	typ         ActionType
+	path        string
+	destination string
+}
+
+// PlanFile is a selected file as it was when the plan was made.
+type PlanFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Time     time.Time `json:"time"`   // Timestamp from the configured age source
+	Reason   string    `json:"reason"` // Why the file was selected: age, max_total_bytes or min_free_percent
+	Symlink  bool      `json:"symlink,omitempty"`
+	Truncate bool      `json:"truncate,omitempty"`
+}
+
+// Action is one step of a plan.
+type Action struct {
+	Type        ActionType `json:"type"`
+	Path        string     `json:"path"`                  // File, or archive for remote copies of archives
+	Destination string     `json:"destination,omitempty"` // Backup file, archive, remote or trash directory
+	Files       []string   `json:"files,omitempty"`       // Files added to an archive
+	Size        int64      `json:"size"`                  // Bytes read or freed
+	Rule        string     `json:"rule,omitempty"`
+	Compressed  bool       `json:"compressed,omitempty"`
+	Merge       bool       `json:"merge,omitempty"` // The archive exists and is merged
+}
+
+// PlanTotals summarizes a plan.
+type PlanTotals struct {
+	Files        int   `json:"files"`
+	Bytes        int64 `json:"bytes"`
+	Backups      int   `json:"backups"`
+	Archives     int   `json:"archives"`
+	RemoteCopies int   `json:"remote_copies"`
+	Truncates    int   `json:"truncates"`
+	Prunes       int   `json:"prunes"`
+	FreedBytes   int64 `json:"freed_bytes"` // Bytes freed by pruning and truncation
+}
+
+// BuildPlan computes the actions of a cycle without changing anything. Safety
+// limits apply as in RunBackup unless opts.Force is set; opts.DryRun is ignored.
+func BuildPlan(ctx context.Context, cfg *config.Config, opts *RunOptions, log *slog.Logger) (*Plan, *Result, error) {
+	digest, err := configDigest(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	runOpts := RunOptions{}
+	if opts != nil {
+		runOpts = *opts
+	}
+	plan := &Plan{
+		Version:      PlanVersion,
+		CreatedAt:    runOpts.now().UTC(),
+		TargetFolder: cfg.TargetFolder,
+		ConfigDigest: digest,
+		Files:        make([]PlanFile, 0),
+		Actions:      make([]Action, 0),
+	}
+
+	runOpts.DryRun = true
+	runOpts.recorder = plan
+	result, err := RunBackup(ctx, cfg, &runOpts, log)
+	plan.total()
+	return plan, result, err
+}
+
+// ApplyPlan executes a plan made by BuildPlan. The whole plan is refused if the
+// configuration or target folder changed since planning. A file that changed
+// since planning is recorded as an error and none of its actions are taken.
+// Only the planned actions are taken: an action removed from the plan is skipped,
+// so a reviewer can veto a prune by deleting it, and an action that would differ
+// from the planned one is refused and recorded as an error. A file whose backups
+// are all skipped or refused is not pruned. Copies pending in the outbox, empty
+// directories and the trash are left for the next regular cycle.
+func ApplyPlan(ctx context.Context, cfg *config.Config, plan *Plan, opts *RunOptions, log *slog.Logger) (*Result, error) {
+	if plan.Version != PlanVersion {
+		return NewResult(), fmt.Errorf("unsupported plan version %d", plan.Version)
+	}
+	digest, err := configDigest(cfg)
+	if err != nil {
+		return NewResult(), err
+	}
+	if plan.TargetFolder != cfg.TargetFolder {
+		return NewResult(), fmt.Errorf("%w: planned for target_folder %s", ErrPlanMismatch, plan.TargetFolder)
+	}
+	if plan.ConfigDigest != digest {
+		return NewResult(), fmt.Errorf("%w: the configuration changed since planning", ErrPlanMismatch)
+	}
+
+	runOpts := RunOptions{}
+	if opts != nil {
+		runOpts = *opts
+	}
+	plan.index = make(map[actionKey][]int, len(plan.Actions))
+	for i, a := range plan.Actions {
+		key := actionKey{a.Type, a.Path, a.Destination}
+		plan.index[key] = append(plan.index[key], i)
+	}
+	plan.taken = make([]bool, len(plan.Actions))
+	plan.sizes = make(map[string]int64, len(plan.Files))
+	for _, f := range plan.Files {
+		plan.sizes[f.Path] = f.Size
+	}
+
+	runOpts.plan = plan
+	result, err := RunBackup(ctx, cfg, &runOpts, log)
+	for i, a := range plan.Actions {
+		if !plan.taken[i] {
+			log.Warn("planned action not taken",
+				slog.String("type", string(a.Type)),
+				slog.String("path", a.Path),
+				slog.String("destination", a.Destination),
+			)
+		}
+	}
+	return result, err
+}
+
+// ReadPlan reads a plan written as JSON.
+func ReadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(data, plan); err != nil {
+		return nil, fmt.Errorf("read plan %s: %w", path, err)
+	}
+	return plan, nil
+}
+
+// configDigest returns the SHA-256 of the effective configuration.
+func configDigest(cfg *config.Config) (string, error) {
+	data, err := json.Marshal(cfg.Effective())
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// record adds an action to the plan being built, if any.
+func (o *RunOptions) record(a Action) {
+	if o.recorder != nil {
+		o.recorder.Actions = append(o.recorder.Actions, a)
+	}
+}
+
+// allowed reports whether the cycle may take action a. Without a plan being applied
+// every action is allowed. Otherwise a is allowed only if the plan holds the same
+// action; an action that is not in the plan is skipped, and one that differs from
+// the planned action for its file and destination is refused and recorded.
+func (o *RunOptions) allowed(a Action, result *Result, log *slog.Logger) bool {
+	p := o.plan
+	if p == nil {
+		return true
+	}
+	planned := p.index[actionKey{a.Type, a.Path, a.Destination}]
+	for _, i := range planned {
+		if sameAction(p.Actions[i], a) {
+			p.taken[i] = true
+			return true
+		}
+	}
+	attrs := []any{
+		slog.String("type", string(a.Type)),
+		slog.String("path", a.Path),
+		slog.String("destination", a.Destination),
+	}
+	if len(planned) == 0 {
+		log.Info("action not in the plan, skipped", attrs...)
+		return false
+	}
+	log.Warn("action differs from the plan, refused", attrs...)
+	result.AddError(a.Path, "plan", fmt.Errorf("%w: %s to %s", ErrActionRefused, a.Type, a.Destination))
+	return false
+}
+
+// size returns the size of c in its actions: the planned size when a plan is applied,
+// which a copy-truncate snapshot may exceed by what was written meanwhile.
+func (o *RunOptions) size(c pruner.Candidate) int64 {
+	if o.plan != nil {
+		if size, ok := o.plan.sizes[c.Path]; ok {
+			return size
+		}
+	}
+	return c.Info.Size()
+}
+
+// sameAction reports whether two actions are equal; no files and an empty list are the same.
+func sameAction(a, b Action) bool {
+	if len(a.Files) != len(b.Files) {
+		return false
+	}
+	for i := range a.Files {
+		if a.Files[i] != b.Files[i] {
+			return false
+		}
+	}
+	return a.Type == b.Type && a.Path == b.Path && a.Destination == b.Destination && a.Size == b.Size &&
+		a.Rule == b.Rule && a.Compressed == b.Compressed && a.Merge == b.Merge
+}
+
+// addFiles records the selected files.
+func (p *Plan) addFiles(candidates []pruner.Candidate, scanned int) {
+	p.Scanned = scanned
+	for _, c := range candidates {
+		p.Files = append(p.Files, PlanFile{
+			Path:     c.Path,
+			Size:     c.Info.Size(),
+			ModTime:  c.Info.ModTime(),
+			Time:     c.Time,
+			Reason:   c.Reason,
+			Symlink:  c.Info.Mode()&os.ModeSymlink != 0,
+			Truncate: c.Truncate,
+		})
+	}
+}
+
+// addPrunes records the prune or truncate action of each candidate.
+// trashDir is the trash directory pruned files are moved to, if enabled.
+func (p *Plan) addPrunes(candidates []pruner.Candidate, trashDir string) {
+	for _, c := range candidates {
+		p.Actions = append(p.Actions, pruneAction(c, trashDir))
+	}
+}
+
+// pruneAction returns the prune or truncate action of c.
+func pruneAction(c pruner.Candidate, trashDir string) Action {
+	a := Action{Type: ActionPrune, Path: c.Path, Destination: trashDir, Size: c.Info.Size(), Rule: c.Rule.DisplayName()}
+	if c.Truncate {
+		a.Type = ActionTruncate
+		a.Destination = ""
+	}
+	return a
+}
+
+// total computes the plan totals.
+func (p *Plan) total() {
+	t := PlanTotals{Files: len(p.Files)}
+	for _, f := range p.Files {
+		t.Bytes += f.Size
+	}
+	for _, a := range p.Actions {
+		switch a.Type {
+		case ActionBackup:
+			t.Backups++
+		case ActionArchive:
+			t.Archives++
+		case ActionRemoteCopy:
+			t.RemoteCopies++
+		case ActionTruncate:
+			t.Truncates++
+			t.FreedBytes += a.Size
+		case ActionPrune:
+			t.Prunes++
+			t.FreedBytes += a.Size
+		}
+	}
+	p.Totals = t
+}
+
+// candidates returns the planned files that are unchanged since planning, with
+// their rule matched again. Changed or missing files are recorded as errors.
+func (p *Plan) candidates(cfg *config.Config, ruleSet *rules.Set, log *slog.Logger) ([]pruner.Candidate, *pruner.Result) {
+	result := pruner.NewResult()
+	candidates := make([]pruner.Candidate, 0, len(p.Files))
+	for _, f := range p.Files {
+		stat := os.Stat
+		if f.Symlink {
+			stat = os.Lstat
+		}
+		info, err := stat(f.Path)
+		if err == nil && (info.Size() != f.Size || !info.ModTime().Equal(f.ModTime)) {
+			err = fmt.Errorf("size %d, modified %s; planned size %d, modified %s",
+				info.Size(), info.ModTime().Format(time.RFC3339Nano), f.Size, f.ModTime.Format(time.RFC3339Nano))
+		}
+		if err != nil {
+			log.Warn("planned file changed, actions refused",
+				slog.String("path", f.Path),
+				slog.String("error", err.Error()),
+			)
+			result.AddError(f.Path, "plan", fmt.Errorf("%w: %v", ErrFileChanged, err))
+			continue
+		}
+
+		relPath, err := filepath.Rel(cfg.TargetFolder, f.Path)
+		if err != nil {
+			result.AddError(f.Path, "path", err)
+			continue
+		}
+		candidates = append(candidates, pruner.Candidate{
+			Path:     f.Path,
+			Info:     info,
+			Time:     f.Time,
+			Rule:     ruleSet.Match(relPath),
+			Reason:   f.Reason,
+			Truncate: f.Truncate,
+		})
+	}
+	return candidates, result
+}
+
+// memberPaths returns the paths of the files of an archive.
+func memberPaths(members []pruner.Candidate) []string {
+	paths := make([]string, len(members))
+	for i, c := range members {
+		paths[i] = c.Path
+	}
+	return paths
+}
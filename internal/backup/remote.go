@@ -0,0 +1,492 @@
+package backup
+
+import (
+	"context"
+	"filekeeper/internal/config"
+	"filekeeper/internal/outbox"
+	"filekeeper/internal/pruner"
+	"filekeeper/pkg/compression"
+	"filekeeper/pkg/ratelimit"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// remoteCopier makes the remote copies of a cycle. Each copy is retried with backoff;
+// files whose copy to a required remote still fails are kept, and with the outbox
+// enabled, those copies are queued and retried in later cycles. Copies to a
+// BatchDestination are collected and sent together by flush.
+type remoteCopier struct {
+	retry   *outbox.Config
+	box     *outbox.Outbox          // Pending copies; nil without the outbox
+	queued  map[string]outbox.Entry // Files that had pending copies when the cycle started
+	down    map[string]error        // Destinations that failed every try in this cycle
+	batches map[batchKey]*batch
+	order   []batchKey         // Batches in the order of their first copy
+	copied  map[string]string  // First destination each file or archive was delivered to in this cycle
+	missing map[string]bool    // Files and archives whose copy to a required remote failed in this cycle
+	spools  map[string]*spool  // Compressed streams of the current flush, by source
+	read    *ratelimit.Limiter // Reads of streamed files
+	dryRun  bool
+	log     *slog.Logger
+	result  *Result
+}
+
+// batchKey identifies a batch; file and archive copies to a destination are sent
+// separately, as they may differ in the metadata they keep.
+type batchKey struct {
+	destination string
+	archive     bool
+}
+
+// batch holds the copies queued for a BatchDestination.
+type batch struct {
+	dest  BatchDestination
+	items []batchItem
+}
+
+type batchItem struct {
+	entry outbox.Entry
+	bytes int64 // Size of the copy; for compressed streams, known once flush spooled it
+	err   error // Error of the last try
+}
+
+// spool is a compressed stream written to a temporary file, so that it is compressed
+// once for every destination and retry of a flush; a tar header needs its size up front.
+type spool struct {
+	path string
+	size int64
+	err  error
+}
+
+// newRemoteCopier loads the outbox, if enabled, and returns the copier of a cycle.
+func newRemoteCopier(cfg *config.Config, opts *RunOptions, log *slog.Logger, result *Result) (*remoteCopier, error) {
+	retry := cfg.GetRemoteRetryConfig()
+	r := &remoteCopier{
+		retry:   retry,
+		queued:  make(map[string]outbox.Entry),
+		down:    make(map[string]error),
+		batches: make(map[batchKey]*batch),
+		copied:  make(map[string]string),
+		missing: make(map[string]bool),
+		spools:  make(map[string]*spool),
+		read:    opts.limits.ReadLimiter(),
+		dryRun:  opts.DryRun,
+		log:     log,
+		result:  result,
+	}
+	if !retry.Outbox {
+		return r, nil
+	}
+	box, err := outbox.Load(retry.Path)
+	if err != nil {
+		return nil, err
+	}
+	r.box = box
+	for _, e := range box.Entries() {
+		r.queued[e.Path] = e
+	}
+	return r, nil
+}
+
+// copy copies e.Source to remote, retrying on failure, and records the outcome.
+// bytes is the size of the copy. A copy that fails every try is counted as a
+// failed file and queued in the outbox, if enabled; the destination is then not
+// tried again in this cycle, and its further copies are queued right away.
+// Copies to a BatchDestination are only queued for flush.
+func (r *remoteCopier) copy(ctx context.Context, remote Destination, e outbox.Entry, bytes int64) error {
+	if err := r.down[remote.Name()]; err != nil {
+		r.failed(remote, e, err, 0)
+		return err
+	}
+	b, ok := remote.(BatchDestination)
+	if !ok && e.Streamed && e.Compression != nil {
+		err := fmt.Errorf("destination takes files only, compressed copies need a local backup path")
+		r.failed(remote, e, err, 0)
+		return err
+	}
+	if ok {
+		key := batchKey{destination: remote.Name(), archive: e.Archive}
+		if r.batches[key] == nil {
+			r.batches[key] = &batch{dest: b}
+			r.order = append(r.order, key)
+		}
+		r.batches[key].items = append(r.batches[key].items, batchItem{entry: e, bytes: bytes})
+		return nil
+	}
+
+	start := time.Now()
+	tries := 0
+	err := r.retry.Retry(ctx, func() error {
+		tries++
+		err := remote.Copy(ctx, e.Source, e.RelPath)
+		if err != nil && tries < r.retry.Attempts && ctx.Err() == nil {
+			r.log.Debug("remote copy failed, retrying",
+				slog.String("source", e.Source),
+				slog.String("remote", remote.Name()),
+				slog.Int("attempt", tries),
+				slog.Duration("backoff", r.retry.Backoff(tries)),
+				slog.String("error", err.Error()),
+			)
+		}
+		return err
+	})
+	if err == nil {
+		r.succeeded(remote, e, bytes, tries, time.Since(start))
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	r.failed(remote, e, err, tries)
+	return err
+}
+
+// flush sends the queued copies of each BatchDestination, retrying the copies that
+// failed, and records the outcome of each copy.
+func (r *remoteCopier) flush(ctx context.Context) error {
+	defer r.removeSpools()
+	for _, key := range r.order {
+		b := r.batches[key]
+		delete(r.batches, key)
+
+		start := time.Now()
+		pending, err := r.prepare(ctx, b)
+		if err != nil {
+			return err
+		}
+		tries := 0
+		err = r.retry.Retry(ctx, func() error {
+			tries++
+			files := make([]BatchFile, len(pending))
+			for i, item := range pending {
+				files[i] = r.batchFile(item)
+			}
+			errs := b.dest.CopyBatch(ctx, files)
+			if len(errs) != len(files) {
+				err := fmt.Errorf("%s returned %d results for %d files", b.dest.Name(), len(errs), len(files))
+				errs = make([]error, len(files))
+				for i := range errs {
+					errs[i] = err
+				}
+			}
+
+			var failed []batchItem
+			for i, item := range pending {
+				if errs[i] == nil {
+					r.succeeded(b.dest, item.entry, item.bytes, tries, time.Since(start))
+					continue
+				}
+				item.err = errs[i]
+				failed = append(failed, item)
+			}
+			pending = failed
+			if len(pending) == 0 {
+				return nil
+			}
+			if tries < r.retry.Attempts && ctx.Err() == nil {
+				r.log.Debug("remote batch failed, retrying",
+					slog.String("remote", b.dest.Name()),
+					slog.Int("failed", len(pending)),
+					slog.Int("attempt", tries),
+					slog.Duration("backoff", r.retry.Backoff(tries)),
+					slog.String("error", pending[0].err.Error()),
+				)
+			}
+			return pending[0].err
+		})
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, item := range pending {
+			r.failed(b.dest, item.entry, item.err, tries)
+		}
+
+		r.log.Info("sent batch to remote backup",
+			slog.String("remote", b.dest.Name()),
+			slog.Int("files", len(b.items)),
+			slog.Int("failed", len(pending)),
+			slog.Int("attempts", tries),
+			slog.Duration("duration", time.Since(start)),
+		)
+	}
+	r.order = nil
+	return nil
+}
+
+// prepare returns the items of b, with each compressed stream spooled and its size
+// set. Items whose file cannot be read are recorded as failed and left out.
+func (r *remoteCopier) prepare(ctx context.Context, b *batch) ([]batchItem, error) {
+	items := make([]batchItem, 0, len(b.items))
+	for _, item := range b.items {
+		if !item.entry.Streamed || item.entry.Compression == nil {
+			items = append(items, item)
+			continue
+		}
+		sp, err := r.spool(ctx, item.entry)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			r.failed(b.dest, item.entry, err, 0)
+			continue
+		}
+		item.bytes = sp.size
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// spool compresses the file of e to a temporary file, unless this flush already did.
+func (r *remoteCopier) spool(ctx context.Context, e outbox.Entry) (*spool, error) {
+	if sp, ok := r.spools[e.Source]; ok {
+		return sp, sp.err
+	}
+	sp := &spool{}
+	f, err := os.CreateTemp("", "filekeeper-stream-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temporary file: %w", err)
+	}
+	sp.path = f.Name()
+	res, err := compression.CompressStream(ctx, f, e.Source, e.Compression, r.read)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("close temporary file: %w", closeErr)
+	}
+	if err != nil {
+		os.Remove(sp.path)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		sp.err = err
+	} else {
+		sp.size = res.CompressedSize
+	}
+	r.spools[e.Source] = sp
+	return sp, sp.err
+}
+
+// removeSpools removes the temporary files of the current flush.
+func (r *remoteCopier) removeSpools() {
+	for source, sp := range r.spools {
+		if sp.err == nil {
+			os.Remove(sp.path)
+		}
+		delete(r.spools, source)
+	}
+}
+
+// batchFile returns the BatchFile of item. Compressed streams are read from their spool.
+func (r *remoteCopier) batchFile(item batchItem) BatchFile {
+	e := item.entry
+	f := BatchFile{Source: e.Source, RelPath: e.RelPath}
+	if sp := r.spools[e.Source]; e.Streamed && e.Compression != nil && sp != nil {
+		f.Size = item.bytes
+		f.Open = func() (io.ReadCloser, error) {
+			return os.Open(sp.path)
+		}
+	}
+	return f
+}
+
+// succeeded records a delivered copy and removes it from the outbox.
+func (r *remoteCopier) succeeded(remote Destination, e outbox.Entry, bytes int64, tries int, elapsed time.Duration) {
+	if r.box != nil {
+		r.box.Remove(remote.Name(), e.Path)
+	}
+	if _, ok := r.copied[e.Path]; !ok {
+		r.copied[e.Path] = remote.Name()
+	}
+	r.result.RemoteCopied++
+	r.result.addCopy(remote.Name(), true, true, bytes)
+	r.log.Info("copied to remote backup",
+		slog.String("source", e.Source),
+		slog.String("remote", remote.Name()),
+		slog.Int("attempts", tries),
+		slog.Duration("duration", elapsed),
+	)
+}
+
+// failed records a copy that failed every try and queues it in the outbox, if enabled.
+// A file whose copy to a required remote failed is kept, with or without the outbox.
+func (r *remoteCopier) failed(remote Destination, e outbox.Entry, err error, tries int) {
+	if r.retry.Required(remote.Name()) {
+		r.missing[e.Path] = true
+	}
+	if r.box != nil {
+		r.down[remote.Name()] = err
+	}
+	r.result.RemoteFailed++
+	r.result.addCopy(remote.Name(), true, false, 0)
+	r.result.AddError(e.Path, "remote_copy", fmt.Errorf("%s: %w", remote.Name(), err))
+	attrs := []any{
+		slog.String("source", e.Source),
+		slog.String("remote", remote.Name()),
+		slog.Int("attempts", tries),
+		slog.String("error", err.Error()),
+	}
+	if r.box == nil {
+		r.log.Warn("remote backup failed", attrs...)
+		return
+	}
+	e.Destination = remote.Name()
+	e.Attempts = tries
+	e.QueuedAt = time.Now()
+	e.LastError = err.Error()
+	r.box.Add(e)
+	r.log.Warn("remote backup failed, queued in outbox", attrs...)
+}
+
+// drain retries the copies queued in earlier cycles. files and archives are the
+// destinations of file and archive copies. Entries whose destination is no longer
+// configured or whose local copy is gone are dropped.
+func (r *remoteCopier) drain(ctx context.Context, files, archives []Destination) error {
+	if r.box == nil || r.box.Len() == 0 {
+		return nil
+	}
+	r.log.Info("retrying pending remote copies", slog.Int("pending", r.box.Len()))
+
+	for _, e := range r.box.Entries() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dests := files
+		if e.Archive {
+			dests = archives
+		}
+		remote := findDestination(dests, e.Destination)
+		if remote == nil {
+			r.log.Warn("dropping pending remote copy, destination no longer configured",
+				slog.String("path", e.Path),
+				slog.String("remote", e.Destination),
+			)
+			r.box.Remove(e.Destination, e.Path)
+			continue
+		}
+		info, err := os.Stat(e.Source)
+		if err != nil {
+			r.log.Warn("dropping pending remote copy, local copy is gone",
+				slog.String("path", e.Path),
+				slog.String("source", e.Source),
+				slog.String("remote", e.Destination),
+			)
+			r.box.Remove(e.Destination, e.Path)
+			continue
+		}
+		// A streamed file that changed is backed up again as a new file
+		if e.Streamed && !e.Matches(info) {
+			r.log.Info("dropping pending remote copy, file changed",
+				slog.String("path", e.Path),
+				slog.String("remote", e.Destination),
+			)
+			r.box.Remove(e.Destination, e.Path)
+			continue
+		}
+
+		if r.dryRun {
+			r.log.Info("[DRY-RUN] would retry remote copy",
+				slog.String("source", e.Source),
+				slog.String("remote", e.Destination),
+				slog.Int("attempts", e.Attempts),
+			)
+			r.box.Remove(e.Destination, e.Path)
+			continue
+		}
+		if err := r.copy(ctx, remote, e, info.Size()); err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// pending reports whether c was backed up in an earlier cycle and is unchanged, so
+// it only waits for its queued remote copies and needs no new backup. Queued copies
+// of a file that changed since are dropped; the file is backed up again, as is a
+// file whose copies were all dropped by drain.
+func (r *remoteCopier) pending(c pruner.Candidate) bool {
+	e, ok := r.queued[c.Path]
+	if !ok {
+		return false
+	}
+	if !e.Matches(c.Info) {
+		r.forget(c.Path)
+		return false
+	}
+	return r.copied[c.Path] != "" || len(r.box.Pending(c.Path)) > 0
+}
+
+// deliveredTo returns the first destination path was delivered to in this cycle,
+// or "" if none.
+func (r *remoteCopier) deliveredTo(path string) string {
+	return r.copied[path]
+}
+
+// forget drops the pending copies of a file that changed since it was queued.
+func (r *remoteCopier) forget(path string) {
+	if r.box == nil {
+		return
+	}
+	for _, e := range r.box.Pending(path) {
+		r.box.Remove(e.Destination, e.Path)
+	}
+}
+
+// blocked reports whether path has a copy to a required remote that failed in this
+// cycle or is pending in the outbox.
+func (r *remoteCopier) blocked(path string) bool {
+	if r.missing[path] {
+		return true
+	}
+	if r.box == nil {
+		return false
+	}
+	for _, e := range r.box.Pending(path) {
+		if r.retry.Required(e.Destination) {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverable returns the candidates without failed or pending copies to a required remote.
+// It is called after flush.
+func (r *remoteCopier) deliverable(candidates []pruner.Candidate) []pruner.Candidate {
+	kept := make([]pruner.Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if r.blocked(c.Path) {
+			r.log.Info("file kept until its remote copies are delivered", slog.String("path", c.Path))
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// save writes the outbox and records its depth in the result.
+func (r *remoteCopier) save() error {
+	if r.box == nil {
+		return nil
+	}
+	r.result.OutboxPending = r.box.Len()
+	if r.dryRun {
+		return nil
+	}
+	if err := r.box.Save(); err != nil {
+		return err
+	}
+	if r.box.Len() > 0 {
+		r.log.Warn("remote copies pending in outbox", slog.Int("pending", r.box.Len()))
+	}
+	return nil
+}
+
+// findDestination returns the destination named name, or nil.
+func findDestination(dests []Destination, name string) Destination {
+	for _, d := range dests {
+		if d.Name() == name {
+			return d
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// ReportVersion is the version of the report format written by NewReport.
+const ReportVersion = 1
+
+// Status is the overall outcome of a cycle.
+type Status string
+
+const (
+	StatusSuccess           Status = "success"            // Every file was processed
+	StatusPartialFailure    Status = "partial_failure"    // Some files or remote copies failed
+	StatusThresholdExceeded Status = "threshold_exceeded" // The cycle stopped at error_threshold_percent
+	StatusFailed            Status = "failed"             // The cycle stopped early, for example at a safety limit
+	StatusInterrupted       Status = "interrupted"        // The cycle was cut short by shutdown
+	StatusConfigError       Status = "config_error"       // The configuration could not be loaded; set by the caller
+)
+
+// CycleStatus returns the status of a cycle from its result and error.
+func CycleStatus(result *Result, err error) Status {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return StatusInterrupted
+	case errors.Is(err, ErrThresholdExceeded):
+		return StatusThresholdExceeded
+	case err != nil:
+		return StatusFailed
+	case result != nil && (result.HasErrors() || result.RemoteFailed > 0):
+		return StatusPartialFailure
+	default:
+		return StatusSuccess
+	}
+}
+
+// Report is the outcome of one cycle in a form that serializes to JSON.
+type Report struct {
+	Version      int                 `json:"version"`
+	Status       Status              `json:"status"`
+	Error        string              `json:"error,omitempty"` // Error that stopped the cycle
+	StartedAt    time.Time           `json:"started_at"`
+	FinishedAt   time.Time           `json:"finished_at"`
+	DurationMS   int64               `json:"duration_ms"`
+	Hostname     string              `json:"hostname,omitempty"`
+	TargetFolder string              `json:"target_folder,omitempty"`
+	DryRun       bool                `json:"dry_run"`
+	Files        ReportFiles         `json:"files"`
+	Bytes        ReportBytes         `json:"bytes"`
+	Destinations []DestinationResult `json:"destinations"`
+	Archives     []ArchiveInfo       `json:"archives"`
+	Errors       []FileError         `json:"errors"`
+}
+
+// ReportFiles counts the files of a cycle.
+type ReportFiles struct {
+	Succeeded          int     `json:"succeeded"`
+	Failed             int     `json:"failed"`
+	FailureRatePercent float64 `json:"failure_rate_percent"`
+	Skipped            int     `json:"skipped"`
+	InUse              int     `json:"in_use"`
+	BackedUp           int     `json:"backed_up"`
+	Pruned             int     `json:"pruned"`
+	Truncated          int     `json:"truncated"`
+	DirsRemoved        int     `json:"dirs_removed"`
+	TrashPurged        int     `json:"trash_purged"`
+	RemoteCopied       int     `json:"remote_copied"`
+	RemoteFailed       int     `json:"remote_failed"`
+	OutboxPending      int     `json:"outbox_pending"`
+	SnapshotPending    int     `json:"snapshot_pending"`
+}
+
+// ReportBytes sums the bytes of a cycle.
+type ReportBytes struct {
+	Total      int64 `json:"total"`      // Size of the files processed
+	Original   int64 `json:"original"`   // Size of the files before compression
+	Compressed int64 `json:"compressed"` // Size written after compression
+	Truncated  int64 `json:"truncated"`  // Bytes reclaimed by copy-truncate
+	Archive    int64 `json:"archive"`    // Size of the archives created or updated
+}
+
+// NewReport builds the report of a cycle that started at startedAt and ended
+// now with result and err. result may be nil if the cycle did not start.
+func NewReport(result *Result, err error, startedAt time.Time) *Report {
+	if result == nil {
+		result = NewResult()
+	}
+	finishedAt := time.Now()
+	hostname, _ := os.Hostname()
+
+	r := &Report{
+		Version:    ReportVersion,
+		Status:     CycleStatus(result, err),
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: finishedAt.UTC(),
+		DurationMS: finishedAt.Sub(startedAt).Milliseconds(),
+		Hostname:   hostname,
+		Files: ReportFiles{
+			Succeeded:          result.Succeeded,
+			Failed:             result.Failed,
+			FailureRatePercent: result.FailureRate(),
+			Skipped:            result.Skipped,
+			InUse:              result.InUse,
+			BackedUp:           result.BackedUp,
+			Pruned:             result.Pruned,
+			Truncated:          result.Truncated,
+			DirsRemoved:        result.DirsRemoved,
+			TrashPurged:        result.TrashPurged,
+			RemoteCopied:       result.RemoteCopied,
+			RemoteFailed:       result.RemoteFailed,
+			OutboxPending:      result.OutboxPending,
+			SnapshotPending:    result.SnapshotPending,
+		},
+		Bytes: ReportBytes{
+			Total:      result.TotalBytes,
+			Original:   result.OriginalBytes,
+			Compressed: result.CompressedBytes,
+			Truncated:  result.TruncatedBytes,
+			Archive:    result.ArchiveSize,
+		},
+		Destinations: result.Destinations,
+		Archives:     result.Archives,
+		Errors:       result.Errors,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	// Lists are written as [] rather than null
+	if r.Destinations == nil {
+		r.Destinations = []DestinationResult{}
+	}
+	if r.Archives == nil {
+		r.Archives = []ArchiveInfo{}
+	}
+	if r.Errors == nil {
+		r.Errors = []FileError{}
+	}
+	return r
+}
@@ -1,10 +1,40 @@
 package backup
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/archive"
+	"filekeeper/internal/pruner"
+	"filekeeper/internal/safety"
+	"filekeeper/pkg/ratelimit"
+	"fmt"
+	"time"
+)
+
+// ErrThresholdExceeded is returned when the failure rate exceeds error_threshold_percent.
+var ErrThresholdExceeded = pruner.ErrThresholdExceeded
+
+// ErrAllArchivesFailed is returned when no archive could be created in any backup destination.
+var ErrAllArchivesFailed = errors.New("all archive creations failed")
+
+// ErrSafetyLimit is returned when a cycle is aborted by a safety limit before anything was changed.
+var ErrSafetyLimit = safety.ErrLimitExceeded
 
 // RunOptions contains runtime options for the backup process.
 type RunOptions struct {
 	DryRun bool // If true, show what would be done without doing it
+	Force  bool // If true, safety limits and denied roots are not enforced
+
+	Now          func() time.Time  // Clock for file ages, trash batches and plans (nil = time.Now)
+	Remove       pruner.RemoveFunc // Deletes pruned files when the trash is disabled (nil = os.Remove)
+	Destinations []Destination     // Receive copies in addition to remote_backups
+	Hooks        Hooks             // Called as files are backed up, pruned or fail
+
+	recorder *Plan             // Plan the actions of a dry run are recorded in, set by BuildPlan
+	plan     *Plan             // Plan whose files are processed instead of selecting them, set by ApplyPlan
+	commands *commandHooks     // Hook commands of the configuration, set by RunBackup
+	limits   *ratelimit.Limits // Bandwidth limits of the configuration, set by RunBackup
+	remote   *remoteCopier     // Remote copies with retries and the outbox, set by RunBackup
 }
 
 // ShouldExecute returns true if actual operations should be performed.
@@ -12,6 +42,45 @@ func (o *RunOptions) ShouldExecute() bool {
 	return !o.DryRun
 }
 
+// now returns the current time of the clock.
+func (o *RunOptions) now() time.Time {
+	if o.Now != nil {
+		return o.Now()
+	}
+	return time.Now()
+}
+
+// backedUp calls the OnFileBackedUp hook and the on_file_backed_up hook commands, if any.
+// destination is the first local copy or archive of the file.
+func (o *RunOptions) backedUp(c pruner.Candidate, destination string) {
+	if o.DryRun {
+		return
+	}
+	if o.Hooks.OnFileBackedUp != nil {
+		o.Hooks.OnFileBackedUp(candidateEvent(c))
+	}
+	if o.commands != nil {
+		o.commands.fileBackedUp(c, destination)
+	}
+}
+
+// fileError calls the OnError hook and the on_error hook commands, if any.
+func (o *RunOptions) fileError(e FileError) {
+	if o.Hooks.OnError != nil {
+		o.Hooks.OnError(e)
+	}
+	if o.commands != nil {
+		o.commands.fileError(e)
+	}
+}
+
+// pruned calls the OnFilePruned hook, if any.
+func (o *RunOptions) pruned(c pruner.Candidate) {
+	if o.Hooks.OnFilePruned != nil {
+		o.Hooks.OnFilePruned(candidateEvent(c))
+	}
+}
+
 // FileError represents an error that occurred while processing a specific file.
 type FileError struct {
 	Path      string
@@ -23,20 +92,64 @@ func (e FileError) Error() string {
 	return fmt.Sprintf("%s failed for %s: %v", e.Operation, e.Path, e.Err)
 }
 
+// MarshalJSON encodes the error with its message, since error values do not serialize.
+func (e FileError) MarshalJSON() ([]byte, error) {
+	message := ""
+	if e.Err != nil {
+		message = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		Path      string `json:"path"`
+		Operation string `json:"operation"`
+		Message   string `json:"message"`
+	}{e.Path, e.Operation, message})
+}
+
 // Result represents the outcome of a backup or prune operation.
 type Result struct {
 	Succeeded       int
 	Failed          int
 	Skipped         int
+	InUse           int // Files deferred to the next cycle because they were still being written
 	Errors          []FileError
 	TotalBytes      int64
 	BackedUp        int
 	Pruned          int
+	Truncated       int   // Files emptied in place by copy-truncate
+	TruncatedBytes  int64 // Bytes reclaimed by copy-truncate
+	DirsRemoved     int   // Empty directories removed after pruning
+	TrashPurged     int   // Trashed files removed after their grace period
 	RemoteCopied    int
-	OriginalBytes   int64  // Total original bytes before compression
-	CompressedBytes int64  // Total compressed bytes (if compression enabled)
-	ArchiveSize     int64  // Size of created archive (if archive mode enabled)
-	ArchivePath     string // Path to created archive (if archive mode enabled)
+	RemoteFailed    int                 // Remote copies that failed every try, each also recorded as a remote_copy error
+	OutboxPending   int                 // Remote copies waiting in the outbox after the cycle
+	SnapshotPending int                 // Copy-truncate snapshots of earlier cycles left for the next regular cycle
+	OriginalBytes   int64               // Total original bytes before compression
+	CompressedBytes int64               // Total compressed bytes (if compression enabled)
+	ArchiveSize     int64               // Total size of archives created or updated (if archive mode enabled)
+	ArchivePath     string              // Path to the first archive created (if archive mode enabled)
+	Archives        []ArchiveInfo       // Every archive created or updated this cycle (if archive mode enabled)
+	Destinations    []DestinationResult // Outcome per local and remote destination, in configuration order
+
+	onError func(FileError) // Called for each recorded error
+}
+
+// ArchiveInfo describes one archive written during a cycle.
+type ArchiveInfo struct {
+	Path          string `json:"path"`
+	FilesArchived int    `json:"files_archived"` // Files added this cycle
+	MergedEntries int    `json:"merged_entries"` // Entries kept from an existing archive for the same period
+	OriginalBytes int64  `json:"original_bytes"` // Size of the files added this cycle
+	Size          int64  `json:"size"`           // Size of the archive after this cycle
+}
+
+// DestinationResult counts the copies written to one backup destination.
+// Archive mode counts archives, otherwise files.
+type DestinationResult struct {
+	Destination string `json:"destination"`
+	Remote      bool   `json:"remote"`
+	Succeeded   int    `json:"succeeded"`
+	Failed      int    `json:"failed"`
+	Bytes       int64  `json:"bytes"` // Bytes written, after compression
 }
 
 // NewResult creates a new empty Result.
@@ -48,7 +161,7 @@ func NewResult() *Result {
 
 // AddError records a file processing error.
 func (r *Result) AddError(path, operation string, err error) {
-	r.Errors = append(r.Errors, FileError{
+	r.addFileError(FileError{
 		Path:      path,
 		Operation: operation,
 		Err:       err,
@@ -56,6 +169,14 @@ func (r *Result) AddError(path, operation string, err error) {
 	r.Failed++
 }
 
+// addFileError appends an error and calls the error hook, if any.
+func (r *Result) addFileError(e FileError) {
+	r.Errors = append(r.Errors, e)
+	if r.onError != nil {
+		r.onError(e)
+	}
+}
+
 // AddSuccess records a successful file operation.
 func (r *Result) AddSuccess(bytes int64) {
 	r.Succeeded++
@@ -84,17 +205,92 @@ func (r *Result) Merge(other *Result) {
 	r.Succeeded += other.Succeeded
 	r.Failed += other.Failed
 	r.Skipped += other.Skipped
+	r.InUse += other.InUse
 	r.TotalBytes += other.TotalBytes
 	r.BackedUp += other.BackedUp
 	r.Pruned += other.Pruned
+	r.Truncated += other.Truncated
+	r.TruncatedBytes += other.TruncatedBytes
+	r.DirsRemoved += other.DirsRemoved
+	r.TrashPurged += other.TrashPurged
 	r.RemoteCopied += other.RemoteCopied
+	r.RemoteFailed += other.RemoteFailed
+	r.OutboxPending += other.OutboxPending
+	r.SnapshotPending += other.SnapshotPending
 	r.OriginalBytes += other.OriginalBytes
 	r.CompressedBytes += other.CompressedBytes
 	r.ArchiveSize += other.ArchiveSize
 	if other.ArchivePath != "" && r.ArchivePath == "" {
 		r.ArchivePath = other.ArchivePath
 	}
+	r.Archives = append(r.Archives, other.Archives...)
 	r.Errors = append(r.Errors, other.Errors...)
+	for _, d := range other.Destinations {
+		dest := r.destination(d.Destination, d.Remote)
+		dest.Succeeded += d.Succeeded
+		dest.Failed += d.Failed
+		dest.Bytes += d.Bytes
+	}
+}
+
+// destination returns the result of a destination, adding it if it is new.
+func (r *Result) destination(path string, remote bool) *DestinationResult {
+	for i := range r.Destinations {
+		if r.Destinations[i].Destination == path && r.Destinations[i].Remote == remote {
+			return &r.Destinations[i]
+		}
+	}
+	r.Destinations = append(r.Destinations, DestinationResult{Destination: path, Remote: remote})
+	return &r.Destinations[len(r.Destinations)-1]
+}
+
+// addCopy records a copy to a destination; bytes is ignored for failed copies.
+func (r *Result) addCopy(path string, remote, ok bool, bytes int64) {
+	dest := r.destination(path, remote)
+	if !ok {
+		dest.Failed++
+		return
+	}
+	dest.Succeeded++
+	dest.Bytes += bytes
+}
+
+// addArchive records the statistics of an archive written in this cycle.
+// Only growth of a merged archive counts toward CompressedBytes.
+func (r *Result) addArchive(a *archive.Result) {
+	r.Archives = append(r.Archives, ArchiveInfo{
+		Path:          a.ArchivePath,
+		FilesArchived: a.FilesArchived,
+		MergedEntries: a.MergedEntries,
+		OriginalBytes: a.TotalSize,
+		Size:          a.ArchiveSize,
+	})
+	if r.ArchivePath == "" {
+		r.ArchivePath = a.ArchivePath
+	}
+	r.ArchiveSize += a.ArchiveSize
+	r.OriginalBytes += a.TotalSize
+	r.CompressedBytes += a.ArchiveSize - a.PreviousSize
+}
+
+// mergePrune adds the skipped files and errors of a pruner Result.
+func (r *Result) mergePrune(other *pruner.Result) {
+	if other == nil {
+		return
+	}
+	r.Skipped += other.Skipped
+	r.Failed += other.Failed
+	r.Truncated += other.Truncated
+	r.TruncatedBytes += other.TruncatedBytes
+	r.DirsRemoved += other.DirsRemoved
+	// Convert pruner errors to backup errors
+	for _, e := range other.Errors {
+		r.addFileError(FileError{
+			Path:      e.Path,
+			Operation: e.Operation,
+			Err:       e.Err,
+		})
+	}
 }
 
 // CompressionRatio returns the compression ratio as a percentage.
@@ -0,0 +1,254 @@
+package backup
+
+import (
+	"context"
+	"filekeeper/internal/config"
+	"filekeeper/internal/pruner"
+	"filekeeper/internal/rules"
+	"filekeeper/pkg/metadata"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// snapshotDirPattern names the per-cycle directory holding copy-truncate snapshots.
+// Snapshots are kept under the file's directory relative to the target folder.
+const snapshotDirPattern = ".filekeeper-snapshot-*"
+
+// reasonSnapshot is the selection reason of a snapshot left by an earlier cycle.
+const reasonSnapshot = "snapshot"
+
+// snapshotCandidates copies each copy-truncate candidate that will be backed up to a
+// snapshot in dir and truncates the original in place. The candidate's Source is set to
+// the snapshot, so backups read the content as it was at truncation and pruning removes
+// the snapshot once it is backed up.
+// Candidates whose snapshot fails are dropped and left untouched for the next cycle.
+func snapshotCandidates(ctx context.Context, candidates []pruner.Candidate, dir string, cfg *config.Config, opts *RunOptions, log *slog.Logger, result *Result) ([]pruner.Candidate, error) {
+	kept := make([]pruner.Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		if !c.Truncate || c.Source != "" || !c.Rule.BackupEnabled() {
+			kept = append(kept, c)
+			continue
+		}
+
+		if opts.DryRun {
+			log.Info("[DRY-RUN] would copy-truncate file",
+				slog.String("path", c.Path),
+				slog.Int64("size_bytes", c.Info.Size()),
+			)
+			kept = append(kept, c)
+			continue
+		}
+
+		// When a plan is applied, only its truncations are made
+		if !opts.allowed(pruneAction(c, ""), result, log) {
+			continue
+		}
+
+		relPath, err := filepath.Rel(cfg.TargetFolder, c.Path)
+		if err != nil {
+			result.AddError(c.Path, "truncate", err)
+			continue
+		}
+		fileDir := filepath.Join(dir, filepath.Dir(relPath))
+		if err := os.MkdirAll(fileDir, 0755); err != nil {
+			result.AddError(c.Path, "truncate", fmt.Errorf("create snapshot directory: %w", err))
+			continue
+		}
+
+		snapshot, size, err := copyTruncate(c.Path, fileDir, cfg.PreserveMetadata)
+		if err != nil {
+			// After truncation the snapshot holds the only copy of the data, so it is left in place
+			log.Error("copy-truncate failed",
+				slog.String("path", c.Path),
+				slog.String("snapshot", snapshot),
+				slog.String("error", err.Error()),
+			)
+			result.AddError(c.Path, "truncate", err)
+			continue
+		}
+
+		info, err := os.Stat(snapshot)
+		if err != nil {
+			result.AddError(c.Path, "truncate", err)
+			continue
+		}
+
+		log.Info("truncated file",
+			slog.String("path", c.Path),
+			slog.String("snapshot", snapshot),
+			slog.Int64("reclaimed_bytes", size),
+		)
+		result.Truncated++
+		result.TruncatedBytes += size
+
+		c.Source = snapshot
+		c.Info = info
+		kept = append(kept, c)
+	}
+	return kept, nil
+}
+
+// leftoverSnapshots returns a candidate for each snapshot that an earlier cycle left in
+// the snapshot directories of backupPath, because its backup failed or the cycle was
+// interrupted, along with those directories. A candidate has the original file's path
+// and the snapshot as Source, so it is backed up like a fresh snapshot and the snapshot
+// is removed once backed up. Snapshots whose rule no longer backs them up are kept.
+func leftoverSnapshots(backupPath string, cfg *config.Config, ruleSet *rules.Set, log *slog.Logger) ([]pruner.Candidate, []string, error) {
+	dirs, err := filepath.Glob(filepath.Join(backupPath, snapshotDirPattern))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var candidates []pruner.Candidate
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			// Snapshots are named after the file with a random suffix
+			name := filepath.Base(rel)
+			i := strings.LastIndex(name, ".")
+			if i <= 0 || !d.Type().IsRegular() {
+				log.Warn("unknown file in snapshot directory kept", slog.String("path", path))
+				return nil
+			}
+			relPath := filepath.Join(filepath.Dir(rel), name[:i])
+
+			rule := ruleSet.Match(relPath)
+			if !rule.BackupEnabled() {
+				log.Warn("snapshot left by an earlier cycle kept, its rule does not back it up",
+					slog.String("snapshot", path),
+					slog.String("rule", rule.DisplayName()),
+				)
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			candidates = append(candidates, pruner.Candidate{
+				Path:     filepath.Join(cfg.TargetFolder, relPath),
+				Info:     info,
+				Time:     info.ModTime(),
+				Rule:     rule,
+				Reason:   reasonSnapshot,
+				Truncate: true,
+				Source:   path,
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("read snapshot directory %s: %w", dir, err)
+		}
+	}
+	return candidates, dirs, nil
+}
+
+// hasTruncate reports whether any candidate uses copy-truncate.
+func hasTruncate(candidates []pruner.Candidate) bool {
+	for _, c := range candidates {
+		if c.Truncate {
+			return true
+		}
+	}
+	return false
+}
+
+// removeSnapshotDir removes a snapshot directory once every snapshot was pruned.
+// Snapshots of files whose backup failed hold the only copy of their data and are kept.
+func removeSnapshotDir(dir string, log *slog.Logger) {
+	// Emptied subdirectories go first, deepest first
+	var subdirs []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.IsDir() && path != dir {
+			subdirs = append(subdirs, path)
+		}
+		return nil
+	})
+	for i := len(subdirs) - 1; i >= 0; i-- {
+		os.Remove(subdirs[i])
+	}
+	if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		log.Warn("copy-truncate snapshots kept for files whose backup failed",
+			slog.String("directory", dir),
+		)
+	}
+}
+
+// copyTruncate copies path to a new snapshot file in dir and truncates path to zero.
+// The bulk of the file is copied and synced first; then whatever the writer appended
+// meanwhile is copied, and the file is truncated right after that read reaches the end.
+// Only writes in the instant between that last read and the truncation can be lost,
+// as with logrotate's copytruncate. It returns the snapshot path and the bytes reclaimed.
+func copyTruncate(path, dir string, preserveMetadata bool) (string, int64, error) {
+	src, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+
+	// Metadata is read up front, before the copy and truncation change the times
+	var meta *metadata.Metadata
+	if preserveMetadata {
+		if meta, err = metadata.Read(path); err != nil {
+			return "", 0, err
+		}
+	}
+
+	dest, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return "", 0, fmt.Errorf("create snapshot: %w", err)
+	}
+	defer dest.Close()
+
+	fail := func(err error) (string, int64, error) {
+		dest.Close()
+		os.Remove(dest.Name())
+		return "", 0, err
+	}
+
+	size, err := io.Copy(dest, src)
+	if err != nil {
+		return fail(fmt.Errorf("copy to snapshot: %w", err))
+	}
+	if err := dest.Sync(); err != nil {
+		return fail(fmt.Errorf("sync snapshot: %w", err))
+	}
+
+	// Writes that landed during the copy and sync
+	tail, err := io.Copy(dest, src)
+	if err != nil {
+		return fail(fmt.Errorf("copy to snapshot: %w", err))
+	}
+	if err := src.Truncate(0); err != nil {
+		return fail(fmt.Errorf("truncate: %w", err))
+	}
+
+	// The original is now empty, so from here on the snapshot is kept even on error
+	size += tail
+	if err := dest.Sync(); err != nil {
+		return dest.Name(), size, fmt.Errorf("sync snapshot: %w", err)
+	}
+	if err := dest.Close(); err != nil {
+		return dest.Name(), size, fmt.Errorf("close snapshot: %w", err)
+	}
+	if err := metadata.Apply(dest.Name(), meta); err != nil {
+		return dest.Name(), size, err
+	}
+	return dest.Name(), size, nil
+}
@@ -1,13 +1,25 @@
 package config
 
 import (
-	"encoding/json"
 	"filekeeper/internal/archive"
+	"filekeeper/internal/duration"
+	"filekeeper/internal/filetime"
+	"filekeeper/internal/hooks"
+	"filekeeper/internal/inuse"
+	"filekeeper/internal/notify"
+	"filekeeper/internal/outbox"
+	"filekeeper/internal/pruner"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/safety"
+	"filekeeper/internal/trash"
 	"filekeeper/pkg/compression"
+	"filekeeper/pkg/ratelimit"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // CompressionConfig holds compression settings for backups.
@@ -22,22 +34,69 @@ type ArchiveConfig struct {
 	Enabled bool   `json:"enabled"`  // Enable archive mode (bundle files into single archive)
 	Format  string `json:"format"`   // Archive format: "tar", "tar.gz", "zip"
 	GroupBy string `json:"group_by"` // Group files by: "daily", "weekly", "monthly"
+
+	Reproducible  bool   `json:"reproducible"`    // Normalize entry headers for byte-identical archives
+	UID           *int   `json:"uid,omitempty"`   // Owner uid recorded in tar entries
+	GID           *int   `json:"gid,omitempty"`   // Owner gid recorded in tar entries
+	Uname         string `json:"uname,omitempty"` // Owner user name recorded in tar entries
+	Gname         string `json:"gname,omitempty"` // Owner group name recorded in tar entries
+	ModeMask      string `json:"mode_mask"`       // Octal mask applied to entry modes, e.g. "0644"
+	ZeroGzipMtime bool   `json:"zero_gzip_mtime"` // Write a zero timestamp to the gzip header
+}
+
+// EmptyDirsConfig holds settings for removing empty directories after pruning.
+type EmptyDirsConfig struct {
+	Enabled     bool     `json:"enabled"`       // Remove empty directories under target_folder after pruning
+	MinAgeHours float64  `json:"min_age_hours"` // Only remove directories not modified for this long (default: 0)
+	Protect     []string `json:"protect"`       // Globs for directories that are never removed
 }
 
 type Config struct {
-	PruneAfterHours       float32            `json:"prune_after_hours"`
+	PruneAfter            duration.Duration  `json:"prune_after,omitempty"`       // Age threshold as a duration, e.g. "36h" or "P30D"
+	PruneAfterHours       float32            `json:"prune_after_hours,omitempty"` // Age threshold in hours (older form of prune_after)
+	AgeSource             string             `json:"age_source"`                  // mtime, ctime, atime, birth, filename (default: mtime)
+	AgeSourceLayout       string             `json:"age_source_layout"`           // Go time layout for the filename source, e.g. "app-2006-01-02.log"
+	Links                 string             `json:"links"`                       // symlink policy: skip, preserve, follow (default: skip)
+	CopyTruncate          bool               `json:"copy_truncate"`               // back up and truncate files in place instead of removing them
+	Rules                 []rules.Rule       `json:"rules"`                       // Ordered per-pattern age rules, first match wins
+	MaxTotalBytes         int64              `json:"max_total_bytes"`             // prune oldest files until target_folder is at or below this size (0 = disabled)
+	MinFreePercent        float64            `json:"min_free_percent"`            // prune oldest files until filesystem free space is at or above this (0-100, 0 = disabled)
 	TargetFolder          string             `json:"target_folder"`
-	RunInterval           int                `json:"run_interval"`
-	BackupPath            string             `json:"backup_path"`              // Single backup path (backward compatible)
-	BackupPaths           []string           `json:"backup_paths"`             // Multiple backup paths
-	RemoteBackup          string             `json:"remote_backup"`            // Single remote backup (backward compatible)
-	RemoteBackups         []string           `json:"remote_backups"`           // Multiple remote backups
+	RunInterval           duration.Duration  `json:"run_interval"`            // Time between cycles, e.g. "1h"; a number is seconds
+	BackupPath            string             `json:"backup_path,omitempty"`   // Single backup path (backward compatible)
+	BackupPaths           []string           `json:"backup_paths"`            // Multiple backup paths
+	RemoteBackup          string             `json:"remote_backup,omitempty"` // Single remote backup (backward compatible)
+	RemoteBackups         []string           `json:"remote_backups"`          // Multiple remote backups
+	RemoteTransfer        string             `json:"remote_transfer"`         // scp, tar (default: scp)
 	EnableBackup          bool               `json:"enable_backup"`
-	LogLevel              string             `json:"log_level"`                // debug, info, warn, error (default: info)
-	LogFormat             string             `json:"log_format"`               // text, json (default: text)
-	ErrorThresholdPercent float64            `json:"error_threshold_percent"`  // max failure rate before stopping (0-100, default: 0 = disabled)
-	Compression           *CompressionConfig `json:"compression,omitempty"`    // Compression settings for backups
-	Archive               *ArchiveConfig     `json:"archive,omitempty"`        // Archive mode settings for backups
+	PreserveMetadata      bool               `json:"preserve_metadata"`           // keep mode, owner, times and xattrs on backups
+	LogLevel              string             `json:"log_level"`                   // debug, info, warn, error (default: info)
+	LogFormat             string             `json:"log_format"`                  // text, json (default: text)
+	ErrorThresholdPercent float64            `json:"error_threshold_percent"`     // max failure rate before stopping (0-100, default: 0 = disabled)
+	Compression           *CompressionConfig `json:"compression,omitempty"`       // Compression settings for backups
+	Archive               *ArchiveConfig     `json:"archive,omitempty"`           // Archive mode settings for backups
+	Notifications         *notify.Config     `json:"notifications,omitempty"`     // Webhook and email notifications on cycle outcomes
+	InUseCheck            *inuse.Config      `json:"in_use_check,omitempty"`      // Defer files that are still being written
+	RemoveEmptyDirs       *EmptyDirsConfig   `json:"remove_empty_dirs,omitempty"` // Remove directories left empty by pruning
+	Trash                 *trash.Config      `json:"trash,omitempty"`             // Move pruned files to a trash directory instead of deleting them
+	Safety                *safety.Config     `json:"safety,omitempty"`            // Limits that abort implausibly large prune cycles
+	Hooks                 []hooks.Config     `json:"hooks"`                       // Commands run before and after cycles, before pruning, per file and per error
+	RateLimit             *ratelimit.Config  `json:"rate_limit,omitempty"`        // Bandwidth limits for local reads and writes and remote uploads
+	RemoteRetry           *outbox.Config     `json:"remote_retry,omitempty"`      // Retries and an outbox for failed remote copies
+}
+
+// GetPruneAfter returns the age threshold from prune_after, or from prune_after_hours
+// if prune_after is not set. Fractional hours are kept.
+func (c *Config) GetPruneAfter() time.Duration {
+	if c.PruneAfter != 0 {
+		return c.PruneAfter.Std()
+	}
+	return duration.Hours(float64(c.PruneAfterHours))
+}
+
+// GetRunInterval returns the time between cycles.
+func (c *Config) GetRunInterval() time.Duration {
+	return c.RunInterval.Std()
 }
 
 // GetCompressionConfig returns the compression configuration, converting to the pkg format.
@@ -80,12 +139,111 @@ func (c *Config) GetArchiveConfig() *archive.Config {
 	}
 
 	return &archive.Config{
-		Enabled: true,
-		Format:  format,
-		GroupBy: groupBy,
+		Enabled:       true,
+		Format:        format,
+		GroupBy:       groupBy,
+		Reproducible:  c.Archive.Reproducible,
+		UID:           c.Archive.UID,
+		GID:           c.Archive.GID,
+		Uname:         c.Archive.Uname,
+		Gname:         c.Archive.Gname,
+		ModeMask:      c.Archive.ModeMask,
+		ZeroGzipMtime: c.Archive.ZeroGzipMtime,
+
+		PreserveMetadata: c.PreserveMetadata,
+		FollowLinks:      c.GetLinkPolicy() == pruner.LinksFollow,
+	}
+}
+
+// GetNotifyConfig returns the notification configuration with defaults applied.
+func (c *Config) GetNotifyConfig() *notify.Config {
+	if c.Notifications == nil || !c.Notifications.Enabled {
+		return &notify.Config{Enabled: false}
+	}
+
+	cfg := *c.Notifications
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = notify.DefaultConsecutiveFailures
+	}
+
+	return &cfg
+}
+
+// GetFileTimeConfig returns the age source configuration, converting to the internal/filetime format.
+func (c *Config) GetFileTimeConfig() *filetime.Config {
+	source := filetime.Source(strings.ToLower(c.AgeSource))
+	if source == "" {
+		source = filetime.ModTime
+	}
+	return &filetime.Config{
+		Source: source,
+		Layout: c.AgeSourceLayout,
 	}
 }
 
+// GetLinkPolicy returns the symlink policy, defaulting to skip.
+func (c *Config) GetLinkPolicy() pruner.LinkPolicy {
+	policy := pruner.LinkPolicy(strings.ToLower(c.Links))
+	if policy == "" {
+		policy = pruner.LinksSkip
+	}
+	return policy
+}
+
+// GetInUseConfig returns the in-use check configuration with defaults applied.
+func (c *Config) GetInUseConfig() *inuse.Config {
+	if c.InUseCheck == nil || !c.InUseCheck.Enabled {
+		return &inuse.Config{Enabled: false}
+	}
+
+	cfg := *c.InUseCheck
+	if cfg.SettleSeconds == 0 {
+		cfg.SettleSeconds = inuse.DefaultSettleSeconds
+	}
+	return &cfg
+}
+
+// GetDirPolicy returns the empty directory removal policy, or nil if it is disabled.
+func (c *Config) GetDirPolicy() *pruner.DirPolicy {
+	if c.RemoveEmptyDirs == nil || !c.RemoveEmptyDirs.Enabled {
+		return nil
+	}
+	return &pruner.DirPolicy{
+		MinAge:  time.Duration(c.RemoveEmptyDirs.MinAgeHours * float64(time.Hour)),
+		Protect: c.RemoveEmptyDirs.Protect,
+	}
+}
+
+// GetTrashConfig returns the trash configuration with defaults applied.
+func (c *Config) GetTrashConfig() *trash.Config {
+	if c.Trash == nil || !c.Trash.Enabled {
+		return &trash.Config{Enabled: false}
+	}
+
+	cfg := *c.Trash
+	if cfg.Path == "" {
+		cfg.Path = filepath.Join(c.TargetFolder, trash.DefaultDirName)
+	}
+	if cfg.GraceHours == 0 {
+		cfg.GraceHours = trash.DefaultGraceHours
+	}
+	return &cfg
+}
+
+// GetSafetyConfig returns the safety limits. Denied roots apply even if none are configured.
+func (c *Config) GetSafetyConfig() *safety.Config {
+	if c.Safety == nil {
+		return &safety.Config{}
+	}
+	cfg := *c.Safety
+	return &cfg
+}
+
+// GetRuleSet compiles the configured per-pattern rules.
+func (c *Config) GetRuleSet() (*rules.Set, error) {
+	return rules.New(c.Rules)
+}
+
 // GetBackupPaths returns all configured backup paths, merging single and multiple path configs.
 func (c *Config) GetBackupPaths() []string {
 	paths := make([]string, 0)
@@ -115,6 +273,20 @@ func (c *Config) GetBackupPaths() []string {
 	return paths
 }
 
+// Transfer methods of remote_backups.
+const (
+	RemoteTransferTar = "tar" // One tar stream per destination and cycle, over one ssh session
+	RemoteTransferSCP = "scp" // One scp per file
+)
+
+// GetRemoteTransfer returns the transfer method of remote_backups, defaulting to scp.
+func (c *Config) GetRemoteTransfer() string {
+	if c.RemoteTransfer == "" {
+		return RemoteTransferSCP
+	}
+	return strings.ToLower(c.RemoteTransfer)
+}
+
 // GetRemoteBackups returns all configured remote backup destinations.
 func (c *Config) GetRemoteBackups() []string {
 	remotes := make([]string, 0)
@@ -144,40 +316,118 @@ func (c *Config) GetRemoteBackups() []string {
 	return remotes
 }
 
-func LoadConfig(filePath string) (*Config, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, err
+// GetRateLimitConfig returns the bandwidth limits; none are set by default.
+func (c *Config) GetRateLimitConfig() *ratelimit.Config {
+	if c.RateLimit == nil {
+		return &ratelimit.Config{}
+	}
+	return c.RateLimit
+}
+
+// GetRemoteRetryConfig returns the retry settings of remote copies. Without a
+// remote_retry section each copy is tried once and failures are not kept.
+func (c *Config) GetRemoteRetryConfig() *outbox.Config {
+	cfg := outbox.Config{Attempts: 1}
+	if c.RemoteRetry != nil {
+		cfg = *c.RemoteRetry
+		if cfg.Attempts == 0 {
+			cfg.Attempts = outbox.DefaultAttempts
+		}
+	}
+	if cfg.InitialBackoff == 0 {
+		cfg.InitialBackoff = duration.Duration(outbox.DefaultInitialBackoff)
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			panic(err)
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = duration.Duration(outbox.DefaultMaxBackoff)
+	}
+	if cfg.Outbox && cfg.Path == "" {
+		if paths := c.GetBackupPaths(); len(paths) > 0 {
+			cfg.Path = filepath.Join(paths[0], outbox.DefaultFileName)
 		}
-	}(file)
+	}
+	return &cfg
+}
 
-	cfg := &Config{}
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(cfg)
-	if err != nil {
-		return nil, err
+// GetHooks returns the hook commands with defaults applied.
+func (c *Config) GetHooks() []hooks.Config {
+	list := make([]hooks.Config, 0, len(c.Hooks))
+	for _, h := range c.Hooks {
+		list = append(list, h.WithDefaults())
 	}
+	return list
+}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+// Effective returns a copy of the configuration as a cycle uses it: defaults from the
+// Get*Config methods applied, backup_path and remote_backup merged into the lists,
+// and prune_after_hours converted to prune_after.
+func (c *Config) Effective() *Config {
+	e := *c
+
+	e.PruneAfter = duration.Duration(c.GetPruneAfter())
+	e.PruneAfterHours = 0
+	e.AgeSource = string(c.GetFileTimeConfig().Source)
+	e.Links = string(c.GetLinkPolicy())
+	if e.Rules == nil {
+		e.Rules = []rules.Rule{}
+	}
+	e.BackupPaths = c.GetBackupPaths()
+	e.BackupPath = ""
+	e.RemoteBackups = c.GetRemoteBackups()
+	e.RemoteBackup = ""
+	e.RemoteTransfer = c.GetRemoteTransfer()
+	if e.LogLevel == "" {
+		e.LogLevel = "info"
+	}
+	if e.LogFormat == "" {
+		e.LogFormat = "text"
 	}
 
-	return cfg, nil
+	comp := c.GetCompressionConfig()
+	e.Compression = &CompressionConfig{Enabled: comp.Enabled, Algorithm: string(comp.Algorithm), Level: comp.Level}
+
+	arch := c.GetArchiveConfig()
+	e.Archive = &ArchiveConfig{Enabled: arch.Enabled, Format: string(arch.Format), GroupBy: string(arch.GroupBy)}
+	if c.Archive != nil && arch.Enabled {
+		*e.Archive = *c.Archive
+		e.Archive.Format = string(arch.Format)
+		e.Archive.GroupBy = string(arch.GroupBy)
+	}
+
+	e.Notifications = c.GetNotifyConfig()
+	e.InUseCheck = c.GetInUseConfig()
+	e.Trash = c.GetTrashConfig()
+	e.Safety = c.GetSafetyConfig()
+	e.Hooks = c.GetHooks()
+	e.RateLimit = c.GetRateLimitConfig()
+	e.RemoteRetry = c.GetRemoteRetryConfig()
+	if c.RemoveEmptyDirs == nil {
+		e.RemoveEmptyDirs = &EmptyDirsConfig{}
+	}
+	return &e
 }
 
 // Validate checks that all configuration values are valid and safe to use.
 func (c *Config) Validate() error {
-	if c.PruneAfterHours <= 0 {
-		return fmt.Errorf("prune_after_hours must be positive, got %f", c.PruneAfterHours)
+	if c.PruneAfter != 0 && c.PruneAfterHours != 0 {
+		return fmt.Errorf("prune_after and prune_after_hours cannot both be set; use prune_after")
+	}
+	if c.GetPruneAfter() <= 0 {
+		if c.PruneAfterHours != 0 {
+			return fmt.Errorf("prune_after_hours must be positive, got %f", c.PruneAfterHours)
+		}
+		return fmt.Errorf("prune_after must be positive, got %s", c.PruneAfter)
+	}
+
+	if c.MaxTotalBytes < 0 {
+		return fmt.Errorf("max_total_bytes must not be negative, got %d", c.MaxTotalBytes)
+	}
+
+	if c.MinFreePercent < 0 || c.MinFreePercent >= 100 {
+		return fmt.Errorf("min_free_percent must be between 0 and 100 (exclusive), got: %f", c.MinFreePercent)
 	}
 
 	if c.RunInterval <= 0 {
-		return fmt.Errorf("run_interval must be positive, got %d", c.RunInterval)
+		return fmt.Errorf("run_interval must be positive, got %s", c.RunInterval)
 	}
 
 	if c.TargetFolder == "" {
@@ -199,8 +449,13 @@ func (c *Config) Validate() error {
 	// Validate backup settings
 	if c.EnableBackup {
 		backupPaths := c.GetBackupPaths()
+		if len(backupPaths) == 0 && len(c.GetRemoteBackups()) == 0 {
+			return fmt.Errorf("at least one backup_path, backup_paths or remote_backups entry is required when enable_backup is true")
+		}
 		if len(backupPaths) == 0 {
-			return fmt.Errorf("at least one backup_path or backup_paths entry is required when enable_backup is true")
+			if err := c.validateRemoteOnly(); err != nil {
+				return err
+			}
 		}
 
 		// Validate each backup path
@@ -208,6 +463,10 @@ func (c *Config) Validate() error {
 			if info, err := os.Stat(path); err == nil && !info.IsDir() {
 				return fmt.Errorf("backup path exists but is not a directory: %s", path)
 			}
+			// A destination inside the target would back up and prune its own backups
+			if overlaps(path, c.TargetFolder) {
+				return fmt.Errorf("backup path overlaps target_folder: %s", path)
+			}
 		}
 	}
 
@@ -226,6 +485,9 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("remote_backups entry has invalid format, expected user@host:/path or host:/path, got: %s", remote)
 		}
 	}
+	if transfer := c.GetRemoteTransfer(); transfer != RemoteTransferTar && transfer != RemoteTransferSCP {
+		return fmt.Errorf("remote_transfer must be 'tar' or 'scp'; got: %s", c.RemoteTransfer)
+	}
 
 	// Validate log level if specified
 	if c.LogLevel != "" {
@@ -277,5 +539,175 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	// Validate age source
+	if err := c.GetFileTimeConfig().Validate(); err != nil {
+		return fmt.Errorf("age_source: %w", err)
+	}
+
+	// Validate symlink policy
+	if err := c.GetLinkPolicy().Validate(); err != nil {
+		return fmt.Errorf("links: %w", err)
+	}
+
+	// Validate in-use check
+	if err := c.GetInUseConfig().Validate(); err != nil {
+		return fmt.Errorf("in_use_check: %w", err)
+	}
+
+	// Validate empty directory removal
+	if c.RemoveEmptyDirs != nil && c.RemoveEmptyDirs.Enabled {
+		if c.RemoveEmptyDirs.MinAgeHours < 0 {
+			return fmt.Errorf("remove_empty_dirs: min_age_hours must not be negative, got %g", c.RemoveEmptyDirs.MinAgeHours)
+		}
+		for i, glob := range c.RemoveEmptyDirs.Protect {
+			if err := rules.ValidateGlob(glob); err != nil {
+				return fmt.Errorf("remove_empty_dirs: protect[%d]: %w", i, err)
+			}
+		}
+	}
+
+	// Validate trash settings
+	if trashCfg := c.GetTrashConfig(); trashCfg.Enabled {
+		if err := trashCfg.Validate(); err != nil {
+			return fmt.Errorf("trash: %w", err)
+		}
+		if samePath(trashCfg.Path, c.TargetFolder) {
+			return fmt.Errorf("trash: path must not be the target_folder itself")
+		}
+		for _, path := range c.GetBackupPaths() {
+			if samePath(trashCfg.Path, path) {
+				return fmt.Errorf("trash: path must not be a backup path: %s", path)
+			}
+		}
+	}
+
+	// Validate safety limits
+	if err := c.GetSafetyConfig().Validate(); err != nil {
+		return fmt.Errorf("safety: %w", err)
+	}
+
+	// Validate bandwidth limits
+	if err := c.GetRateLimitConfig().Validate(); err != nil {
+		return fmt.Errorf("rate_limit: %w", err)
+	}
+	remotes := make(map[string]bool)
+	for _, remote := range c.GetRemoteBackups() {
+		remotes[remote] = true
+	}
+	for remote := range c.GetRateLimitConfig().Remotes {
+		if !remotes[remote] {
+			return fmt.Errorf("rate_limit: remotes: %s is not a remote_backups entry", remote)
+		}
+	}
+
+	// Validate remote retries
+	if c.RemoteRetry != nil {
+		retry := c.GetRemoteRetryConfig()
+		if err := retry.Validate(); err != nil {
+			return fmt.Errorf("remote_retry: %w", err)
+		}
+		if retry.Outbox && retry.Path == "" {
+			return fmt.Errorf("remote_retry: outbox requires a path or a backup path")
+		}
+		for _, remote := range retry.OptionalRemotes {
+			if !remotes[remote] {
+				return fmt.Errorf("remote_retry: optional_remotes: %s is not a remote_backups entry", remote)
+			}
+		}
+	}
+
+	// Validate hook commands
+	for i, h := range c.Hooks {
+		if err := h.Validate(); err != nil {
+			return fmt.Errorf("hooks[%d]: %w", i, err)
+		}
+	}
+
+	// Validate per-pattern rules
+	if _, err := c.GetRuleSet(); err != nil {
+		return err
+	}
+	for i, r := range c.Rules {
+		if r.Backup != nil && *r.Backup && !c.EnableBackup {
+			return fmt.Errorf("rules[%d]: backup requires enable_backup to be true", i)
+		}
+		if r.Compress != nil && c.Archive != nil && c.Archive.Enabled {
+			return fmt.Errorf("rules[%d]: compress cannot be set in archive mode", i)
+		}
+	}
+
+	// Validate notification settings
+	if c.Notifications != nil && c.Notifications.Enabled {
+		if err := c.GetNotifyConfig().Validate(); err != nil {
+			return fmt.Errorf("notifications: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateRemoteOnly checks that a backup without a local backup path can stream
+// every file straight to the remotes.
+func (c *Config) validateRemoteOnly() error {
+	if c.GetArchiveConfig().Enabled {
+		return fmt.Errorf("archive mode requires a backup path")
+	}
+	if c.GetRemoteTransfer() != RemoteTransferTar {
+		return fmt.Errorf("remote_transfer %s requires a backup path; set remote_transfer: tar for remote-only backups", c.GetRemoteTransfer())
+	}
+	if c.GetLinkPolicy() == pruner.LinksPreserve {
+		return fmt.Errorf("links preserve requires a backup path; links are not copied to remotes")
+	}
+	if c.CopyTruncate {
+		return fmt.Errorf("copy_truncate requires a backup path for its snapshots")
+	}
+	for i, r := range c.Rules {
+		if r.CopyTruncateEnabled(false) {
+			return fmt.Errorf("rules[%d]: copy_truncate requires a backup path for its snapshots", i)
+		}
+	}
 	return nil
 }
+
+// overlaps reports whether a and b are the same directory or one contains the other,
+// after resolving symlinks. Paths that do not exist yet are resolved through their
+// nearest existing parent.
+func overlaps(a, b string) bool {
+	realA, realB := realPath(a), realPath(b)
+	return within(realA, realB) || within(realB, realA)
+}
+
+// within reports whether path is dir or inside it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath returns the absolute path with symlinks resolved in its longest existing prefix.
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			parts := append([]string{resolved}, missing...)
+			return filepath.Join(parts...)
+		}
+		if filepath.Dir(dir) == dir {
+			return abs
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// samePath reports whether a and b name the same location after cleaning.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
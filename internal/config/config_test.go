@@ -1,9 +1,15 @@
 package config
 
 import (
+	"filekeeper/internal/duration"
+	"filekeeper/internal/outbox"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/trash"
+	"filekeeper/pkg/ratelimit"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestValidate_PruneAfterHours(t *testing.T) {
@@ -24,7 +30,7 @@ func TestValidate_PruneAfterHours(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: tt.hours,
-				RunInterval:     3600,
+				RunInterval:     duration.Duration(time.Hour),
 				TargetFolder:    tempDir,
 				EnableBackup:    false,
 			}
@@ -41,13 +47,13 @@ func TestValidate_RunInterval(t *testing.T) {
 
 	tests := []struct {
 		name     string
-		interval int
+		interval duration.Duration
 		wantErr  bool
 	}{
-		{"positive interval", 3600, false},
+		{"positive interval", duration.Duration(time.Hour), false},
 		{"zero interval", 0, true},
-		{"negative interval", -1, true},
-		{"small positive", 1, false},
+		{"negative interval", duration.Duration(-time.Second), true},
+		{"small positive", duration.Duration(time.Second), false},
 	}
 
 	for _, tt := range tests {
@@ -88,7 +94,7 @@ func TestValidate_TargetFolder(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: 24,
-				RunInterval:     3600,
+				RunInterval:     duration.Duration(time.Hour),
 				TargetFolder:    tt.targetFolder,
 				EnableBackup:    false,
 			}
@@ -101,6 +107,7 @@ func TestValidate_TargetFolder(t *testing.T) {
 }
 
 func TestValidate_BackupPath(t *testing.T) {
+	targetDir := t.TempDir()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "testfile.txt")
 	if err := os.WriteFile(tempFile, []byte("test"), 0644); err != nil {
@@ -124,8 +131,8 @@ func TestValidate_BackupPath(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: 24,
-				RunInterval:     3600,
-				TargetFolder:    tempDir,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    targetDir,
 				EnableBackup:    tt.enableBackup,
 				BackupPath:      tt.backupPath,
 			}
@@ -158,7 +165,7 @@ func TestValidate_RemoteBackup(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: 24,
-				RunInterval:     3600,
+				RunInterval:     duration.Duration(time.Hour),
 				TargetFolder:    tempDir,
 				EnableBackup:    false,
 				RemoteBackup:    tt.remoteBackup,
@@ -243,7 +250,7 @@ func TestValidate_LogLevel(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: 24,
-				RunInterval:     3600,
+				RunInterval:     duration.Duration(time.Hour),
 				TargetFolder:    tempDir,
 				EnableBackup:    false,
 				LogLevel:        tt.logLevel,
@@ -277,7 +284,7 @@ func TestValidate_LogFormat(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			cfg := &Config{
 				PruneAfterHours: 24,
-				RunInterval:     3600,
+				RunInterval:     duration.Duration(time.Hour),
 				TargetFolder:    tempDir,
 				EnableBackup:    false,
 				LogFormat:       tt.logFormat,
@@ -289,3 +296,429 @@ func TestValidate_LogFormat(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate_SizeAndFreeSpaceRules(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name           string
+		maxTotalBytes  int64
+		minFreePercent float64
+		wantErr        bool
+	}{
+		{"disabled", 0, 0, false},
+		{"valid limits", 1 << 30, 15, false},
+		{"negative max bytes", -1, 0, true},
+		{"negative free percent", 0, -5, true},
+		{"free percent 100", 0, 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				MaxTotalBytes:   tt.maxTotalBytes,
+				MinFreePercent:  tt.minFreePercent,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Rules(t *testing.T) {
+	tempDir := t.TempDir()
+	yes := true
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"valid rules", Config{Rules: []rules.Rule{{Glob: "*.log", PruneAfterHours: 6}}}, false},
+		{"invalid regex", Config{Rules: []rules.Rule{{Regex: "(", PruneAfterHours: 6}}}, true},
+		{"backup without enable_backup", Config{Rules: []rules.Rule{{Glob: "*", PruneAfterHours: 6, Backup: &yes}}}, true},
+		{"compress in archive mode", Config{
+			EnableBackup: true,
+			BackupPath:   tempDir,
+			Archive:      &ArchiveConfig{Enabled: true},
+			Rules:        []rules.Rule{{Glob: "*", PruneAfterHours: 6, Compress: &yes}},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			cfg.PruneAfterHours = 24
+			cfg.RunInterval = duration.Duration(time.Hour)
+			cfg.TargetFolder = tempDir
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_AgeSource(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		source  string
+		layout  string
+		wantErr bool
+	}{
+		{"default", "", "", false},
+		{"mtime", "mtime", "", false},
+		{"filename", "filename", "app-2006-01-02.log", false},
+		{"filename without layout", "filename", "", true},
+		{"unknown", "inode", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				AgeSource:       tt.source,
+				AgeSourceLayout: tt.layout,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Links(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		links   string
+		wantErr bool
+	}{
+		{"", false},
+		{"skip", false},
+		{"preserve", false},
+		{"Follow", false},
+		{"copy", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.links, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				Links:           tt.links,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_RemoveEmptyDirs(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		dirs    *EmptyDirsConfig
+		wantErr bool
+	}{
+		{"disabled", &EmptyDirsConfig{MinAgeHours: -1}, false},
+		{"valid", &EmptyDirsConfig{Enabled: true, MinAgeHours: 24, Protect: []string{"incoming", "spool/*"}}, false},
+		{"negative age", &EmptyDirsConfig{Enabled: true, MinAgeHours: -1}, true},
+		{"bad glob", &EmptyDirsConfig{Enabled: true, Protect: []string{"["}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				RemoveEmptyDirs: tt.dirs,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_Trash(t *testing.T) {
+	tempDir := t.TempDir()
+	backupDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		trash   *trash.Config
+		wantErr bool
+	}{
+		{"disabled", &trash.Config{GraceHours: -1}, false},
+		{"default path", &trash.Config{Enabled: true}, false},
+		{"negative grace", &trash.Config{Enabled: true, GraceHours: -1}, true},
+		{"target folder", &trash.Config{Enabled: true, Path: tempDir}, true},
+		{"backup path", &trash.Config{Enabled: true, Path: backupDir}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				EnableBackup:    true,
+				BackupPath:      backupDir,
+				Trash:           tt.trash,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_RateLimit(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name      string
+		rateLimit *ratelimit.Config
+		wantErr   bool
+	}{
+		{"limits", &ratelimit.Config{ReadBytesPerSec: 1 << 20, Remotes: map[string]int64{"user@host:/backup": 1 << 20}}, false},
+		{"negative", &ratelimit.Config{WriteBytesPerSec: -1}, true},
+		{"unknown remote", &ratelimit.Config{Remotes: map[string]int64{"user@other:/backup": 1 << 20}}, true},
+		{"bad schedule", &ratelimit.Config{Schedule: []ratelimit.Window{{Start: "25:00", End: "06:00"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+				RemoteBackups:   []string{"user@host:/backup"},
+				RateLimit:       tt.rateLimit,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_RemoteRetry(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name        string
+		backupPaths []string
+		retry       *outbox.Config
+		wantErr     bool
+	}{
+		{"outbox in backup path", []string{tempDir}, &outbox.Config{Outbox: true, OptionalRemotes: []string{"user@host:/backup"}}, false},
+		{"outbox path", nil, &outbox.Config{Outbox: true, Path: "/var/lib/filekeeper/outbox.json"}, false},
+		{"outbox without path", nil, &outbox.Config{Outbox: true}, true},
+		{"negative attempts", nil, &outbox.Config{Attempts: -1}, true},
+		{"unknown optional remote", nil, &outbox.Config{OptionalRemotes: []string{"user@other:/backup"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    t.TempDir(),
+				BackupPaths:     tt.backupPaths,
+				EnableBackup:    len(tt.backupPaths) > 0,
+				RemoteBackups:   []string{"user@host:/backup"},
+				RemoteRetry:     tt.retry,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_RemoteOnly(t *testing.T) {
+	truncate := true
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr bool
+	}{
+		{"remote only", func(c *Config) {}, false},
+		{"no destination", func(c *Config) { c.RemoteBackups = nil }, true},
+		{"archive", func(c *Config) { c.Archive = &ArchiveConfig{Enabled: true} }, true},
+		{"scp", func(c *Config) { c.RemoteTransfer = RemoteTransferSCP }, true},
+		{"default transfer", func(c *Config) { c.RemoteTransfer = "" }, true},
+		{"preserved links", func(c *Config) { c.Links = "preserve" }, true},
+		{"copy truncate", func(c *Config) { c.CopyTruncate = true }, true},
+		{"copy truncate rule", func(c *Config) { c.Rules = []rules.Rule{{Glob: "*.log", CopyTruncate: &truncate}} }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    t.TempDir(),
+				RemoteBackups:   []string{"user@host:/backup"},
+				RemoteTransfer:  RemoteTransferTar,
+				EnableBackup:    true,
+			}
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidate_BackupPathOverlap(t *testing.T) {
+	targetDir := t.TempDir()
+	outsideDir := t.TempDir()
+	link := filepath.Join(outsideDir, "link")
+	if err := os.Symlink(targetDir, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		backupPath string
+		wantErr    bool
+	}{
+		{"outside", filepath.Join(outsideDir, "backup"), false},
+		{"same as target", targetDir, true},
+		{"nested, not created yet", filepath.Join(targetDir, "backup"), true},
+		{"nested through symlink", filepath.Join(link, "backup"), true},
+		{"contains target", filepath.Dir(targetDir), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfterHours: 24,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    targetDir,
+				EnableBackup:    true,
+				BackupPaths:     []string{tt.backupPath},
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetPruneAfter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		want time.Duration
+	}{
+		{"fractional hours", Config{PruneAfterHours: 0.5}, 30 * time.Minute},
+		{"whole hours", Config{PruneAfterHours: 36}, 36 * time.Hour},
+		{"duration", Config{PruneAfter: duration.Duration(30 * 24 * time.Hour)}, 30 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.GetPruneAfter(); got != tt.want {
+				t.Errorf("GetPruneAfter() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate_PruneAfter(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		pruneAfter duration.Duration
+		hours      float32
+		wantErr    bool
+	}{
+		{"duration", duration.Duration(36 * time.Hour), 0, false},
+		{"negative duration", duration.Duration(-time.Hour), 0, true},
+		{"both set", duration.Duration(time.Hour), 1, true},
+		{"neither set", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				PruneAfter:      tt.pruneAfter,
+				PruneAfterHours: tt.hours,
+				RunInterval:     duration.Duration(time.Hour),
+				TargetFolder:    tempDir,
+			}
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_Durations(t *testing.T) {
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		fields       string
+		wantPrune    time.Duration
+		wantInterval time.Duration
+		wantErr      bool
+	}{
+		{"numeric fields", `"prune_after_hours": 0.5, "run_interval": 3600`, 30 * time.Minute, time.Hour, false},
+		{"go durations", `"prune_after": "36h", "run_interval": "15m"`, 36 * time.Hour, 15 * time.Minute, false},
+		{"iso durations", `"prune_after": "P30D", "run_interval": "PT1H"`, 30 * 24 * time.Hour, time.Hour, false},
+		{"invalid duration", `"prune_after": "30 days", "run_interval": 3600`, 0, 0, true},
+		{"months", `"prune_after": "P1M", "run_interval": 3600`, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, "config.json")
+			content := `{` + tt.fields + `, "target_folder": "` + filepath.ToSlash(tempDir) + `"}`
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := cfg.GetPruneAfter(); got != tt.wantPrune {
+				t.Errorf("GetPruneAfter() = %s, want %s", got, tt.wantPrune)
+			}
+			if got := cfg.GetRunInterval(); got != tt.wantInterval {
+				t.Errorf("GetRunInterval() = %s, want %s", got, tt.wantInterval)
+			}
+		})
+	}
+}
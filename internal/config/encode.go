@@ -0,0 +1,187 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Encode writes the configuration in format. JSON and YAML keep the declaration
+// order of the keys; TOML sorts them. Unset optional sections are left out.
+func Encode(cfg *Config, format Format) ([]byte, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return convertJSON(data, format)
+}
+
+// convertJSON re-encodes a JSON document in format, dropping null values.
+func convertJSON(data []byte, format Format) ([]byte, error) {
+	if format == FormatTOML {
+		var tree map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&tree); err != nil {
+			return nil, err
+		}
+		return toml.Marshal(tomlValue(tree))
+	}
+
+	// JSON is valid YAML, and the node tree keeps the key order
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	dropNulls(&doc)
+	if format == FormatYAML {
+		blockStyle(&doc)
+	}
+	return encodeNode(&doc, format)
+}
+
+// encodeNode writes a YAML document node as YAML or JSON.
+func encodeNode(doc *yaml.Node, format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	if format == FormatYAML {
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if err := writeJSON(&buf, node, ""); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// blockStyle clears the flow and quoting styles of nodes parsed from JSON, so
+// they are written in the usual block style.
+func blockStyle(node *yaml.Node) {
+	node.Style &^= yaml.FlowStyle | yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// dropNulls removes mapping entries with null values.
+func dropNulls(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		content := node.Content[:0]
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if value.Kind == yaml.ScalarNode && value.ShortTag() == "!!null" {
+				continue
+			}
+			content = append(content, node.Content[i], value)
+		}
+		node.Content = content
+	}
+	for _, child := range node.Content {
+		dropNulls(child)
+	}
+}
+
+// writeJSON writes a YAML node as indented JSON.
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias, indent)
+	case yaml.MappingNode:
+		inner := indent + "  "
+		buf.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			key, _ := json.Marshal(node.Content[i].Value)
+			buf.WriteString("\n" + inner)
+			buf.Write(key)
+			buf.WriteString(": ")
+			if err := writeJSON(buf, node.Content[i+1], inner); err != nil {
+				return err
+			}
+		}
+		if len(node.Content) > 0 {
+			buf.WriteString("\n" + indent)
+		}
+		buf.WriteString("}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		inner := indent + "  "
+		buf.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n" + inner)
+			if err := writeJSON(buf, item, inner); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + indent + "]")
+	case yaml.ScalarNode:
+		var value interface{} = node.Value
+		if node.ShortTag() != "!!str" {
+			if err := node.Decode(&value); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		buf.Write(data)
+	default:
+		return fmt.Errorf("line %d: unsupported YAML node", node.Line)
+	}
+	return nil
+}
+
+// tomlValue converts a decoded JSON value for the TOML encoder: numbers become
+// int64 or float64 and null values are left out.
+func tomlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if item != nil {
+				m[key] = tomlValue(item)
+			}
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				items = append(items, tomlValue(item))
+			}
+		}
+		return items
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	default:
+		return v
+	}
+}
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the environment variables that override configuration keys.
+// The rest of the name is the key path in upper case joined by underscores,
+// e.g. FILEKEEPER_TARGET_FOLDER or FILEKEEPER_COMPRESSION_LEVEL.
+const envPrefix = "FILEKEEPER_"
+
+// EnvName returns the environment variable that overrides a key path such as
+// "archive.group_by".
+func EnvName(path string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// interpolate expands ${VAR} and ${VAR:-default} in the string values of value,
+// which is decoded into type t. A value that becomes a number or boolean for a
+// numeric or boolean field is converted, so "${MAX_FILES}" works for max_files.
+// "$${" is a literal "${".
+func interpolate(value interface{}, t reflect.Type, path string, origin *Origin, lookupEnv func(string) (string, bool)) (interface{}, error) {
+	t = indirect(t)
+	pos := origin.positions
+
+	switch v := value.(type) {
+	case string:
+		expanded, vars, err := expand(v, lookupEnv)
+		if len(vars) > 0 {
+			origin.interpolated[path] = vars
+		}
+		if err != nil {
+			return nil, pos.errorf(path, "%s: %w", path, err)
+		}
+		if expanded == v || t.Kind() == reflect.String || reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+			return expanded, nil
+		}
+		converted, err := envValue(t, expanded)
+		if err != nil {
+			return nil, pos.errorf(path, "%s: %w", path, err)
+		}
+		return converted, nil
+	case map[string]interface{}:
+		var fields map[string]reflect.StructField
+		if t.Kind() == reflect.Struct {
+			fields = jsonFields(t)
+		}
+		for key, item := range v {
+			itemType := reflect.TypeOf((*interface{})(nil)).Elem()
+			if f, ok := lookupField(fields, key); ok {
+				itemType = f.Type
+			} else if t.Kind() == reflect.Map {
+				itemType = t.Elem()
+			}
+			expanded, err := interpolate(item, itemType, joinPath(path, key), origin, lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+	case []interface{}:
+		itemType := reflect.TypeOf((*interface{})(nil)).Elem()
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			itemType = t.Elem()
+		}
+		for i, item := range v {
+			expanded, err := interpolate(item, itemType, fmt.Sprintf("%s[%d]", path, i), origin, lookupEnv)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+	}
+	return value, nil
+}
+
+// expand replaces ${VAR} and ${VAR:-default} references in s. It also returns
+// the names of the variables referenced.
+func expand(s string, lookupEnv func(string) (string, bool)) (string, []string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil, nil
+	}
+
+	var b strings.Builder
+	var vars []string
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), vars, nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			// Escaped: "$${" is a literal "${"
+			b.WriteString(s[:i])
+			b.WriteString("{")
+			s = s[i+2:]
+			continue
+		}
+		b.WriteString(s[:i])
+
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", vars, fmt.Errorf("unterminated ${ in %q", s)
+		}
+		ref := s[i+2 : i+end]
+		name, def, hasDefault := strings.Cut(ref, ":-")
+		if !validEnvName(name) {
+			return "", vars, fmt.Errorf("invalid environment variable name %q", name)
+		}
+		vars = append(vars, name)
+		value, ok := lookupEnv(name)
+		switch {
+		case ok && (value != "" || !hasDefault):
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			return "", vars, fmt.Errorf("environment variable %s is not set", name)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// validEnvName reports whether name is a valid environment variable name.
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// applyEnv sets keys of tree, the section at path decoded into struct type t,
+// from the environment variables named by EnvName. Nested sections recurse, and
+// are only created when a variable for one of their keys is set.
+func applyEnv(tree map[string]interface{}, t reflect.Type, path string, origin *Origin, lookupEnv func(string) (string, bool)) error {
+	for name, f := range jsonFields(indirect(t)) {
+		keyPath := joinPath(path, name)
+		envName := EnvName(keyPath)
+		key := treeKey(tree, name)
+		ft := indirect(f.Type)
+
+		if ft.Kind() == reflect.Struct && !reflect.PtrTo(ft).Implements(jsonUnmarshaler) {
+			section, ok := tree[key].(map[string]interface{})
+			if !ok {
+				section = make(map[string]interface{})
+			}
+			if err := applyEnv(section, ft, keyPath, origin, lookupEnv); err != nil {
+				return err
+			}
+			if len(section) > 0 {
+				tree[key] = section
+			}
+			continue
+		}
+
+		raw, ok := lookupEnv(envName)
+		if !ok {
+			continue
+		}
+		value, err := envValue(ft, raw)
+		if err != nil {
+			return fmt.Errorf("%s: %w", envName, err)
+		}
+		tree[key] = value
+		origin.env[keyPath] = envName
+	}
+	return nil
+}
+
+// envValue converts an environment variable to a value decoded into type t.
+func envValue(t reflect.Type, raw string) (interface{}, error) {
+	t = indirect(t)
+	s := strings.TrimSpace(raw)
+
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		// Durations accept a string or a number of seconds
+		if _, err := strconv.ParseFloat(s, 64); err == nil {
+			return json.Number(s), nil
+		}
+		return raw, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", raw)
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(s, 10, t.Bits()); err != nil {
+			return nil, fmt.Errorf("invalid integer %q", raw)
+		}
+		return json.Number(s), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, err := strconv.ParseUint(s, 10, t.Bits()); err != nil {
+			return nil, fmt.Errorf("invalid integer %q", raw)
+		}
+		return json.Number(s), nil
+	case reflect.Float32, reflect.Float64:
+		if _, err := strconv.ParseFloat(s, t.Bits()); err != nil {
+			return nil, fmt.Errorf("invalid number %q", raw)
+		}
+		return json.Number(s), nil
+	case reflect.Slice:
+		// Lists of strings may be comma-separated; anything else is JSON
+		if indirect(t.Elem()).Kind() == reflect.String && !strings.HasPrefix(s, "[") {
+			items := make([]interface{}, 0)
+			if s == "" {
+				return items, nil
+			}
+			for _, item := range strings.Split(s, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+			return items, nil
+		}
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, fmt.Errorf("invalid JSON value: %w", err)
+	}
+	return value, nil
+}
+
+// treeKey returns the key of tree that matches name ignoring case, or name.
+func treeKey(tree map[string]interface{}, name string) string {
+	if _, ok := tree[name]; ok {
+		return name
+	}
+	for key := range tree {
+		if strings.EqualFold(key, name) {
+			return key
+		}
+	}
+	return name
+}
+
+// indirect returns the type pointed to by pointer types.
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Field describes a configuration key for "config explain" and "config schema".
+type Field struct {
+	Path        string   // Key path, e.g. "archive.group_by"; list items use "[]", e.g. "rules[].glob"
+	Type        string   // string, boolean, integer, number, duration, list, map or section
+	Description string   // What the key means
+	Enum        []string // Allowed values, if restricted
+	Default     string   // Value used when the key is not set, if any
+	Deprecated  string   // Key that replaces this one, if any
+	Secret      bool     // Value is redacted by "config print" and "config explain"
+}
+
+// fieldDoc documents a key; see Field.
+type fieldDoc struct {
+	desc       string
+	enum       []string
+	def        string
+	deprecated string
+	secret     bool
+}
+
+// triggerEnum lists the notification triggers.
+var triggerEnum = []string{"threshold_exceeded", "safety_limit", "archive_failed", "remote_failed", "consecutive_failures", "recovery"}
+
+// fieldDocs documents every configuration key by path.
+var fieldDocs = map[string]fieldDoc{
+	"prune_after":                        {desc: `Age threshold; files older than this are backed up and pruned, e.g. "36h" or "P30D"`},
+	"prune_after_hours":                  {desc: "Age threshold in hours", deprecated: "prune_after"},
+	"age_source":                         {desc: "Timestamp used for file age", enum: []string{"mtime", "ctime", "atime", "birth", "filename"}, def: "mtime"},
+	"age_source_layout":                  {desc: `Go time layout for the filename age source, e.g. "app-2006-01-02.log"`},
+	"links":                              {desc: "Symlink handling", enum: []string{"skip", "preserve", "follow"}, def: "skip"},
+	"copy_truncate":                      {desc: "Back up files and truncate them in place instead of removing them", def: "false"},
+	"rules":                              {desc: "Ordered per-pattern age rules, first match wins"},
+	"rules[].name":                       {desc: "Rule name shown in logs"},
+	"rules[].glob":                       {desc: `Shell pattern matched against the relative path, e.g. "*.debug.log"`},
+	"rules[].regex":                      {desc: "Regular expression matched against the relative path"},
+	"rules[].prune_after":                {desc: "Age threshold for matching files"},
+	"rules[].prune_after_hours":          {desc: "Age threshold in hours for matching files", deprecated: "rules[].prune_after"},
+	"rules[].backup":                     {desc: "Back up matching files before pruning", def: "true"},
+	"rules[].compress":                   {desc: "Override compression for matching files"},
+	"rules[].copy_truncate":              {desc: "Override copy_truncate for matching files"},
+	"max_total_bytes":                    {desc: "Prune the oldest files until target_folder is at or below this size (0 = disabled)", def: "0"},
+	"min_free_percent":                   {desc: "Prune the oldest files until the filesystem has this much free space (0 = disabled)", def: "0"},
+	"target_folder":                      {desc: "Directory whose old files are backed up and pruned"},
+	"run_interval":                       {desc: `Time between cycles, e.g. "1h"; a number is seconds`},
+	"backup_path":                        {desc: "Local backup directory", deprecated: "backup_paths"},
+	"backup_paths":                       {desc: "Local backup directories"},
+	"remote_backup":                      {desc: "Remote scp destination, user@host:/path", deprecated: "remote_backups"},
+	"remote_backups":                     {desc: "Remote scp destinations, user@host:/path"},
+	"remote_transfer":                    {desc: "Transfer to remote_backups: one scp per file, or one tar stream per destination and cycle over ssh", enum: []string{"scp", "tar"}, def: "scp"},
+	"enable_backup":                      {desc: "Back up files before pruning; if false files are only pruned", def: "false"},
+	"preserve_metadata":                  {desc: "Keep mode, owner, times and extended attributes on backups", def: "false"},
+	"log_level":                          {desc: "Logging level", enum: []string{"debug", "info", "warn", "error"}, def: "info"},
+	"log_format":                         {desc: "Log output format", enum: []string{"text", "json"}, def: "text"},
+	"error_threshold_percent":            {desc: "Stop the cycle when the failure rate exceeds this percentage (0 = disabled)", def: "0"},
+	"compression":                        {desc: "Compression of backup files"},
+	"compression.enabled":                {desc: "Compress backup files", def: "false"},
+	"compression.algorithm":              {desc: "Compression algorithm", enum: []string{"none", "gzip"}, def: "gzip"},
+	"compression.level":                  {desc: "Compression level (gzip: 1-9)", def: "6"},
+	"archive":                            {desc: "Bundle backups into archives instead of copying files"},
+	"archive.enabled":                    {desc: "Enable archive mode", def: "false"},
+	"archive.format":                     {desc: "Archive format", enum: []string{"tar", "tar.gz", "zip"}, def: "tar.gz"},
+	"archive.group_by":                   {desc: "Period of each archive, by file time", enum: []string{"daily", "weekly", "monthly"}, def: "daily"},
+	"archive.reproducible":               {desc: "Normalize entry headers for byte-identical archives", def: "false"},
+	"archive.uid":                        {desc: "Owner uid recorded in tar entries"},
+	"archive.gid":                        {desc: "Owner gid recorded in tar entries"},
+	"archive.uname":                      {desc: "Owner user name recorded in tar entries"},
+	"archive.gname":                      {desc: "Owner group name recorded in tar entries"},
+	"archive.mode_mask":                  {desc: `Octal mask applied to entry modes, e.g. "0644"`},
+	"archive.zero_gzip_mtime":            {desc: "Write a zero timestamp to the gzip header", def: "false"},
+	"notifications":                      {desc: "Webhook and email notifications on cycle outcomes"},
+	"notifications.enabled":              {desc: "Send notifications", def: "false"},
+	"notifications.consecutive_failures": {desc: "Failed cycles in a row that trigger an alert", def: "3"},
+	"notifications.webhooks":             {desc: "Webhook endpoints"},
+	"notifications.webhooks[].url":       {desc: "Webhook URL; often carries a token", secret: true},
+	"notifications.webhooks[].format":    {desc: "Payload format", enum: []string{"json", "slack"}, def: "json"},
+	"notifications.webhooks[].headers":   {desc: "Extra HTTP headers", secret: true},
+	"notifications.webhooks[].template":  {desc: "Message template"},
+	"notifications.webhooks[].timeout_seconds": {desc: "Request timeout in seconds", def: "10"},
+	"notifications.webhooks[].triggers":        {desc: "Triggers sent to this webhook (default: all)", enum: triggerEnum},
+	"notifications.email":                      {desc: "SMTP email notifications"},
+	"notifications.email.host":                 {desc: "SMTP server host"},
+	"notifications.email.port":                 {desc: "SMTP server port"},
+	"notifications.email.username":             {desc: "SMTP user name"},
+	"notifications.email.password":             {desc: "SMTP password; use ${VAR} to keep it out of the file", secret: true},
+	"notifications.email.from":                 {desc: "Sender address"},
+	"notifications.email.to":                   {desc: "Recipient addresses"},
+	"notifications.email.subject":              {desc: "Subject template"},
+	"notifications.email.template":             {desc: "Body template"},
+	"notifications.email.timeout_seconds":      {desc: "SMTP timeout in seconds", def: "10"},
+	"notifications.email.triggers":             {desc: "Triggers sent by email (default: all)", enum: triggerEnum},
+	"in_use_check":                             {desc: "Defer files that are still being written"},
+	"in_use_check.enabled":                     {desc: "Enable the in-use check", def: "false"},
+	"in_use_check.settle_seconds":              {desc: "Time size and mtime must stay unchanged", def: "2"},
+	"in_use_check.open_handles":                {desc: "Defer files open in any process (Linux)", def: "false"},
+	"in_use_check.lock_suffixes":               {desc: `Defer a file while the file plus this suffix exists, e.g. ".lock"`},
+	"remove_empty_dirs":                        {desc: "Remove directories left empty by pruning"},
+	"remove_empty_dirs.enabled":                {desc: "Remove empty directories", def: "false"},
+	"remove_empty_dirs.min_age_hours":          {desc: "Only remove directories not modified for this long", def: "0"},
+	"remove_empty_dirs.protect":                {desc: "Globs for directories that are never removed"},
+	"trash":                                    {desc: "Move pruned files to a trash directory instead of deleting them"},
+	"trash.enabled":                            {desc: "Enable the trash", def: "false"},
+	"trash.path":                               {desc: "Trash directory", def: "<target_folder>/.filekeeper-trash"},
+	"trash.grace_hours":                        {desc: "Hours trashed files are kept before they are deleted", def: "72"},
+	"safety":                                   {desc: "Limits that abort implausibly large prune cycles"},
+	"safety.max_files":                         {desc: "Maximum files pruned per cycle (0 = disabled)", def: "0"},
+	"safety.max_bytes":                         {desc: "Maximum bytes pruned per cycle (0 = disabled)", def: "0"},
+	"safety.max_percent":                       {desc: "Maximum percentage of the folder's files pruned per cycle (0 = disabled)", def: "0"},
+	"safety.denied_roots":                      {desc: "Target folders refused in addition to /, /home and /etc"},
+	"hooks":                                    {desc: "Commands run at stages of a cycle, with context in FILEKEEPER_* environment variables"},
+	"hooks[].name":                             {desc: "Hook name shown in logs", def: "<command>"},
+	"hooks[].stage":                            {desc: "When the hook runs", enum: []string{"pre_cycle", "post_cycle", "pre_prune", "on_file_backed_up", "on_error"}},
+	"hooks[].command":                          {desc: "Shell command, run with /bin/sh -c or cmd /C"},
+	"hooks[].timeout_seconds":                  {desc: "Seconds before the command is killed", def: "30"},
+	"hooks[].on_failure":                       {desc: "What a failure does: abort the cycle, warn, or ignore", enum: []string{"abort", "warn", "ignore"}, def: "warn"},
+
+	"rate_limit":                                 {desc: "Bandwidth limits in bytes per second for local reads and writes and remote uploads"},
+	"rate_limit.read_bytes_per_sec":              {desc: "Reads of source files (0 = unlimited)", def: "0"},
+	"rate_limit.write_bytes_per_sec":             {desc: "Writes of local backups and archives (0 = unlimited)", def: "0"},
+	"rate_limit.remote_bytes_per_sec":            {desc: "All remote uploads together (0 = unlimited)", def: "0"},
+	"rate_limit.remotes":                         {desc: "Upload limit per remote_backups entry, in addition to remote_bytes_per_sec"},
+	"rate_limit.schedule":                        {desc: "Times of day with other read, write and remote limits; the first matching window applies"},
+	"rate_limit.schedule[].start":                {desc: `Start of the window in local time, "HH:MM"`},
+	"rate_limit.schedule[].end":                  {desc: `End of the window, "HH:MM"; before start means past midnight`},
+	"rate_limit.schedule[].read_bytes_per_sec":   {desc: "Reads of source files during the window (0 = unlimited)", def: "0"},
+	"rate_limit.schedule[].write_bytes_per_sec":  {desc: "Writes of local backups and archives during the window (0 = unlimited)", def: "0"},
+	"rate_limit.schedule[].remote_bytes_per_sec": {desc: "All remote uploads together during the window (0 = unlimited)", def: "0"},
+	"remote_retry":                               {desc: "Retries and an outbox for failed remote copies"},
+	"remote_retry.attempts":                      {desc: "Tries per remote copy in a cycle", def: "3"},
+	"remote_retry.initial_backoff":               {desc: "Wait before the second try, doubled for each further one", def: "2s"},
+	"remote_retry.max_backoff":                   {desc: "Longest wait between tries", def: "1m"},
+	"remote_retry.outbox":                        {desc: "Keep copies that failed every try, retry them in later cycles and keep their files", def: "false"},
+	"remote_retry.path":                          {desc: "Outbox file", def: "<backup_paths[0]>/.filekeeper-outbox.json"},
+	"remote_retry.optional_remotes":              {desc: "Remotes whose pending copies do not keep files from being pruned"},
+}
+
+// Fields returns every configuration key in declaration order, sections before their keys.
+func Fields() []Field {
+	var fields []Field
+	collectFields(reflect.TypeOf(Config{}), "", &fields)
+	return fields
+}
+
+// collectFields appends the keys of struct type t under path.
+func collectFields(t reflect.Type, path string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+		keyPath := joinPath(path, name)
+		doc := fieldDocs[keyPath]
+		*fields = append(*fields, Field{
+			Path:        keyPath,
+			Type:        typeName(f.Type),
+			Description: doc.desc,
+			Enum:        doc.enum,
+			Default:     doc.def,
+			Deprecated:  doc.deprecated,
+			Secret:      doc.secret,
+		})
+
+		ft := indirect(f.Type)
+		switch {
+		case isSection(ft):
+			collectFields(ft, keyPath, fields)
+		case ft.Kind() == reflect.Slice && isSection(indirect(ft.Elem())):
+			collectFields(indirect(ft.Elem()), keyPath+"[]", fields)
+		}
+	}
+}
+
+// isSection reports whether t is decoded as a nested section of keys.
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(jsonUnmarshaler)
+}
+
+// typeName returns the Field type of a Go type.
+func typeName(t reflect.Type) string {
+	t = indirect(t)
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map:
+		return "map"
+	case reflect.Struct:
+		return "section"
+	default:
+		return "string"
+	}
+}
+
+// IsItem reports whether the field describes the items of a list, such as "rules[].glob".
+func (f Field) IsItem() bool {
+	return strings.Contains(f.Path, "[]")
+}
@@ -0,0 +1,582 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a configuration file format.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// FormatFor picks the format from the file extension: .yaml and .yml are YAML,
+// .toml is TOML, anything else is JSON.
+func FormatFor(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// LoadConfig reads the configuration file in the format given by its extension,
+// expands ${VAR} references, applies FILEKEEPER_* environment overrides and validates
+// the result. Unknown keys are rejected with their line and column.
+func LoadConfig(filePath string) (*Config, error) {
+	cfg, _, err := LoadConfigWithOrigin(filePath)
+	return cfg, err
+}
+
+// LoadConfigWithOrigin is LoadConfig that also reports where each value came from.
+func LoadConfigWithOrigin(filePath string) (*Config, *Origin, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg, origin, err := parse(data, FormatFor(filePath), os.LookupEnv)
+	if err != nil {
+		var parseErr *ParseError
+		if errors.As(err, &parseErr) && parseErr.Line > 0 {
+			return nil, nil, fmt.Errorf("%s:%w", filePath, err)
+		}
+		return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	origin.File = filePath
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, origin, nil
+}
+
+// Parse decodes a configuration without validating it. lookupEnv resolves ${VAR}
+// references and FILEKEEPER_* overrides; pass nil to use neither.
+// Errors start with the line and column of the offending key where it is known.
+func Parse(data []byte, format Format, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg, _, err := parse(data, format, lookupEnv)
+	return cfg, err
+}
+
+// parse implements Parse and records the origin of each value.
+func parse(data []byte, format Format, lookupEnv func(string) (string, bool)) (*Config, *Origin, error) {
+	tree, pos, err := parseTree(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	origin := &Origin{
+		positions:    pos,
+		env:          make(map[string]string),
+		interpolated: make(map[string][]string),
+	}
+
+	configType := reflect.TypeOf(Config{})
+	if err := checkFields(tree, configType, "", pos); err != nil {
+		return nil, nil, err
+	}
+
+	if lookupEnv != nil {
+		if _, err := interpolate(tree, configType, "", origin, lookupEnv); err != nil {
+			return nil, nil, err
+		}
+		if err := applyEnv(tree, configType, "", origin, lookupEnv); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Every format is decoded through the JSON tags, so custom types such as durations apply
+	encoded, err := json.Marshal(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := &Config{}
+	if err := json.Unmarshal(encoded, cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, nil, pos.errorf(typeErr.Field, "%s must be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, nil, err
+	}
+	return cfg, origin, nil
+}
+
+// Origin records where the values of a loaded configuration came from.
+type Origin struct {
+	File         string              // Configuration file path
+	positions    positions           // Key positions in the file
+	env          map[string]string   // Key path -> FILEKEEPER_* variable that set it
+	interpolated map[string][]string // Key path -> variables referenced in its file value
+}
+
+// Source describes where the value of a key path came from: the environment
+// variable that overrides it, its position in the file (with any ${VAR}
+// references), or "default" if it is not set.
+func (o *Origin) Source(path string) string {
+	if name, ok := o.env[path]; ok {
+		return "env " + name
+	}
+	if pos, ok := o.positions[path]; ok {
+		src := fmt.Sprintf("%s:%d:%d", o.File, pos.line, pos.col)
+		if vars := o.interpolated[path]; len(vars) > 0 {
+			src += " via ${" + strings.Join(vars, "}, ${") + "}"
+		}
+		return src
+	}
+	return "default"
+}
+
+// IsSet reports whether the key path was set by the file or the environment.
+func (o *Origin) IsSet(path string) bool {
+	return o.Source(path) != "default"
+}
+
+// position is the line and column of a key in the configuration file.
+type position struct {
+	line, col int
+}
+
+// positions maps key paths such as "archive.format" or "rules[0].glob" to their position.
+type positions map[string]position
+
+// errorf returns a ParseError at the position of a key path, if known.
+func (p positions) errorf(path, format string, args ...interface{}) error {
+	pos := p[path]
+	return errorAt(pos.line, pos.col, fmt.Errorf(format, args...))
+}
+
+// ParseError is a configuration error at a line and column of the file.
+// Line is zero when the position is not known.
+type ParseError struct {
+	Line, Column int
+	Err          error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%d:%d: %v", e.Line, e.Column, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt returns a ParseError at line and col.
+func errorAt(line, col int, err error) error {
+	return &ParseError{Line: line, Column: col, Err: err}
+}
+
+// joinPath appends a key to a path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// parseTree decodes data into maps, slices and scalars and records key positions.
+func parseTree(data []byte, format Format) (map[string]interface{}, positions, error) {
+	pos := make(positions)
+	var value interface{}
+	var err error
+	switch format {
+	case FormatYAML:
+		value, err = parseYAML(data, pos)
+	case FormatTOML:
+		value, err = parseTOML(data, pos)
+	default:
+		value, err = parseJSON(data, pos)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if value == nil {
+		return make(map[string]interface{}), pos, nil
+	}
+	tree, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, errorAt(1, 1, fmt.Errorf("configuration must be a mapping of keys to values"))
+	}
+	return tree, pos, nil
+}
+
+// parseJSON decodes JSON token by token to record the position of every key.
+func parseJSON(data []byte, pos positions) (interface{}, error) {
+	// The token stream reports syntax errors less precisely, so check the syntax first
+	var probe interface{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, jsonError(data, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := readJSON(dec, data, "", pos)
+	if err != nil {
+		return nil, jsonError(data, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		line, col := lineCol(data, int(dec.InputOffset()))
+		return nil, errorAt(line, col, fmt.Errorf("unexpected data after the configuration"))
+	}
+	return value, nil
+}
+
+// readJSON reads one JSON value at path.
+func readJSON(dec *json.Decoder, data []byte, path string, pos positions) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := make(map[string]interface{})
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := keyTok.(string)
+			// The offset is just past the closing quote of the key
+			end := int(dec.InputOffset())
+			start := bytes.LastIndexByte(data[:end-1], '"')
+			line, col := lineCol(data, start)
+			keyPath := joinPath(path, key)
+			pos[keyPath] = position{line, col}
+
+			value, err := readJSON(dec, data, keyPath, pos)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		_, err := dec.Token() // Closing brace
+		return m, err
+	case json.Delim('['):
+		items := make([]interface{}, 0)
+		for i := 0; dec.More(); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			line, col := lineCol(data, skipSeparators(data, int(dec.InputOffset())))
+			pos[itemPath] = position{line, col}
+			value, err := readJSON(dec, data, itemPath, pos)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		_, err := dec.Token() // Closing bracket
+		return items, err
+	default:
+		return tok, nil
+	}
+}
+
+// skipSeparators returns the offset of the next value after whitespace and commas.
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n,", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// jsonError adds the line and column to JSON syntax errors.
+func jsonError(data []byte, err error) error {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		// Offset is just past the offending character
+		line, col := lineCol(data, int(syntaxErr.Offset)-1)
+		return errorAt(line, col, err)
+	}
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		line, col := lineCol(data, len(data))
+		return errorAt(line, col, fmt.Errorf("unexpected end of JSON input"))
+	}
+	return err
+}
+
+// lineCol converts a byte offset to a 1-based line and column.
+func lineCol(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	col := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return line, col
+}
+
+// parseYAML decodes YAML through its node tree to record the position of every key.
+func parseYAML(data []byte, pos positions) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return convertYAML(doc.Content[0], "", pos)
+}
+
+// convertYAML converts a YAML node at path.
+func convertYAML(node *yaml.Node, path string, pos positions) (interface{}, error) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := make(map[string]interface{})
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			if keyNode.Tag == "!!merge" {
+				return nil, errorAt(keyNode.Line, keyNode.Column, fmt.Errorf("merge keys are not supported"))
+			}
+			keyPath := joinPath(path, keyNode.Value)
+			pos[keyPath] = position{keyNode.Line, keyNode.Column}
+			value, err := convertYAML(valueNode, keyPath, pos)
+			if err != nil {
+				return nil, err
+			}
+			m[keyNode.Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+		for i, itemNode := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			pos[itemPath] = position{itemNode.Line, itemNode.Column}
+			value, err := convertYAML(itemNode, itemPath, pos)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case yaml.AliasNode:
+		return convertYAML(node.Alias, path, pos)
+	default:
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, errorAt(node.Line, node.Column, err)
+		}
+		return value, nil
+	}
+}
+
+// parseTOML decodes TOML and walks its syntax tree to record the position of every key.
+func parseTOML(data []byte, pos positions) (interface{}, error) {
+	var m map[string]interface{}
+	if err := toml.Unmarshal(data, &m); err != nil {
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			line, col := decodeErr.Position()
+			return nil, errorAt(line, col, err)
+		}
+		return nil, err
+	}
+
+	p := &unstable.Parser{}
+	p.Reset(data)
+	table := ""
+	arrays := make(map[string]int) // Number of [[array]] tables seen, by resolved path
+	for p.NextExpression() {
+		expr := p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			it := expr.Key()
+			table = tomlKeyPath(p, "", &it, pos, arrays)
+			if expr.Kind == unstable.ArrayTable {
+				first := table
+				table = fmt.Sprintf("%s[%d]", table, arrays[table])
+				arrays[first]++
+				pos[table] = pos[first]
+			}
+		case unstable.KeyValue:
+			recordTOMLKeyValue(p, table, expr, pos, arrays)
+		}
+	}
+	return m, nil
+}
+
+// tomlKeyPath resolves a dotted key under path, recording the position of each part.
+// Parts that name an array of tables refer to its latest element.
+func tomlKeyPath(p *unstable.Parser, path string, it *unstable.Iterator, pos positions, arrays map[string]int) string {
+	for it.Next() {
+		node := it.Node()
+		path = joinPath(path, string(node.Data))
+		if _, ok := pos[path]; !ok {
+			shape := p.Shape(tomlRange(p, node))
+			pos[path] = position{shape.Start.Line, shape.Start.Column}
+		}
+		if n, ok := arrays[path]; ok && !it.IsLast() {
+			path = fmt.Sprintf("%s[%d]", path, n-1)
+		}
+	}
+	return path
+}
+
+// recordTOMLKeyValue records the positions of a key-value expression and of
+// the keys of inline tables in its value.
+func recordTOMLKeyValue(p *unstable.Parser, table string, expr *unstable.Node, pos positions, arrays map[string]int) {
+	it := expr.Key()
+	path := tomlKeyPath(p, table, &it, pos, arrays)
+	recordTOMLValue(p, path, expr.Value(), pos, arrays)
+}
+
+// recordTOMLValue records the keys inside inline tables and arrays.
+func recordTOMLValue(p *unstable.Parser, path string, value *unstable.Node, pos positions, arrays map[string]int) {
+	switch value.Kind {
+	case unstable.InlineTable:
+		children := value.Children()
+		for children.Next() {
+			recordTOMLKeyValue(p, path, children.Node(), pos, arrays)
+		}
+	case unstable.Array:
+		children := value.Children()
+		for i := 0; children.Next(); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			pos[itemPath] = pos[path]
+			recordTOMLValue(p, itemPath, children.Node(), pos, arrays)
+		}
+	}
+}
+
+// tomlRange returns the input range of a key node.
+func tomlRange(p *unstable.Parser, node *unstable.Node) unstable.Range {
+	if node.Raw.Length > 0 {
+		return node.Raw
+	}
+	return p.Range(node.Data)
+}
+
+// jsonUnmarshaler is implemented by types that decode themselves, such as durations.
+var jsonUnmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// jsonFields returns the fields of a struct type by their JSON name.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if name, ok := jsonName(f); ok {
+			fields[name] = f
+		}
+	}
+	return fields
+}
+
+// jsonName returns the JSON name of a struct field, or false if it is not encoded.
+func jsonName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false // Unexported
+	}
+	name := strings.Split(f.Tag.Get("json"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+// lookupField finds a field by JSON name, ignoring case like encoding/json does.
+func lookupField(fields map[string]reflect.StructField, key string) (reflect.StructField, bool) {
+	if f, ok := fields[key]; ok {
+		return f, true
+	}
+	for name, f := range fields {
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// checkFields rejects keys that do not correspond to a field of t.
+// Keys are checked in file order, so the first unknown key is reported.
+func checkFields(value interface{}, t reflect.Type, path string, pos positions) error {
+	t = indirect(t)
+	if reflect.PtrTo(t).Implements(jsonUnmarshaler) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil // Type mismatches are reported by the decoder
+		}
+		fields := jsonFields(t)
+		for _, key := range sortedKeys(m, path, pos) {
+			keyPath := joinPath(path, key)
+			f, ok := lookupField(fields, key)
+			if !ok {
+				return pos.errorf(keyPath, "unknown field %q", keyPath)
+			}
+			if err := checkFields(m[key], f.Type, keyPath, pos); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			if err := checkFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), pos); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for _, key := range sortedKeys(m, path, pos) {
+			if err := checkFields(m[key], t.Elem(), joinPath(path, key), pos); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in file order, then by name.
+func sortedKeys(m map[string]interface{}, path string, pos positions) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		pi, pj := pos[joinPath(path, keys[i])], pos[joinPath(path, keys[j])]
+		if pi.line != pj.line {
+			return pi.line < pj.line
+		}
+		if pi.col != pj.col {
+			return pi.col < pj.col
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
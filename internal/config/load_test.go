@@ -0,0 +1,236 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap returns a lookupEnv function backed by a map.
+func envMap(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	tempDir := t.TempDir()
+	target := filepath.ToSlash(tempDir)
+
+	files := map[string]string{
+		"config.json": `{
+  "target_folder": "` + target + `",
+  "prune_after": "36h",
+  "run_interval": "1h",
+  "compression": {"enabled": true, "algorithm": "gzip", "level": 9},
+  "rules": [{"glob": "*.log", "prune_after": "P7D"}]
+}`,
+		"config.yaml": `target_folder: ` + target + `
+prune_after: 36h
+run_interval: 1h
+compression:
+  enabled: true
+  algorithm: gzip
+  level: 9
+rules:
+  - glob: "*.log"
+    prune_after: P7D
+`,
+		"config.toml": `target_folder = "` + target + `"
+prune_after = "36h"
+run_interval = "1h"
+
+[compression]
+enabled = true
+algorithm = "gzip"
+level = 9
+
+[[rules]]
+glob = "*.log"
+prune_after = "P7D"
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, name)
+			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg, err := LoadConfig(configPath)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+			if cfg.TargetFolder != target || cfg.GetPruneAfter() != 36*time.Hour || cfg.GetRunInterval() != time.Hour {
+				t.Errorf("Unexpected top-level fields: %+v", cfg)
+			}
+			if c := cfg.Compression; c == nil || !c.Enabled || c.Algorithm != "gzip" || c.Level != 9 {
+				t.Errorf("Unexpected compression: %+v", c)
+			}
+			if len(cfg.Rules) != 1 || cfg.Rules[0].Glob != "*.log" || cfg.Rules[0].PruneAfter() != 7*24*time.Hour {
+				t.Errorf("Unexpected rules: %+v", cfg.Rules)
+			}
+		})
+	}
+}
+
+func TestParse_UnknownField(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		content string
+		want    string
+	}{
+		{"json top level", FormatJSON, "{\n  \"target_folder\": \"/data\",\n  \"prune_aftr\": \"1h\"\n}", `3:3: unknown field "prune_aftr"`},
+		{"json nested", FormatJSON, `{"compression": {"enabled": true, "levl": 3}}`, `1:35: unknown field "compression.levl"`},
+		{"json rule", FormatJSON, "{\"rules\": [\n  {\"glob\": \"*\", \"age\": \"1h\"}\n]}", `2:17: unknown field "rules[0].age"`},
+		{"yaml nested", FormatYAML, "archive:\n  enabled: true\n  group: daily\n", `3:3: unknown field "archive.group"`},
+		{"yaml rule", FormatYAML, "rules:\n  - glob: '*'\n  - glob: '*.tmp'\n    hours: 1\n", `4:5: unknown field "rules[1].hours"`},
+		{"toml table", FormatTOML, "target_folder = \"/data\"\n\n[compression]\nalgo = \"gzip\"\n", `4:1: unknown field "compression.algo"`},
+		{"toml array table", FormatTOML, "[[rules]]\nglob = \"*\"\n\n[[rules]]\nglob = \"*.tmp\"\nage = \"1h\"\n", `6:1: unknown field "rules[1].age"`},
+		{"toml inline table", FormatTOML, "archive = { enabled = true, fmt = \"tar\" }\n", `1:29: unknown field "archive.fmt"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content), tt.format, nil)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Parse() error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_SyntaxAndTypeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		content string
+		want    string
+	}{
+		{"json syntax", FormatJSON, "{\n  \"target_folder\": \"/data\",\n}", "3:1:"},
+		{"json type", FormatJSON, "{\n  \"max_total_bytes\": \"lots\"\n}", "2:3: max_total_bytes must be int64"},
+		{"yaml type", FormatYAML, "enable_backup: true\nmax_total_bytes: lots\n", "2:1: max_total_bytes must be int64"},
+		{"toml syntax", FormatTOML, "target_folder = \n", "1:"},
+		{"not a mapping", FormatYAML, "- a\n- b\n", "1:1: configuration must be a mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.content), tt.format, nil)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want prefix %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_ErrorNamesFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(configPath, []byte("target_folder: /data\nbogus: 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(configPath)
+	if want := configPath + `:2:1: unknown field "bogus"`; err == nil || err.Error() != want {
+		t.Errorf("LoadConfig() error = %v, want %s", err, want)
+	}
+}
+
+func TestParse_EnvOverrides(t *testing.T) {
+	content := `{"target_folder": "/data", "prune_after": "1h", "compression": {"enabled": false, "level": 6}}`
+	env := envMap(map[string]string{
+		"FILEKEEPER_TARGET_FOLDER":        "/mnt/logs",
+		"FILEKEEPER_PRUNE_AFTER":          "P2D",
+		"FILEKEEPER_RUN_INTERVAL":         "900",
+		"FILEKEEPER_ENABLE_BACKUP":        "true",
+		"FILEKEEPER_BACKUP_PATHS":         "/backup/a, /backup/b",
+		"FILEKEEPER_COMPRESSION_ENABLED":  "1",
+		"FILEKEEPER_COMPRESSION_LEVEL":    "9",
+		"FILEKEEPER_ARCHIVE_GROUP_BY":     "weekly",
+		"FILEKEEPER_SAFETY_MAX_PERCENT":   "12.5",
+		"FILEKEEPER_RULES":                `[{"glob": "*.tmp", "prune_after": "1h"}]`,
+		"FILEKEEPER_NOTIFICATIONS_UNUSED": "ignored",
+	})
+
+	cfg, err := Parse([]byte(content), FormatJSON, env)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if cfg.TargetFolder != "/mnt/logs" || cfg.GetPruneAfter() != 48*time.Hour || cfg.GetRunInterval() != 15*time.Minute || !cfg.EnableBackup {
+		t.Errorf("Unexpected top-level fields: %+v", cfg)
+	}
+	if got := strings.Join(cfg.BackupPaths, ","); got != "/backup/a,/backup/b" {
+		t.Errorf("BackupPaths = %q", got)
+	}
+	if c := cfg.Compression; c == nil || !c.Enabled || c.Level != 9 {
+		t.Errorf("Unexpected compression: %+v", c)
+	}
+	if a := cfg.Archive; a == nil || a.GroupBy != "weekly" {
+		t.Errorf("Expected archive section created from the environment, got %+v", a)
+	}
+	if s := cfg.Safety; s == nil || s.MaxPercent != 12.5 {
+		t.Errorf("Unexpected safety: %+v", s)
+	}
+	if len(cfg.Rules) != 1 || cfg.Rules[0].Glob != "*.tmp" {
+		t.Errorf("Unexpected rules: %+v", cfg.Rules)
+	}
+	// Sections without variables stay unset
+	if cfg.Trash != nil || cfg.InUseCheck != nil {
+		t.Errorf("Expected unset sections to stay nil, got trash %+v, in_use_check %+v", cfg.Trash, cfg.InUseCheck)
+	}
+
+	_, err = Parse([]byte(content), FormatJSON, envMap(map[string]string{"FILEKEEPER_COMPRESSION_LEVEL": "high"}))
+	if err == nil || !strings.Contains(err.Error(), "FILEKEEPER_COMPRESSION_LEVEL") {
+		t.Errorf("Expected error naming the variable, got %v", err)
+	}
+}
+
+func TestParse_Interpolation(t *testing.T) {
+	env := envMap(map[string]string{
+		"SMTP_PASSWORD": "s3cret",
+		"MAX_FILES":     "500",
+		"EMPTY":         "",
+	})
+
+	content := `notifications:
+  email:
+    host: smtp.example.com
+    port: 587
+    from: filekeeper@example.com
+    to: [ops@example.com]
+    password: ${SMTP_PASSWORD}
+target_folder: ${DATA_DIR:-/var/data}/logs
+log_format: ${EMPTY:-json}
+age_source_layout: "$${literal}"
+safety:
+  max_files: ${MAX_FILES}
+`
+	cfg, err := Parse([]byte(content), FormatYAML, env)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got := cfg.Notifications.Email.Password; got != "s3cret" {
+		t.Errorf("password = %q", got)
+	}
+	if cfg.TargetFolder != "/var/data/logs" {
+		t.Errorf("target_folder = %q", cfg.TargetFolder)
+	}
+	if cfg.LogFormat != "json" {
+		t.Errorf("log_format = %q", cfg.LogFormat)
+	}
+	if cfg.AgeSourceLayout != "${literal}" {
+		t.Errorf("age_source_layout = %q", cfg.AgeSourceLayout)
+	}
+	if cfg.Safety == nil || cfg.Safety.MaxFiles != 500 {
+		t.Errorf("Unexpected safety: %+v", cfg.Safety)
+	}
+
+	_, err = Parse([]byte("target_folder: /data\nbackup_path: ${BACKUP_DIR}\n"), FormatYAML, env)
+	if want := "2:1: backup_path: environment variable BACKUP_DIR is not set"; err == nil || err.Error() != want {
+		t.Errorf("Parse() error = %v, want %s", err, want)
+	}
+}
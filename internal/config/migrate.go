@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// migrations maps the older single-value keys to the lists that replace them.
+// The single value was used before the list entries, so it is prepended.
+var migrations = []struct{ from, to string }{
+	{"backup_path", "backup_paths"},
+	{"remote_backup", "remote_backups"},
+}
+
+// Migrate rewrites the older backup_path and remote_backup keys into the
+// backup_paths and remote_backups lists. It returns the rewritten file and a
+// description of each change; without changes the file is returned as is.
+// JSON and YAML keep the key order, and YAML keeps comments; TOML is re-encoded.
+func Migrate(data []byte, format Format) ([]byte, []string, error) {
+	// Report syntax errors with their position first
+	if _, _, err := parseTree(data, format); err != nil {
+		return nil, nil, err
+	}
+
+	if format == FormatTOML {
+		return migrateTOML(data)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return data, nil, nil
+	}
+
+	var changes []string
+	for _, m := range migrations {
+		if change := migrateNode(doc.Content[0], m.from, m.to); change != "" {
+			changes = append(changes, change)
+		}
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+
+	out, err := encodeNode(&doc, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, changes, nil
+}
+
+// migrateNode moves the value of key from into the list at key to in a mapping node.
+func migrateNode(mapping *yaml.Node, from, to string) string {
+	fromIdx, toIdx := -1, -1
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		switch mapping.Content[i].Value {
+		case from:
+			fromIdx = i
+		case to:
+			toIdx = i
+		}
+	}
+	if fromIdx < 0 {
+		return ""
+	}
+
+	value := mapping.Content[fromIdx+1]
+	empty := value.Kind != yaml.ScalarNode || value.ShortTag() == "!!null" || value.Value == ""
+
+	switch {
+	case empty:
+		// Nothing to keep
+	case toIdx < 0 || mapping.Content[toIdx+1].Kind != yaml.SequenceNode:
+		// Reuse the key in place so its position and comments are kept
+		mapping.Content[fromIdx].Value = to
+		mapping.Content[fromIdx+1] = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: []*yaml.Node{value}}
+		if toIdx >= 0 {
+			removePair(mapping, toIdx)
+		}
+		return fmt.Sprintf("moved %s %q into %s", from, value.Value, to)
+	default:
+		list := mapping.Content[toIdx+1]
+		for _, item := range list.Content {
+			if item.Value == value.Value {
+				removePair(mapping, fromIdx)
+				return fmt.Sprintf("removed %s %q, already in %s", from, value.Value, to)
+			}
+		}
+		list.Content = append([]*yaml.Node{value}, list.Content...)
+		removePair(mapping, fromIdx)
+		return fmt.Sprintf("moved %s %q into %s", from, value.Value, to)
+	}
+
+	removePair(mapping, fromIdx)
+	return fmt.Sprintf("removed empty %s", from)
+}
+
+// removePair removes the key at index i and its value from a mapping node.
+func removePair(mapping *yaml.Node, i int) {
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+}
+
+// migrateTOML migrates a TOML file through a map, which does not keep comments or key order.
+func migrateTOML(data []byte) ([]byte, []string, error) {
+	var tree map[string]interface{}
+	if err := toml.Unmarshal(data, &tree); err != nil {
+		return nil, nil, err
+	}
+
+	var changes []string
+	for _, m := range migrations {
+		value, ok := tree[m.from]
+		if !ok {
+			continue
+		}
+		delete(tree, m.from)
+
+		s, _ := value.(string)
+		if s == "" {
+			changes = append(changes, fmt.Sprintf("removed empty %s", m.from))
+			continue
+		}
+		list, _ := tree[m.to].([]interface{})
+		found := false
+		for _, item := range list {
+			found = found || item == s
+		}
+		if found {
+			changes = append(changes, fmt.Sprintf("removed %s %q, already in %s", m.from, s, m.to))
+			continue
+		}
+		tree[m.to] = append([]interface{}{s}, list...)
+		changes = append(changes, fmt.Sprintf("moved %s %q into %s", m.from, s, m.to))
+	}
+	if len(changes) == 0 {
+		return data, nil, nil
+	}
+
+	out, err := toml.Marshal(tree)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, append(changes, "comments and key order are not kept in TOML files"), nil
+}
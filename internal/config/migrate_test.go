@@ -0,0 +1,176 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      Format
+		input       string
+		contains    []string
+		notContains []string
+		changes     int
+	}{
+		{
+			name:   "yaml keeps comments",
+			format: FormatYAML,
+			input: `# Service logs
+target_folder: /var/log/app
+backup_path: /backup/a # nightly
+backup_paths:
+  - /backup/b
+remote_backup: host:/logs
+`,
+			contains:    []string{"# Service logs", "- /backup/a", "- /backup/b", "remote_backups:", "- host:/logs"},
+			notContains: []string{"backup_path:", "remote_backup:"},
+			changes:     2,
+		},
+		{
+			name:        "json dedupes",
+			format:      FormatJSON,
+			input:       `{"target_folder": "/var/log/app", "backup_path": "/backup/a", "backup_paths": ["/backup/a"]}`,
+			contains:    []string{`"backup_paths": [`, `"/backup/a"`},
+			notContains: []string{`"backup_path":`},
+			changes:     1,
+		},
+		{
+			name:     "toml",
+			format:   FormatTOML,
+			input:    "target_folder = '/var/log/app'\nbackup_path = '/backup/a'\n",
+			contains: []string{"backup_paths = ['/backup/a']"},
+			changes:  2, // Includes the note that comments are not kept
+		},
+		{
+			name:    "up to date",
+			format:  FormatYAML,
+			input:   "target_folder: /var/log/app\nbackup_paths: [/backup/a]\n",
+			changes: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, changes, err := Migrate([]byte(tt.input), tt.format)
+			if err != nil {
+				t.Fatalf("Migrate failed: %v", err)
+			}
+			if len(changes) != tt.changes {
+				t.Errorf("Expected %d changes, got %q", tt.changes, changes)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("Expected output to contain %q, got:\n%s", s, out)
+				}
+			}
+			for _, s := range tt.notContains {
+				if strings.Contains(string(out), s) {
+					t.Errorf("Expected output not to contain %q, got:\n%s", s, out)
+				}
+			}
+			if tt.changes == 0 && string(out) != tt.input {
+				t.Errorf("Expected an up-to-date file to be returned as is, got:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	cfg, err := Parse([]byte(`{
+  "target_folder": "/var/log/app",
+  "backup_path": "/backup/a",
+  "prune_after": "P7D",
+  "run_interval": "1h",
+  "rules": [{"glob": "*.log", "prune_after": "36h"}]
+}`), FormatJSON, envMap(nil))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	effective := cfg.Effective()
+	if got := effective.GetBackupPaths(); !reflect.DeepEqual(got, []string{"/backup/a"}) {
+		t.Errorf("Expected backup_path merged into backup_paths, got %v", got)
+	}
+
+	for _, format := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			out, err := Encode(effective, format)
+			if err != nil {
+				t.Fatalf("Encode failed: %v", err)
+			}
+			parsed, err := Parse(out, format, envMap(nil))
+			if err != nil {
+				t.Fatalf("Encoded configuration does not parse: %v\n%s", err, out)
+			}
+			if !reflect.DeepEqual(parsed.Effective(), effective) {
+				t.Errorf("Round trip changed the configuration:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestSchema_CoversFields(t *testing.T) {
+	data, err := json.Marshal(Schema())
+	if err != nil {
+		t.Fatalf("Schema does not encode: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema does not decode: %v", err)
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	for _, f := range Fields() {
+		if f.Description == "" {
+			t.Errorf("Field %s has no description", f.Path)
+		}
+		if strings.Contains(f.Path, ".") {
+			continue
+		}
+		if _, ok := properties[f.Path]; !ok {
+			t.Errorf("Schema is missing top-level field %s", f.Path)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cfg, origin, err := parse([]byte(`{
+  "target_folder": "/var/log/app",
+  "backup_path": "/backup/a",
+  "prune_after": "P7D",
+  "rules": [{"glob": "${APP_GLOB}", "prune_after": "36h"}],
+  "notifications": {
+    "enabled": true,
+    "webhooks": [{"url": "https://hooks.example.com/T0/B0/token", "headers": {"Authorization": "Bearer ${TOKEN}"}}],
+    "email": {"host": "smtp.example.com", "port": 587, "username": "ops", "password": "s3cret", "from": "a@example.com", "to": ["b@example.com"]}
+  }
+}`), FormatJSON, envMap(map[string]string{"APP_GLOB": "*.secret", "TOKEN": "abc123"}))
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+
+	for _, format := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+		out, err := EncodeRedacted(cfg, origin, format)
+		if err != nil {
+			t.Fatalf("EncodeRedacted failed: %v", err)
+		}
+		for _, secret := range []string{"s3cret", "abc123", "*.secret", "hooks.example.com"} {
+			if strings.Contains(string(out), secret) {
+				t.Errorf("%s: expected %q redacted:\n%s", format, secret, out)
+			}
+		}
+		for _, visible := range []string{"smtp.example.com", "Authorization", "[redacted]", "/backup/a"} {
+			if !strings.Contains(string(out), visible) {
+				t.Errorf("%s: expected %q in the output:\n%s", format, visible, out)
+			}
+		}
+	}
+
+	// The configuration itself, used for plan digests, keeps the values
+	if cfg.Notifications.Email.Password != "s3cret" || cfg.Rules[0].Glob != "*.secret" {
+		t.Error("Expected Redact to leave the configuration unchanged")
+	}
+}
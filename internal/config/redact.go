@@ -0,0 +1,94 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values in the output of "config print" and "config explain".
+const redacted = "[redacted]"
+
+// listIndex matches the list indexes of a key path, e.g. "[0]" in "hooks[0].command".
+var listIndex = regexp.MustCompile(`\[\d+\]`)
+
+// Redact returns the effective configuration as JSON, with the values of secret keys
+// and the values that came from ${VAR} references replaced by "[redacted]". origin
+// may be nil. Keys keep their declaration order. It is meant for display only; the
+// digest of a plan is taken from the configuration as it is.
+func Redact(cfg *Config, origin *Origin) ([]byte, error) {
+	data, err := json.Marshal(cfg.Effective())
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) > 0 {
+		redactNode(doc.Content[0], "", origin)
+	}
+	return encodeNode(&doc, FormatJSON)
+}
+
+// EncodeRedacted writes the effective configuration in format, redacted as by Redact.
+func EncodeRedacted(cfg *Config, origin *Origin, format Format) ([]byte, error) {
+	data, err := Redact(cfg, origin)
+	if err != nil {
+		return nil, err
+	}
+	return convertJSON(data, format)
+}
+
+// redactNode redacts the secret and interpolated values under node, the value of path.
+func redactNode(node *yaml.Node, path string, origin *Origin) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyPath := joinPath(path, node.Content[i].Value)
+			if isSecret(keyPath, origin) {
+				redactAll(node.Content[i+1])
+				continue
+			}
+			redactNode(node.Content[i+1], keyPath, origin)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			if isSecret(itemPath, origin) {
+				redactAll(item)
+				continue
+			}
+			redactNode(item, itemPath, origin)
+		}
+	}
+}
+
+// isSecret reports whether the value of the key path is redacted.
+func isSecret(path string, origin *Origin) bool {
+	if fieldDocs[listIndex.ReplaceAllString(path, "[]")].secret {
+		return true
+	}
+	return origin != nil && len(origin.interpolated[path]) > 0
+}
+
+// redactAll replaces every set scalar under node; empty values stay visible.
+func redactAll(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!null" || node.Value == "" {
+			return
+		}
+		node.Value, node.Tag, node.Style = redacted, "!!str", 0
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			redactAll(node.Content[i])
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			redactAll(item)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// SchemaID is the $id of the configuration JSON Schema.
+const SchemaID = "https://github.com/DenisFri/filekeeper/config.schema.json"
+
+// Schema returns a JSON Schema (draft 2020-12) for the configuration file, for
+// editor validation of JSON and YAML files. Unknown keys are rejected, as by LoadConfig.
+func Schema() map[string]interface{} {
+	s := schemaFor(reflect.TypeOf(Config{}), "")
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = SchemaID
+	s["title"] = "filekeeper configuration"
+	s["required"] = []string{"target_folder", "run_interval"}
+	return s
+}
+
+// schemaFor returns the schema of a value of type t at path.
+func schemaFor(t reflect.Type, path string) map[string]interface{} {
+	t = indirect(t)
+	s := make(map[string]interface{})
+	if doc, ok := fieldDocs[path]; ok {
+		if doc.desc != "" {
+			s["description"] = doc.desc
+		}
+		if len(doc.enum) > 0 && t.Kind() == reflect.String {
+			s["enum"] = doc.enum
+		}
+		if doc.deprecated != "" {
+			s["deprecated"] = true
+		}
+		if doc.def != "" {
+			s["default"] = schemaDefault(t, doc.def)
+		}
+	}
+
+	switch typeName(t) {
+	case "duration":
+		s["type"] = []string{"string", "number"}
+	case "boolean", "integer", "number", "string":
+		s["type"] = typeName(t)
+	case "list":
+		s["type"] = "array"
+		items := schemaFor(t.Elem(), path+"[]")
+		if doc, ok := fieldDocs[path]; ok && len(doc.enum) > 0 {
+			items["enum"] = doc.enum
+		}
+		s["items"] = items
+	case "map":
+		s["type"] = "object"
+		s["additionalProperties"] = schemaFor(t.Elem(), path+"[]")
+	case "section":
+		props := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if name, ok := jsonName(f); ok {
+				props[name] = schemaFor(f.Type, joinPath(path, name))
+			}
+		}
+		s["type"] = "object"
+		s["properties"] = props
+		s["additionalProperties"] = false
+	}
+	return s
+}
+
+// schemaDefault converts a documented default to the JSON type of t.
+func schemaDefault(t reflect.Type, def string) interface{} {
+	switch typeName(t) {
+	case "boolean":
+		if b, err := strconv.ParseBool(def); err == nil {
+			return b
+		}
+	case "integer", "number":
+		if f, err := strconv.ParseFloat(def, 64); err == nil {
+			return f
+		}
+	}
+	return def
+}
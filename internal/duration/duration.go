@@ -0,0 +1,170 @@
+// Package duration parses the durations accepted in the configuration: Go durations
+// such as "36h" or "90m", and ISO-8601 durations such as "P30D" or "PT1H30M".
+package duration
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a configuration duration. In JSON it is a string accepted by Parse,
+// or a number of seconds.
+type Duration time.Duration
+
+// Std returns the duration as a time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration in Go syntax, e.g. "36h0m0s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON encodes the duration as a Go duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON decodes a duration string or a number of seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		parsed, err := Parse(s)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err != nil {
+		return fmt.Errorf("duration must be a string such as \"36h\" or \"P30D\", or a number of seconds")
+	}
+	parsed, err := fromFloat(seconds, time.Second)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Hours converts a number of hours to a duration without truncating fractions.
+func Hours(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// Parse parses a Go duration ("1h30m", "0.5h") or an ISO-8601 duration ("P30D",
+// "P1W", "PT36H", "P1DT12H", "PT0.5H"). ISO years and months are rejected, since
+// their length varies.
+func Parse(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+	if s[0] == 'P' || s[0] == 'p' || strings.HasPrefix(s, "-P") || strings.HasPrefix(s, "-p") {
+		return parseISO(s)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: use Go syntax such as \"36h\" or ISO-8601 such as \"P30D\"", s)
+	}
+	return d, nil
+}
+
+// parseISO parses an ISO-8601 duration of weeks, days, hours, minutes and seconds.
+// Designators must appear in that order, each at most once.
+func parseISO(s string) (time.Duration, error) {
+	orig := s
+	sign := time.Duration(1)
+	if s[0] == '-' {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.ToUpper(s[1:]) // Drop the P designator
+
+	var total time.Duration
+	inTime := false
+	units := 0
+	last := 0 // Rank of the previous designator; W, D, H, M and S must come in that order, once each
+	for len(s) > 0 {
+		if s[0] == 'T' {
+			if inTime {
+				return 0, fmt.Errorf("invalid duration %q: repeated T designator", orig)
+			}
+			inTime = true
+			s = s[1:]
+			if s == "" {
+				return 0, fmt.Errorf("invalid duration %q: no time after T", orig)
+			}
+			continue
+		}
+
+		// Number with an optional fraction (ISO allows a comma as decimal separator)
+		end := 0
+		for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == ',') {
+			end++
+		}
+		if end == 0 || end == len(s) {
+			return 0, fmt.Errorf("invalid duration %q", orig)
+		}
+		value, err := strconv.ParseFloat(strings.Replace(s[:end], ",", ".", 1), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", orig, err)
+		}
+
+		var unit time.Duration
+		var rank int
+		designator := s[end]
+		switch {
+		case !inTime && designator == 'W':
+			unit, rank = 7*24*time.Hour, 1
+		case !inTime && designator == 'D':
+			unit, rank = 24*time.Hour, 2
+		case inTime && designator == 'H':
+			unit, rank = time.Hour, 3
+		case inTime && designator == 'M':
+			unit, rank = time.Minute, 4
+		case inTime && designator == 'S':
+			unit, rank = time.Second, 5
+		case !inTime && (designator == 'Y' || designator == 'M'):
+			return 0, fmt.Errorf("invalid duration %q: years and months are not supported, use days", orig)
+		default:
+			return 0, fmt.Errorf("invalid duration %q: unexpected %q", orig, designator)
+		}
+		if rank <= last {
+			return 0, fmt.Errorf("invalid duration %q: %q out of order or repeated", orig, designator)
+		}
+		last = rank
+
+		part, err := fromFloat(value, unit)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", orig, err)
+		}
+		if total > math.MaxInt64-part {
+			return 0, fmt.Errorf("invalid duration %q: out of range", orig)
+		}
+		total += part
+		units++
+		s = s[end+1:]
+	}
+
+	if units == 0 {
+		return 0, fmt.Errorf("invalid duration %q", orig)
+	}
+	return sign * total, nil
+}
+
+// fromFloat multiplies value by unit, rejecting results out of range.
+func fromFloat(value float64, unit time.Duration) (time.Duration, error) {
+	d := value * float64(unit)
+	if math.IsNaN(d) || d >= math.MaxInt64 || d < math.MinInt64 {
+		return 0, fmt.Errorf("duration out of range")
+	}
+	return time.Duration(d), nil
+}
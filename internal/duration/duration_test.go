@@ -0,0 +1,116 @@
+package duration
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		// Go syntax
+		{"36h", 36 * time.Hour, false},
+		{"1h30m", 90 * time.Minute, false},
+		{"0.5h", 30 * time.Minute, false},
+		{" 90s ", 90 * time.Second, false},
+		{"-1h", -time.Hour, false},
+
+		// ISO-8601
+		{"P30D", 30 * 24 * time.Hour, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"PT36H", 36 * time.Hour, false},
+		{"P1DT12H", 36 * time.Hour, false},
+		{"PT1H30M15S", time.Hour + 30*time.Minute + 15*time.Second, false},
+		{"PT0.5H", 30 * time.Minute, false},
+		{"PT0,5H", 30 * time.Minute, false},
+		{"p2d", 48 * time.Hour, false},
+		{"-P1D", -24 * time.Hour, false},
+		{"P1W2D", 9 * 24 * time.Hour, false},
+
+		// Errors
+		{"", 0, true},
+		{"36", 0, true},
+		{"abc", 0, true},
+		{"P", 0, true},
+		{"PT", 0, true},
+		{"P1Y", 0, true},
+		{"P1M", 0, true},
+		{"P1H", 0, true},
+		{"PT1D", 0, true},
+		{"P1DT", 0, true},
+		{"PT1H T1M", 0, true},
+		{"P1.2.3D", 0, true},
+		{"P99999999999D", 0, true},
+
+		// Designators out of order or repeated
+		{"PT5M1H", 0, true},
+		{"PT1S1M", 0, true},
+		{"PT1H1H", 0, true},
+		{"P1D2D", 0, true},
+		{"P1D1W", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"36h"`, 36 * time.Hour, false},
+		{`"P30D"`, 30 * 24 * time.Hour, false},
+		{`3600`, time.Hour, false},
+		{`1.5`, 1500 * time.Millisecond, false},
+		{`"soon"`, 0, true},
+		{`true`, 0, true},
+		{`1e300`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var d Duration
+			err := json.Unmarshal([]byte(tt.input), &d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if d.Std() != tt.want {
+				t.Errorf("Unmarshal(%s) = %s, want %s", tt.input, d, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(Duration(36 * time.Hour))
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(data) != `"36h0m0s"` {
+		t.Errorf("Marshal = %s, want \"36h0m0s\"", data)
+	}
+}
+
+func TestHours(t *testing.T) {
+	if got := Hours(0.5); got != 30*time.Minute {
+		t.Errorf("Hours(0.5) = %s, want 30m", got)
+	}
+	if got := Hours(0.01); got != 36*time.Second {
+		t.Errorf("Hours(0.01) = %s, want 36s", got)
+	}
+}
@@ -0,0 +1,119 @@
+package filetime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source represents the timestamp used to determine a file's age.
+type Source string
+
+const (
+	ModTime    Source = "mtime"    // Last modification time (default)
+	ChangeTime Source = "ctime"    // Last inode change time
+	AccessTime Source = "atime"    // Last access time
+	BirthTime  Source = "birth"    // Creation time (statx on Linux)
+	FileName   Source = "filename" // Date parsed from the file name
+)
+
+// Config holds age source settings.
+type Config struct {
+	Source Source `json:"source"` // mtime, ctime, atime, birth, filename (default: mtime)
+	Layout string `json:"layout"` // Go time layout for the file name, e.g. "app-2006-01-02.log"
+}
+
+// Validate checks that the age source is known and supported on this platform.
+func (c *Config) Validate() error {
+	switch c.Source {
+	case ModTime, "":
+		return nil
+	case FileName:
+		if c.Layout == "" {
+			return fmt.Errorf("age source %q requires a layout", c.Source)
+		}
+		return nil
+	case ChangeTime, AccessTime, BirthTime:
+		if !supported(c.Source) {
+			return fmt.Errorf("age source %q is not supported on this platform", c.Source)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown age source: %s (supported: mtime, ctime, atime, birth, filename)", c.Source)
+	}
+}
+
+// Resolver returns the configured timestamp for files.
+// A nil Resolver uses the modification time.
+type Resolver struct {
+	source Source
+	layout string
+}
+
+// New creates a Resolver for the given configuration.
+func New(cfg *Config) (*Resolver, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	source := cfg.Source
+	if source == "" {
+		source = ModTime
+	}
+	return &Resolver{source: source, layout: cfg.Layout}, nil
+}
+
+// Source returns the configured age source.
+func (r *Resolver) Source() Source {
+	if r == nil {
+		return ModTime
+	}
+	return r.source
+}
+
+// Time returns the timestamp of the file at path, whose Lstat result is info.
+// With the filename source, files whose name does not match the layout fall back
+// to the modification time; ok is false in that case.
+func (r *Resolver) Time(path string, info os.FileInfo) (t time.Time, ok bool, err error) {
+	if r == nil {
+		return info.ModTime(), true, nil
+	}
+
+	switch r.source {
+	case FileName:
+		t, err := ParseName(filepath.Base(path), r.layout)
+		if err != nil {
+			return info.ModTime(), false, nil
+		}
+		return t, true, nil
+	case ChangeTime, AccessTime, BirthTime:
+		t, err := statTime(path, info, r.source)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("read %s: %w", r.source, err)
+		}
+		return t, true, nil
+	default:
+		return info.ModTime(), true, nil
+	}
+}
+
+// ParseName parses a date from a file name using a Go time layout in local time.
+// Compression suffixes such as ".gz" are ignored if the layout does not include them.
+func ParseName(name, layout string) (time.Time, error) {
+	t, err := time.ParseInLocation(layout, name, time.Local)
+	if err == nil {
+		return t, nil
+	}
+	for _, ext := range []string{".gz", ".zip", ".tar"} {
+		if strings.HasSuffix(name, ext) && !strings.HasSuffix(layout, ext) {
+			if t, err2 := time.ParseInLocation(layout, strings.TrimSuffix(name, ext), time.Local); err2 == nil {
+				return t, nil
+			}
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,30 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package filetime
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+func supported(source Source) bool {
+	return true
+}
+
+func statTime(path string, info os.FileInfo, source Source) (time.Time, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, fmt.Errorf("no stat data for %s", path)
+	}
+	switch source {
+	case AccessTime:
+		return time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec)), nil
+	case BirthTime:
+		return time.Unix(int64(st.Birthtimespec.Sec), int64(st.Birthtimespec.Nsec)), nil
+	default:
+		return time.Unix(int64(st.Ctimespec.Sec), int64(st.Ctimespec.Nsec)), nil
+	}
+}
@@ -0,0 +1,116 @@
+package filetime
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	atFdcwd           = -0x64
+	atSymlinkNofollow = 0x100
+	statxBtime        = 0x800
+)
+
+// statxTimestamp mirrors struct statx_timestamp.
+type statxTimestamp struct {
+	Sec  int64
+	Nsec uint32
+	_    int32
+}
+
+// statxBuf mirrors the 256-byte struct statx from linux/stat.h.
+type statxBuf struct {
+	Mask           uint32
+	Blksize        uint32
+	Attributes     uint64
+	Nlink          uint32
+	Uid            uint32
+	Gid            uint32
+	Mode           uint16
+	_              uint16
+	Ino            uint64
+	Size           uint64
+	Blocks         uint64
+	AttributesMask uint64
+	Atime          statxTimestamp
+	Btime          statxTimestamp
+	Ctime          statxTimestamp
+	Mtime          statxTimestamp
+	_              [16]uint64
+}
+
+// statxTrap returns the statx system call number for the running architecture.
+func statxTrap() (uintptr, bool) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return 332, true
+	case "arm64", "riscv64", "loong64":
+		return 291, true
+	case "386", "ppc64", "ppc64le":
+		return 383, true
+	case "arm":
+		return 397, true
+	case "s390x":
+		return 379, true
+	default:
+		return 0, false
+	}
+}
+
+func supported(source Source) bool {
+	if source == BirthTime {
+		_, ok := statxTrap()
+		return ok
+	}
+	return true
+}
+
+func statTime(path string, info os.FileInfo, source Source) (time.Time, error) {
+	if source == BirthTime {
+		return birthTime(path)
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return time.Time{}, fmt.Errorf("no stat data for %s", path)
+	}
+	switch source {
+	case AccessTime:
+		return time.Unix(int64(st.Atim.Sec), int64(st.Atim.Nsec)), nil
+	default:
+		return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec)), nil
+	}
+}
+
+// birthTime reads the creation time with statx(2), which needs Linux 4.11 and filesystem support.
+func birthTime(path string) (time.Time, error) {
+	trap, ok := statxTrap()
+	if !ok {
+		return time.Time{}, fmt.Errorf("statx is not supported on %s", runtime.GOARCH)
+	}
+	p, err := syscall.BytePtrFromString(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var buf statxBuf
+	dirfd := atFdcwd
+	_, _, errno := syscall.Syscall6(trap,
+		uintptr(dirfd),
+		uintptr(unsafe.Pointer(p)),
+		atSymlinkNofollow,
+		statxBtime,
+		uintptr(unsafe.Pointer(&buf)),
+		0)
+	if errno != 0 {
+		return time.Time{}, fmt.Errorf("statx: %w", errno)
+	}
+	if buf.Mask&statxBtime == 0 {
+		return time.Time{}, fmt.Errorf("filesystem does not report birth time")
+	}
+	return time.Unix(buf.Btime.Sec, int64(buf.Btime.Nsec)), nil
+}
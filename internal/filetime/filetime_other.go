@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !windows
+// +build !linux,!darwin,!freebsd,!windows
+
+package filetime
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func supported(source Source) bool {
+	return false
+}
+
+func statTime(path string, info os.FileInfo, source Source) (time.Time, error) {
+	return time.Time{}, fmt.Errorf("age source %q is not supported on this platform", source)
+}
@@ -0,0 +1,154 @@
+package filetime
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func createFile(t *testing.T, name string, mtime, atime time.Time) (string, os.FileInfo) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		t.Fatalf("Failed to set file times: %v", err)
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	return path, info
+}
+
+func TestResolver_ModTime(t *testing.T) {
+	mtime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	path, info := createFile(t, "a.log", mtime, time.Now())
+
+	for _, r := range []*Resolver{nil, mustNew(t, &Config{}), mustNew(t, &Config{Source: ModTime})} {
+		got, ok, err := r.Time(path, info)
+		if err != nil || !ok {
+			t.Fatalf("Time failed: ok=%v err=%v", ok, err)
+		}
+		if !got.Equal(mtime) {
+			t.Errorf("Expected %v, got %v", mtime, got)
+		}
+	}
+}
+
+func TestResolver_AccessTime(t *testing.T) {
+	if !supported(AccessTime) {
+		t.Skip("atime not supported on this platform")
+	}
+	atime := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	path, info := createFile(t, "a.log", time.Now(), atime)
+
+	got, _, err := mustNew(t, &Config{Source: AccessTime}).Time(path, info)
+	if err != nil {
+		t.Fatalf("Time failed: %v", err)
+	}
+	if !got.Equal(atime) {
+		t.Errorf("Expected atime %v, got %v", atime, got)
+	}
+}
+
+func TestResolver_ChangeTime(t *testing.T) {
+	if !supported(ChangeTime) {
+		t.Skip("ctime not supported on this platform")
+	}
+	// Chtimes cannot move ctime back, so the ctime is recent even though mtime is old
+	old := time.Now().Add(-72 * time.Hour)
+	path, info := createFile(t, "a.log", old, old)
+
+	got, _, err := mustNew(t, &Config{Source: ChangeTime}).Time(path, info)
+	if err != nil {
+		t.Fatalf("Time failed: %v", err)
+	}
+	if time.Since(got) > time.Hour {
+		t.Errorf("Expected recent ctime, got %v", got)
+	}
+}
+
+func TestResolver_BirthTime(t *testing.T) {
+	if !supported(BirthTime) {
+		t.Skip("birth time not supported on this platform")
+	}
+	old := time.Now().Add(-72 * time.Hour)
+	path, info := createFile(t, "a.log", old, old)
+
+	got, _, err := mustNew(t, &Config{Source: BirthTime}).Time(path, info)
+	if err != nil {
+		// Not every filesystem records birth time (e.g. some overlay and tmpfs mounts)
+		t.Skipf("birth time unavailable: %v", err)
+	}
+	if time.Since(got) > time.Hour {
+		t.Errorf("Expected recent birth time, got %v", got)
+	}
+}
+
+func TestResolver_FileName(t *testing.T) {
+	mtime := time.Now().Truncate(time.Second)
+	r := mustNew(t, &Config{Source: FileName, Layout: "app-2006-01-02.log"})
+
+	path, info := createFile(t, "app-2026-03-15.log", mtime, mtime)
+	got, ok, err := r.Time(path, info)
+	if err != nil || !ok {
+		t.Fatalf("Time failed: ok=%v err=%v", ok, err)
+	}
+	want := time.Date(2026, 3, 15, 0, 0, 0, 0, time.Local)
+	if !got.Equal(want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	// Compressed copies keep their date
+	path, info = createFile(t, "app-2026-03-16.log.gz", mtime, mtime)
+	if got, ok, _ := r.Time(path, info); !ok || got.Day() != 16 {
+		t.Errorf("Expected date from compressed name, got %v (ok=%v)", got, ok)
+	}
+
+	// Non-matching names fall back to mtime
+	path, info = createFile(t, "other.txt", mtime, mtime)
+	got, ok, err = r.Time(path, info)
+	if err != nil {
+		t.Fatalf("Time failed: %v", err)
+	}
+	if ok || !got.Equal(mtime) {
+		t.Errorf("Expected mtime fallback, got %v (ok=%v)", got, ok)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", Config{}, false},
+		{"mtime", Config{Source: ModTime}, false},
+		{"filename with layout", Config{Source: FileName, Layout: "2006-01-02.log"}, false},
+		{"filename without layout", Config{Source: FileName}, true},
+		{"unknown", Config{Source: "mystery"}, true},
+		{"ctime", Config{Source: ChangeTime}, runtime.GOOS == "windows"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustNew(t *testing.T, cfg *Config) *Resolver {
+	t.Helper()
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return r
+}
@@ -0,0 +1,27 @@
+package filetime
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+func supported(source Source) bool {
+	return source == AccessTime || source == BirthTime
+}
+
+func statTime(path string, info os.FileInfo, source Source) (time.Time, error) {
+	attr, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return time.Time{}, fmt.Errorf("no file attributes for %s", path)
+	}
+	switch source {
+	case AccessTime:
+		return time.Unix(0, attr.LastAccessTime.Nanoseconds()), nil
+	case BirthTime:
+		return time.Unix(0, attr.CreationTime.Nanoseconds()), nil
+	default:
+		return time.Time{}, fmt.Errorf("age source %q is not supported on windows", source)
+	}
+}
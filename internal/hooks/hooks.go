@@ -0,0 +1,229 @@
+// Package hooks runs configured commands around a cycle: before and after it,
+// before pruning, after each backed up file and for each error. Context is passed
+// to the commands in FILEKEEPER_* environment variables.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stage is the point of a cycle at which a hook runs.
+type Stage string
+
+const (
+	PreCycle       Stage = "pre_cycle"         // Before files are selected; abort skips the cycle
+	PostCycle      Stage = "post_cycle"        // After the cycle, with its result summary, even if it failed
+	PrePrune       Stage = "pre_prune"         // After backups, before the first file is pruned
+	OnFileBackedUp Stage = "on_file_backed_up" // After each file was backed up or archived
+	OnError        Stage = "on_error"          // For each file error
+)
+
+// Policy is what a failed hook does to the cycle.
+type Policy string
+
+const (
+	PolicyAbort  Policy = "abort"  // Stop the cycle; at post_cycle the cycle is reported as failed
+	PolicyWarn   Policy = "warn"   // Log a warning and continue
+	PolicyIgnore Policy = "ignore" // Log at debug level and continue
+)
+
+// DefaultTimeoutSeconds is how long a hook may run when no timeout is configured.
+const DefaultTimeoutSeconds = 30
+
+// maxOutput is how much of a hook's output is kept for the log.
+const maxOutput = 4096
+
+// ErrFailed is returned when a hook with on_failure abort fails.
+var ErrFailed = errors.New("hook failed")
+
+// Config describes one hook command.
+type Config struct {
+	Name           string  `json:"name"`            // Shown in logs (default: the command)
+	Stage          Stage   `json:"stage"`           // When the hook runs
+	Command        string  `json:"command"`         // Run with /bin/sh -c, or cmd /C on Windows
+	TimeoutSeconds float64 `json:"timeout_seconds"` // Kill the command after this long (default: 30)
+	OnFailure      Policy  `json:"on_failure"`      // abort, warn or ignore (default: warn)
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	switch c.Stage {
+	case PreCycle, PostCycle, PrePrune, OnFileBackedUp, OnError:
+	case "":
+		return fmt.Errorf("stage is required")
+	default:
+		return fmt.Errorf("stage must be one of: pre_cycle, post_cycle, pre_prune, on_file_backed_up, on_error; got: %s", c.Stage)
+	}
+	if strings.TrimSpace(c.Command) == "" {
+		return fmt.Errorf("command is required")
+	}
+	if c.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds must not be negative, got %g", c.TimeoutSeconds)
+	}
+	switch c.OnFailure {
+	case "", PolicyAbort, PolicyWarn, PolicyIgnore:
+	default:
+		return fmt.Errorf("on_failure must be abort, warn or ignore; got: %s", c.OnFailure)
+	}
+	return nil
+}
+
+// WithDefaults returns a copy of the hook with defaults applied.
+func (c Config) WithDefaults() Config {
+	if c.Name == "" {
+		c.Name = c.Command
+	}
+	if c.TimeoutSeconds == 0 {
+		c.TimeoutSeconds = DefaultTimeoutSeconds
+	}
+	if c.OnFailure == "" {
+		c.OnFailure = PolicyWarn
+	}
+	return c
+}
+
+// Env holds the environment variables passed to a hook in addition to the process environment.
+type Env map[string]string
+
+// Runner runs the hooks of each stage in configuration order.
+type Runner struct {
+	hooks  []Config
+	dryRun bool
+	log    *slog.Logger
+}
+
+// New returns a Runner for hooks. In dry-run mode hooks are logged but not run.
+func New(hooks []Config, dryRun bool, log *slog.Logger) *Runner {
+	r := &Runner{dryRun: dryRun, log: log}
+	for _, h := range hooks {
+		r.hooks = append(r.hooks, h.WithDefaults())
+	}
+	return r
+}
+
+// Has reports whether any hook runs at stage.
+func (r *Runner) Has(stage Stage) bool {
+	for _, h := range r.hooks {
+		if h.Stage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// Run runs the hooks of stage with env plus FILEKEEPER_STAGE and FILEKEEPER_HOOK.
+// It returns an error wrapping ErrFailed when a hook with on_failure abort fails;
+// the remaining hooks of the stage are then skipped. Failures of other hooks are logged.
+func (r *Runner) Run(ctx context.Context, stage Stage, env Env) error {
+	for _, h := range r.hooks {
+		if h.Stage != stage {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if r.dryRun {
+			r.log.Info("[DRY-RUN] would run hook",
+				slog.String("hook", h.Name),
+				slog.String("stage", string(stage)),
+			)
+			continue
+		}
+
+		start := time.Now()
+		output, err := run(ctx, h, env)
+		if err == nil {
+			r.log.Debug("ran hook",
+				slog.String("hook", h.Name),
+				slog.String("stage", string(stage)),
+				slog.Duration("duration", time.Since(start)),
+			)
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		attrs := []any{
+			slog.String("hook", h.Name),
+			slog.String("stage", string(stage)),
+			slog.String("error", err.Error()),
+			slog.String("output", output),
+		}
+		switch h.OnFailure {
+		case PolicyAbort:
+			r.log.Error("hook failed, aborting cycle", attrs...)
+			return fmt.Errorf("%w: %s hook %q: %v", ErrFailed, stage, h.Name, err)
+		case PolicyIgnore:
+			r.log.Debug("hook failed", attrs...)
+		default:
+			r.log.Warn("hook failed", attrs...)
+		}
+	}
+	return nil
+}
+
+// run runs a hook command and returns the end of its combined output.
+func run(ctx context.Context, h Config, env Env) (string, error) {
+	timeout := time.Duration(h.TimeoutSeconds * float64(time.Second))
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", h.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", h.Command)
+	}
+
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	cmd.Env = os.Environ()
+	for _, key := range keys {
+		cmd.Env = append(cmd.Env, key+"="+env[key])
+	}
+	cmd.Env = append(cmd.Env, "FILEKEEPER_STAGE="+string(h.Stage), "FILEKEEPER_HOOK="+h.Name)
+
+	// Background processes that keep the output open do not hold up the cycle
+	out := &tailBuffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+	return strings.TrimSpace(out.String()), err
+}
+
+// tailBuffer keeps the last maxOutput bytes written to it.
+type tailBuffer struct {
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - maxOutput; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return t.buf.String()
+}
@@ -0,0 +1,104 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"valid", Config{Stage: PreCycle, Command: "true"}, false},
+		{"all fields", Config{Name: "n", Stage: OnError, Command: "true", TimeoutSeconds: 5, OnFailure: PolicyAbort}, false},
+		{"missing stage", Config{Command: "true"}, true},
+		{"unknown stage", Config{Stage: "after", Command: "true"}, true},
+		{"missing command", Config{Stage: PostCycle, Command: " "}, true},
+		{"negative timeout", Config{Stage: PostCycle, Command: "true", TimeoutSeconds: -1}, true},
+		{"unknown policy", Config{Stage: PostCycle, Command: "true", OnFailure: "retry"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands use /bin/sh")
+	}
+	log := slog.New(slog.DiscardHandler)
+	ctx := context.Background()
+
+	t.Run("environment", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		r := New([]Config{
+			{Name: "env", Stage: PostCycle, Command: `echo "$FILEKEEPER_HOOK $FILEKEEPER_STAGE $FILEKEEPER_STATUS" > ` + out},
+			{Stage: PreCycle, Command: "exit 1", OnFailure: PolicyAbort},
+		}, false, log)
+		if err := r.Run(ctx, PostCycle, Env{"FILEKEEPER_STATUS": "success"}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSpace(string(data)); got != "env post_cycle success" {
+			t.Errorf("hook output = %q", got)
+		}
+	})
+
+	t.Run("policies", func(t *testing.T) {
+		for _, policy := range []Policy{PolicyWarn, PolicyIgnore} {
+			r := New([]Config{{Stage: OnError, Command: "exit 3", OnFailure: policy}}, false, log)
+			if err := r.Run(ctx, OnError, nil); err != nil {
+				t.Errorf("%s: Run() error = %v, want nil", policy, err)
+			}
+		}
+
+		out := filepath.Join(t.TempDir(), "out")
+		r := New([]Config{
+			{Stage: PreCycle, Command: "exit 3", OnFailure: PolicyAbort},
+			{Stage: PreCycle, Command: "touch " + out},
+		}, false, log)
+		if err := r.Run(ctx, PreCycle, nil); !errors.Is(err, ErrFailed) {
+			t.Errorf("abort: Run() error = %v, want ErrFailed", err)
+		}
+		if _, err := os.Stat(out); err == nil {
+			t.Error("hook after an aborting hook ran")
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		r := New([]Config{{Stage: PrePrune, Command: "sleep 10", TimeoutSeconds: 0.1, OnFailure: PolicyAbort}}, false, log)
+		start := time.Now()
+		err := r.Run(ctx, PrePrune, nil)
+		if !errors.Is(err, ErrFailed) || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("Run() error = %v, want timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("Run() took %s", elapsed)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		r := New([]Config{{Stage: PreCycle, Command: "exit 1", OnFailure: PolicyAbort}}, true, log)
+		if err := r.Run(ctx, PreCycle, nil); err != nil {
+			t.Errorf("Run() error = %v, want nil in dry-run mode", err)
+		}
+	})
+}
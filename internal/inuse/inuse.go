@@ -0,0 +1,164 @@
+// Package inuse defers files that may still be written to.
+// A file is in use if its size or modification time changes while it settles,
+// if a process holds it open (Linux only), or if a lock file exists next to it.
+package inuse
+
+import (
+	"context"
+	"filekeeper/internal/pruner"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Reasons a file is considered in use.
+const (
+	ReasonChanging = "changing"
+	ReasonOpen     = "open"
+	ReasonLocked   = "locked"
+)
+
+// DefaultSettleSeconds is how long a file must stay unchanged when no interval is configured.
+const DefaultSettleSeconds = 2
+
+// Config holds the in-use check settings.
+type Config struct {
+	Enabled       bool     `json:"enabled"`
+	SettleSeconds float64  `json:"settle_seconds"` // Time size and mtime must stay unchanged (default: 2)
+	OpenHandles   bool     `json:"open_handles"`   // Defer files open in any process (Linux, via /proc/*/fd)
+	LockSuffixes  []string `json:"lock_suffixes"`  // Defer "name" while "name"+suffix exists, e.g. ".lock"
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.SettleSeconds < 0 {
+		return fmt.Errorf("settle_seconds must not be negative, got %g", c.SettleSeconds)
+	}
+	if c.OpenHandles && !openFilesSupported {
+		return fmt.Errorf("open_handles is only supported on Linux")
+	}
+	for i, suffix := range c.LockSuffixes {
+		if suffix == "" {
+			return fmt.Errorf("lock_suffixes[%d] must not be empty", i)
+		}
+	}
+	return nil
+}
+
+// Checker filters candidates that are still being written.
+// A nil Checker lets every file through.
+type Checker struct {
+	settle       time.Duration
+	openHandles  bool
+	lockSuffixes []string
+}
+
+// New creates a Checker. It returns nil if the check is disabled.
+func New(cfg *Config) *Checker {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	return &Checker{
+		settle:       time.Duration(cfg.SettleSeconds * float64(time.Second)),
+		openHandles:  cfg.OpenHandles,
+		lockSuffixes: cfg.LockSuffixes,
+	}
+}
+
+// Filter returns the candidates that are not in use and the number deferred.
+// It first waits until the settle interval has passed since the candidates were
+// stat'ed at since; a zero since skips the wait, for a re-check of files that
+// already settled. since must come from time.Now, not an injected clock: the wait
+// is measured on the monotonic clock, so clock offsets and jumps cannot skip it.
+// Deferred files are left for the next cycle.
+func (c *Checker) Filter(ctx context.Context, candidates []pruner.Candidate, since time.Time, log *slog.Logger) ([]pruner.Candidate, int, error) {
+	if c == nil || len(candidates) == 0 {
+		return candidates, 0, nil
+	}
+
+	if !since.IsZero() {
+		if wait := c.settle - time.Since(since); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, 0, ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+
+	var open map[string]bool
+	if c.openHandles {
+		var err error
+		if open, err = openFiles(); err != nil {
+			return nil, 0, fmt.Errorf("scan open files: %w", err)
+		}
+	}
+
+	ready := make([]pruner.Candidate, 0, len(candidates))
+	deferred := 0
+	for _, cand := range candidates {
+		// Copy-truncate is meant for files that stay open and keep growing
+		if cand.Truncate {
+			ready = append(ready, cand)
+			continue
+		}
+		if reason := c.check(cand, open); reason != "" {
+			log.Info("file in use, deferred to next cycle",
+				slog.String("path", cand.Path),
+				slog.String("reason", reason),
+			)
+			deferred++
+			continue
+		}
+		ready = append(ready, cand)
+	}
+	return ready, deferred, nil
+}
+
+// check returns why the candidate is in use, or "" if it is not.
+func (c *Checker) check(cand pruner.Candidate, open map[string]bool) string {
+	if changed(cand) {
+		return ReasonChanging
+	}
+	if open != nil && open[resolve(cand.Path)] {
+		return ReasonOpen
+	}
+	for _, suffix := range c.lockSuffixes {
+		if _, err := os.Lstat(cand.Path + suffix); err == nil {
+			return ReasonLocked
+		}
+	}
+	return ""
+}
+
+// changed reports whether the file's size or modification time differs from when it was selected.
+// A file that disappeared counts as changed, so it is neither backed up nor pruned.
+func changed(cand pruner.Candidate) bool {
+	stat := os.Stat
+	if cand.Info.Mode()&os.ModeSymlink != 0 {
+		stat = os.Lstat
+	}
+	info, err := stat(cand.Path)
+	if err != nil {
+		return true
+	}
+	return info.Size() != cand.Info.Size() || !info.ModTime().Equal(cand.Info.ModTime())
+}
+
+// resolve returns the absolute path with symlinks resolved, as the kernel reports open files.
+func resolve(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
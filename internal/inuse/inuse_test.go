@@ -0,0 +1,174 @@
+package inuse
+
+import (
+	"context"
+	"filekeeper/internal/logger"
+	"filekeeper/internal/pruner"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testLogger creates a logger for testing
+func testLogger() *slog.Logger {
+	return logger.New("error", "text")
+}
+
+// candidate creates a file and returns it as a selected candidate.
+func candidate(t *testing.T, dir, name string) pruner.Candidate {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat file: %v", err)
+	}
+	return pruner.Candidate{Path: path, Info: info}
+}
+
+func TestFilter_Disabled(t *testing.T) {
+	checker := New(&Config{Enabled: false})
+	if checker != nil {
+		t.Fatal("Expected nil checker when disabled")
+	}
+
+	candidates := []pruner.Candidate{candidate(t, t.TempDir(), "a.log")}
+	ready, deferred, err := checker.Filter(context.Background(), candidates, time.Now(), testLogger())
+	if err != nil || len(ready) != 1 || deferred != 0 {
+		t.Errorf("Expected all files to pass, got %d ready, %d deferred, err %v", len(ready), deferred, err)
+	}
+}
+
+func TestFilter_Changing(t *testing.T) {
+	dir := t.TempDir()
+	stable := candidate(t, dir, "stable.log")
+	growing := candidate(t, dir, "growing.log")
+
+	// The writer appends after the file was selected
+	f, err := os.OpenFile(growing.Path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	if _, err := f.WriteString(" more"); err != nil {
+		t.Fatalf("Failed to append: %v", err)
+	}
+	f.Close()
+
+	checker := New(&Config{Enabled: true, SettleSeconds: 0.01})
+	ready, deferred, err := checker.Filter(context.Background(), []pruner.Candidate{stable, growing}, time.Now(), testLogger())
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if deferred != 1 || len(ready) != 1 || ready[0].Path != stable.Path {
+		t.Errorf("Expected only stable.log to be ready, got %d ready, %d deferred", len(ready), deferred)
+	}
+}
+
+func TestFilter_Removed(t *testing.T) {
+	c := candidate(t, t.TempDir(), "gone.log")
+	if err := os.Remove(c.Path); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	checker := New(&Config{Enabled: true})
+	_, deferred, err := checker.Filter(context.Background(), []pruner.Candidate{c}, time.Time{}, testLogger())
+	if err != nil || deferred != 1 {
+		t.Errorf("Expected a removed file to be deferred, got %d deferred, err %v", deferred, err)
+	}
+}
+
+func TestFilter_LockFile(t *testing.T) {
+	dir := t.TempDir()
+	locked := candidate(t, dir, "locked.log")
+	free := candidate(t, dir, "free.log")
+	if err := os.WriteFile(locked.Path+".lock", nil, 0644); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+
+	checker := New(&Config{Enabled: true, LockSuffixes: []string{".lock"}})
+	ready, deferred, err := checker.Filter(context.Background(), []pruner.Candidate{locked, free}, time.Time{}, testLogger())
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if deferred != 1 || len(ready) != 1 || ready[0].Path != free.Path {
+		t.Errorf("Expected only free.log to be ready, got %d ready, %d deferred", len(ready), deferred)
+	}
+}
+
+func TestFilter_OpenHandles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("open handle detection is only supported on Linux")
+	}
+
+	dir := t.TempDir()
+	open := candidate(t, dir, "open.log")
+	closed := candidate(t, dir, "closed.log")
+
+	f, err := os.Open(open.Path)
+	if err != nil {
+		t.Fatalf("Failed to open file: %v", err)
+	}
+	defer f.Close()
+
+	checker := New(&Config{Enabled: true, OpenHandles: true})
+	ready, deferred, err := checker.Filter(context.Background(), []pruner.Candidate{open, closed}, time.Time{}, testLogger())
+	if err != nil {
+		t.Fatalf("Filter failed: %v", err)
+	}
+	if deferred != 1 || len(ready) != 1 || ready[0].Path != closed.Path {
+		t.Errorf("Expected only closed.log to be ready, got %d ready, %d deferred", len(ready), deferred)
+	}
+}
+
+func TestFilter_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	checker := New(&Config{Enabled: true, SettleSeconds: 60})
+	candidates := []pruner.Candidate{candidate(t, t.TempDir(), "a.log")}
+	if _, _, err := checker.Filter(ctx, candidates, time.Now(), testLogger()); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestFilter_SettleFromSince(t *testing.T) {
+	// The wait is measured from since on the monotonic clock; a file stat'ed longer
+	// than the settle interval ago is checked right away
+	checker := New(&Config{Enabled: true, SettleSeconds: 60})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	candidates := []pruner.Candidate{candidate(t, t.TempDir(), "a.log")}
+	ready, deferred, err := checker.Filter(ctx, candidates, time.Now().Add(-time.Minute), testLogger())
+	if err != nil || len(ready) != 1 || deferred != 0 {
+		t.Errorf("Expected the settled file to pass without waiting, got %d ready, %d deferred, err %v", len(ready), deferred, err)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"disabled", Config{SettleSeconds: -1}, false},
+		{"defaults", Config{Enabled: true}, false},
+		{"negative settle", Config{Enabled: true, SettleSeconds: -1}, true},
+		{"empty lock suffix", Config{Enabled: true, LockSuffixes: []string{""}}, true},
+		{"open handles", Config{Enabled: true, OpenHandles: true}, runtime.GOOS != "linux"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
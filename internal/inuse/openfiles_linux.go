@@ -0,0 +1,41 @@
+//go:build linux
+// +build linux
+
+package inuse
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const openFilesSupported = true
+
+// openFiles returns the paths open in any process visible in /proc.
+// Without root, only the current user's processes can be inspected.
+func openFiles() (map[string]bool, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	open := make(map[string]bool)
+	for _, proc := range procs {
+		if !proc.IsDir() || strings.TrimLeft(proc.Name(), "0123456789") != "" {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // Process exited or belongs to another user
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "/") {
+				continue // Sockets, pipes and anonymous inodes
+			}
+			open[target] = true
+		}
+	}
+	return open, nil
+}
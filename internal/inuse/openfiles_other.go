@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package inuse
+
+import "errors"
+
+const openFilesSupported = false
+
+// openFiles is not supported on this platform.
+func openFiles() (map[string]bool, error) {
+	return nil, errors.New("open file detection is only supported on Linux")
+}
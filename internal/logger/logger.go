@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 	"strings"
@@ -10,15 +11,20 @@ import (
 // logLevel: debug, info, warn, error (default: info)
 // logFormat: text, json (default: text)
 func New(logLevel, logFormat string) *slog.Logger {
+	return NewTo(os.Stdout, logLevel, logFormat)
+}
+
+// NewTo creates a logger like New that writes to w.
+func NewTo(w io.Writer, logLevel, logFormat string) *slog.Logger {
 	level := parseLevel(logLevel)
 	opts := &slog.HandlerOptions{Level: level}
 
 	var handler slog.Handler
 	format := strings.ToLower(logFormat)
 	if format == "json" {
-		handler = slog.NewJSONHandler(os.Stdout, opts)
+		handler = slog.NewJSONHandler(w, opts)
 	} else {
-		handler = slog.NewTextHandler(os.Stdout, opts)
+		handler = slog.NewTextHandler(w, opts)
 	}
 
 	return slog.New(handler)
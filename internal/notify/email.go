@@ -0,0 +1,135 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Email sends events as plain-text messages over SMTP.
+type Email struct {
+	cfg     EmailConfig
+	subject *template.Template
+	body    *template.Template
+	timeout time.Duration
+}
+
+// NewEmail creates an SMTP email notifier.
+func NewEmail(cfg EmailConfig) (*Email, error) {
+	if cfg.Port == 0 {
+		cfg.Port = 25
+	}
+	subject, err := parseTemplate("subject", cfg.Subject, DefaultSubject)
+	if err != nil {
+		return nil, err
+	}
+	body, err := parseTemplate("body", cfg.Template, DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &Email{
+		cfg:     cfg,
+		subject: subject,
+		body:    body,
+		timeout: timeoutOrDefault(cfg.TimeoutSeconds),
+	}, nil
+}
+
+// Name returns the SMTP server address.
+func (e *Email) Name() string {
+	return "smtp://" + e.addr()
+}
+
+func (e *Email) addr() string {
+	return net.JoinHostPort(e.cfg.Host, strconv.Itoa(e.cfg.Port))
+}
+
+// Notify renders the event and sends it to all recipients.
+// STARTTLS is used when the server offers it; authentication is used when a username is set.
+func (e *Email) Notify(ctx context.Context, event *Event) error {
+	subject, err := render(e.subject, event)
+	if err != nil {
+		return err
+	}
+	body, err := render(e.body, event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", e.addr())
+	if err != nil {
+		return fmt.Errorf("connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, e.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: e.cfg.Host}); err != nil {
+			return fmt.Errorf("smtp starttls: %w", err)
+		}
+	}
+
+	if e.cfg.Username != "" {
+		auth := smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, e.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.cfg.From); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	for _, to := range e.cfg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("smtp rcpt to %s: %w", to, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(e.buildMessage(subject, body, event.Time)); err != nil {
+		w.Close()
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMessage assembles an RFC 5322 message with CRLF line endings.
+func (e *Email) buildMessage(subject, body string, t time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", strings.TrimSpace(strings.ReplaceAll(subject, "\n", " ")))
+	fmt.Fprintf(&buf, "Date: %s\r\n", t.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,355 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Trigger identifies the kind of cycle outcome that caused a notification.
+type Trigger string
+
+const (
+	TriggerThresholdExceeded   Trigger = "threshold_exceeded"
+	TriggerSafetyLimit         Trigger = "safety_limit"
+	TriggerArchiveFailed       Trigger = "archive_failed"
+	TriggerRemoteFailed        Trigger = "remote_failed"
+	TriggerConsecutiveFailures Trigger = "consecutive_failures"
+	TriggerRecovery            Trigger = "recovery"
+)
+
+// Format represents the payload format of a webhook.
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatSlack Format = "slack"
+)
+
+// DefaultConsecutiveFailures is the number of failed cycles in a row that triggers an alert.
+const DefaultConsecutiveFailures = 3
+
+// DefaultTemplate is the message template used when none is configured.
+const DefaultTemplate = "{{.Message}}"
+
+// DefaultSubject is the email subject template used when none is configured.
+const DefaultSubject = "[filekeeper] {{.Trigger}} on {{.Hostname}}"
+
+// Config holds notification settings.
+type Config struct {
+	Enabled             bool            `json:"enabled"`
+	ConsecutiveFailures int             `json:"consecutive_failures"` // Failed cycles in a row before alerting (default: 3)
+	Webhooks            []WebhookConfig `json:"webhooks"`
+	Email               *EmailConfig    `json:"email,omitempty"`
+}
+
+// WebhookConfig holds settings for a single webhook destination.
+type WebhookConfig struct {
+	URL            string            `json:"url"`
+	Format         Format            `json:"format"`          // json, slack (default: json)
+	Template       string            `json:"template"`        // text/template for the message (default: "{{.Message}}")
+	Headers        map[string]string `json:"headers"`         // Extra HTTP headers, e.g. Authorization
+	Triggers       []Trigger         `json:"triggers"`        // Triggers to send (default: all)
+	TimeoutSeconds int               `json:"timeout_seconds"` // Request timeout (default: 10)
+}
+
+// EmailConfig holds SMTP settings for email notifications.
+type EmailConfig struct {
+	Host           string    `json:"host"`
+	Port           int       `json:"port"` // default: 25
+	Username       string    `json:"username"`
+	Password       string    `json:"password"`
+	From           string    `json:"from"`
+	To             []string  `json:"to"`
+	Subject        string    `json:"subject"`         // text/template for the subject line
+	Template       string    `json:"template"`        // text/template for the body
+	Triggers       []Trigger `json:"triggers"`        // Triggers to send (default: all)
+	TimeoutSeconds int       `json:"timeout_seconds"` // Connection timeout (default: 10)
+}
+
+// Validate checks that the notification configuration is valid.
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if c.ConsecutiveFailures < 0 {
+		return fmt.Errorf("consecutive_failures must not be negative, got %d", c.ConsecutiveFailures)
+	}
+
+	for i, wh := range c.Webhooks {
+		u, err := url.Parse(wh.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhooks[%d]: url must be an http or https URL, got: %s", i, wh.URL)
+		}
+		switch wh.Format {
+		case FormatJSON, FormatSlack, "":
+			// Valid formats
+		default:
+			return fmt.Errorf("webhooks[%d]: unknown format: %s (supported: json, slack)", i, wh.Format)
+		}
+		if _, err := parseTemplate("message", wh.Template, DefaultTemplate); err != nil {
+			return fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+		if err := validateTriggers(wh.Triggers); err != nil {
+			return fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+	}
+
+	if c.Email != nil {
+		if c.Email.Host == "" {
+			return fmt.Errorf("email: host is required")
+		}
+		if c.Email.From == "" {
+			return fmt.Errorf("email: from is required")
+		}
+		if len(c.Email.To) == 0 {
+			return fmt.Errorf("email: at least one recipient is required")
+		}
+		if _, err := parseTemplate("subject", c.Email.Subject, DefaultSubject); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		if _, err := parseTemplate("body", c.Email.Template, DefaultTemplate); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+		if err := validateTriggers(c.Email.Triggers); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func validateTriggers(triggers []Trigger) error {
+	for _, t := range triggers {
+		switch t {
+		case TriggerThresholdExceeded, TriggerSafetyLimit, TriggerArchiveFailed, TriggerRemoteFailed,
+			TriggerConsecutiveFailures, TriggerRecovery:
+			// Valid triggers
+		default:
+			return fmt.Errorf("unknown trigger: %s", t)
+		}
+	}
+	return nil
+}
+
+// parseTemplate parses a text/template, falling back to def when text is empty.
+func parseTemplate(name, text, def string) (*template.Template, error) {
+	if text == "" {
+		text = def
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+// render executes a template against an event.
+func render(tmpl *template.Template, event *Event) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("render %s template: %w", tmpl.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// Event is the data passed to notifiers and exposed to templates.
+// Result holds the cycle result, so templates can use fields such as {{.Result.Failed}}.
+type Event struct {
+	Trigger             Trigger     `json:"trigger"`
+	Time                time.Time   `json:"time"`
+	Hostname            string      `json:"hostname"`
+	Message             string      `json:"message"`
+	Error               string      `json:"error,omitempty"`
+	ConsecutiveFailures int         `json:"consecutive_failures"`
+	Result              interface{} `json:"result,omitempty"`
+}
+
+// Cycle describes the outcome of one backup cycle.
+type Cycle struct {
+	Result            interface{} // Cycle result, exposed to templates as .Result
+	Err               error       // Error that ended the cycle, if any
+	Failed            bool        // Whether the cycle counts as failed
+	ThresholdExceeded bool        // Whether the error threshold was exceeded
+	SafetyLimit       bool        // Whether a safety limit aborted the cycle
+	ArchivesFailed    bool        // Whether every archive creation failed
+	RemoteFailures    int         // Number of failed remote copies
+}
+
+// Notifier delivers an event to a single destination.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, event *Event) error
+}
+
+// route pairs a notifier with the triggers it subscribes to.
+type route struct {
+	notifier Notifier
+	triggers []Trigger
+}
+
+func (r route) wants(t Trigger) bool {
+	if len(r.triggers) == 0 {
+		return true
+	}
+	for _, want := range r.triggers {
+		if want == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager evaluates cycle outcomes and dispatches notifications.
+// It keeps track of consecutive failed cycles between calls to Observe.
+type Manager struct {
+	routes              []route
+	consecutiveFailures int
+	failures            int
+	log                 *slog.Logger
+}
+
+// New creates a Manager from the given configuration.
+// A nil or disabled configuration yields a Manager that never sends anything.
+func New(cfg *Config, log *slog.Logger) (*Manager, error) {
+	m := &Manager{
+		consecutiveFailures: DefaultConsecutiveFailures,
+		log:                 log,
+	}
+	if cfg == nil || !cfg.Enabled {
+		return m, nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.ConsecutiveFailures > 0 {
+		m.consecutiveFailures = cfg.ConsecutiveFailures
+	}
+
+	for _, wh := range cfg.Webhooks {
+		n, err := NewWebhook(wh)
+		if err != nil {
+			return nil, err
+		}
+		m.routes = append(m.routes, route{notifier: n, triggers: wh.Triggers})
+	}
+
+	if cfg.Email != nil {
+		n, err := NewEmail(*cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		m.routes = append(m.routes, route{notifier: n, triggers: cfg.Email.Triggers})
+	}
+
+	return m, nil
+}
+
+// Observe evaluates a cycle outcome, sends notifications for every trigger that fired,
+// and returns the events that were produced. Delivery failures are logged, not returned.
+func (m *Manager) Observe(ctx context.Context, c Cycle) []*Event {
+	var events []*Event
+	errMsg := ""
+	if c.Err != nil {
+		errMsg = c.Err.Error()
+	}
+
+	if c.ThresholdExceeded {
+		events = append(events, m.newEvent(TriggerThresholdExceeded, c, errMsg,
+			"error threshold exceeded, cycle aborted"))
+	}
+
+	if c.SafetyLimit {
+		events = append(events, m.newEvent(TriggerSafetyLimit, c, errMsg,
+			"safety limit exceeded, cycle aborted before pruning"))
+	}
+
+	if c.ArchivesFailed {
+		events = append(events, m.newEvent(TriggerArchiveFailed, c, errMsg,
+			"all archive creations failed"))
+	}
+
+	if c.RemoteFailures > 0 {
+		events = append(events, m.newEvent(TriggerRemoteFailed, c, errMsg,
+			fmt.Sprintf("%d remote copies failed", c.RemoteFailures)))
+	}
+
+	if c.Failed {
+		m.failures++
+		if m.failures == m.consecutiveFailures {
+			events = append(events, m.newEvent(TriggerConsecutiveFailures, c, errMsg,
+				fmt.Sprintf("%d consecutive backup cycles failed", m.failures)))
+		}
+	} else {
+		if m.failures >= m.consecutiveFailures {
+			events = append(events, m.newEvent(TriggerRecovery, c, errMsg,
+				fmt.Sprintf("backup cycle succeeded after %d failed cycles", m.failures)))
+		}
+		m.failures = 0
+	}
+
+	for _, event := range events {
+		m.dispatch(ctx, event)
+	}
+
+	return events
+}
+
+// newEvent builds an event for the given trigger.
+func (m *Manager) newEvent(t Trigger, c Cycle, errMsg, message string) *Event {
+	hostname, _ := os.Hostname()
+	return &Event{
+		Trigger:             t,
+		Time:                time.Now(),
+		Hostname:            hostname,
+		Message:             message,
+		Error:               errMsg,
+		ConsecutiveFailures: m.failures,
+		Result:              c.Result,
+	}
+}
+
+// dispatch sends an event to every notifier subscribed to its trigger.
+func (m *Manager) dispatch(ctx context.Context, event *Event) {
+	for _, r := range m.routes {
+		if !r.wants(event.Trigger) {
+			continue
+		}
+		if err := r.notifier.Notify(ctx, event); err != nil {
+			m.log.Warn("notification failed",
+				slog.String("notifier", r.notifier.Name()),
+				slog.String("trigger", string(event.Trigger)),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		m.log.Debug("notification sent",
+			slog.String("notifier", r.notifier.Name()),
+			slog.String("trigger", string(event.Trigger)),
+		)
+	}
+}
+
+// timeoutOrDefault converts a timeout in seconds to a duration, defaulting to 10 seconds.
+func timeoutOrDefault(seconds int) time.Duration {
+	if seconds <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// redactURL strips credentials and query strings from a URL for logging.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "webhook"
+	}
+	return strings.TrimSuffix(u.Scheme+"://"+u.Host+u.Path, "/")
+}
@@ -0,0 +1,386 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/logger"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testLogger creates a logger for testing
+func testLogger() *slog.Logger {
+	return logger.New("error", "text")
+}
+
+// fakeResult mimics the fields of backup.Result used by templates.
+type fakeResult struct {
+	Succeeded int
+	Failed    int
+}
+
+// webhookStub records the bodies posted to it.
+type webhookStub struct {
+	mu     sync.Mutex
+	bodies [][]byte
+	header http.Header
+}
+
+func newWebhookStub(t *testing.T) (*webhookStub, *httptest.Server) {
+	stub := &webhookStub{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		stub.mu.Lock()
+		stub.bodies = append(stub.bodies, body)
+		stub.header = r.Header.Clone()
+		stub.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+	return stub, srv
+}
+
+// smtpStub is a minimal SMTP server that records received messages.
+type smtpStub struct {
+	mu       sync.Mutex
+	from     string
+	rcpts    []string
+	messages []string
+}
+
+func newSMTPStub(t *testing.T) (*smtpStub, string, int) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	stub := &smtpStub{}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	host, portStr, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	return stub, host, port
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP stub")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from = strings.TrimSpace(line[len("MAIL FROM:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.TrimSpace(line[len("RCPT TO:"):]))
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, msg.String())
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestManager_ConsecutiveFailuresAndRecovery(t *testing.T) {
+	m, err := New(&Config{Enabled: true, ConsecutiveFailures: 2}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	if events := m.Observe(ctx, Cycle{Failed: true}); len(events) != 0 {
+		t.Errorf("Expected no events after first failure, got %d", len(events))
+	}
+
+	events := m.Observe(ctx, Cycle{Failed: true})
+	if len(events) != 1 || events[0].Trigger != TriggerConsecutiveFailures {
+		t.Fatalf("Expected consecutive_failures event, got %v", events)
+	}
+	if events[0].ConsecutiveFailures != 2 {
+		t.Errorf("Expected ConsecutiveFailures 2, got %d", events[0].ConsecutiveFailures)
+	}
+
+	// Further failures in the same streak do not alert again
+	if events := m.Observe(ctx, Cycle{Failed: true}); len(events) != 0 {
+		t.Errorf("Expected no repeated alert, got %d events", len(events))
+	}
+
+	events = m.Observe(ctx, Cycle{})
+	if len(events) != 1 || events[0].Trigger != TriggerRecovery {
+		t.Fatalf("Expected recovery event, got %v", events)
+	}
+
+	// A success without a preceding alert does not produce a recovery
+	m.Observe(ctx, Cycle{Failed: true})
+	if events := m.Observe(ctx, Cycle{}); len(events) != 0 {
+		t.Errorf("Expected no recovery without alert, got %d events", len(events))
+	}
+}
+
+func TestManager_CycleTriggers(t *testing.T) {
+	m, err := New(&Config{Enabled: true}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	events := m.Observe(context.Background(), Cycle{
+		Err:               errors.New("boom"),
+		Failed:            true,
+		ThresholdExceeded: true,
+		SafetyLimit:       true,
+		ArchivesFailed:    true,
+		RemoteFailures:    2,
+	})
+
+	want := []Trigger{TriggerThresholdExceeded, TriggerSafetyLimit, TriggerArchiveFailed, TriggerRemoteFailed}
+	if len(events) != len(want) {
+		t.Fatalf("Expected %d events, got %d", len(want), len(events))
+	}
+	for i, tr := range want {
+		if events[i].Trigger != tr {
+			t.Errorf("Event %d: expected trigger %s, got %s", i, tr, events[i].Trigger)
+		}
+		if events[i].Error != "boom" {
+			t.Errorf("Event %d: expected error 'boom', got %q", i, events[i].Error)
+		}
+	}
+}
+
+func TestWebhook_JSONPayload(t *testing.T) {
+	stub, srv := newWebhookStub(t)
+
+	m, err := New(&Config{
+		Enabled: true,
+		Webhooks: []WebhookConfig{{
+			URL:      srv.URL + "/hook",
+			Template: "{{.Message}} ({{.Result.Failed}} failed)",
+			Headers:  map[string]string{"Authorization": "Bearer token"},
+		}},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	m.Observe(context.Background(), Cycle{
+		Result:         &fakeResult{Succeeded: 5, Failed: 3},
+		Failed:         true,
+		RemoteFailures: 3,
+	})
+
+	if len(stub.bodies) != 1 {
+		t.Fatalf("Expected 1 webhook call, got %d", len(stub.bodies))
+	}
+	if got := stub.header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Expected Authorization header, got %q", got)
+	}
+
+	var payload struct {
+		Trigger string `json:"trigger"`
+		Message string `json:"message"`
+		Result  struct {
+			Succeeded int
+			Failed    int
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(stub.bodies[0], &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.Trigger != string(TriggerRemoteFailed) {
+		t.Errorf("Expected trigger %s, got %s", TriggerRemoteFailed, payload.Trigger)
+	}
+	if payload.Message != "3 remote copies failed (3 failed)" {
+		t.Errorf("Unexpected message: %q", payload.Message)
+	}
+	if payload.Result.Succeeded != 5 {
+		t.Errorf("Expected result.Succeeded 5, got %d", payload.Result.Succeeded)
+	}
+}
+
+func TestWebhook_SlackPayload(t *testing.T) {
+	stub, srv := newWebhookStub(t)
+
+	m, err := New(&Config{
+		Enabled: true,
+		Webhooks: []WebhookConfig{{
+			URL:      srv.URL,
+			Format:   FormatSlack,
+			Template: ":warning: {{.Trigger}}: {{.Message}}",
+		}},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	m.Observe(context.Background(), Cycle{ArchivesFailed: true, Failed: true})
+
+	if len(stub.bodies) != 1 {
+		t.Fatalf("Expected 1 webhook call, got %d", len(stub.bodies))
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(stub.bodies[0], &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if len(payload) != 1 {
+		t.Errorf("Expected only a text field, got %v", payload)
+	}
+	if payload["text"] != ":warning: archive_failed: all archive creations failed" {
+		t.Errorf("Unexpected text: %v", payload["text"])
+	}
+}
+
+func TestWebhook_TriggerFilter(t *testing.T) {
+	stub, srv := newWebhookStub(t)
+
+	m, err := New(&Config{
+		Enabled:  true,
+		Webhooks: []WebhookConfig{{URL: srv.URL, Triggers: []Trigger{TriggerRecovery}}},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	m.Observe(context.Background(), Cycle{RemoteFailures: 1})
+
+	if len(stub.bodies) != 0 {
+		t.Errorf("Expected no webhook calls for unsubscribed trigger, got %d", len(stub.bodies))
+	}
+}
+
+func TestWebhook_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	wh, err := NewWebhook(WebhookConfig{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("NewWebhook failed: %v", err)
+	}
+	if err := wh.Notify(context.Background(), &Event{Trigger: TriggerRecovery}); err == nil {
+		t.Error("Expected error for 500 response, got nil")
+	}
+}
+
+func TestEmail_SendsMessage(t *testing.T) {
+	stub, host, port := newSMTPStub(t)
+
+	m, err := New(&Config{
+		Enabled: true,
+		Email: &EmailConfig{
+			Host:     host,
+			Port:     port,
+			From:     "filekeeper@example.com",
+			To:       []string{"ops@example.com", "oncall@example.com"},
+			Subject:  "[fk] {{.Trigger}}",
+			Template: "{{.Message}}\nsucceeded={{.Result.Succeeded}}",
+		},
+	}, testLogger())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	m.Observe(context.Background(), Cycle{
+		Result:            &fakeResult{Succeeded: 7},
+		Failed:            true,
+		ThresholdExceeded: true,
+	})
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	if len(stub.messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(stub.messages))
+	}
+	if !strings.Contains(stub.from, "filekeeper@example.com") {
+		t.Errorf("Unexpected MAIL FROM: %q", stub.from)
+	}
+	if len(stub.rcpts) != 2 {
+		t.Errorf("Expected 2 recipients, got %d", len(stub.rcpts))
+	}
+
+	msg := stub.messages[0]
+	if !strings.Contains(msg, "Subject: [fk] threshold_exceeded\r\n") {
+		t.Errorf("Message missing subject: %q", msg)
+	}
+	if !strings.Contains(msg, "succeeded=7") {
+		t.Errorf("Message missing templated result field: %q", msg)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"disabled", Config{Enabled: false, Webhooks: []WebhookConfig{{URL: "bad"}}}, false},
+		{"valid webhook", Config{Enabled: true, Webhooks: []WebhookConfig{{URL: "https://hooks.example.com/x"}}}, false},
+		{"invalid url", Config{Enabled: true, Webhooks: []WebhookConfig{{URL: "ftp://example.com"}}}, true},
+		{"unknown format", Config{Enabled: true, Webhooks: []WebhookConfig{{URL: "http://x", Format: "xml"}}}, true},
+		{"bad template", Config{Enabled: true, Webhooks: []WebhookConfig{{URL: "http://x", Template: "{{.Message"}}}, true},
+		{"unknown trigger", Config{Enabled: true, Webhooks: []WebhookConfig{{URL: "http://x", Triggers: []Trigger{"nope"}}}}, true},
+		{"negative failures", Config{Enabled: true, ConsecutiveFailures: -1}, true},
+		{"email missing host", Config{Enabled: true, Email: &EmailConfig{From: "a@b", To: []string{"c@d"}}}, true},
+		{"email missing recipients", Config{Enabled: true, Email: &EmailConfig{Host: "smtp", From: "a@b"}}, true},
+		{"valid email", Config{Enabled: true, Email: &EmailConfig{Host: "smtp", From: "a@b", To: []string{"c@d"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/template"
+)
+
+// Webhook posts events as JSON to an HTTP endpoint.
+// With FormatSlack the payload is a Slack-compatible {"text": ...} message.
+type Webhook struct {
+	cfg     WebhookConfig
+	tmpl    *template.Template
+	client  *http.Client
+	display string
+}
+
+// NewWebhook creates a webhook notifier.
+func NewWebhook(cfg WebhookConfig) (*Webhook, error) {
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+	}
+	tmpl, err := parseTemplate("message", cfg.Template, DefaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return &Webhook{
+		cfg:     cfg,
+		tmpl:    tmpl,
+		client:  &http.Client{Timeout: timeoutOrDefault(cfg.TimeoutSeconds)},
+		display: redactURL(cfg.URL),
+	}, nil
+}
+
+// Name returns the webhook URL without credentials or query parameters.
+func (w *Webhook) Name() string {
+	return w.display
+}
+
+// Notify renders the event and posts it to the webhook URL.
+func (w *Webhook) Notify(ctx context.Context, event *Event) error {
+	text, err := render(w.tmpl, event)
+	if err != nil {
+		return err
+	}
+
+	var payload interface{}
+	switch w.cfg.Format {
+	case FormatSlack:
+		payload = map[string]string{"text": text}
+	default:
+		e := *event
+		e.Message = text
+		payload = e
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "filekeeper")
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package outbox retries failed remote copies. Each copy is tried a few times with
+// exponential backoff; copies that still fail are kept in a JSON file and retried in
+// later cycles, and their files are kept until every required copy was delivered.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"filekeeper/internal/duration"
+	"filekeeper/pkg/compression"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultFileName is the outbox file created in the first backup path when no path is configured.
+const DefaultFileName = ".filekeeper-outbox.json"
+
+// Defaults used when remote_retry is configured without them.
+const (
+	DefaultAttempts       = 3
+	DefaultInitialBackoff = 2 * time.Second
+	DefaultMaxBackoff     = time.Minute
+)
+
+// Config holds the retry settings of remote copies.
+type Config struct {
+	Attempts        int               `json:"attempts"`         // Tries per copy in a cycle (default: 3)
+	InitialBackoff  duration.Duration `json:"initial_backoff"`  // Wait before the second try, doubled for each further one (default: 2s)
+	MaxBackoff      duration.Duration `json:"max_backoff"`      // Longest wait between tries (default: 1m)
+	Outbox          bool              `json:"outbox"`           // Keep copies that failed every try and retry them in later cycles
+	Path            string            `json:"path"`             // Outbox file (default: .filekeeper-outbox.json in the first backup path)
+	OptionalRemotes []string          `json:"optional_remotes"` // Remotes whose pending copies do not keep files from being pruned
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	if c.Attempts < 0 {
+		return fmt.Errorf("attempts must not be negative, got %d", c.Attempts)
+	}
+	if c.InitialBackoff < 0 {
+		return fmt.Errorf("initial_backoff must not be negative, got %s", c.InitialBackoff)
+	}
+	if c.MaxBackoff < 0 {
+		return fmt.Errorf("max_backoff must not be negative, got %s", c.MaxBackoff)
+	}
+	return nil
+}
+
+// Required reports whether pending copies to remote keep files from being pruned.
+func (c *Config) Required(remote string) bool {
+	for _, optional := range c.OptionalRemotes {
+		if optional == remote {
+			return false
+		}
+	}
+	return true
+}
+
+// Backoff returns the wait after the given failed try, counted from 1.
+func (c *Config) Backoff(try int) time.Duration {
+	wait := time.Duration(c.InitialBackoff)
+	for i := 1; i < try && wait < time.Duration(c.MaxBackoff); i++ {
+		wait *= 2
+	}
+	return min(wait, time.Duration(c.MaxBackoff))
+}
+
+// Retry calls fn up to Attempts times, waiting Backoff between tries, and returns
+// the last error. It stops early with the context's error if ctx is done.
+func (c *Config) Retry(ctx context.Context, fn func() error) error {
+	var err error
+	for try := 1; try <= max(c.Attempts, 1); try++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if try == max(c.Attempts, 1) {
+			break
+		}
+		timer := time.NewTimer(c.Backoff(try))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		}
+	}
+	return err
+}
+
+// Entry is a remote copy waiting in the outbox.
+type Entry struct {
+	Destination string    `json:"destination"` // Name of the remote destination
+	Path        string    `json:"path"`        // Original file, or the archive for archive copies
+	Size        int64     `json:"size"`        // Size of the original file when it was backed up
+	ModTime     time.Time `json:"mod_time"`    // Modification time of the original file when it was backed up
+	Source      string    `json:"source"`      // Local backup, archive or streamed file the copy is made from
+	RelPath     string    `json:"rel_path"`    // Path of the copy relative to the backup directory
+	Archive     bool      `json:"archive"`     // The copy is of an archive rather than a file
+	Attempts    int       `json:"attempts"`    // Tries so far, over all cycles
+	QueuedAt    time.Time `json:"queued_at"`
+	LastError   string    `json:"last_error"`
+
+	// Streamed copies have no local copy: they are read from the original file
+	// Source and compressed with Compression, if set, while being sent.
+	Streamed    bool                `json:"streamed,omitempty"`
+	Compression *compression.Config `json:"compression,omitempty"`
+}
+
+// Matches reports whether the entry was queued for the file as it is now.
+func (e Entry) Matches(info os.FileInfo) bool {
+	return info != nil && e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// Outbox is the set of pending remote copies, stored as a JSON file.
+type Outbox struct {
+	path    string
+	entries map[string]Entry // By destination and path
+}
+
+// file is the JSON layout of the outbox file.
+type file struct {
+	Version int     `json:"version"`
+	Entries []Entry `json:"entries"`
+}
+
+// Load reads the outbox at path. A missing file is an empty outbox.
+func Load(path string) (*Outbox, error) {
+	o := &Outbox{path: path, entries: make(map[string]Entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse outbox %s: %w", path, err)
+	}
+	for _, e := range f.Entries {
+		o.entries[key(e.Destination, e.Path)] = e
+	}
+	return o, nil
+}
+
+// Save writes the outbox, replacing the file atomically. An empty outbox removes the file.
+func (o *Outbox) Save() error {
+	if len(o.entries) == 0 {
+		if err := os.Remove(o.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove outbox: %w", err)
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(file{Version: 1, Entries: o.Entries()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode outbox: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), o.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	return nil
+}
+
+// key identifies the copy of path to destination.
+func key(destination, path string) string {
+	return destination + "\x00" + path
+}
+
+// Add queues e, replacing an earlier entry for the same destination and path and
+// keeping its attempt count and queue time.
+func (o *Outbox) Add(e Entry) {
+	if old, ok := o.entries[key(e.Destination, e.Path)]; ok {
+		e.Attempts += old.Attempts
+		e.QueuedAt = old.QueuedAt
+	}
+	o.entries[key(e.Destination, e.Path)] = e
+}
+
+// Remove removes the entry for destination and path, if any.
+func (o *Outbox) Remove(destination, path string) {
+	delete(o.entries, key(destination, path))
+}
+
+// Pending returns the entries for path, ordered by destination.
+func (o *Outbox) Pending(path string) []Entry {
+	var list []Entry
+	for _, e := range o.entries {
+		if e.Path == path {
+			list = append(list, e)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Destination < list[j].Destination })
+	return list
+}
+
+// Entries returns all entries, ordered by queue time, path and destination.
+func (o *Outbox) Entries() []Entry {
+	list := make([]Entry, 0, len(o.entries))
+	for _, e := range o.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if !a.QueuedAt.Equal(b.QueuedAt) {
+			return a.QueuedAt.Before(b.QueuedAt)
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Destination < b.Destination
+	})
+	return list
+}
+
+// Len returns the number of pending copies.
+func (o *Outbox) Len() int {
+	return len(o.entries)
+}
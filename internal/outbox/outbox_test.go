@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"filekeeper/internal/duration"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	cfg := Config{InitialBackoff: duration.Duration(time.Second), MaxBackoff: duration.Duration(5 * time.Second)}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := cfg.Backoff(i + 1); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	cfg := Config{Attempts: 3, InitialBackoff: duration.Duration(time.Millisecond), MaxBackoff: duration.Duration(time.Millisecond)}
+	errFail := errors.New("fail")
+
+	// Succeeds on the second try
+	tries := 0
+	err := cfg.Retry(context.Background(), func() error {
+		tries++
+		if tries < 2 {
+			return errFail
+		}
+		return nil
+	})
+	if err != nil || tries != 2 {
+		t.Errorf("Retry() = %v after %d tries, want nil after 2", err, tries)
+	}
+
+	// Gives up after Attempts tries with the last error
+	tries = 0
+	err = cfg.Retry(context.Background(), func() error {
+		tries++
+		return errFail
+	})
+	if !errors.Is(err, errFail) || tries != 3 {
+		t.Errorf("Retry() = %v after %d tries, want fail after 3", err, tries)
+	}
+
+	// Stops waiting when the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cfg.InitialBackoff = duration.Duration(time.Hour)
+	cfg.MaxBackoff = duration.Duration(time.Hour)
+	tries = 0
+	err = cfg.Retry(ctx, func() error {
+		tries++
+		return errFail
+	})
+	if !errors.Is(err, context.Canceled) || tries != 1 {
+		t.Errorf("Retry() = %v after %d tries, want context.Canceled after 1", err, tries)
+	}
+}
+
+func TestOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+
+	box, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of a missing file failed: %v", err)
+	}
+	if box.Len() != 0 {
+		t.Fatalf("Expected an empty outbox, got %d entries", box.Len())
+	}
+
+	queued := time.Now().Truncate(time.Second)
+	box.Add(Entry{Destination: "b:/x", Path: "/logs/a.log", Attempts: 3, QueuedAt: queued, LastError: "first"})
+	box.Add(Entry{Destination: "a:/x", Path: "/logs/a.log", Attempts: 3, QueuedAt: queued})
+	box.Add(Entry{Destination: "b:/x", Path: "/logs/a.log", Attempts: 2, QueuedAt: queued.Add(time.Hour), LastError: "second"})
+	if err := box.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	box, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	pending := box.Pending("/logs/a.log")
+	if len(pending) != 2 || pending[0].Destination != "a:/x" || pending[1].Destination != "b:/x" {
+		t.Fatalf("Expected copies to a:/x and b:/x, got %+v", pending)
+	}
+	if e := pending[1]; e.Attempts != 5 || !e.QueuedAt.Equal(queued) || e.LastError != "second" {
+		t.Errorf("Expected attempts added up and the first queue time kept, got %+v", e)
+	}
+
+	// An empty outbox removes its file
+	box.Remove("a:/x", "/logs/a.log")
+	box.Remove("b:/x", "/logs/a.log")
+	if err := box.Save(); err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the outbox file removed, got %v", err)
+	}
+}
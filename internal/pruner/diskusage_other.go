@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pruner
+
+import "errors"
+
+// DiskUsage is not supported on this platform.
+func DiskUsage(path string) (Usage, error) {
+	return Usage{}, errors.New("free space check is not supported on this platform")
+}
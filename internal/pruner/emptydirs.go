@@ -0,0 +1,128 @@
+package pruner
+
+import (
+	"context"
+	"errors"
+	"filekeeper/internal/rules"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DirPolicy describes which empty directories are removed after pruning.
+type DirPolicy struct {
+	MinAge  time.Duration // Only remove directories not modified for this long (0 = any age)
+	Protect []string      // Globs for directories that are never removed, matched like rule globs
+	Exclude []string      // Directories that are neither entered nor removed, such as backup or trash directories
+	Now     time.Time     // Reference time for MinAge (zero = time.Now())
+}
+
+// RemoveEmptyDirs removes empty directories under directory, deepest first, so a tree of
+// dated folders left empty by pruning disappears in one pass. The directory itself,
+// protected directories and directories younger than MinAge are kept, and so are their
+// parents. Ages are taken before anything is removed. Symlinked directories are not entered.
+// If dryRun is true, it logs the directories that would be removed.
+func RemoveEmptyDirs(ctx context.Context, directory string, policy DirPolicy, dryRun bool, log *slog.Logger) (*Result, error) {
+	result := NewResult()
+
+	type dir struct {
+		path    string
+		modTime time.Time
+	}
+	var dirs []dir
+	exclude := newExcludeSet(policy.Exclude)
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err != nil {
+			// Unreadable directories cannot be checked for emptiness; keep them
+			return nil
+		}
+		if info.IsDir() && exclude.contains(path) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && path != directory {
+			dirs = append(dirs, dir{path: path, modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	// Walk order lists parents before children, so reverse order handles children first
+	removed := make(map[string]bool)
+	now := policy.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	threshold := now.Add(-policy.MinAge)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+
+		relPath, err := filepath.Rel(directory, d.path)
+		if err != nil || protected(relPath, policy.Protect) {
+			continue
+		}
+		if policy.MinAge > 0 && !d.modTime.Before(threshold) {
+			continue
+		}
+		if !isEmpty(d.path, removed) {
+			continue
+		}
+
+		if dryRun {
+			log.Info("[DRY-RUN] would remove empty directory", slog.String("path", d.path))
+			removed[d.path] = true
+			result.DirsRemoved++
+			continue
+		}
+
+		if err := os.Remove(d.path); err != nil {
+			// A file created since the check keeps the directory, which is fine
+			if !errors.Is(err, syscall.ENOTEMPTY) && !errors.Is(err, syscall.EEXIST) {
+				log.Warn("failed to remove empty directory",
+					slog.String("path", d.path),
+					slog.String("error", err.Error()),
+				)
+				result.AddError(d.path, "rmdir", err)
+			}
+			continue
+		}
+		log.Info("removed empty directory", slog.String("path", d.path))
+		removed[d.path] = true
+		result.DirsRemoved++
+	}
+
+	return result, nil
+}
+
+// protected reports whether the directory matches a protected glob.
+func protected(relPath string, globs []string) bool {
+	for _, glob := range globs {
+		if rules.MatchGlob(glob, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmpty reports whether dir contains nothing but directories already removed.
+// In dry-run mode, removed holds the directories that would have been removed.
+func isEmpty(dir string, removed map[string]bool) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, e := range entries {
+		if !removed[filepath.Join(dir, e.Name())] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package pruner
+
+import "os"
+
+// fileID is not available on this platform; directories are compared with os.SameFile instead.
+func fileID(info os.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
@@ -5,80 +5,115 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
-	"time"
 )
 
-// PruneFiles deletes files older than pruneThreshold from the specified directory.
+// PruneFiles deletes the files selected by policy from the specified directory.
 // It accepts a context for graceful shutdown support and returns a Result with success/failure counts.
 // Individual file errors are logged but processing continues unless error threshold is exceeded.
 // If dryRun is true, it shows what would be deleted without actually deleting files.
-func PruneFiles(ctx context.Context, directory string, pruneThreshold time.Time, errorThresholdPercent float64, dryRun bool, log *slog.Logger) (*Result, error) {
+func PruneFiles(ctx context.Context, directory string, policy Policy, errorThresholdPercent float64, dryRun bool, log *slog.Logger) (*Result, error) {
+	candidates, result, err := Select(ctx, directory, policy, log)
+	if err != nil {
+		return result, err
+	}
+
+	pruneResult, err := PruneCandidates(ctx, candidates, nil, nil, errorThresholdPercent, dryRun, log)
+	result.Merge(pruneResult)
+	return result, err
+}
+
+// RemoveFunc removes a pruned file, for example by moving it to a trash directory.
+type RemoveFunc func(path string) error
+
+// PruneCandidates deletes the given files in order using remove, or os.Remove if remove is nil.
+// pruned, if set, is called for each file after it was pruned.
+// Individual file errors are logged but processing continues unless error threshold is exceeded.
+// If dryRun is true, it shows the planned deletion order without deleting anything.
+func PruneCandidates(ctx context.Context, candidates []Candidate, remove RemoveFunc, pruned func(Candidate), errorThresholdPercent float64, dryRun bool, log *slog.Logger) (*Result, error) {
 	result := NewResult()
+	if remove == nil {
+		remove = os.Remove
+	}
 
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+	for i, c := range candidates {
 		// Check for context cancellation before processing each file
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return result, ctx.Err()
 		default:
 		}
 
-		// Handle access errors - log and continue
-		if err != nil {
-			log.Warn("failed to access file for pruning",
-				slog.String("path", path),
-				slog.String("error", err.Error()),
-			)
-			result.AddError(path, "access", err)
-			return nil // Continue walking
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		if !info.ModTime().Before(pruneThreshold) {
-			result.Skipped++
-			return nil
-		}
-
 		// In dry-run mode, just log what would happen
 		if dryRun {
-			log.Info("[DRY-RUN] would prune file",
-				slog.String("path", path),
-				slog.Int64("size_bytes", info.Size()),
-				slog.Time("mod_time", info.ModTime()),
+			msg := "[DRY-RUN] would prune file"
+			if c.Truncate {
+				msg = "[DRY-RUN] would truncate file"
+			}
+			log.Info(msg,
+				slog.Int("order", i+1),
+				slog.String("path", c.Path),
+				slog.String("rule", c.Rule.DisplayName()),
+				slog.String("reason", c.Reason),
+				slog.Int64("size_bytes", c.Info.Size()),
+				slog.Time("file_time", c.Time),
 			)
 			result.Pruned++
-			return nil
+			continue
 		}
 
-		// Attempt to remove the file
-		if err := os.Remove(path); err != nil {
+		if err := prune(c, remove, result); err != nil {
 			log.Error("prune failed",
-				slog.String("path", path),
+				slog.String("path", c.Path),
 				slog.String("error", err.Error()),
 			)
-			result.AddError(path, "prune", err)
+			result.AddError(c.Path, "prune", err)
 
 			// Check error threshold
 			if errorThresholdPercent > 0 && result.FailureRate() > errorThresholdPercent {
-				return fmt.Errorf("error threshold exceeded: %.1f%% failures (threshold: %.1f%%)",
-					result.FailureRate(), errorThresholdPercent)
+				return result, fmt.Errorf("%w: %.1f%% failures (threshold: %.1f%%)",
+					ErrThresholdExceeded, result.FailureRate(), errorThresholdPercent)
 			}
-			return nil // Continue walking
+			continue
 		}
 
-		log.Info("pruned file",
-			slog.String("path", path),
-			slog.Int64("size_bytes", info.Size()),
-			slog.Time("mod_time", info.ModTime()),
+		msg := "pruned file"
+		if c.Truncate {
+			msg = "truncated file"
+		}
+		log.Info(msg,
+			slog.String("path", c.Path),
+			slog.String("rule", c.Rule.DisplayName()),
+			slog.String("reason", c.Reason),
+			slog.Int64("size_bytes", c.Info.Size()),
+			slog.Time("file_time", c.Time),
 		)
 		result.Pruned++
+		if pruned != nil {
+			pruned(c)
+		}
+	}
 
-		return nil
-	})
+	return result, nil
+}
 
-	return result, err
+// prune removes the candidate, or for copy-truncate empties it in place.
+// A copy-truncate candidate with a snapshot was already truncated; only the snapshot is removed.
+func prune(c Candidate, remove RemoveFunc, result *Result) error {
+	if !c.Truncate {
+		return remove(c.Path)
+	}
+	if c.Source != "" {
+		return os.Remove(c.Source)
+	}
+
+	info, err := os.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(c.Path, 0); err != nil {
+		return err
+	}
+	result.Truncated++
+	result.TruncatedBytes += info.Size()
+	return nil
 }
@@ -0,0 +1,478 @@
+package pruner
+
+import (
+	"context"
+	"filekeeper/internal/logger"
+	"filekeeper/internal/rules"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// testLogger creates a logger for testing
+func testLogger() *slog.Logger {
+	return logger.New("error", "text")
+}
+
+// createFile writes a file of the given size with its modification time set to age ago.
+func createFile(t *testing.T, dir, name string, size int, age time.Duration) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	modTime := time.Now().Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	return path
+}
+
+func candidatePaths(candidates []Candidate) []string {
+	paths := make([]string, len(candidates))
+	for i, c := range candidates {
+		paths[i] = filepath.Base(c.Path)
+	}
+	return paths
+}
+
+func TestSelect_AgeOnly(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "new.log", 10, time.Hour)
+	createFile(t, dir, "old.log", 10, 48*time.Hour)
+	createFile(t, dir, "sub/older.log", 10, 72*time.Hour)
+
+	policy := Policy{Threshold: time.Now().Add(-24 * time.Hour)}
+	candidates, result, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	got := candidatePaths(candidates)
+	want := []string{"older.log", "old.log"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Position %d: expected %s, got %s", i, want[i], got[i])
+		}
+		if candidates[i].Reason != ReasonAge {
+			t.Errorf("Position %d: expected reason %s, got %s", i, ReasonAge, candidates[i].Reason)
+		}
+	}
+	if result.Skipped != 1 {
+		t.Errorf("Expected 1 skipped file, got %d", result.Skipped)
+	}
+}
+
+func TestSelect_MaxTotalBytes(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "a.log", 100, 5*time.Hour)
+	createFile(t, dir, "b.log", 100, 4*time.Hour)
+	createFile(t, dir, "c.log", 100, 3*time.Hour)
+	createFile(t, dir, "d.log", 100, 2*time.Hour)
+
+	// Nothing is old enough, but the folder holds 400 bytes and may only hold 250
+	policy := Policy{
+		Threshold:     time.Now().Add(-24 * time.Hour),
+		MaxTotalBytes: 250,
+	}
+	candidates, result, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	got := candidatePaths(candidates)
+	if len(got) != 2 || got[0] != "a.log" || got[1] != "b.log" {
+		t.Fatalf("Expected [a.log b.log], got %v", got)
+	}
+	for _, c := range candidates {
+		if c.Reason != ReasonMaxTotalBytes {
+			t.Errorf("Expected reason %s for %s, got %s", ReasonMaxTotalBytes, c.Path, c.Reason)
+		}
+	}
+	if result.Skipped != 2 {
+		t.Errorf("Expected 2 skipped files, got %d", result.Skipped)
+	}
+}
+
+func TestSelect_CombinesAgeAndSize(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "old.log", 100, 48*time.Hour)
+	createFile(t, dir, "mid.log", 100, 3*time.Hour)
+	createFile(t, dir, "new.log", 100, time.Hour)
+
+	policy := Policy{
+		Threshold:     time.Now().Add(-24 * time.Hour),
+		MaxTotalBytes: 150,
+	}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	if len(candidates) != 2 {
+		t.Fatalf("Expected 2 candidates, got %v", candidatePaths(candidates))
+	}
+	if candidates[0].Reason != ReasonAge || candidates[1].Reason != ReasonMaxTotalBytes {
+		t.Errorf("Unexpected reasons: %s, %s", candidates[0].Reason, candidates[1].Reason)
+	}
+}
+
+func TestSelect_SizeKeepsLongerRuleRetention(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "audit/a.log", 100, 5*time.Hour)
+	createFile(t, dir, "b.log", 100, 4*time.Hour)
+	createFile(t, dir, "c.log", 100, 3*time.Hour)
+	createFile(t, dir, "d.log", 100, 2*time.Hour)
+
+	ruleSet, err := rules.New([]rules.Rule{{Name: "audit", Glob: "audit/*.log", PruneAfterHours: 720}})
+	if err != nil {
+		t.Fatalf("Failed to create rules: %v", err)
+	}
+
+	// The oldest file is kept by its rule, so the next oldest are taken instead
+	policy := Policy{
+		Threshold:     time.Now().Add(-24 * time.Hour),
+		Rules:         ruleSet,
+		MaxTotalBytes: 250,
+	}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	got := candidatePaths(candidates)
+	if len(got) != 2 || got[0] != "b.log" || got[1] != "c.log" {
+		t.Fatalf("Expected [b.log c.log], got %v", got)
+	}
+}
+
+func TestSelect_MinFreePercent(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" && runtime.GOOS != "freebsd" {
+		t.Skip("free space check not supported on this platform")
+	}
+
+	dir := t.TempDir()
+	createFile(t, dir, "a.log", 10, 3*time.Hour)
+	createFile(t, dir, "b.log", 10, 2*time.Hour)
+
+	// An unreachable free-space target selects every file, oldest first
+	policy := Policy{
+		Threshold:      time.Now().Add(-24 * time.Hour),
+		MinFreePercent: 99.999,
+	}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	got := candidatePaths(candidates)
+	if len(got) != 2 || got[0] != "a.log" {
+		t.Fatalf("Expected [a.log b.log], got %v", got)
+	}
+	if candidates[0].Reason != ReasonMinFreePercent {
+		t.Errorf("Expected reason %s, got %s", ReasonMinFreePercent, candidates[0].Reason)
+	}
+}
+
+func TestPruneCandidates_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	path := createFile(t, dir, "old.log", 10, 48*time.Hour)
+
+	candidates, _, err := Select(context.Background(), dir, Policy{Threshold: time.Now()}, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+
+	result, err := PruneCandidates(context.Background(), candidates, nil, nil, 0, true, testLogger())
+	if err != nil {
+		t.Fatalf("PruneCandidates failed: %v", err)
+	}
+	if result.Pruned != 1 {
+		t.Errorf("Expected 1 file would be pruned, got %d", result.Pruned)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected file to remain in dry-run mode: %v", err)
+	}
+}
+
+func TestPruneFiles(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := createFile(t, dir, "old.log", 10, 48*time.Hour)
+	newPath := createFile(t, dir, "new.log", 10, time.Hour)
+
+	result, err := PruneFiles(context.Background(), dir, Policy{Threshold: time.Now().Add(-24 * time.Hour)}, 0, false, testLogger())
+	if err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if result.Pruned != 1 || result.Skipped != 1 {
+		t.Errorf("Expected 1 pruned and 1 skipped, got %d and %d", result.Pruned, result.Skipped)
+	}
+	if _, err := os.Stat(oldPath); !os.IsNotExist(err) {
+		t.Error("Expected old file to be pruned")
+	}
+	if _, err := os.Stat(newPath); err != nil {
+		t.Errorf("Expected new file to remain: %v", err)
+	}
+}
+
+func TestSelect_Links(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	target := createFile(t, outside, "target.log", 10, 48*time.Hour)
+	createFile(t, outside, "logs/linked.log", 10, 48*time.Hour)
+	createFile(t, dir, "old.log", 10, 48*time.Hour)
+	if err := os.Symlink(target, filepath.Join(dir, "file-link.log")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "logs"), filepath.Join(dir, "dir-link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	tests := []struct {
+		links LinkPolicy
+		want  []string
+	}{
+		{LinksSkip, []string{"old.log"}},
+		{"", []string{"old.log"}},
+		{LinksPreserve, []string{"dir-link", "file-link.log", "old.log"}},
+		// dir-link points outside the target folder, so it is not walked
+		{LinksFollow, []string{"file-link.log", "old.log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.links), func(t *testing.T) {
+			// A preserved link has its own, fresh timestamp, so every file is old enough here
+			policy := Policy{Threshold: time.Now().Add(time.Hour), Links: tt.links}
+			candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+			if err != nil {
+				t.Fatalf("Select failed: %v", err)
+			}
+
+			got := make(map[string]bool)
+			for _, c := range candidates {
+				got[filepath.Base(c.Path)] = true
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, candidatePaths(candidates))
+			}
+			for _, name := range tt.want {
+				if !got[name] {
+					t.Errorf("Expected %s to be selected, got %v", name, candidatePaths(candidates))
+				}
+			}
+
+			for _, c := range candidates {
+				isLink := c.Info.Mode()&os.ModeSymlink != 0
+				if isLink != (tt.links == LinksPreserve && filepath.Base(c.Path) != "old.log") {
+					t.Errorf("%s: unexpected symlink info %v", c.Path, c.Info.Mode())
+				}
+			}
+		})
+	}
+}
+
+func TestSelect_FollowLinksLoop(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "sub/old.log", 10, 48*time.Hour)
+	if err := os.Symlink(dir, filepath.Join(dir, "sub", "loop")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	policy := Policy{Threshold: time.Now().Add(-24 * time.Hour), Links: LinksFollow}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(candidates) != 1 {
+		t.Errorf("Expected the file once despite the loop, got %v", candidatePaths(candidates))
+	}
+}
+
+func TestSelect_FollowLinksInsideRoot(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	createFile(t, dir, "data/old.log", 10, 48*time.Hour)
+	createFile(t, outside, "old.log", 10, 48*time.Hour)
+	if err := os.Symlink(filepath.Join(dir, "data"), filepath.Join(dir, "current")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "elsewhere")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	policy := Policy{Threshold: time.Now().Add(-24 * time.Hour), Links: LinksFollow}
+	result, err := PruneFiles(context.Background(), dir, policy, 0, false, testLogger())
+	if err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if result.Pruned != 1 {
+		t.Errorf("Expected 1 pruned file, got %d", result.Pruned)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "data", "old.log")); !os.IsNotExist(err) {
+		t.Error("Expected the file inside the target folder to be pruned")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "old.log")); err != nil {
+		t.Errorf("Expected the file outside the target folder to remain: %v", err)
+	}
+}
+
+func TestPruneCandidates_PreservedSymlink(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	target := createFile(t, outside, "target.log", 10, 48*time.Hour)
+	link := filepath.Join(dir, "link.log")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	policy := Policy{Threshold: time.Now().Add(time.Hour), Links: LinksPreserve}
+	if _, err := PruneFiles(context.Background(), dir, policy, 0, false, testLogger()); err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Error("Expected the symlink to be pruned")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("Expected the link target to remain: %v", err)
+	}
+}
+
+func TestPruneFiles_CopyTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := createFile(t, dir, "app.log", 100, 48*time.Hour)
+
+	policy := Policy{Threshold: time.Now().Add(-24 * time.Hour), CopyTruncate: true}
+	result, err := PruneFiles(context.Background(), dir, policy, 0, false, testLogger())
+	if err != nil {
+		t.Fatalf("PruneFiles failed: %v", err)
+	}
+	if result.Pruned != 1 || result.Truncated != 1 || result.TruncatedBytes != 100 {
+		t.Errorf("Expected 1 truncated file and 100 bytes, got %d pruned, %d truncated, %d bytes",
+			result.Pruned, result.Truncated, result.TruncatedBytes)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected file to remain: %v", err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Expected file to be empty, got %d bytes", info.Size())
+	}
+
+	// An emptied file has nothing to reclaim and is not selected again
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(candidates) != 0 {
+		t.Errorf("Expected empty file not to be selected, got %v", candidatePaths(candidates))
+	}
+}
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"2026/09/15", "2026/09/16", "incoming/today", "keep"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	createFile(t, dir, "keep/app.log", 10, time.Hour)
+
+	policy := DirPolicy{Protect: []string{"incoming"}}
+	result, err := RemoveEmptyDirs(context.Background(), dir, policy, false, testLogger())
+	if err != nil {
+		t.Fatalf("RemoveEmptyDirs failed: %v", err)
+	}
+
+	// 2026 with its three subfolders and incoming/today go; incoming itself is protected
+	if result.DirsRemoved != 5 {
+		t.Errorf("Expected 5 directories removed, got %d", result.DirsRemoved)
+	}
+	for _, gone := range []string{"2026", "incoming/today"} {
+		if _, err := os.Stat(filepath.Join(dir, gone)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", gone)
+		}
+	}
+	for _, kept := range []string{"", "incoming", "keep"} {
+		if _, err := os.Stat(filepath.Join(dir, kept)); err != nil {
+			t.Errorf("Expected %q to be kept: %v", kept, err)
+		}
+	}
+}
+
+func TestRemoveEmptyDirs_DryRunAndMinAge(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := filepath.Join(dir, "old", "day")
+	newDir := filepath.Join(dir, "new")
+	for _, d := range []string{oldDir, newDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	for _, d := range []string{oldDir, filepath.Dir(oldDir)} {
+		if err := os.Chtimes(d, old, old); err != nil {
+			t.Fatalf("Failed to set directory time: %v", err)
+		}
+	}
+
+	policy := DirPolicy{MinAge: 24 * time.Hour}
+	result, err := RemoveEmptyDirs(context.Background(), dir, policy, true, testLogger())
+	if err != nil {
+		t.Fatalf("RemoveEmptyDirs failed: %v", err)
+	}
+	if result.DirsRemoved != 2 {
+		t.Errorf("Expected old and old/day to be reported, got %d", result.DirsRemoved)
+	}
+	for _, d := range []string{oldDir, newDir} {
+		if _, err := os.Stat(d); err != nil {
+			t.Errorf("Expected %s to remain in dry-run mode: %v", d, err)
+		}
+	}
+
+	result, err = RemoveEmptyDirs(context.Background(), dir, policy, false, testLogger())
+	if err != nil {
+		t.Fatalf("RemoveEmptyDirs failed: %v", err)
+	}
+	if result.DirsRemoved != 2 {
+		t.Errorf("Expected 2 directories removed, got %d", result.DirsRemoved)
+	}
+	if _, err := os.Stat(newDir); err != nil {
+		t.Errorf("Expected the new directory to be kept: %v", err)
+	}
+}
+
+func TestSelect_Exclude(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "app.log", 10, 48*time.Hour)
+	createFile(t, dir, "backup/app.log", 10, 48*time.Hour)
+	if err := os.Symlink(filepath.Join(dir, "backup"), filepath.Join(dir, "backup-link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	policy := Policy{
+		Threshold: time.Now().Add(-24 * time.Hour),
+		Links:     LinksFollow,
+		Exclude:   []string{filepath.Join(dir, "backup")},
+	}
+	candidates, _, err := Select(context.Background(), dir, policy, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Path != filepath.Join(dir, "app.log") {
+		t.Errorf("Expected only app.log, got %v", candidatePaths(candidates))
+	}
+}
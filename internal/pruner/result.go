@@ -1,6 +1,12 @@
 package pruner
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrThresholdExceeded is returned when the failure rate exceeds the configured error threshold.
+var ErrThresholdExceeded = errors.New("error threshold exceeded")
 
 // FileError represents an error that occurred while processing a specific file.
 type FileError struct {
@@ -15,10 +21,13 @@ func (e FileError) Error() string {
 
 // Result represents the outcome of a prune operation.
 type Result struct {
-	Pruned  int
-	Failed  int
-	Skipped int
-	Errors  []FileError
+	Pruned         int
+	Failed         int
+	Skipped        int
+	Truncated      int   // Files emptied in place by copy-truncate (also counted in Pruned)
+	TruncatedBytes int64 // Bytes reclaimed by copy-truncate
+	DirsRemoved    int   // Empty directories removed after pruning
+	Errors         []FileError
 }
 
 // NewResult creates a new empty Result.
@@ -47,6 +56,20 @@ func (r *Result) FailureRate() float64 {
 	return float64(r.Failed) / float64(total) * 100
 }
 
+// Merge combines another Result into this one.
+func (r *Result) Merge(other *Result) {
+	if other == nil {
+		return
+	}
+	r.Pruned += other.Pruned
+	r.Failed += other.Failed
+	r.Skipped += other.Skipped
+	r.Truncated += other.Truncated
+	r.TruncatedBytes += other.TruncatedBytes
+	r.DirsRemoved += other.DirsRemoved
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
 // Summary returns a human-readable summary of the result.
 func (r *Result) Summary() string {
 	if r.Failed == 0 {
@@ -0,0 +1,199 @@
+package pruner
+
+import (
+	"context"
+	"filekeeper/internal/filetime"
+	"filekeeper/internal/rules"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// Reasons a file can be selected for pruning.
+const (
+	ReasonAge            = "age"
+	ReasonMaxTotalBytes  = "max_total_bytes"
+	ReasonMinFreePercent = "min_free_percent"
+)
+
+// Policy describes which files are selected for pruning.
+// Files older than their age threshold are always selected: the threshold of the first
+// matching rule, or Threshold if no rule matches. If MaxTotalBytes or MinFreePercent
+// are set, the oldest remaining files are selected as well until both limits are met.
+type Policy struct {
+	Threshold      time.Time          // Files matching no rule and modified before this time are selected
+	Rules          *rules.Set         // Per-pattern rules, first match wins (optional)
+	Times          *filetime.Resolver // Age source for files (nil = modification time)
+	MaxTotalBytes  int64              // Keep the folder at or below this size (0 = disabled)
+	MinFreePercent float64            // Keep filesystem free space at or above this percentage (0 = disabled)
+	Links          LinkPolicy         // How symlinks are handled (default: skip)
+	CopyTruncate   bool               // Truncate files in place instead of removing them, unless a rule overrides it
+	Exclude        []string           // Directories that are not walked, such as backup or trash directories inside the folder
+	Now            time.Time          // Reference time for rule thresholds (zero = time.Now())
+}
+
+// Candidate is a file selected for backup and pruning.
+type Candidate struct {
+	Path   string
+	Info   os.FileInfo // Lstat info for preserved symlinks, otherwise the info of the file itself
+	Time   time.Time   // Timestamp from the configured age source
+	Rule   *rules.Rule // Matching rule, nil if the default rule applies
+	Reason string      // Why the file was selected: age, max_total_bytes or min_free_percent
+
+	// Truncate empties the file in place instead of removing it (copy-truncate).
+	// Source, if set, is a snapshot of the content taken before truncation; backups
+	// read from it and pruning removes it.
+	Truncate bool
+	Source   string
+}
+
+// ContentPath returns the path to read the file's content from.
+func (c *Candidate) ContentPath() string {
+	if c.Source != "" {
+		return c.Source
+	}
+	return c.Path
+}
+
+// Select walks directory and returns the files to prune, oldest first by their age source timestamp.
+// Symlinks are handled according to policy.Links; devices, sockets and FIFOs are never selected.
+// Files that are not selected are counted as skipped in the returned Result;
+// files that cannot be accessed are recorded as errors and walking continues.
+func Select(ctx context.Context, directory string, policy Policy, log *slog.Logger) ([]Candidate, *Result, error) {
+	result := NewResult()
+	var files []Candidate
+	var totalBytes int64
+
+	_, resolvedRoot := resolvePath(directory)
+	w := &walker{
+		ctx:      ctx,
+		root:     directory,
+		realRoot: resolvedRoot,
+		links:    policy.Links,
+		exclude:  newExcludeSet(policy.Exclude),
+		log:      log,
+		result:   result,
+	}
+	w.visit = func(path, relPath string, info os.FileInfo) {
+		fileTime, ok, err := policy.Times.Time(path, info)
+		if err != nil {
+			log.Warn("failed to read file time",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+			result.AddError(path, "age", err)
+			return
+		}
+		if !ok {
+			log.Debug("file name does not match layout, using modification time",
+				slog.String("path", path),
+			)
+		}
+
+		rule := policy.Rules.Match(relPath)
+		files = append(files, Candidate{
+			Path:     path,
+			Info:     info,
+			Time:     fileTime,
+			Rule:     rule,
+			Truncate: info.Mode().IsRegular() && rule.CopyTruncateEnabled(policy.CopyTruncate),
+		})
+		totalBytes += info.Size()
+	}
+	if err := w.walk(directory, directory); err != nil {
+		return nil, result, err
+	}
+
+	// Oldest first; ties are broken by path so the order is stable across runs
+	sort.SliceStable(files, func(i, j int) bool {
+		ti, tj := files[i].Time, files[j].Time
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	// Bytes that must be freed to satisfy the free-space rule
+	var freeNeeded int64
+	if policy.MinFreePercent > 0 {
+		usage, err := DiskUsage(directory)
+		if err != nil {
+			return nil, result, fmt.Errorf("check free space: %w", err)
+		}
+		want := int64(policy.MinFreePercent / 100 * float64(usage.Total))
+		if want > int64(usage.Free) {
+			freeNeeded = want - int64(usage.Free)
+		}
+	}
+
+	// Age rule first, then the oldest remaining files until the size limits are met
+	now := policy.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	var selectedBytes int64
+	for i := range files {
+		f := &files[i]
+		if f.Truncate && f.Info.Size() == 0 {
+			continue // Nothing to reclaim from an emptied file
+		}
+		threshold := policy.Threshold
+		if f.Rule != nil {
+			threshold = now.Add(-f.Rule.PruneAfter())
+		}
+		if f.Time.Before(threshold) {
+			f.Reason = ReasonAge
+			selectedBytes += f.Info.Size()
+		}
+	}
+	// Files whose rule keeps them longer than the default are not taken before that age
+	protected := 0
+	for i := range files {
+		f := &files[i]
+		if f.Reason != "" || (f.Truncate && f.Info.Size() == 0) {
+			continue
+		}
+		if f.Rule != nil && now.Add(-f.Rule.PruneAfter()).Before(policy.Threshold) {
+			protected++
+			continue
+		}
+		switch {
+		case policy.MaxTotalBytes > 0 && totalBytes-selectedBytes > policy.MaxTotalBytes:
+			f.Reason = ReasonMaxTotalBytes
+		case selectedBytes < freeNeeded:
+			f.Reason = ReasonMinFreePercent
+		default:
+			continue
+		}
+		selectedBytes += f.Info.Size()
+	}
+	if protected > 0 && ((policy.MaxTotalBytes > 0 && totalBytes-selectedBytes > policy.MaxTotalBytes) || selectedBytes < freeNeeded) {
+		log.Warn("size limits not met, remaining files are kept by their rules",
+			slog.Int("kept_by_rules", protected),
+		)
+	}
+
+	selected := make([]Candidate, 0, len(files))
+	for _, f := range files {
+		if f.Reason == "" {
+			log.Debug("file retained",
+				slog.String("path", f.Path),
+				slog.String("rule", f.Rule.DisplayName()),
+				slog.Time("file_time", f.Time),
+			)
+			result.Skipped++
+			continue
+		}
+		selected = append(selected, f)
+	}
+
+	return selected, result, nil
+}
+
+// Usage describes the capacity of a filesystem in bytes.
+type Usage struct {
+	Total uint64 // Filesystem size
+	Free  uint64 // Space available to unprivileged users
+}
@@ -0,0 +1,247 @@
+package pruner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LinkPolicy controls how symbolic links in the target folder are handled.
+type LinkPolicy string
+
+const (
+	// LinksSkip leaves symlinks alone: they are neither backed up nor pruned.
+	LinksSkip LinkPolicy = "skip"
+	// LinksPreserve backs up symlinks as links and prunes the link, never its target.
+	LinksPreserve LinkPolicy = "preserve"
+	// LinksFollow backs up the content a symlink points to and prunes the link.
+	// Linked directories inside the target folder are walked like subdirectories;
+	// each directory is walked once, so loops end. Linked directories outside the
+	// target folder are skipped, so nothing outside it is pruned.
+	LinksFollow LinkPolicy = "follow"
+)
+
+// Validate checks that the policy is known. An empty policy means LinksSkip.
+func (p LinkPolicy) Validate() error {
+	switch p {
+	case LinksSkip, LinksPreserve, LinksFollow, "":
+		return nil
+	default:
+		return fmt.Errorf("unknown links policy: %s (supported: skip, preserve, follow)", p)
+	}
+}
+
+// specialMode covers file types that are never backed up or pruned.
+const specialMode = os.ModeDevice | os.ModeCharDevice | os.ModeSocket | os.ModeNamedPipe | os.ModeIrregular
+
+// walker visits the files under a directory according to a link policy.
+type walker struct {
+	ctx      context.Context
+	root     string
+	realRoot string // root with symlinks resolved
+	links    LinkPolicy
+	exclude  excludeSet
+	log      *slog.Logger
+	result   *Result
+	visit    func(path, relPath string, info os.FileInfo)
+
+	// Directories already walked, so links to them are not walked twice and loops end
+	seen     map[fileKey]bool
+	seenDirs []os.FileInfo // Used where fileID is not available
+}
+
+// fileKey identifies a file by device and inode.
+type fileKey struct {
+	dev, ino uint64
+}
+
+// seenBefore records the directory info and reports whether it was already walked.
+// Directories can only be reached twice when links are followed.
+func (w *walker) seenBefore(info os.FileInfo) bool {
+	if w.links != LinksFollow {
+		return false
+	}
+	if key, ok := fileID(info); ok {
+		if w.seen == nil {
+			w.seen = make(map[fileKey]bool)
+		}
+		if w.seen[key] {
+			return true
+		}
+		w.seen[key] = true
+		return false
+	}
+	for _, dir := range w.seenDirs {
+		if os.SameFile(dir, info) {
+			return true
+		}
+	}
+	w.seenDirs = append(w.seenDirs, info)
+	return false
+}
+
+// walk walks dir, reporting paths under display. display differs from dir only
+// inside a directory reached through a followed symlink.
+func (w *walker) walk(dir, display string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		// Check for context cancellation before processing each file
+		select {
+		case <-w.ctx.Done():
+			return w.ctx.Err()
+		default:
+		}
+
+		// A target folder that is itself a symlink is always walked
+		if path == dir && err == nil && info.Mode()&os.ModeSymlink != 0 {
+			resolved, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				return err
+			}
+			return w.walk(resolved, display)
+		}
+
+		path = display + strings.TrimPrefix(path, dir)
+
+		// Handle access errors - log and continue
+		if err != nil {
+			w.log.Warn("failed to access file",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+			w.result.AddError(path, "access", err)
+			return nil // Continue walking
+		}
+
+		if info.IsDir() {
+			if w.exclude.contains(path) {
+				w.log.Debug("excluded directory skipped", slog.String("path", path))
+				return filepath.SkipDir
+			}
+			if w.seenBefore(info) {
+				w.log.Warn("directory already visited through a symlink, skipped", slog.String("path", path))
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			return w.link(path, info)
+		}
+
+		if info.Mode()&specialMode != 0 {
+			w.log.Debug("special file skipped",
+				slog.String("path", path),
+				slog.String("type", info.Mode().Type().String()),
+			)
+			w.result.Skipped++
+			return nil
+		}
+
+		return w.file(path, info)
+	})
+}
+
+// excludeSet holds directories that are not walked, by absolute and by real path,
+// so they are recognized when reached through a symlink as well.
+type excludeSet map[string]bool
+
+// newExcludeSet resolves the excluded directories. It returns nil if there are none.
+func newExcludeSet(dirs []string) excludeSet {
+	if len(dirs) == 0 {
+		return nil
+	}
+	set := make(excludeSet)
+	for _, dir := range dirs {
+		abs, resolved := resolvePath(dir)
+		set[abs] = true
+		set[resolved] = true
+	}
+	return set
+}
+
+// contains reports whether dir is one of the excluded directories.
+func (s excludeSet) contains(dir string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	abs, resolved := resolvePath(dir)
+	return s[abs] || s[resolved]
+}
+
+// resolvePath returns the absolute path and the path with symlinks resolved.
+// Either falls back to the cleaned path if it cannot be determined.
+func resolvePath(path string) (string, string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = filepath.Clean(path)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		resolved = abs
+	}
+	return abs, resolved
+}
+
+// within reports whether path is dir or lies below it.
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// link handles a symlink according to the link policy.
+func (w *walker) link(path string, info os.FileInfo) error {
+	switch w.links {
+	case LinksPreserve:
+		return w.file(path, info)
+	case LinksFollow:
+		target, err := os.Stat(path)
+		if err != nil {
+			w.log.Warn("failed to follow symlink",
+				slog.String("path", path),
+				slog.String("error", err.Error()),
+			)
+			w.result.AddError(path, "access", err)
+			return nil
+		}
+		if target.IsDir() {
+			resolved, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				w.result.AddError(path, "access", err)
+				return nil
+			}
+			if !within(w.realRoot, resolved) {
+				w.log.Warn("symlinked directory outside the target folder skipped",
+					slog.String("path", path),
+					slog.String("target", resolved),
+				)
+				w.result.Skipped++
+				return nil
+			}
+			return w.walk(resolved, path)
+		}
+		if target.Mode()&specialMode != 0 {
+			w.log.Debug("special file skipped", slog.String("path", path))
+			w.result.Skipped++
+			return nil
+		}
+		return w.file(path, target)
+	default:
+		w.log.Debug("symlink skipped", slog.String("path", path))
+		w.result.Skipped++
+		return nil
+	}
+}
+
+// file reports a file to the visitor.
+func (w *walker) file(path string, info os.FileInfo) error {
+	relPath, err := filepath.Rel(w.root, path)
+	if err != nil {
+		w.result.AddError(path, "path", err)
+		return nil
+	}
+	w.visit(path, relPath, info)
+	return nil
+}
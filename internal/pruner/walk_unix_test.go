@@ -0,0 +1,31 @@
+//go:build linux || darwin || freebsd
+// +build linux darwin freebsd
+
+package pruner
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSelect_SkipsSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	createFile(t, dir, "old.log", 10, 48*time.Hour)
+	if err := syscall.Mkfifo(filepath.Join(dir, "pipe"), 0644); err != nil {
+		t.Fatalf("Failed to create FIFO: %v", err)
+	}
+
+	candidates, result, err := Select(context.Background(), dir, Policy{Threshold: time.Now().Add(time.Hour)}, testLogger())
+	if err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if len(candidates) != 1 || filepath.Base(candidates[0].Path) != "old.log" {
+		t.Errorf("Expected only old.log, got %v", candidatePaths(candidates))
+	}
+	if result.Skipped != 1 {
+		t.Errorf("Expected the FIFO to be skipped, got %d skipped", result.Skipped)
+	}
+}
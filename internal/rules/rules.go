@@ -0,0 +1,163 @@
+package rules
+
+import (
+	"filekeeper/internal/duration"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultName is the rule name reported for files that match no configured rule.
+const DefaultName = "default"
+
+// Rule is a retention rule for files matching a glob or regular expression.
+// Patterns are matched against the slash-separated path relative to the target folder;
+// a glob without a slash is matched against the file name as well.
+type Rule struct {
+	Name               string            `json:"name"`
+	Glob               string            `json:"glob,omitempty"`              // Shell pattern, e.g. "*.debug.log" or "audit/*.log"
+	Regex              string            `json:"regex,omitempty"`             // Regular expression, e.g. "^audit/.*\\.log$"
+	PruneAfterHours    float64           `json:"prune_after_hours,omitempty"` // Age threshold in hours for matching files
+	PruneAfterDuration duration.Duration `json:"prune_after,omitempty"`       // Age threshold as a duration, e.g. "36h" or "P30D"
+	Backup             *bool             `json:"backup,omitempty"`            // Back up before pruning (default: true)
+	Compress           *bool             `json:"compress,omitempty"`          // Override compression for matching files (default: inherit)
+	CopyTruncate       *bool             `json:"copy_truncate,omitempty"`     // Truncate matching files in place instead of removing them (default: inherit)
+
+	re *regexp.Regexp
+}
+
+// PruneAfter returns the age threshold from prune_after, or from prune_after_hours.
+func (r *Rule) PruneAfter() time.Duration {
+	if r.PruneAfterDuration != 0 {
+		return r.PruneAfterDuration.Std()
+	}
+	return duration.Hours(r.PruneAfterHours)
+}
+
+// BackupEnabled reports whether files matching the rule are backed up before pruning.
+// A nil rule (no match) always backs up.
+func (r *Rule) BackupEnabled() bool {
+	return r == nil || r.Backup == nil || *r.Backup
+}
+
+// CopyTruncateEnabled reports whether matching files are truncated instead of removed.
+// A nil rule or a rule without an override uses def.
+func (r *Rule) CopyTruncateEnabled(def bool) bool {
+	if r == nil || r.CopyTruncate == nil {
+		return def
+	}
+	return *r.CopyTruncate
+}
+
+// DisplayName returns the rule name, or DefaultName for a nil rule.
+func (r *Rule) DisplayName() string {
+	if r == nil {
+		return DefaultName
+	}
+	return r.Name
+}
+
+// Matches reports whether the relative path matches the rule's pattern.
+func (r *Rule) Matches(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if r.re != nil {
+		return r.re.MatchString(relPath)
+	}
+	return MatchGlob(r.Glob, relPath)
+}
+
+// MatchGlob reports whether the slash-separated relative path matches the glob.
+// A glob without a slash is matched against the last path element as well.
+func MatchGlob(glob, relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	if ok, _ := path.Match(glob, relPath); ok {
+		return true
+	}
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(relPath))
+		return ok
+	}
+	return false
+}
+
+// ValidateGlob checks that the glob is well formed.
+func ValidateGlob(glob string) error {
+	if _, err := path.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	return nil
+}
+
+// compile validates the rule and prepares its pattern.
+func (r *Rule) compile() error {
+	if (r.Glob == "") == (r.Regex == "") {
+		return fmt.Errorf("exactly one of glob or regex is required")
+	}
+	if r.PruneAfterDuration != 0 && r.PruneAfterHours != 0 {
+		return fmt.Errorf("prune_after and prune_after_hours cannot both be set; use prune_after")
+	}
+	if r.PruneAfter() <= 0 {
+		if r.PruneAfterDuration != 0 {
+			return fmt.Errorf("prune_after must be positive, got %s", r.PruneAfterDuration)
+		}
+		return fmt.Errorf("prune_after_hours must be positive, got %g", r.PruneAfterHours)
+	}
+	if r.Glob != "" {
+		return ValidateGlob(r.Glob)
+	}
+	re, err := regexp.Compile(r.Regex)
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	r.re = re
+	return nil
+}
+
+// Set is an ordered list of rules where the first match wins.
+type Set struct {
+	rules []Rule
+}
+
+// New compiles an ordered list of rules.
+// Rules without a name are named after their position, e.g. "rule-1".
+func New(list []Rule) (*Set, error) {
+	s := &Set{rules: make([]Rule, len(list))}
+	copy(s.rules, list)
+	for i := range s.rules {
+		r := &s.rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if r.Name == DefaultName {
+			return nil, fmt.Errorf("rules[%d]: name %q is reserved", i, DefaultName)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rules[%d] (%s): %w", i, r.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// Match returns the first rule matching the relative path, or nil if none match.
+func (s *Set) Match(relPath string) *Rule {
+	if s == nil {
+		return nil
+	}
+	for i := range s.rules {
+		if s.rules[i].Matches(relPath) {
+			return &s.rules[i]
+		}
+	}
+	return nil
+}
+
+// Len returns the number of rules in the set.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.rules)
+}
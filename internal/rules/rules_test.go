@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"filekeeper/internal/duration"
+	"testing"
+	"time"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestSet_FirstMatchWins(t *testing.T) {
+	set, err := New([]Rule{
+		{Name: "debug", Glob: "*.debug.log", PruneAfterHours: 6, Backup: boolPtr(false)},
+		{Name: "audit", Regex: `^audit/.*\.log$`, PruneAfterHours: 2160},
+		{Name: "logs", Glob: "*.log", PruneAfterHours: 24},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"app.debug.log", "debug"},
+		{"nested/dir/app.debug.log", "debug"},
+		{"audit/2026-01-01.log", "audit"},
+		{"audit/x.debug.log", "debug"},
+		{"app.log", "logs"},
+		{"data.csv", DefaultName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := set.Match(tt.path).DisplayName(); got != tt.want {
+				t.Errorf("Match(%q) = %s, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSet_GlobWithDirectory(t *testing.T) {
+	set, err := New([]Rule{{Glob: "tmp/*.log", PruneAfterHours: 1}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if set.Match("tmp/a.log") == nil {
+		t.Error("Expected tmp/a.log to match")
+	}
+	if set.Match("other/tmp/a.log") != nil {
+		t.Error("Expected other/tmp/a.log not to match a rooted glob")
+	}
+	if set.Match("a.log") != nil {
+		t.Error("Expected a.log not to match a glob with a directory")
+	}
+}
+
+func TestRule_Defaults(t *testing.T) {
+	set, err := New([]Rule{{Glob: "*.log", PruneAfterHours: 0.5}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	r := set.Match("a.log")
+	if r.Name != "rule-1" {
+		t.Errorf("Expected generated name rule-1, got %s", r.Name)
+	}
+	if r.PruneAfter() != 30*time.Minute {
+		t.Errorf("Expected 30m threshold, got %s", r.PruneAfter())
+	}
+	if !r.BackupEnabled() {
+		t.Error("Expected backup to default to enabled")
+	}
+
+	r.PruneAfterDuration = duration.Duration(36 * time.Hour)
+	r.PruneAfterHours = 0
+	if r.PruneAfter() != 36*time.Hour {
+		t.Errorf("Expected prune_after to set a 36h threshold, got %s", r.PruneAfter())
+	}
+
+	if r.CopyTruncateEnabled(false) || !r.CopyTruncateEnabled(true) {
+		t.Error("Expected copy_truncate to inherit the default")
+	}
+
+	var none *Rule
+	if !none.BackupEnabled() {
+		t.Error("Expected nil rule to back up")
+	}
+	if !none.CopyTruncateEnabled(true) {
+		t.Error("Expected nil rule to inherit copy_truncate")
+	}
+
+	r.CopyTruncate = boolPtr(true)
+	if !r.CopyTruncateEnabled(false) {
+		t.Error("Expected rule override to enable copy_truncate")
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"no pattern", Rule{PruneAfterHours: 1}},
+		{"both patterns", Rule{Glob: "*", Regex: ".*", PruneAfterHours: 1}},
+		{"bad glob", Rule{Glob: "[", PruneAfterHours: 1}},
+		{"bad regex", Rule{Regex: "(", PruneAfterHours: 1}},
+		{"zero age", Rule{Glob: "*"}},
+		{"negative duration", Rule{Glob: "*", PruneAfterDuration: duration.Duration(-time.Hour)}},
+		{"both ages", Rule{Glob: "*", PruneAfterHours: 1, PruneAfterDuration: duration.Duration(time.Hour)}},
+		{"reserved name", Rule{Name: DefaultName, Glob: "*", PruneAfterHours: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New([]Rule{tt.rule}); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
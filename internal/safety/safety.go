@@ -0,0 +1,110 @@
+// Package safety stops a cycle before it deletes an implausible share of the target folder,
+// as after a clock jump, a mistyped age threshold or a target folder pointing at a system root.
+package safety
+
+import (
+	"errors"
+	"filekeeper/internal/pruner"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrLimitExceeded is returned when a cycle would exceed a safety limit or the
+// target folder is a denied root.
+var ErrLimitExceeded = errors.New("safety limit exceeded")
+
+// DefaultDeniedRoots are target folders that are always refused.
+var DefaultDeniedRoots = []string{"/", "/home", "/etc"}
+
+// Config holds the safety limits. Zero limits are disabled.
+type Config struct {
+	MaxFiles    int      `json:"max_files"`    // Maximum files pruned per cycle
+	MaxBytes    int64    `json:"max_bytes"`    // Maximum bytes pruned per cycle
+	MaxPercent  float64  `json:"max_percent"`  // Maximum percentage of the files in the folder pruned per cycle
+	DeniedRoots []string `json:"denied_roots"` // Target folders refused in addition to the defaults
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	if c.MaxFiles < 0 {
+		return fmt.Errorf("max_files must not be negative, got %d", c.MaxFiles)
+	}
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("max_bytes must not be negative, got %d", c.MaxBytes)
+	}
+	if c.MaxPercent < 0 || c.MaxPercent > 100 {
+		return fmt.Errorf("max_percent must be between 0 and 100, got %g", c.MaxPercent)
+	}
+	for i, root := range c.DeniedRoots {
+		if root == "" {
+			return fmt.Errorf("denied_roots[%d] must not be empty", i)
+		}
+	}
+	return nil
+}
+
+// CheckRoot returns an error if target, with symlinks resolved, is one of the
+// default or configured denied roots.
+func (c *Config) CheckRoot(target string) error {
+	resolved := resolve(target)
+	roots := append(append([]string{}, DefaultDeniedRoots...), c.DeniedRoots...)
+	for _, root := range roots {
+		if resolve(root) == resolved {
+			return fmt.Errorf("%w: target_folder %s is a denied root (%s)", ErrLimitExceeded, target, root)
+		}
+	}
+	return nil
+}
+
+// CheckPath returns an error if path, with the symlinks of its directory resolved,
+// lies outside target or directly in a denied root. The file itself is not resolved:
+// a pruned symlink is removed, never its target.
+func (c *Config) CheckPath(target, path string) error {
+	dir := resolve(filepath.Dir(path))
+	rel, err := filepath.Rel(resolve(target), dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%w: %s is outside target_folder %s", ErrLimitExceeded, filepath.Join(dir, filepath.Base(path)), target)
+	}
+	roots := append(append([]string{}, DefaultDeniedRoots...), c.DeniedRoots...)
+	for _, root := range roots {
+		if resolve(root) == dir {
+			return fmt.Errorf("%w: %s is in a denied root (%s)", ErrLimitExceeded, path, root)
+		}
+	}
+	return nil
+}
+
+// Check returns an error if pruning the candidates would exceed a limit.
+// total is the number of files found in the folder, selected or not.
+func (c *Config) Check(candidates []pruner.Candidate, total int) error {
+	var bytes int64
+	for _, cand := range candidates {
+		bytes += cand.Info.Size()
+	}
+
+	if c.MaxFiles > 0 && len(candidates) > c.MaxFiles {
+		return fmt.Errorf("%w: %d files selected (max_files: %d)", ErrLimitExceeded, len(candidates), c.MaxFiles)
+	}
+	if c.MaxBytes > 0 && bytes > c.MaxBytes {
+		return fmt.Errorf("%w: %d bytes selected (max_bytes: %d)", ErrLimitExceeded, bytes, c.MaxBytes)
+	}
+	if c.MaxPercent > 0 && total > 0 {
+		percent := float64(len(candidates)) / float64(total) * 100
+		if percent > c.MaxPercent {
+			return fmt.Errorf("%w: %.1f%% of files selected (max_percent: %g)", ErrLimitExceeded, percent, c.MaxPercent)
+		}
+	}
+	return nil
+}
+
+// resolve returns the absolute path with symlinks resolved where possible.
+func resolve(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Clean(path)
+}
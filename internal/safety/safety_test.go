@@ -0,0 +1,118 @@
+package safety
+
+import (
+	"errors"
+	"filekeeper/internal/pruner"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fileInfo is a minimal os.FileInfo with a size.
+type fileInfo struct{ size int64 }
+
+func (f fileInfo) Name() string       { return "file" }
+func (f fileInfo) Size() int64        { return f.size }
+func (f fileInfo) Mode() os.FileMode  { return 0644 }
+func (f fileInfo) ModTime() time.Time { return time.Time{} }
+func (f fileInfo) IsDir() bool        { return false }
+func (f fileInfo) Sys() interface{}   { return nil }
+
+func candidates(n int, size int64) []pruner.Candidate {
+	c := make([]pruner.Candidate, n)
+	for i := range c {
+		c[i] = pruner.Candidate{Info: fileInfo{size: size}}
+	}
+	return c
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		n       int
+		total   int
+		wantErr bool
+	}{
+		{"no limits", Config{}, 100, 100, false},
+		{"files within", Config{MaxFiles: 10}, 10, 100, false},
+		{"files exceeded", Config{MaxFiles: 10}, 11, 100, true},
+		{"bytes within", Config{MaxBytes: 1000}, 10, 100, false},
+		{"bytes exceeded", Config{MaxBytes: 999}, 10, 100, true},
+		{"percent within", Config{MaxPercent: 50}, 50, 100, false},
+		{"percent exceeded", Config{MaxPercent: 50}, 51, 100, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Check(candidates(tt.n, 100), tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrLimitExceeded) {
+				t.Errorf("Expected ErrLimitExceeded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckRoot(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(dir, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	cfg := &Config{DeniedRoots: []string{dir}}
+	if err := cfg.CheckRoot("/"); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected / to be denied by default, got %v", err)
+	}
+	if err := cfg.CheckRoot(link); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected a symlink to a denied root to be denied, got %v", err)
+	}
+	if err := cfg.CheckRoot(filepath.Join(dir, "sub")); err != nil {
+		t.Errorf("Expected a subdirectory to be allowed, got %v", err)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	target := t.TempDir()
+	outside := t.TempDir()
+	denied := filepath.Join(target, "keep")
+	for _, dir := range []string{filepath.Join(target, "sub"), denied} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(target, "elsewhere")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "app.log"), filepath.Join(target, "link.log")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &Config{DeniedRoots: []string{denied}}
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{filepath.Join(target, "app.log"), false},
+		{filepath.Join(target, "sub", "app.log"), false},
+		{filepath.Join(target, "link.log"), false}, // The link is pruned, not its target
+		{filepath.Join(target, "elsewhere", "app.log"), true},
+		{filepath.Join(target, "..", "app.log"), true},
+		{filepath.Join(denied, "app.log"), true},
+		{"/etc/passwd", true},
+	}
+
+	for _, tt := range tests {
+		err := cfg.CheckPath(target, tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckPath(%s) error = %v, wantErr %v", tt.path, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("Expected ErrLimitExceeded, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package trash moves pruned files into a quarantine directory instead of deleting them.
+// Each cycle moves its files into a batch directory named after the time of the cycle,
+// keeping their path relative to the target folder. Batches are purged once their
+// grace period has passed; until then files can be restored with Restore.
+package trash
+
+import (
+	"context"
+	"errors"
+	"filekeeper/pkg/metadata"
+	"filekeeper/pkg/utils"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// DefaultDirName is the trash directory created in the target folder when no path is configured.
+const DefaultDirName = ".filekeeper-trash"
+
+// DefaultGraceHours is how long trashed files are kept when no grace period is configured.
+const DefaultGraceHours = 72
+
+// batchLayout names batch directories; it sorts chronologically.
+const batchLayout = "20060102T150405Z"
+
+// ErrExists is returned by Restore when a file already exists at the original path.
+var ErrExists = errors.New("file already exists")
+
+// Config holds the trash settings.
+type Config struct {
+	Enabled    bool    `json:"enabled"`
+	Path       string  `json:"path"`        // Trash directory (default: .filekeeper-trash in target_folder)
+	GraceHours float64 `json:"grace_hours"` // Time before trashed files are purged (default: 72)
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if c.GraceHours < 0 {
+		return fmt.Errorf("grace_hours must not be negative, got %g", c.GraceHours)
+	}
+	return nil
+}
+
+// Trash moves files under a root folder into batches and back.
+// A nil Trash is disabled.
+type Trash struct {
+	dir   string
+	root  string
+	grace time.Duration
+}
+
+// New creates a Trash for files under root. It returns nil if the trash is disabled.
+func New(cfg *Config, root string) *Trash {
+	if cfg == nil || !cfg.Enabled {
+		return nil
+	}
+	return &Trash{
+		dir:   cfg.Path,
+		root:  root,
+		grace: time.Duration(cfg.GraceHours * float64(time.Hour)),
+	}
+}
+
+// Dir returns the trash directory.
+func (t *Trash) Dir() string {
+	return t.dir
+}
+
+// Mover returns a function that moves a file under the root into the batch for now.
+func (t *Trash) Mover(now time.Time) func(path string) error {
+	batchDir := filepath.Join(t.dir, now.UTC().Format(batchLayout))
+	return func(path string) error {
+		relPath, err := filepath.Rel(t.root, path)
+		if err != nil {
+			return err
+		}
+		return move(path, filepath.Join(batchDir, relPath))
+	}
+}
+
+// Entry is a file in the trash.
+type Entry struct {
+	Batch   string    // Batch directory name
+	Deleted time.Time // When the file was moved to the trash
+	RelPath string    // Path relative to the root, where the file is restored
+	Path    string    // Current path inside the trash
+	Size    int64
+}
+
+// List returns the files in the trash, newest batch first.
+func (t *Trash) List() ([]Entry, error) {
+	batches, err := t.batches()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for i := len(batches) - 1; i >= 0; i-- {
+		b := batches[i]
+		batchDir := filepath.Join(t.dir, b.name)
+		err := filepath.Walk(batchDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			relPath, err := filepath.Rel(batchDir, path)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, Entry{
+				Batch:   b.name,
+				Deleted: b.time,
+				RelPath: relPath,
+				Path:    path,
+				Size:    info.Size(),
+			})
+			return nil
+		})
+		if err != nil {
+			return entries, err
+		}
+	}
+	return entries, nil
+}
+
+// Restore moves a trashed file back to its original path under the root.
+// An existing file is only replaced if overwrite is true. Directories of the
+// batch left empty are removed.
+func (t *Trash) Restore(e Entry, overwrite bool) (string, error) {
+	dest := filepath.Join(t.root, e.RelPath)
+	if _, err := os.Lstat(dest); err == nil && !overwrite {
+		return dest, fmt.Errorf("%w: %s", ErrExists, dest)
+	}
+	if err := move(e.Path, dest); err != nil {
+		return dest, err
+	}
+
+	// Remove parents up to and including the batch directory once they are empty
+	batchDir := filepath.Join(t.dir, e.Batch)
+	for dir := filepath.Dir(e.Path); ; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil || dir == batchDir {
+			break
+		}
+	}
+	return dest, nil
+}
+
+// Purge removes batches older than the grace period and returns the number of files removed.
+// If dryRun is true, it logs the batches that would be purged.
+func (t *Trash) Purge(ctx context.Context, now time.Time, dryRun bool, log *slog.Logger) (int, error) {
+	if t == nil {
+		return 0, nil
+	}
+	batches, err := t.batches()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	threshold := now.Add(-t.grace)
+	for _, b := range batches {
+		select {
+		case <-ctx.Done():
+			return purged, ctx.Err()
+		default:
+		}
+		if !b.time.Before(threshold) {
+			break // Batches are sorted oldest first
+		}
+
+		batchDir := filepath.Join(t.dir, b.name)
+		files := countFiles(batchDir)
+		if dryRun {
+			log.Info("[DRY-RUN] would purge trash batch",
+				slog.String("path", batchDir),
+				slog.Int("files_count", files),
+			)
+			purged += files
+			continue
+		}
+		if err := os.RemoveAll(batchDir); err != nil {
+			return purged, fmt.Errorf("purge trash batch %s: %w", batchDir, err)
+		}
+		log.Info("purged trash batch",
+			slog.String("path", batchDir),
+			slog.Int("files_count", files),
+		)
+		purged += files
+	}
+	return purged, nil
+}
+
+// batch is a batch directory and the time it was created.
+type batch struct {
+	name string
+	time time.Time
+}
+
+// batches returns the batch directories, oldest first.
+// Entries that are not named like a batch are ignored.
+func (t *Trash) batches() ([]batch, error) {
+	entries, err := os.ReadDir(t.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var batches []batch
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		batchTime, err := time.Parse(batchLayout, e.Name())
+		if err != nil {
+			continue
+		}
+		batches = append(batches, batch{name: e.Name(), time: batchTime})
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].time.Before(batches[j].time)
+	})
+	return batches, nil
+}
+
+// countFiles returns the number of non-directory entries under dir.
+func countFiles(dir string) int {
+	n := 0
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+// move renames src to dest, creating the parent of dest. Across filesystems,
+// where rename fails, the file is copied with its metadata and src is removed.
+func move(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	err := os.Rename(src, dest)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		err = utils.CopySymlink(src, dest)
+	} else {
+		err = utils.CopyFile(src, dest)
+		if err == nil {
+			err = metadata.Copy(src, dest)
+		}
+	}
+	if err != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return os.Remove(src)
+}
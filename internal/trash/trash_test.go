@@ -0,0 +1,115 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"filekeeper/internal/logger"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestNew_Disabled(t *testing.T) {
+	if New(&Config{Enabled: false}, t.TempDir()) != nil {
+		t.Error("Expected nil Trash when disabled")
+	}
+	var bin *Trash
+	if n, err := bin.Purge(context.Background(), time.Now(), false, logger.New("error", "text")); n != 0 || err != nil {
+		t.Errorf("Purge on nil Trash = %d, %v", n, err)
+	}
+}
+
+func TestMoveListRestore(t *testing.T) {
+	root := t.TempDir()
+	bin := New(&Config{Enabled: true, Path: filepath.Join(root, DefaultDirName), GraceHours: 1}, root)
+
+	path := filepath.Join(root, "sub", "app.log")
+	writeFile(t, path, "data")
+
+	deleted := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := bin.Mover(deleted)(path); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected file to be moved, stat error: %v", err)
+	}
+
+	entries, err := bin.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.RelPath != filepath.Join("sub", "app.log") || !e.Deleted.Equal(deleted) || e.Size != 4 {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	// An existing file is not replaced without overwrite
+	writeFile(t, path, "new")
+	if _, err := bin.Restore(e, false); !errors.Is(err, ErrExists) {
+		t.Fatalf("Expected ErrExists, got %v", err)
+	}
+	if _, err := bin.Restore(e, true); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "data" {
+		t.Errorf("Expected restored content %q, got %q (%v)", "data", content, err)
+	}
+
+	// The emptied batch directory is removed
+	if _, err := os.Stat(filepath.Join(bin.Dir(), e.Batch)); !os.IsNotExist(err) {
+		t.Errorf("Expected batch directory to be removed, stat error: %v", err)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	root := t.TempDir()
+	bin := New(&Config{Enabled: true, Path: filepath.Join(root, DefaultDirName), GraceHours: 24}, root)
+	now := time.Now()
+
+	oldPath := filepath.Join(root, "old.log")
+	newPath := filepath.Join(root, "new.log")
+	writeFile(t, oldPath, "old")
+	writeFile(t, newPath, "new")
+	if err := bin.Mover(now.Add(-48 * time.Hour))(oldPath); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+	if err := bin.Mover(now.Add(-time.Hour))(newPath); err != nil {
+		t.Fatalf("move failed: %v", err)
+	}
+
+	log := logger.New("error", "text")
+	purged, err := bin.Purge(context.Background(), now, true, log)
+	if err != nil || purged != 1 {
+		t.Fatalf("dry-run Purge = %d, %v; want 1", purged, err)
+	}
+	if entries, _ := bin.List(); len(entries) != 2 {
+		t.Fatalf("Expected dry run to keep 2 entries, got %d", len(entries))
+	}
+
+	purged, err = bin.Purge(context.Background(), now, false, log)
+	if err != nil || purged != 1 {
+		t.Fatalf("Purge = %d, %v; want 1", purged, err)
+	}
+	entries, err := bin.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].RelPath != "new.log" {
+		t.Errorf("Expected only new.log to remain, got %+v", entries)
+	}
+}
@@ -2,6 +2,9 @@ package compression
 
 import (
 	"compress/gzip"
+	"context"
+	"filekeeper/pkg/metadata"
+	"filekeeper/pkg/ratelimit"
 	"fmt"
 	"io"
 	"os"
@@ -93,79 +96,208 @@ func ExtensionFor(alg Algorithm) string {
 // Returns compression statistics and any error encountered.
 // If compression is disabled or algorithm is "none", performs a regular file copy.
 func CompressFile(src, dest string, cfg *Config) (*Result, error) {
-	// Get source file info for original size
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return nil, fmt.Errorf("stat source file: %w", err)
-	}
+	return CompressFileLimited(context.Background(), src, dest, cfg, nil, nil)
+}
 
-	result := &Result{
-		OriginalSize: srcInfo.Size(),
-		Algorithm:    None,
-	}
+// CompressFileLimited works like CompressFile, reading the source no faster than read
+// and writing the destination no faster than write allows. A nil limiter is unlimited.
+// Waiting for a limiter stops with the context's error if ctx is done.
+func CompressFileLimited(ctx context.Context, src, dest string, cfg *Config, read, write *ratelimit.Limiter) (*Result, error) {
+	result, errs := CompressFiles(ctx, src, []string{dest}, cfg, read, write)
+	return result, errs[0]
+}
 
-	// If compression is disabled or algorithm is none, do regular copy
-	if cfg == nil || !cfg.Enabled || cfg.Algorithm == None || cfg.Algorithm == "" {
-		if err := copyFile(src, dest); err != nil {
-			return nil, err
+// CompressFiles works like CompressFileLimited for several destinations: the source is
+// read and compressed once and the output is written to every destination. errs[i] is
+// the error of dests[i]; a destination that fails is dropped while the others are
+// still written. The result is nil if every destination failed.
+func CompressFiles(ctx context.Context, src string, dests []string, cfg *Config, read, write *ratelimit.Limiter) (*Result, []error) {
+	errs := make([]error, len(dests))
+	fail := func(err error) (*Result, []error) {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
 		}
-		result.CompressedSize = srcInfo.Size()
-		return result, nil
+		return nil, errs
+	}
+
+	compressed := cfg != nil && cfg.Enabled && cfg.Algorithm != None && cfg.Algorithm != ""
+	if compressed && cfg.Algorithm != Gzip {
+		return fail(fmt.Errorf("unknown compression algorithm: %s", cfg.Algorithm))
 	}
 
-	// Open source file
 	srcFile, err := os.Open(src)
 	if err != nil {
-		return nil, fmt.Errorf("open source file: %w", err)
+		return fail(fmt.Errorf("open source file: %w", err))
 	}
 	defer srcFile.Close()
 
-	// Add appropriate extension to destination
-	destPath := dest + ExtensionFor(cfg.Algorithm)
-
-	// Create destination file
-	destFile, err := os.Create(destPath)
-	if err != nil {
-		return nil, fmt.Errorf("create destination file: %w", err)
+	// Add appropriate extension to destinations
+	ext := ""
+	if compressed {
+		ext = ExtensionFor(cfg.Algorithm)
+	}
+	fan := &fanoutWriter{errs: errs}
+	for i, dest := range dests {
+		destFile, err := os.Create(dest + ext)
+		if err != nil {
+			errs[i] = fmt.Errorf("create destination file: %w", err)
+			continue
+		}
+		defer destFile.Close()
+		fan.add(i, destFile, ratelimit.NewWriter(ctx, destFile, write))
+	}
+	if len(fan.targets) == 0 {
+		return nil, errs
 	}
-	defer destFile.Close()
 
-	// Compress based on algorithm
-	switch cfg.Algorithm {
-	case Gzip:
+	counter := &countingWriter{w: fan}
+	reader := ratelimit.NewReader(ctx, srcFile, read)
+	result := &Result{Algorithm: None}
+	if compressed {
 		level := cfg.Level
 		if level == 0 {
 			level = gzip.DefaultCompression
 		}
-		writer, err := gzip.NewWriterLevel(destFile, level)
+		writer, err := gzip.NewWriterLevel(counter, level)
 		if err != nil {
-			return nil, fmt.Errorf("create gzip writer: %w", err)
+			return fail(fmt.Errorf("create gzip writer: %w", err))
 		}
-
-		if _, err := io.Copy(writer, srcFile); err != nil {
+		n, err := io.Copy(writer, reader)
+		if err != nil {
 			writer.Close()
-			return nil, fmt.Errorf("compress file: %w", err)
+			return fail(fmt.Errorf("compress file: %w", err))
 		}
-
 		if err := writer.Close(); err != nil {
-			return nil, fmt.Errorf("close gzip writer: %w", err)
+			return fail(fmt.Errorf("close gzip writer: %w", err))
 		}
-	default:
-		return nil, fmt.Errorf("unknown compression algorithm: %s", cfg.Algorithm)
+		result.Algorithm = cfg.Algorithm
+		result.OriginalSize = n
+	} else {
+		n, err := io.Copy(counter, reader)
+		if err != nil {
+			return fail(fmt.Errorf("copy file: %w", err))
+		}
+		result.OriginalSize = n
+	}
+	result.CompressedSize = counter.n
+
+	if !fan.close() {
+		return nil, errs
 	}
+	return result, errs
+}
+
+// fanoutWriter writes to several destination files. A destination whose write fails
+// has its error recorded and is dropped; writing fails once every destination failed.
+type fanoutWriter struct {
+	targets []fanoutTarget
+	errs    []error
+}
+
+type fanoutTarget struct {
+	index int
+	file  *os.File
+	w     io.Writer
+}
 
-	// Get compressed file size
-	destInfo, err := os.Stat(destPath)
+func (f *fanoutWriter) add(index int, file *os.File, w io.Writer) {
+	f.targets = append(f.targets, fanoutTarget{index: index, file: file, w: w})
+}
+
+func (f *fanoutWriter) Write(p []byte) (int, error) {
+	var firstErr error
+	live := f.targets[:0]
+	for _, t := range f.targets {
+		if _, err := t.w.Write(p); err != nil {
+			f.errs[t.index] = fmt.Errorf("write destination file: %w", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		live = append(live, t)
+	}
+	f.targets = live
+	if len(live) == 0 {
+		return 0, firstErr
+	}
+	return len(p), nil
+}
+
+// close closes the remaining destination files and reports whether any was written.
+func (f *fanoutWriter) close() bool {
+	ok := false
+	for _, t := range f.targets {
+		if err := t.file.Close(); err != nil {
+			f.errs[t.index] = fmt.Errorf("close destination file: %w", err)
+			continue
+		}
+		ok = true
+	}
+	return ok
+}
+
+// CompressStream writes the file src to w, compressed with cfg, or as is if
+// compression is disabled, reading no faster than read allows. It returns the
+// sizes of the file and of what was written to w.
+func CompressStream(ctx context.Context, w io.Writer, src string, cfg *Config, read *ratelimit.Limiter) (*Result, error) {
+	srcFile, err := os.Open(src)
 	if err != nil {
-		return nil, fmt.Errorf("stat compressed file: %w", err)
+		return nil, fmt.Errorf("open source file: %w", err)
 	}
+	defer srcFile.Close()
 
-	result.Algorithm = cfg.Algorithm
-	result.CompressedSize = destInfo.Size()
+	counter := &countingWriter{w: w}
+	reader := ratelimit.NewReader(ctx, srcFile, read)
+	result := &Result{Algorithm: None}
+	if cfg == nil || !cfg.Enabled || cfg.Algorithm == None || cfg.Algorithm == "" {
+		n, err := io.Copy(counter, reader)
+		if err != nil {
+			return nil, fmt.Errorf("copy file: %w", err)
+		}
+		result.OriginalSize, result.CompressedSize = n, n
+		return result, nil
+	}
+	if cfg.Algorithm != Gzip {
+		return nil, fmt.Errorf("unknown compression algorithm: %s", cfg.Algorithm)
+	}
 
+	level := cfg.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	writer, err := gzip.NewWriterLevel(counter, level)
+	if err != nil {
+		return nil, fmt.Errorf("create gzip writer: %w", err)
+	}
+	n, err := io.Copy(writer, reader)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("compress file: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip writer: %w", err)
+	}
+	result.Algorithm = Gzip
+	result.OriginalSize = n
+	result.CompressedSize = counter.n
 	return result, nil
 }
 
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
 // GetDestinationPath returns the destination path with compression extension if applicable.
 func GetDestinationPath(dest string, cfg *Config) string {
 	if cfg == nil || !cfg.Enabled || cfg.Algorithm == None || cfg.Algorithm == "" {
@@ -192,6 +324,31 @@ func DecompressFile(src, dest string) error {
 	}
 	defer destFile.Close()
 
+	if err := decompress(destFile, srcFile, ext); err != nil {
+		return err
+	}
+	if err := destFile.Close(); err != nil {
+		return fmt.Errorf("close destination file: %w", err)
+	}
+
+	return nil
+}
+
+// DecompressFilePreserve decompresses a file like DecompressFile and gives the
+// destination the source's metadata. Use it for backups made with preserve_metadata,
+// which carry the original file's metadata.
+func DecompressFilePreserve(src, dest string) error {
+	if err := DecompressFile(src, dest); err != nil {
+		return err
+	}
+	if err := metadata.Copy(src, dest); err != nil {
+		return fmt.Errorf("restore metadata: %w", err)
+	}
+	return nil
+}
+
+// decompress writes the decompressed contents of srcFile to destFile.
+func decompress(destFile io.Writer, srcFile io.Reader, ext string) error {
 	switch ext {
 	case ".gz":
 		reader, err := gzip.NewReader(srcFile)
@@ -212,24 +369,3 @@ func DecompressFile(src, dest string) error {
 
 	return nil
 }
-
-// copyFile performs a simple file copy without compression.
-func copyFile(src, dest string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return fmt.Errorf("open source file: %w", err)
-	}
-	defer srcFile.Close()
-
-	destFile, err := os.Create(dest)
-	if err != nil {
-		return fmt.Errorf("create destination file: %w", err)
-	}
-	defer destFile.Close()
-
-	if _, err := io.Copy(destFile, srcFile); err != nil {
-		return fmt.Errorf("copy file: %w", err)
-	}
-
-	return nil
-}
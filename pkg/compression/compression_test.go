@@ -3,10 +3,15 @@ package compression
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
+	"filekeeper/pkg/ratelimit"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCompressFileGzip(t *testing.T) {
@@ -348,3 +353,204 @@ func TestGzipCompressionLevels(t *testing.T) {
 		os.Remove(destPath + ".gz")
 	}
 }
+
+func TestDecompressFilePreserve(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	srcPath := filepath.Join(tmpDir, "source.txt")
+	if err := os.WriteFile(srcPath, []byte("restore me"), 0600); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	cfg := &Config{Enabled: true, Algorithm: Gzip, Level: 6}
+	if _, err := CompressFile(srcPath, filepath.Join(tmpDir, "backup.txt"), cfg); err != nil {
+		t.Fatalf("CompressFile failed: %v", err)
+	}
+
+	// The backup carries the original file's metadata
+	backupPath := filepath.Join(tmpDir, "backup.txt.gz")
+	modTime := time.Date(2026, 1, 15, 8, 0, 0, 0, time.UTC)
+	if err := os.Chmod(backupPath, 0640); err != nil {
+		t.Fatalf("Failed to chmod backup: %v", err)
+	}
+	if err := os.Chtimes(backupPath, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set backup times: %v", err)
+	}
+
+	restoredPath := filepath.Join(tmpDir, "restored.txt")
+	if err := DecompressFilePreserve(backupPath, restoredPath); err != nil {
+		t.Fatalf("DecompressFilePreserve failed: %v", err)
+	}
+
+	// Without preservation the restored file gets the defaults
+	plainPath := filepath.Join(tmpDir, "plain.txt")
+	if err := DecompressFile(backupPath, plainPath); err != nil {
+		t.Fatalf("DecompressFile failed: %v", err)
+	}
+	plain, err := os.Stat(plainPath)
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %v", err)
+	}
+	if plain.ModTime().Equal(modTime) {
+		t.Errorf("Expected a fresh modification time without preservation, got %v", plain.ModTime())
+	}
+
+	info, err := os.Stat(restoredPath)
+	if err != nil {
+		t.Fatalf("Failed to stat restored file: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %o", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("Expected modification time %v, got %v", modTime, info.ModTime())
+	}
+}
+
+func TestCompressFileLimited(t *testing.T) {
+	tmpDir := t.TempDir()
+	srcPath := filepath.Join(tmpDir, "test.txt")
+	content := strings.Repeat("limited ", 64*1024)
+	if err := os.WriteFile(srcPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	cfg := &Config{Enabled: true, Algorithm: Gzip, Level: 6}
+
+	// Without limiters the file is compressed as usual
+	result, err := CompressFileLimited(context.Background(), srcPath, filepath.Join(tmpDir, "a.txt"), cfg, nil, nil)
+	if err != nil {
+		t.Fatalf("CompressFileLimited failed: %v", err)
+	}
+	if result.OriginalSize != int64(len(content)) {
+		t.Errorf("Expected original size %d, got %d", len(content), result.OriginalSize)
+	}
+
+	// A limited copy stops when the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	limiter := ratelimit.NewLimiter(1024)
+	for _, c := range []*Config{cfg, {Enabled: false}} {
+		if _, err := CompressFileLimited(ctx, srcPath, filepath.Join(tmpDir, "b.txt"), c, limiter, nil); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	}
+}
+
+func TestCompressStream(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "test.log")
+	content := strings.Repeat("stream me\n", 500)
+	if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	var out bytes.Buffer
+	cfg := &Config{Enabled: true, Algorithm: Gzip, Level: 6}
+	result, err := CompressStream(context.Background(), &out, src, cfg, nil)
+	if err != nil {
+		t.Fatalf("CompressStream failed: %v", err)
+	}
+	if result.OriginalSize != int64(len(content)) || result.CompressedSize != int64(out.Len()) {
+		t.Errorf("Expected sizes %d and %d, got %+v", len(content), out.Len(), result)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("Expected a gzip stream: %v", err)
+	}
+	var plain bytes.Buffer
+	if _, err := plain.ReadFrom(zr); err != nil || plain.String() != content {
+		t.Errorf("Expected the original content back, got %d bytes, %v", plain.Len(), err)
+	}
+
+	// Disabled compression streams the file as is
+	out.Reset()
+	result, err = CompressStream(context.Background(), &out, src, nil, nil)
+	if err != nil || out.String() != content || result.CompressedSize != int64(len(content)) {
+		t.Errorf("Expected the file as is, got %d bytes, %v", out.Len(), err)
+	}
+}
+
+func TestCompressFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	src := filepath.Join(tmpDir, "test.log")
+	content := strings.Repeat("fan out\n", 1000)
+	if err := os.WriteFile(src, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	// A destination that cannot be created fails alone
+	dests := []string{
+		filepath.Join(tmpDir, "a.log"),
+		filepath.Join(tmpDir, "missing", "b.log"),
+		filepath.Join(tmpDir, "c.log"),
+	}
+	cfg := &Config{Enabled: true, Algorithm: Gzip, Level: 6}
+	result, errs := CompressFiles(context.Background(), src, dests, cfg, nil, nil)
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil {
+		t.Fatalf("Expected only the second destination to fail, got %v", errs)
+	}
+	if result == nil || result.OriginalSize != int64(len(content)) || result.Algorithm != Gzip {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	for _, dest := range []string{dests[0], dests[2]} {
+		data, err := os.ReadFile(dest + ".gz")
+		if err != nil || int64(len(data)) != result.CompressedSize {
+			t.Errorf("Expected %s.gz of %d bytes, got %d, %v", dest, result.CompressedSize, len(data), err)
+			continue
+		}
+		plain := filepath.Join(tmpDir, "plain.log")
+		if err := DecompressFile(dest+".gz", plain); err != nil {
+			t.Fatalf("DecompressFile failed: %v", err)
+		}
+		if data, _ := os.ReadFile(plain); string(data) != content {
+			t.Errorf("Expected the original content from %s.gz", dest)
+		}
+	}
+
+	// A missing source fails every destination
+	result, errs = CompressFiles(context.Background(), filepath.Join(tmpDir, "none.log"), dests[:1], nil, nil, nil)
+	if result != nil || errs[0] == nil {
+		t.Errorf("Expected an error for a missing source, got %+v, %v", result, errs)
+	}
+}
+
+// benchmarkDestinations is the number of backup paths in the destination benchmarks.
+const benchmarkDestinations = 3
+
+// BenchmarkCompressDestinations compares compressing a file for each destination with
+// compressing it once and writing the output to every destination.
+func BenchmarkCompressDestinations(b *testing.B) {
+	tmpDir := b.TempDir()
+	src := filepath.Join(tmpDir, "bench.log")
+	var content strings.Builder
+	for i := 0; content.Len() < 4<<20; i++ {
+		fmt.Fprintf(&content, "2024-01-15T10:%02d:%02d INFO request %d served in %dms\n", i/60%60, i%60, i, i%97)
+	}
+	if err := os.WriteFile(src, []byte(content.String()), 0644); err != nil {
+		b.Fatalf("Failed to create source file: %v", err)
+	}
+	var dests []string
+	for i := 0; i < benchmarkDestinations; i++ {
+		dests = append(dests, filepath.Join(tmpDir, fmt.Sprintf("dest%d.log", i)))
+	}
+	cfg := &Config{Enabled: true, Algorithm: Gzip, Level: 6}
+	ctx := context.Background()
+
+	b.Run("per-destination", func(b *testing.B) {
+		b.SetBytes(int64(content.Len()))
+		for i := 0; i < b.N; i++ {
+			for _, dest := range dests {
+				if _, err := CompressFileLimited(ctx, src, dest, cfg, nil, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("fan-out", func(b *testing.B) {
+		b.SetBytes(int64(content.Len()))
+		for i := 0; i < b.N; i++ {
+			if _, errs := CompressFiles(ctx, src, dests, cfg, nil, nil); errs[0] != nil {
+				b.Fatal(errs[0])
+			}
+		}
+	})
+}
@@ -0,0 +1,375 @@
+package filekeeper_test
+
+import (
+	"filekeeper/pkg/filekeeper"
+	"reflect"
+	"testing"
+)
+
+// apiTypes are the public types whose fields or methods are frozen. They alias
+// internal types, so apiFields pins what they expose: a change to an internal type
+// that would change the public API fails TestAPIFrozen until apiFields and the
+// package documentation are updated with it.
+var apiTypes = map[string]reflect.Type{
+	"Config":            reflect.TypeOf(filekeeper.Config{}),
+	"CompressionConfig": reflect.TypeOf(filekeeper.CompressionConfig{}),
+	"ArchiveConfig":     reflect.TypeOf(filekeeper.ArchiveConfig{}),
+	"EmptyDirsConfig":   reflect.TypeOf(filekeeper.EmptyDirsConfig{}),
+	"Rule":              reflect.TypeOf(filekeeper.Rule{}),
+	"InUseConfig":       reflect.TypeOf(filekeeper.InUseConfig{}),
+	"TrashConfig":       reflect.TypeOf(filekeeper.TrashConfig{}),
+	"SafetyConfig":      reflect.TypeOf(filekeeper.SafetyConfig{}),
+	"HookConfig":        reflect.TypeOf(filekeeper.HookConfig{}),
+	"RateLimitConfig":   reflect.TypeOf(filekeeper.RateLimitConfig{}),
+	"RateLimitWindow":   reflect.TypeOf(filekeeper.RateLimitWindow{}),
+	"RemoteRetryConfig": reflect.TypeOf(filekeeper.RemoteRetryConfig{}),
+	"NotifyConfig":      reflect.TypeOf(filekeeper.NotifyConfig{}),
+	"WebhookConfig":     reflect.TypeOf(filekeeper.WebhookConfig{}),
+	"EmailConfig":       reflect.TypeOf(filekeeper.EmailConfig{}),
+	"Result":            reflect.TypeOf(filekeeper.Result{}),
+	"FileError":         reflect.TypeOf(filekeeper.FileError{}),
+	"ArchiveInfo":       reflect.TypeOf(filekeeper.ArchiveInfo{}),
+	"DestinationResult": reflect.TypeOf(filekeeper.DestinationResult{}),
+	"Report":            reflect.TypeOf(filekeeper.Report{}),
+	"ReportFiles":       reflect.TypeOf(filekeeper.ReportFiles{}),
+	"ReportBytes":       reflect.TypeOf(filekeeper.ReportBytes{}),
+	"Plan":              reflect.TypeOf(filekeeper.Plan{}),
+	"PlanFile":          reflect.TypeOf(filekeeper.PlanFile{}),
+	"PlanTotals":        reflect.TypeOf(filekeeper.PlanTotals{}),
+	"Action":            reflect.TypeOf(filekeeper.Action{}),
+	"FileEvent":         reflect.TypeOf(filekeeper.FileEvent{}),
+	"BatchFile":         reflect.TypeOf(filekeeper.BatchFile{}),
+	"Destination":       reflect.TypeOf((*filekeeper.Destination)(nil)).Elem(),
+	"BatchDestination":  reflect.TypeOf((*filekeeper.BatchDestination)(nil)).Elem(),
+	"Clock":             reflect.TypeOf((*filekeeper.Clock)(nil)).Elem(),
+	"FileSystem":        reflect.TypeOf((*filekeeper.FileSystem)(nil)).Elem(),
+}
+
+// apiFields lists the exported fields of each struct, with their types and tags,
+// and the methods of each interface, in declaration order.
+var apiFields = map[string][]string{
+	"Config": {
+		"PruneAfter duration.Duration `json:\"prune_after,omitempty\"`",
+		"PruneAfterHours float32 `json:\"prune_after_hours,omitempty\"`",
+		"AgeSource string `json:\"age_source\"`",
+		"AgeSourceLayout string `json:\"age_source_layout\"`",
+		"Links string `json:\"links\"`",
+		"CopyTruncate bool `json:\"copy_truncate\"`",
+		"Rules []rules.Rule `json:\"rules\"`",
+		"MaxTotalBytes int64 `json:\"max_total_bytes\"`",
+		"MinFreePercent float64 `json:\"min_free_percent\"`",
+		"TargetFolder string `json:\"target_folder\"`",
+		"RunInterval duration.Duration `json:\"run_interval\"`",
+		"BackupPath string `json:\"backup_path,omitempty\"`",
+		"BackupPaths []string `json:\"backup_paths\"`",
+		"RemoteBackup string `json:\"remote_backup,omitempty\"`",
+		"RemoteBackups []string `json:\"remote_backups\"`",
+		"RemoteTransfer string `json:\"remote_transfer\"`",
+		"EnableBackup bool `json:\"enable_backup\"`",
+		"PreserveMetadata bool `json:\"preserve_metadata\"`",
+		"LogLevel string `json:\"log_level\"`",
+		"LogFormat string `json:\"log_format\"`",
+		"ErrorThresholdPercent float64 `json:\"error_threshold_percent\"`",
+		"Compression *config.CompressionConfig `json:\"compression,omitempty\"`",
+		"Archive *config.ArchiveConfig `json:\"archive,omitempty\"`",
+		"Notifications *notify.Config `json:\"notifications,omitempty\"`",
+		"InUseCheck *inuse.Config `json:\"in_use_check,omitempty\"`",
+		"RemoveEmptyDirs *config.EmptyDirsConfig `json:\"remove_empty_dirs,omitempty\"`",
+		"Trash *trash.Config `json:\"trash,omitempty\"`",
+		"Safety *safety.Config `json:\"safety,omitempty\"`",
+		"Hooks []hooks.Config `json:\"hooks\"`",
+		"RateLimit *ratelimit.Config `json:\"rate_limit,omitempty\"`",
+		"RemoteRetry *outbox.Config `json:\"remote_retry,omitempty\"`",
+	},
+	"CompressionConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"Algorithm string `json:\"algorithm\"`",
+		"Level int `json:\"level\"`",
+	},
+	"ArchiveConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"Format string `json:\"format\"`",
+		"GroupBy string `json:\"group_by\"`",
+		"Reproducible bool `json:\"reproducible\"`",
+		"UID *int `json:\"uid,omitempty\"`",
+		"GID *int `json:\"gid,omitempty\"`",
+		"Uname string `json:\"uname,omitempty\"`",
+		"Gname string `json:\"gname,omitempty\"`",
+		"ModeMask string `json:\"mode_mask\"`",
+		"ZeroGzipMtime bool `json:\"zero_gzip_mtime\"`",
+	},
+	"EmptyDirsConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"MinAgeHours float64 `json:\"min_age_hours\"`",
+		"Protect []string `json:\"protect\"`",
+	},
+	"Rule": {
+		"Name string `json:\"name\"`",
+		"Glob string `json:\"glob,omitempty\"`",
+		"Regex string `json:\"regex,omitempty\"`",
+		"PruneAfterHours float64 `json:\"prune_after_hours,omitempty\"`",
+		"PruneAfterDuration duration.Duration `json:\"prune_after,omitempty\"`",
+		"Backup *bool `json:\"backup,omitempty\"`",
+		"Compress *bool `json:\"compress,omitempty\"`",
+		"CopyTruncate *bool `json:\"copy_truncate,omitempty\"`",
+	},
+	"InUseConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"SettleSeconds float64 `json:\"settle_seconds\"`",
+		"OpenHandles bool `json:\"open_handles\"`",
+		"LockSuffixes []string `json:\"lock_suffixes\"`",
+	},
+	"TrashConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"Path string `json:\"path\"`",
+		"GraceHours float64 `json:\"grace_hours\"`",
+	},
+	"SafetyConfig": {
+		"MaxFiles int `json:\"max_files\"`",
+		"MaxBytes int64 `json:\"max_bytes\"`",
+		"MaxPercent float64 `json:\"max_percent\"`",
+		"DeniedRoots []string `json:\"denied_roots\"`",
+	},
+	"HookConfig": {
+		"Name string `json:\"name\"`",
+		"Stage hooks.Stage `json:\"stage\"`",
+		"Command string `json:\"command\"`",
+		"TimeoutSeconds float64 `json:\"timeout_seconds\"`",
+		"OnFailure hooks.Policy `json:\"on_failure\"`",
+	},
+	"RateLimitConfig": {
+		"ReadBytesPerSec int64 `json:\"read_bytes_per_sec\"`",
+		"WriteBytesPerSec int64 `json:\"write_bytes_per_sec\"`",
+		"RemoteBytesPerSec int64 `json:\"remote_bytes_per_sec\"`",
+		"Remotes map[string]int64 `json:\"remotes\"`",
+		"Schedule []ratelimit.Window `json:\"schedule\"`",
+	},
+	"RateLimitWindow": {
+		"Start string `json:\"start\"`",
+		"End string `json:\"end\"`",
+		"ReadBytesPerSec int64 `json:\"read_bytes_per_sec\"`",
+		"WriteBytesPerSec int64 `json:\"write_bytes_per_sec\"`",
+		"RemoteBytesPerSec int64 `json:\"remote_bytes_per_sec\"`",
+	},
+	"RemoteRetryConfig": {
+		"Attempts int `json:\"attempts\"`",
+		"InitialBackoff duration.Duration `json:\"initial_backoff\"`",
+		"MaxBackoff duration.Duration `json:\"max_backoff\"`",
+		"Outbox bool `json:\"outbox\"`",
+		"Path string `json:\"path\"`",
+		"OptionalRemotes []string `json:\"optional_remotes\"`",
+	},
+	"NotifyConfig": {
+		"Enabled bool `json:\"enabled\"`",
+		"ConsecutiveFailures int `json:\"consecutive_failures\"`",
+		"Webhooks []notify.WebhookConfig `json:\"webhooks\"`",
+		"Email *notify.EmailConfig `json:\"email,omitempty\"`",
+	},
+	"WebhookConfig": {
+		"URL string `json:\"url\"`",
+		"Format notify.Format `json:\"format\"`",
+		"Template string `json:\"template\"`",
+		"Headers map[string]string `json:\"headers\"`",
+		"Triggers []notify.Trigger `json:\"triggers\"`",
+		"TimeoutSeconds int `json:\"timeout_seconds\"`",
+	},
+	"EmailConfig": {
+		"Host string `json:\"host\"`",
+		"Port int `json:\"port\"`",
+		"Username string `json:\"username\"`",
+		"Password string `json:\"password\"`",
+		"From string `json:\"from\"`",
+		"To []string `json:\"to\"`",
+		"Subject string `json:\"subject\"`",
+		"Template string `json:\"template\"`",
+		"Triggers []notify.Trigger `json:\"triggers\"`",
+		"TimeoutSeconds int `json:\"timeout_seconds\"`",
+	},
+	"Result": {
+		"Succeeded int",
+		"Failed int",
+		"Skipped int",
+		"InUse int",
+		"Errors []backup.FileError",
+		"TotalBytes int64",
+		"BackedUp int",
+		"Pruned int",
+		"Truncated int",
+		"TruncatedBytes int64",
+		"DirsRemoved int",
+		"TrashPurged int",
+		"RemoteCopied int",
+		"RemoteFailed int",
+		"OutboxPending int",
+		"SnapshotPending int",
+		"OriginalBytes int64",
+		"CompressedBytes int64",
+		"ArchiveSize int64",
+		"ArchivePath string",
+		"Archives []backup.ArchiveInfo",
+		"Destinations []backup.DestinationResult",
+	},
+	"FileError": {
+		"Path string",
+		"Operation string",
+		"Err error",
+	},
+	"ArchiveInfo": {
+		"Path string `json:\"path\"`",
+		"FilesArchived int `json:\"files_archived\"`",
+		"MergedEntries int `json:\"merged_entries\"`",
+		"OriginalBytes int64 `json:\"original_bytes\"`",
+		"Size int64 `json:\"size\"`",
+	},
+	"DestinationResult": {
+		"Destination string `json:\"destination\"`",
+		"Remote bool `json:\"remote\"`",
+		"Succeeded int `json:\"succeeded\"`",
+		"Failed int `json:\"failed\"`",
+		"Bytes int64 `json:\"bytes\"`",
+	},
+	"Report": {
+		"Version int `json:\"version\"`",
+		"Status backup.Status `json:\"status\"`",
+		"Error string `json:\"error,omitempty\"`",
+		"StartedAt time.Time `json:\"started_at\"`",
+		"FinishedAt time.Time `json:\"finished_at\"`",
+		"DurationMS int64 `json:\"duration_ms\"`",
+		"Hostname string `json:\"hostname,omitempty\"`",
+		"TargetFolder string `json:\"target_folder,omitempty\"`",
+		"DryRun bool `json:\"dry_run\"`",
+		"Files backup.ReportFiles `json:\"files\"`",
+		"Bytes backup.ReportBytes `json:\"bytes\"`",
+		"Destinations []backup.DestinationResult `json:\"destinations\"`",
+		"Archives []backup.ArchiveInfo `json:\"archives\"`",
+		"Errors []backup.FileError `json:\"errors\"`",
+	},
+	"ReportFiles": {
+		"Succeeded int `json:\"succeeded\"`",
+		"Failed int `json:\"failed\"`",
+		"FailureRatePercent float64 `json:\"failure_rate_percent\"`",
+		"Skipped int `json:\"skipped\"`",
+		"InUse int `json:\"in_use\"`",
+		"BackedUp int `json:\"backed_up\"`",
+		"Pruned int `json:\"pruned\"`",
+		"Truncated int `json:\"truncated\"`",
+		"DirsRemoved int `json:\"dirs_removed\"`",
+		"TrashPurged int `json:\"trash_purged\"`",
+		"RemoteCopied int `json:\"remote_copied\"`",
+		"RemoteFailed int `json:\"remote_failed\"`",
+		"OutboxPending int `json:\"outbox_pending\"`",
+		"SnapshotPending int `json:\"snapshot_pending\"`",
+	},
+	"ReportBytes": {
+		"Total int64 `json:\"total\"`",
+		"Original int64 `json:\"original\"`",
+		"Compressed int64 `json:\"compressed\"`",
+		"Truncated int64 `json:\"truncated\"`",
+		"Archive int64 `json:\"archive\"`",
+	},
+	"Plan": {
+		"Version int `json:\"version\"`",
+		"CreatedAt time.Time `json:\"created_at\"`",
+		"TargetFolder string `json:\"target_folder\"`",
+		"ConfigDigest string `json:\"config_digest\"`",
+		"Scanned int `json:\"scanned\"`",
+		"Files []backup.PlanFile `json:\"files\"`",
+		"Actions []backup.Action `json:\"actions\"`",
+		"Totals backup.PlanTotals `json:\"totals\"`",
+	},
+	"PlanFile": {
+		"Path string `json:\"path\"`",
+		"Size int64 `json:\"size\"`",
+		"ModTime time.Time `json:\"mod_time\"`",
+		"Time time.Time `json:\"time\"`",
+		"Reason string `json:\"reason\"`",
+		"Symlink bool `json:\"symlink,omitempty\"`",
+		"Truncate bool `json:\"truncate,omitempty\"`",
+	},
+	"PlanTotals": {
+		"Files int `json:\"files\"`",
+		"Bytes int64 `json:\"bytes\"`",
+		"Backups int `json:\"backups\"`",
+		"Archives int `json:\"archives\"`",
+		"RemoteCopies int `json:\"remote_copies\"`",
+		"Truncates int `json:\"truncates\"`",
+		"Prunes int `json:\"prunes\"`",
+		"FreedBytes int64 `json:\"freed_bytes\"`",
+	},
+	"Action": {
+		"Type backup.ActionType `json:\"type\"`",
+		"Path string `json:\"path\"`",
+		"Destination string `json:\"destination,omitempty\"`",
+		"Files []string `json:\"files,omitempty\"`",
+		"Size int64 `json:\"size\"`",
+		"Rule string `json:\"rule,omitempty\"`",
+		"Compressed bool `json:\"compressed,omitempty\"`",
+		"Merge bool `json:\"merge,omitempty\"`",
+	},
+	"FileEvent": {
+		"Path string",
+		"Size int64",
+		"Time time.Time",
+		"Rule string",
+		"Reason string",
+		"Truncated bool",
+	},
+	"BatchFile": {
+		"Source string",
+		"RelPath string",
+		"Open func() (io.ReadCloser, error)",
+		"Size int64",
+	},
+	"Destination": {
+		"Copy func(context.Context, string, string) error",
+		"Name func() string",
+	},
+	"BatchDestination": {
+		"Copy func(context.Context, string, string) error",
+		"CopyBatch func(context.Context, []backup.BatchFile) []error",
+		"Name func() string",
+	},
+	"Clock": {
+		"Now func() time.Time",
+	},
+	"FileSystem": {
+		"Remove func(string) error",
+	},
+}
+
+func TestAPIFrozen(t *testing.T) {
+	for name, typ := range apiTypes {
+		var got []string
+		if typ.Kind() == reflect.Interface {
+			for i := 0; i < typ.NumMethod(); i++ {
+				got = append(got, typ.Method(i).Name+" "+typ.Method(i).Type.String())
+			}
+		} else {
+			for i := 0; i < typ.NumField(); i++ {
+				f := typ.Field(i)
+				if !f.IsExported() {
+					continue
+				}
+				sig := f.Name + " " + f.Type.String()
+				if f.Tag != "" {
+					sig += " `" + string(f.Tag) + "`"
+				}
+				got = append(got, sig)
+			}
+		}
+		if !reflect.DeepEqual(got, apiFields[name]) {
+			t.Errorf("%s changed:\n got  %q\n want %q", name, got, apiFields[name])
+		}
+	}
+	if len(apiFields) != len(apiTypes) {
+		t.Errorf("Expected fields for %d types, got %d", len(apiTypes), len(apiFields))
+	}
+
+	// Named basic types keep their kinds
+	for _, v := range []any{filekeeper.Status(""), filekeeper.ActionType(""), filekeeper.Trigger(""), filekeeper.Duration(0)} {
+		typ := reflect.TypeOf(v)
+		if want := map[string]reflect.Kind{"Status": reflect.String, "ActionType": reflect.String, "Trigger": reflect.String, "Duration": reflect.Int64}[typ.Name()]; typ.Kind() != want {
+			t.Errorf("%s is a %s, want %s", typ.Name(), typ.Kind(), want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// Package filekeeper embeds FileKeeper's backup and pruning cycle in another program.
+//
+//	engine, err := filekeeper.New(
+//		filekeeper.WithConfigFile("/etc/filekeeper/config.yaml"),
+//		filekeeper.WithLogger(logger),
+//		filekeeper.OnFilePruned(func(e filekeeper.FileEvent) { pruned.Add(e.Size) }),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	result, err := engine.Run(ctx)
+package filekeeper
+
+import (
+	"context"
+	"errors"
+	"filekeeper/internal/backup"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Clock tells the engine the time. File ages, rule thresholds, trash batches and
+// plan timestamps are taken from it; waits such as the in-use settle time are not.
+type Clock interface {
+	Now() time.Time
+}
+
+// FileSystem deletes pruned files. Reading files and writing backups use the
+// operating system. With the trash enabled, pruned files are moved to the trash
+// instead and Remove is not called.
+type FileSystem interface {
+	Remove(name string) error
+}
+
+// Engine runs backup and pruning cycles. It is safe for concurrent use; cycles
+// run one at a time.
+type Engine struct {
+	mu   sync.Mutex
+	cfg  *Config
+	log  *slog.Logger
+	opts backup.RunOptions
+}
+
+// Option configures an Engine.
+type Option func(*Engine) error
+
+// New returns an Engine configured by opts. A configuration is required, from
+// WithConfig or WithConfigFile, and is validated.
+func New(opts ...Option) (*Engine, error) {
+	e := &Engine{log: slog.New(slog.DiscardHandler)}
+	for _, opt := range opts {
+		if err := opt(e); err != nil {
+			return nil, fmt.Errorf("filekeeper: %w", err)
+		}
+	}
+	if e.cfg == nil {
+		return nil, errors.New("filekeeper: no configuration, use WithConfig or WithConfigFile")
+	}
+	if err := e.cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("filekeeper: invalid configuration: %w", err)
+	}
+	return e, nil
+}
+
+// WithConfig uses cfg. The engine keeps the pointer, so cfg must not be changed
+// while a cycle runs.
+func WithConfig(cfg *Config) Option {
+	return func(e *Engine) error {
+		if cfg == nil {
+			return errors.New("nil configuration")
+		}
+		e.cfg = cfg
+		return nil
+	}
+}
+
+// WithConfigFile loads the configuration from a JSON, YAML or TOML file, with
+// FILEKEEPER_* environment overrides applied.
+func WithConfigFile(path string) Option {
+	return func(e *Engine) error {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return err
+		}
+		e.cfg = cfg
+		return nil
+	}
+}
+
+// WithLogger logs to log. By default nothing is logged.
+func WithLogger(log *slog.Logger) Option {
+	return func(e *Engine) error {
+		if log == nil {
+			return errors.New("nil logger")
+		}
+		e.log = log
+		return nil
+	}
+}
+
+// WithClock takes the time from clock instead of the system clock.
+func WithClock(clock Clock) Option {
+	return func(e *Engine) error {
+		if clock == nil {
+			return errors.New("nil clock")
+		}
+		e.opts.Now = clock.Now
+		return nil
+	}
+}
+
+// WithFileSystem deletes pruned files through fsys instead of os.Remove.
+func WithFileSystem(fsys FileSystem) Option {
+	return func(e *Engine) error {
+		if fsys == nil {
+			return errors.New("nil file system")
+		}
+		e.opts.Remove = fsys.Remove
+		return nil
+	}
+}
+
+// WithDestinations adds destinations that receive a copy of each backup after the
+// remote_backups entries. Without a local backup path they are given the original
+// files, and only a BatchDestination can receive compressed copies.
+func WithDestinations(dests ...Destination) Option {
+	return func(e *Engine) error {
+		for _, d := range dests {
+			if d == nil {
+				return errors.New("nil destination")
+			}
+		}
+		e.opts.Destinations = append(e.opts.Destinations, dests...)
+		return nil
+	}
+}
+
+// OnFileBackedUp calls fn after each file was copied to at least one local
+// destination or archived. It is not called in dry-run mode.
+func OnFileBackedUp(fn func(FileEvent)) Option {
+	return func(e *Engine) error {
+		e.opts.Hooks.OnFileBackedUp = fn
+		return nil
+	}
+}
+
+// OnFilePruned calls fn after each file was removed, moved to the trash or
+// truncated. It is not called in dry-run mode.
+func OnFilePruned(fn func(FileEvent)) Option {
+	return func(e *Engine) error {
+		e.opts.Hooks.OnFilePruned = fn
+		return nil
+	}
+}
+
+// OnError calls fn for each error recorded in a cycle's Result.
+func OnError(fn func(FileError)) Option {
+	return func(e *Engine) error {
+		e.opts.Hooks.OnError = fn
+		return nil
+	}
+}
+
+// WithDryRun makes Run log what it would do without changing anything.
+func WithDryRun() Option {
+	return func(e *Engine) error {
+		e.opts.DryRun = true
+		return nil
+	}
+}
+
+// WithForce disables the safety limits and denied roots.
+func WithForce() Option {
+	return func(e *Engine) error {
+		e.opts.Force = true
+		return nil
+	}
+}
+
+// Config returns the configuration of the engine.
+func (e *Engine) Config() *Config {
+	return e.cfg
+}
+
+// Run runs one cycle: select, back up and prune. Individual file errors are
+// recorded in the Result; the error is set if the cycle stopped early, for
+// example with ErrThresholdExceeded, ErrSafetyLimit or the context's error.
+func (e *Engine) Run(ctx context.Context) (*Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	opts := e.opts
+	return backup.RunBackup(ctx, e.cfg, &opts, e.log)
+}
+
+// Plan computes what a cycle would do without changing anything.
+func (e *Engine) Plan(ctx context.Context) (*Plan, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	opts := e.opts
+	plan, _, err := backup.BuildPlan(ctx, e.cfg, &opts, e.log)
+	return plan, err
+}
+
+// Apply runs the files of a plan made by Plan, with the same configuration.
+// The plan is refused with ErrPlanMismatch if the configuration changed; files
+// that changed since planning are recorded as ErrFileChanged errors.
+func (e *Engine) Apply(ctx context.Context, plan *Plan) (*Result, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	opts := e.opts
+	return backup.ApplyPlan(ctx, e.cfg, plan, &opts, e.log)
+}
@@ -0,0 +1,105 @@
+package filekeeper_test
+
+import (
+	"context"
+	"errors"
+	"filekeeper/pkg/filekeeper"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+type recordingFS struct{ removed []string }
+
+func (fs *recordingFS) Remove(name string) error {
+	fs.removed = append(fs.removed, name)
+	return os.Remove(name)
+}
+
+type recordingDestination struct{ copied []string }
+
+func (d *recordingDestination) Name() string { return "memory" }
+
+func (d *recordingDestination) Copy(ctx context.Context, source, relPath string) error {
+	if strings.HasPrefix(relPath, "fail") {
+		return errors.New("destination full")
+	}
+	d.copied = append(d.copied, relPath)
+	return nil
+}
+
+func TestEngineRun(t *testing.T) {
+	logDir := t.TempDir()
+	backupDir := t.TempDir()
+	for _, name := range []string{"app.log", "fail.log"} {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	fsys := &recordingFS{}
+	dest := &recordingDestination{}
+	var backedUp, pruned []string
+	engine, err := filekeeper.New(
+		filekeeper.WithConfig(&filekeeper.Config{
+			TargetFolder: logDir,
+			PruneAfter:   filekeeper.Duration(24 * time.Hour),
+			RunInterval:  filekeeper.Duration(time.Hour),
+			BackupPaths:  []string{backupDir},
+			EnableBackup: true,
+		}),
+		// Files written now are two days old on this clock
+		filekeeper.WithClock(fixedClock(time.Now().Add(48*time.Hour))),
+		filekeeper.WithFileSystem(fsys),
+		filekeeper.WithDestinations(dest),
+		filekeeper.OnFileBackedUp(func(e filekeeper.FileEvent) { backedUp = append(backedUp, filepath.Base(e.Path)) }),
+		filekeeper.OnFilePruned(func(e filekeeper.FileEvent) { pruned = append(pruned, filepath.Base(e.Path)) }),
+	)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	result, err := engine.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	// fail.log is kept, as its remote copy failed
+	if result.Pruned != 1 || len(fsys.removed) != 1 || filepath.Base(fsys.removed[0]) != "app.log" {
+		t.Errorf("Expected app.log pruned through the file system, got %d and %v", result.Pruned, fsys.removed)
+	}
+	if len(backedUp) != 2 || len(pruned) != 1 {
+		t.Errorf("Expected 2 files backed up and 1 pruned, got backed up %v and pruned %v", backedUp, pruned)
+	}
+	if len(dest.copied) != 1 || dest.copied[0] != "app.log" {
+		t.Errorf("Expected app.log copied to the destination, got %v", dest.copied)
+	}
+	if result.RemoteFailed != 1 || filekeeper.CycleStatus(result, err) != filekeeper.StatusPartialFailure {
+		t.Errorf("Expected a partial failure with 1 failed copy, got %d", result.RemoteFailed)
+	}
+
+	var memory *filekeeper.DestinationResult
+	for i := range result.Destinations {
+		if result.Destinations[i].Destination == "memory" {
+			memory = &result.Destinations[i]
+		}
+	}
+	if memory == nil || memory.Succeeded != 1 || memory.Failed != 1 {
+		t.Errorf("Expected 1 succeeded and 1 failed copy to memory, got %+v", result.Destinations)
+	}
+}
+
+func TestNewRequiresConfig(t *testing.T) {
+	if _, err := filekeeper.New(); err == nil {
+		t.Error("Expected an error without a configuration")
+	}
+	_, err := filekeeper.New(filekeeper.WithConfig(&filekeeper.Config{}))
+	if err == nil || !strings.Contains(err.Error(), "invalid configuration") {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+}
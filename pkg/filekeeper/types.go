@@ -0,0 +1,125 @@
+package filekeeper
+
+import (
+	"filekeeper/internal/backup"
+	"filekeeper/internal/config"
+	"filekeeper/internal/duration"
+	"filekeeper/internal/hooks"
+	"filekeeper/internal/inuse"
+	"filekeeper/internal/notify"
+	"filekeeper/internal/outbox"
+	"filekeeper/internal/rules"
+	"filekeeper/internal/safety"
+	"filekeeper/internal/trash"
+	"filekeeper/pkg/ratelimit"
+	"time"
+)
+
+// The types in this file alias internal types and are frozen: their exported
+// fields, with types and tags, and their methods are part of the stable API and
+// pinned by TestAPIFrozen, so an internal change cannot alter them unnoticed.
+// Fields may be added in a minor release; none are removed, renamed or retyped
+// before a new major version.
+
+// Configuration types. Config is the same structure as the configuration file;
+// its sections are exported here so a configuration can be built in code.
+type (
+	Config            = config.Config
+	CompressionConfig = config.CompressionConfig
+	ArchiveConfig     = config.ArchiveConfig
+	EmptyDirsConfig   = config.EmptyDirsConfig
+	Rule              = rules.Rule
+	Duration          = duration.Duration // A time.Duration that reads "36h", "P30D" or seconds
+	InUseConfig       = inuse.Config
+	TrashConfig       = trash.Config
+	SafetyConfig      = safety.Config
+	HookConfig        = hooks.Config
+	RateLimitConfig   = ratelimit.Config
+	RateLimitWindow   = ratelimit.Window
+	RemoteRetryConfig = outbox.Config
+	NotifyConfig      = notify.Config
+	WebhookConfig     = notify.WebhookConfig
+	EmailConfig       = notify.EmailConfig
+	Trigger           = notify.Trigger
+)
+
+// Result types.
+type (
+	Result            = backup.Result
+	FileError         = backup.FileError
+	ArchiveInfo       = backup.ArchiveInfo
+	DestinationResult = backup.DestinationResult
+	Report            = backup.Report
+	ReportFiles       = backup.ReportFiles
+	ReportBytes       = backup.ReportBytes
+	Status            = backup.Status
+	Plan              = backup.Plan
+	PlanFile          = backup.PlanFile
+	PlanTotals        = backup.PlanTotals
+	Action            = backup.Action
+	ActionType        = backup.ActionType
+)
+
+// FileEvent describes a file passed to the OnFileBackedUp and OnFilePruned hooks.
+type FileEvent = backup.FileEvent
+
+// Destination receives a copy of each local backup or archive, like a
+// remote_backups entry. See WithDestinations.
+type Destination = backup.Destination
+
+// BatchDestination is a Destination that takes the copies of a cycle at once, for
+// example over one connection. Copy is not called.
+type BatchDestination = backup.BatchDestination
+
+// BatchFile is a copy passed to BatchDestination.CopyBatch.
+type BatchFile = backup.BatchFile
+
+// Cycle statuses, see CycleStatus.
+const (
+	StatusSuccess           = backup.StatusSuccess
+	StatusPartialFailure    = backup.StatusPartialFailure
+	StatusThresholdExceeded = backup.StatusThresholdExceeded
+	StatusFailed            = backup.StatusFailed
+	StatusInterrupted       = backup.StatusInterrupted
+	StatusConfigError       = backup.StatusConfigError
+)
+
+// Plan action types.
+const (
+	ActionBackup     = backup.ActionBackup
+	ActionArchive    = backup.ActionArchive
+	ActionRemoteCopy = backup.ActionRemoteCopy
+	ActionTruncate   = backup.ActionTruncate
+	ActionPrune      = backup.ActionPrune
+)
+
+// Errors returned by a cycle; test for them with errors.Is.
+var (
+	ErrThresholdExceeded = backup.ErrThresholdExceeded // Failures exceeded error_threshold_percent
+	ErrSafetyLimit       = backup.ErrSafetyLimit       // A safety limit aborted the cycle before anything changed
+	ErrAllArchivesFailed = backup.ErrAllArchivesFailed // No archive could be written to any destination
+	ErrPlanMismatch      = backup.ErrPlanMismatch      // The plan was made for another configuration
+	ErrFileChanged       = backup.ErrFileChanged       // Recorded for planned files that changed since planning
+	ErrHookFailed        = hooks.ErrFailed             // A hook command with on_failure abort failed
+)
+
+// LoadConfig reads and validates a JSON, YAML or TOML configuration file,
+// with FILEKEEPER_* environment overrides applied.
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// CycleStatus returns the status of a cycle from its result and error.
+func CycleStatus(result *Result, err error) Status {
+	return backup.CycleStatus(result, err)
+}
+
+// ReadPlan reads a plan written as JSON.
+func ReadPlan(path string) (*Plan, error) {
+	return backup.ReadPlan(path)
+}
+
+// NewReport builds the JSON report of a cycle that started at startedAt.
+func NewReport(result *Result, err error, startedAt time.Time) *Report {
+	return backup.NewReport(result, err, startedAt)
+}
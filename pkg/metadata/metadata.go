@@ -0,0 +1,110 @@
+// Package metadata reads and re-applies file metadata: permissions, ownership,
+// access and modification times, and extended attributes.
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Metadata is the file metadata preserved in backups.
+// On Linux, POSIX ACLs are stored as the system.posix_acl_access and
+// system.posix_acl_default extended attributes, so they are carried in Xattrs.
+type Metadata struct {
+	Mode   os.FileMode       // Permission, setuid, setgid and sticky bits
+	UID    int               // Owner user id (-1 if unknown)
+	GID    int               // Owner group id (-1 if unknown)
+	Atime  time.Time         // Last access time (zero if unknown)
+	Mtime  time.Time         // Last modification time
+	Xattrs map[string][]byte // Extended attributes (nil if unsupported)
+}
+
+// Read returns the metadata of the file at path.
+func Read(path string) (*Metadata, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := FromFileInfo(info)
+	xattrs, err := listXattrs(path)
+	if err != nil && !isUnsupported(err) {
+		return nil, fmt.Errorf("read extended attributes of %s: %w", path, err)
+	}
+	m.Xattrs = xattrs
+	return m, nil
+}
+
+// FromFileInfo returns the metadata available from info, without extended attributes.
+func FromFileInfo(info os.FileInfo) *Metadata {
+	m := &Metadata{
+		Mode:  info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+		UID:   -1,
+		GID:   -1,
+		Mtime: info.ModTime(),
+	}
+	statOwnerAndAtime(info, m)
+	return m
+}
+
+// Apply sets the metadata on the file at path.
+// Ownership is changed first, since chown clears the setuid and setgid bits, and times last.
+// Changes the platform or the caller's privileges do not allow are skipped:
+// an unprivileged process cannot give a file away, and not every filesystem stores xattrs.
+func Apply(path string, m *Metadata) error {
+	if m == nil {
+		return nil
+	}
+
+	if m.UID >= 0 || m.GID >= 0 {
+		if err := lchown(path, m.UID, m.GID); err != nil && !isUnsupported(err) {
+			return fmt.Errorf("set owner of %s: %w", path, err)
+		}
+	}
+
+	for name, value := range m.Xattrs {
+		if err := setXattr(path, name, value); err != nil && !isUnsupported(err) {
+			return fmt.Errorf("set extended attribute %s on %s: %w", name, path, err)
+		}
+	}
+
+	if err := os.Chmod(path, m.Mode); err != nil {
+		return fmt.Errorf("set mode of %s: %w", path, err)
+	}
+
+	atime := m.Atime
+	if atime.IsZero() {
+		atime = m.Mtime
+	}
+	if !m.Mtime.IsZero() {
+		if err := os.Chtimes(path, atime, m.Mtime); err != nil {
+			return fmt.Errorf("set times of %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// Copy applies the metadata of src to dest.
+func Copy(src, dest string) error {
+	m, err := Read(src)
+	if err != nil {
+		return err
+	}
+	return Apply(dest, m)
+}
+
+// isUnsupported reports whether err means the platform, filesystem or
+// the caller's privileges do not allow the operation.
+func isUnsupported(err error) bool {
+	return errors.Is(err, errUnsupported) ||
+		errors.Is(err, syscall.EPERM) ||
+		errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EOPNOTSUPP)
+}
+
+// errUnsupported is returned where the platform has no extended attribute support.
+var errUnsupported = errors.New("extended attributes not supported")
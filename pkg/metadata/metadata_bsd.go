@@ -0,0 +1,32 @@
+//go:build darwin || freebsd
+// +build darwin freebsd
+
+package metadata
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+func statOwnerAndAtime(info os.FileInfo, m *Metadata) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	m.UID = int(st.Uid)
+	m.GID = int(st.Gid)
+	m.Atime = time.Unix(int64(st.Atimespec.Sec), int64(st.Atimespec.Nsec))
+}
+
+func lchown(path string, uid, gid int) error {
+	return os.Lchown(path, uid, gid)
+}
+
+func listXattrs(path string) (map[string][]byte, error) {
+	return nil, errUnsupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errUnsupported
+}
@@ -0,0 +1,20 @@
+//go:build !linux && !darwin && !freebsd
+// +build !linux,!darwin,!freebsd
+
+package metadata
+
+import "os"
+
+func statOwnerAndAtime(info os.FileInfo, m *Metadata) {}
+
+func lchown(path string, uid, gid int) error {
+	return errUnsupported
+}
+
+func listXattrs(path string) (map[string][]byte, error) {
+	return nil, errUnsupported
+}
+
+func setXattr(path, name string, value []byte) error {
+	return errUnsupported
+}
@@ -0,0 +1,151 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// createFile writes a file with the given mode and times.
+func createFile(t *testing.T, dir, name string, mode os.FileMode, atime, mtime time.Time) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("content"), 0600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("failed to chmod file: %v", err)
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		t.Fatalf("failed to set times: %v", err)
+	}
+	return path
+}
+
+func TestCopy_ModeAndTimes(t *testing.T) {
+	dir := t.TempDir()
+	atime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	mtime := time.Date(2026, 1, 1, 1, 2, 3, 0, time.UTC)
+	src := createFile(t, dir, "src.log", 0640, atime, mtime)
+	dest := createFile(t, dir, "dest.log", 0600, time.Now(), time.Now())
+
+	if err := Copy(src, dest); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	m, err := Read(dest)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if runtime.GOOS != "windows" && m.Mode != 0640 {
+		t.Errorf("mode: got %o, want 0640", m.Mode)
+	}
+	if !m.Mtime.Equal(mtime) {
+		t.Errorf("mtime: got %v, want %v", m.Mtime, mtime)
+	}
+	if runtime.GOOS != "windows" && !m.Atime.Equal(atime) {
+		t.Errorf("atime: got %v, want %v", m.Atime, atime)
+	}
+}
+
+func TestApply_SpecialModeBits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("setgid and sticky bits are not supported on Windows")
+	}
+
+	dir := t.TempDir()
+	path := createFile(t, dir, "file.log", 0644, time.Now(), time.Now())
+
+	want := os.FileMode(0750) | os.ModeSetgid
+	if err := Apply(path, &Metadata{Mode: want, UID: -1, GID: -1}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if got := FromFileInfo(info).Mode; got != want {
+		t.Errorf("mode: got %v, want %v", got, want)
+	}
+}
+
+func TestApply_Owner(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() != 0 {
+		t.Skip("changing ownership requires root")
+	}
+
+	dir := t.TempDir()
+	path := createFile(t, dir, "file.log", 0644, time.Now(), time.Now())
+
+	if err := Apply(path, &Metadata{Mode: 0644, UID: 1234, GID: 5678}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	m, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if m.UID != 1234 || m.GID != 5678 {
+		t.Errorf("owner: got %d:%d, want 1234:5678", m.UID, m.GID)
+	}
+}
+
+func TestApply_OwnerUnprivileged(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("test requires an unprivileged user")
+	}
+
+	dir := t.TempDir()
+	path := createFile(t, dir, "file.log", 0644, time.Now(), time.Now())
+
+	// Giving the file away is not permitted and is skipped rather than failing the backup
+	if err := Apply(path, &Metadata{Mode: 0600, UID: 0, GID: 0}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode: got %o, want 0600", info.Mode().Perm())
+	}
+}
+
+func TestCopy_Xattrs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("extended attributes are only supported on Linux")
+	}
+
+	dir := t.TempDir()
+	src := createFile(t, dir, "src.log", 0644, time.Now(), time.Now())
+	dest := createFile(t, dir, "dest.log", 0644, time.Now(), time.Now())
+
+	if err := setXattr(src, "user.filekeeper.test", []byte("value")); err != nil {
+		if err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP {
+			t.Skip("filesystem does not support user extended attributes")
+		}
+		t.Fatalf("failed to set xattr: %v", err)
+	}
+
+	if err := Copy(src, dest); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	m, err := Read(dest)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if got := string(m.Xattrs["user.filekeeper.test"]); got != "value" {
+		t.Errorf("xattr: got %q, want %q", got, "value")
+	}
+}
+
+func TestApply_Nil(t *testing.T) {
+	if err := Apply(filepath.Join(t.TempDir(), "missing"), nil); err != nil {
+		t.Errorf("Apply(nil) should be a no-op, got %v", err)
+	}
+}
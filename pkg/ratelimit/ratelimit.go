@@ -0,0 +1,321 @@
+// Package ratelimit throttles reads and writes with token buckets. A Limiter is
+// shared by every reader and writer that uses it, so concurrent copies split its
+// rate between them. Limits can change with the time of day.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// chunkSize is the most bytes a limited reader or writer passes at once, so a
+// large buffer does not turn into one long wait.
+const chunkSize = 32 * 1024
+
+// Config holds the rate limits in bytes per second; 0 means unlimited.
+type Config struct {
+	ReadBytesPerSec   int64            `json:"read_bytes_per_sec"`   // Reads of source files
+	WriteBytesPerSec  int64            `json:"write_bytes_per_sec"`  // Writes of local backups and archives
+	RemoteBytesPerSec int64            `json:"remote_bytes_per_sec"` // All remote uploads together
+	Remotes           map[string]int64 `json:"remotes"`              // Upload limit per remote_backups entry, in addition to the global one
+	Schedule          []Window         `json:"schedule"`             // Times of day with other read, write and remote limits
+}
+
+// Window replaces the read, write and global remote limits between Start and End,
+// in local time. A window whose End is before its Start runs past midnight.
+// The first matching window applies.
+type Window struct {
+	Start             string `json:"start"` // "HH:MM"
+	End               string `json:"end"`   // "HH:MM"
+	ReadBytesPerSec   int64  `json:"read_bytes_per_sec"`
+	WriteBytesPerSec  int64  `json:"write_bytes_per_sec"`
+	RemoteBytesPerSec int64  `json:"remote_bytes_per_sec"`
+}
+
+// Validate checks the configuration.
+func (c *Config) Validate() error {
+	if c.ReadBytesPerSec < 0 || c.WriteBytesPerSec < 0 || c.RemoteBytesPerSec < 0 {
+		return fmt.Errorf("limits must not be negative")
+	}
+	for remote, limit := range c.Remotes {
+		if limit < 0 {
+			return fmt.Errorf("remotes: limit for %s must not be negative, got %d", remote, limit)
+		}
+	}
+	for i, w := range c.Schedule {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("schedule[%d]: start: %w", i, err)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("schedule[%d]: end: %w", i, err)
+		}
+		if w.Start == w.End {
+			return fmt.Errorf("schedule[%d]: start and end must differ", i)
+		}
+		if w.ReadBytesPerSec < 0 || w.WriteBytesPerSec < 0 || w.RemoteBytesPerSec < 0 {
+			return fmt.Errorf("schedule[%d]: limits must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, want HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// window returns the schedule window that applies at t, if any.
+func (c *Config) window(t time.Time) *Window {
+	minute := t.Hour()*60 + t.Minute()
+	for i := range c.Schedule {
+		w := &c.Schedule[i]
+		start, err1 := parseClock(w.Start)
+		end, err2 := parseClock(w.End)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if start < end && minute >= start && minute < end {
+			return w
+		}
+		if start > end && (minute >= start || minute < end) {
+			return w
+		}
+	}
+	return nil
+}
+
+// Limits holds the limiters of a configuration. A nil Limits is unlimited.
+type Limits struct {
+	read    *Limiter
+	write   *Limiter
+	remote  *Limiter // All remote uploads
+	remotes map[string]*Limiter
+}
+
+// New returns the limiters of cfg, or nil if cfg sets no limits.
+func New(cfg *Config) *Limits {
+	if cfg == nil || (cfg.ReadBytesPerSec == 0 && cfg.WriteBytesPerSec == 0 && cfg.RemoteBytesPerSec == 0 &&
+		len(cfg.Remotes) == 0 && len(cfg.Schedule) == 0) {
+		return nil
+	}
+	rate := func(base int64, pick func(*Window) int64) func(time.Time) int64 {
+		return func(t time.Time) int64 {
+			if w := cfg.window(t); w != nil {
+				return pick(w)
+			}
+			return base
+		}
+	}
+	l := &Limits{
+		read:    NewScheduled(rate(cfg.ReadBytesPerSec, func(w *Window) int64 { return w.ReadBytesPerSec })),
+		write:   NewScheduled(rate(cfg.WriteBytesPerSec, func(w *Window) int64 { return w.WriteBytesPerSec })),
+		remote:  NewScheduled(rate(cfg.RemoteBytesPerSec, func(w *Window) int64 { return w.RemoteBytesPerSec })),
+		remotes: make(map[string]*Limiter),
+	}
+	for remote, limit := range cfg.Remotes {
+		if limit > 0 {
+			l.remotes[remote] = NewLimiter(limit)
+		}
+	}
+	return l
+}
+
+// ReadLimiter returns the limiter of local reads, nil if unlimited.
+func (l *Limits) ReadLimiter() *Limiter {
+	if l == nil {
+		return nil
+	}
+	return l.read
+}
+
+// WriteLimiter returns the limiter of local writes, nil if unlimited.
+func (l *Limits) WriteLimiter() *Limiter {
+	if l == nil {
+		return nil
+	}
+	return l.write
+}
+
+// RemoteLimiters returns the limiters of uploads to remote: the global one and
+// the remote's own, if any.
+func (l *Limits) RemoteLimiters(remote string) []*Limiter {
+	if l == nil {
+		return nil
+	}
+	return []*Limiter{l.remote, l.remotes[remote]}
+}
+
+// RemoteRate returns the upload rate to remote at t: the lower of the global and
+// the remote's own limit, 0 if neither is set.
+func (l *Limits) RemoteRate(remote string, t time.Time) int64 {
+	var rate int64
+	for _, limiter := range l.RemoteLimiters(remote) {
+		if r := limiter.Rate(t); r > 0 && (rate == 0 || r < rate) {
+			rate = r
+		}
+	}
+	return rate
+}
+
+// Limiter is a token bucket refilled at a rate in bytes per second, holding up to
+// one second of tokens. A nil Limiter is unlimited.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   func(time.Time) int64
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter returns a Limiter of bytesPerSec, or nil if bytesPerSec is 0.
+func NewLimiter(bytesPerSec int64) *Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return NewScheduled(func(time.Time) int64 { return bytesPerSec })
+}
+
+// NewScheduled returns a Limiter whose rate at a time is given by rate; a rate
+// of 0 is unlimited.
+func NewScheduled(rate func(time.Time) int64) *Limiter {
+	return &Limiter{rate: rate}
+}
+
+// Rate returns the rate of the limiter at t, 0 if unlimited.
+func (l *Limiter) Rate(t time.Time) int64 {
+	if l == nil {
+		return 0
+	}
+	return l.rate(t)
+}
+
+// WaitN takes n tokens, waiting until the bucket has refilled enough. It returns
+// early with the context's error if ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	rate := float64(l.rate(now))
+	if rate <= 0 {
+		l.tokens, l.last = 0, time.Time{}
+		l.mu.Unlock()
+		return nil
+	}
+	burst := max(rate, chunkSize)
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*rate)
+	}
+	l.last = now
+
+	// Tokens are taken up front, so concurrent callers queue behind each other
+	l.tokens -= float64(n)
+	wait := time.Duration(0)
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// waitAll takes n tokens from each limiter.
+func waitAll(ctx context.Context, limiters []*Limiter, n int) error {
+	for _, l := range limiters {
+		if err := l.WaitN(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// active returns the limiters that are not nil.
+func active(limiters []*Limiter) []*Limiter {
+	var list []*Limiter
+	for _, l := range limiters {
+		if l != nil {
+			list = append(list, l)
+		}
+	}
+	return list
+}
+
+type reader struct {
+	ctx      context.Context
+	r        io.Reader
+	limiters []*Limiter
+}
+
+// NewReader returns a reader that reads from r no faster than each of limiters
+// allows. It returns r itself if all limiters are nil.
+func NewReader(ctx context.Context, r io.Reader, limiters ...*Limiter) io.Reader {
+	limiters = active(limiters)
+	if len(limiters) == 0 {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiters: limiters}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	if werr := waitAll(r.ctx, r.limiters, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+type writer struct {
+	ctx      context.Context
+	w        io.Writer
+	limiters []*Limiter
+}
+
+// NewWriter returns a writer that writes to w no faster than each of limiters
+// allows. It returns w itself if all limiters are nil.
+func NewWriter(ctx context.Context, w io.Writer, limiters ...*Limiter) io.Writer {
+	limiters = active(limiters)
+	if len(limiters) == 0 {
+		return w
+	}
+	return &writer{ctx: ctx, w: w, limiters: limiters}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), chunkSize)]
+		if err := waitAll(w.ctx, w.limiters, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
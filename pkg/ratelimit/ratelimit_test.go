@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"limits", Config{ReadBytesPerSec: 1, WriteBytesPerSec: 2, RemoteBytesPerSec: 3, Remotes: map[string]int64{"host:/b": 4}}, false},
+		{"window", Config{Schedule: []Window{{Start: "22:00", End: "06:00"}}}, false},
+		{"negative", Config{WriteBytesPerSec: -1}, true},
+		{"negative remote", Config{Remotes: map[string]int64{"host:/b": -1}}, true},
+		{"bad start", Config{Schedule: []Window{{Start: "8am", End: "18:00"}}}, true},
+		{"bad end", Config{Schedule: []Window{{Start: "08:00", End: "24:00"}}}, true},
+		{"empty window", Config{Schedule: []Window{{Start: "08:00", End: "08:00"}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	limits := New(&Config{
+		RemoteBytesPerSec: 1000,
+		Remotes:           map[string]int64{"host:/b": 500},
+		Schedule: []Window{
+			{Start: "08:00", End: "18:00", RemoteBytesPerSec: 100},
+			{Start: "22:00", End: "06:00"},
+		},
+	})
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return t
+	}
+
+	tests := []struct {
+		clock  string
+		remote string
+		want   int64
+	}{
+		{"07:59", "other:/b", 1000},
+		{"08:00", "other:/b", 100},
+		{"17:59", "host:/b", 100},
+		{"18:00", "host:/b", 500},
+		{"23:00", "host:/b", 500},
+		{"23:00", "other:/b", 0},
+		{"05:59", "other:/b", 0},
+		{"06:00", "other:/b", 1000},
+	}
+	for _, tt := range tests {
+		if got := limits.RemoteRate(tt.remote, at(tt.clock)); got != tt.want {
+			t.Errorf("RemoteRate(%s, %s) = %d, want %d", tt.remote, tt.clock, got, tt.want)
+		}
+	}
+
+	if New(&Config{}) != nil {
+		t.Error("New() of an empty configuration should be nil")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	const rate = 1 << 20
+	data := bytes.Repeat([]byte("x"), rate+rate/2)
+
+	// The first second is in the bucket; the other half second is waited for
+	var out bytes.Buffer
+	start := time.Now()
+	w := NewWriter(context.Background(), &out, NewLimiter(rate))
+	if _, err := io.Copy(w, bytes.NewReader(data)); err != nil {
+		t.Fatalf("Copy() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("writing 1.5 s of data took %s", elapsed)
+	}
+	if out.Len() != len(data) {
+		t.Errorf("wrote %d bytes, want %d", out.Len(), len(data))
+	}
+
+	// Waits stop when the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := NewReader(ctx, bytes.NewReader(data), NewLimiter(chunkSize))
+	if _, err := io.Copy(io.Discard, r); !errors.Is(err, context.Canceled) {
+		t.Errorf("Copy() error = %v, want context.Canceled", err)
+	}
+
+	// Without limiters the reader is returned as is
+	src := bytes.NewReader(data)
+	if NewReader(context.Background(), src, nil, nil) != io.Reader(src) {
+		t.Error("NewReader() without limiters should return the reader")
+	}
+}
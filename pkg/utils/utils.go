@@ -1,10 +1,18 @@
 package utils
 
 import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func CopyFile(src, dest string) error {
@@ -28,6 +36,18 @@ func CopyFile(src, dest string) error {
 	return destFile.Sync()
 }
 
+// CopySymlink recreates the symlink src at dest, replacing any existing file at dest.
+func CopySymlink(src, dest string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dest); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Symlink(target, dest)
+}
+
 // ExecuteRemoteCopy securely copies a file to a remote destination using scp.
 func ExecuteRemoteCopy(sourcePath, destination string) error {
 	if _, err := os.Stat(sourcePath); err != nil {
@@ -38,10 +58,273 @@ func ExecuteRemoteCopy(sourcePath, destination string) error {
 		return fmt.Errorf("destination cannot be empty")
 	}
 
-	cmd := exec.Command("scp", sourcePath, destination)
+	return runSCP(sourcePath, destination)
+}
+
+// ExecuteRemoteCopyPreserving copies a file like ExecuteRemoteCopy, keeping its
+// mode and access and modification times (scp -p).
+func ExecuteRemoteCopyPreserving(sourcePath, destination string) error {
+	if _, err := os.Stat(sourcePath); err != nil {
+		return fmt.Errorf("source file does not exist: %w", err)
+	}
+
+	if destination == "" {
+		return fmt.Errorf("destination cannot be empty")
+	}
+
+	return runSCP("-p", sourcePath, destination)
+}
+
+// ExecuteRemoteCopyLimited copies a file like ExecuteRemoteCopy, or like
+// ExecuteRemoteCopyPreserving if preserve is set, uploading no faster than
+// bytesPerSec (scp -l, rounded up to whole Kbit/s). A rate of 0 is unlimited.
+func ExecuteRemoteCopyLimited(sourcePath, destination string, preserve bool, bytesPerSec int64) error {
+	if bytesPerSec <= 0 {
+		if preserve {
+			return ExecuteRemoteCopyPreserving(sourcePath, destination)
+		}
+		return ExecuteRemoteCopy(sourcePath, destination)
+	}
+	if _, err := os.Stat(sourcePath); err != nil {
+		return fmt.Errorf("source file does not exist: %w", err)
+	}
+
+	if destination == "" {
+		return fmt.Errorf("destination cannot be empty")
+	}
+
+	args := []string{"-l", strconv.FormatInt(scpKbits(bytesPerSec), 10)}
+	if preserve {
+		args = append(args, "-p")
+	}
+	return runSCP(append(args, sourcePath, destination)...)
+}
+
+// scpKbits converts bytes per second to the Kbit/s of scp -l, at least 1.
+func scpKbits(bytesPerSec int64) int64 {
+	return max(1, (bytesPerSec*8+999)/1000)
+}
+
+// runSCP runs scp with the given arguments, passed directly without a shell.
+func runSCP(args ...string) error {
+	cmd := exec.Command("scp", args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("scp failed: %w, output: %s", err, string(output))
 	}
 	return nil
 }
+
+// RemoteFile is a file sent by ExecuteRemoteBatch.
+type RemoteFile struct {
+	Path string // File to send; its mode and modification time are used in any case
+	Name string // Slash-separated path on the remote side, relative to its directory
+	// Open, if set, returns the content to send in place of Path's, Size bytes long.
+	Open func() (io.ReadCloser, error)
+	Size int64
+}
+
+// ExecuteRemoteBatch copies files to destination ([user@]host:path) in one ssh
+// session: they are sent as a tar stream and unpacked by tar on the remote side.
+// preserve keeps their mode and modification times (like scp -p). wrap, if not
+// nil, wraps the stream, e.g. to limit its rate. It returns an error for each file,
+// nil for the files that were copied. A file that cannot be read or changes size
+// while it is sent fails alone and never replaces an earlier copy: each file is
+// unpacked under a temporary name and linked to its own name only once it was sent
+// in full. If the session fails, every other file fails.
+func ExecuteRemoteBatch(ctx context.Context, destination string, files []RemoteFile, preserve bool, wrap func(io.Writer) io.Writer) []error {
+	errs := make([]error, len(files))
+	fail := func(err error) []error {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	host, dir, err := splitRemote(destination)
+	if err != nil {
+		return fail(err)
+	}
+	partial := fmt.Sprintf(".filekeeper-partial-%d-%d", os.Getpid(), time.Now().UnixNano())
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh", host, remoteUnpackCommand(dir, partial, preserve))
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fail(err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fail(fmt.Errorf("ssh failed: %w", err))
+	}
+
+	var w io.Writer = stdin
+	if wrap != nil {
+		w = wrap(stdin)
+	}
+	tw := tar.NewWriter(w)
+	var streamErr error
+	for i, f := range files {
+		errs[i], streamErr = sendFile(tw, f, partial+"/"+strconv.Itoa(i))
+		if streamErr != nil {
+			break
+		}
+	}
+	if streamErr == nil {
+		streamErr = tw.Close()
+	}
+	stdin.Close()
+
+	if err := cmd.Wait(); err != nil {
+		return fail(fmt.Errorf("ssh failed: %w, output: %s", err, output.String()))
+	}
+	if streamErr != nil {
+		return fail(fmt.Errorf("send tar stream: %w", streamErr))
+	}
+	return errs
+}
+
+// splitRemote splits [user@]host:path into the ssh host and the directory.
+func splitRemote(destination string) (string, string, error) {
+	i := strings.Index(destination, ":")
+	if i <= 0 || i == len(destination)-1 {
+		return "", "", fmt.Errorf("invalid remote destination %q, expected user@host:/path", destination)
+	}
+	return destination[:i], destination[i+1:], nil
+}
+
+// remoteUnpackCommand returns the shell command that unpacks a tar stream from
+// stdin into dir and then removes the directory partial of temporary names.
+// A dir starting with ~/ is relative to the remote home directory.
+func remoteUnpackCommand(dir, partial string, preserve bool) string {
+	if dir == "~" {
+		dir = "."
+	} else if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+		dir = rest
+		if dir == "" {
+			dir = "."
+		}
+	}
+	flags := "-xmf"
+	if preserve {
+		flags = "-xpf"
+	}
+	quoted := shellQuote(dir)
+	return "mkdir -p -- " + quoted + " && cd -- " + quoted + " && { tar " + flags + " -; s=$?; rm -rf -- " +
+		shellQuote(partial) + "; exit $s; }"
+}
+
+// shellQuote quotes s as a single POSIX shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// sendFile writes f to tw under the temporary name tmp, followed by a hard link
+// from its own name once its content was sent in full. Owners are not sent; mode
+// and modification time are unpacked only if the remote side preserves them.
+// fileErr fails f alone: a file whose content ends early or runs long is padded
+// or cut to the size in its header, so the stream stays valid, and is not linked.
+// streamErr is an error of the stream itself.
+func sendFile(tw *tar.Writer, f RemoteFile, tmp string) (fileErr, streamErr error) {
+	name, err := remoteName(f.Name)
+	if err != nil {
+		return err, nil
+	}
+
+	// Symlinks are followed, as scp does
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return fmt.Errorf("source file does not exist: %w", err), nil
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", f.Path), nil
+	}
+	open, size := f.Open, f.Size
+	if open == nil {
+		open = func() (io.ReadCloser, error) { return os.Open(f.Path) }
+		size = info.Size()
+	}
+	content, err := open()
+	if err != nil {
+		return err, nil
+	}
+	defer content.Close()
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     tmp,
+		Size:     size,
+		Mode:     int64(info.Mode().Perm()),
+		ModTime:  info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	src := &readErrReader{r: content}
+	n, err := io.Copy(tw, src)
+	switch {
+	case src.err != nil:
+		fileErr = fmt.Errorf("read %s: %w", f.Path, src.err)
+	case errors.Is(err, tar.ErrWriteTooLong):
+		return fmt.Errorf("%s grew while being sent", f.Path), nil
+	case err != nil:
+		return nil, err
+	case n < size:
+		fileErr = fmt.Errorf("%s shrank while being sent", f.Path)
+	}
+	if n < size {
+		if _, err := io.CopyN(tw, zeroReader{}, size-n); err != nil {
+			return nil, err
+		}
+	}
+	if fileErr != nil {
+		return fileErr, nil
+	}
+
+	link := &tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     name,
+		Linkname: tmp,
+		Mode:     hdr.Mode,
+		ModTime:  hdr.ModTime,
+	}
+	if err := tw.WriteHeader(link); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// remoteName returns the cleaned tar entry name of a file, refusing names that
+// would unpack outside the remote directory.
+func remoteName(name string) (string, error) {
+	clean := path.Clean(name)
+	if name == "" || clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid remote name %q", name)
+	}
+	return clean, nil
+}
+
+// readErrReader keeps the error of its reader apart from the errors of the writer
+// it is copied to.
+type readErrReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// zeroReader reads zeros.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
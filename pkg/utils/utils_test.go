@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"context"
+	"io"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -31,6 +36,23 @@ func TestExecuteRemoteCopy_EmptyDestination(t *testing.T) {
 	}
 }
 
+func TestScpKbits(t *testing.T) {
+	tests := []struct {
+		bytesPerSec int64
+		want        int64
+	}{
+		{1, 1},
+		{125, 1},
+		{126, 2},
+		{1 << 20, 8389},
+	}
+	for _, tt := range tests {
+		if got := scpKbits(tt.bytesPerSec); got != tt.want {
+			t.Errorf("scpKbits(%d) = %d, want %d", tt.bytesPerSec, got, tt.want)
+		}
+	}
+}
+
 func TestExecuteRemoteCopy_CommandInjectionPrevention(t *testing.T) {
 	tmpDir, err := os.MkdirTemp("", "utils_test")
 	if err != nil {
@@ -90,3 +112,111 @@ func TestCopyFile(t *testing.T) {
 		t.Errorf("content mismatch: got %q, want %q", string(destContent), string(content))
 	}
 }
+
+func TestRemoteUnpackCommand(t *testing.T) {
+	tests := []struct {
+		dir      string
+		preserve bool
+		want     string
+	}{
+		{"/backup/logs/", false, `mkdir -p -- '/backup/logs/' && cd -- '/backup/logs/' && { tar -xmf -; s=$?; rm -rf -- '.part'; exit $s; }`},
+		{"/backup/it's", true, `mkdir -p -- '/backup/it'\''s' && cd -- '/backup/it'\''s' && { tar -xpf -; s=$?; rm -rf -- '.part'; exit $s; }`},
+		{"~/logs", false, `mkdir -p -- 'logs' && cd -- 'logs' && { tar -xmf -; s=$?; rm -rf -- '.part'; exit $s; }`},
+		{"~", false, `mkdir -p -- '.' && cd -- '.' && { tar -xmf -; s=$?; rm -rf -- '.part'; exit $s; }`},
+	}
+	for _, tt := range tests {
+		if got := remoteUnpackCommand(tt.dir, ".part", tt.preserve); got != tt.want {
+			t.Errorf("remoteUnpackCommand(%q) = %s, want %s", tt.dir, got, tt.want)
+		}
+	}
+
+	if _, _, err := splitRemote("host"); err == nil {
+		t.Error("expected error for a destination without a path")
+	}
+	if host, dir, err := splitRemote("user@host:/backup"); err != nil || host != "user@host" || dir != "/backup" {
+		t.Errorf("splitRemote() = %q, %q, %v", host, dir, err)
+	}
+}
+
+func TestExecuteRemoteBatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ssh is a shell script")
+	}
+	if _, err := exec.LookPath("tar"); err != nil {
+		t.Skip("tar not installed")
+	}
+
+	// The fake ssh runs the remote command locally
+	binDir := t.TempDir()
+	script := "#!/bin/sh\nshift\nexec /bin/sh -c \"$1\"\n"
+	if err := os.WriteFile(filepath.Join(binDir, "ssh"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to create fake ssh: %v", err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	srcDir := t.TempDir()
+	files := []string{filepath.Join(srcDir, "a.log"), filepath.Join(srcDir, "missing.log"), filepath.Join(srcDir, "b.log.gz")}
+	for _, f := range []string{files[0], files[2]} {
+		if err := os.WriteFile(f, []byte("data of "+filepath.Base(f)), 0644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	remote := []RemoteFile{
+		{Path: files[0], Name: "a.log"},
+		{Path: files[1], Name: "missing.log"},
+		{Path: files[2], Name: "b.log.gz"},
+		{Path: files[0], Name: "short.log", Size: 10, Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("short")), nil
+		}},
+		{Path: files[0], Name: "c.log", Size: 7, Open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader("content")), nil
+		}},
+		{Path: files[0], Name: "x/app.log"},
+		{Path: files[2], Name: "y/app.log"},
+		{Path: files[0], Name: "../escape.log"},
+	}
+	// A file that shrinks while it is sent does not replace the earlier copy
+	remoteDir := filepath.Join(t.TempDir(), "remote")
+	if err := os.MkdirAll(remoteDir, 0755); err != nil {
+		t.Fatalf("failed to create remote dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(remoteDir, "short.log"), []byte("good copy"), 0644); err != nil {
+		t.Fatalf("failed to create earlier copy: %v", err)
+	}
+	errs := ExecuteRemoteBatch(context.Background(), "host:"+remoteDir, remote, false, nil)
+	if errs[0] != nil || errs[1] == nil || errs[2] != nil || errs[3] == nil || errs[4] != nil ||
+		errs[5] != nil || errs[6] != nil || errs[7] == nil {
+		t.Fatalf("Expected the missing, the short and the escaping file to fail, got %v", errs)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(remoteDir), "escape.log")); !os.IsNotExist(err) {
+		t.Error("Expected no file outside the remote directory")
+	}
+	want := map[string]string{
+		"a.log":     "data of a.log",
+		"short.log": "good copy",
+		"b.log.gz":  "data of b.log.gz",
+		"c.log":     "content",
+		"x/app.log": "data of a.log",
+		"y/app.log": "data of b.log.gz",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(remoteDir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s unpacked on the remote side, got %q, %v", name, data, err)
+		}
+	}
+
+	if partial, _ := filepath.Glob(filepath.Join(remoteDir, ".filekeeper-partial-*")); len(partial) != 0 {
+		t.Errorf("Expected the temporary names removed, got %v", partial)
+	}
+
+	// A failing session fails every file
+	if err := os.WriteFile(filepath.Join(binDir, "ssh"), []byte("#!/bin/sh\nexit 255\n"), 0755); err != nil {
+		t.Fatalf("failed to replace fake ssh: %v", err)
+	}
+	errs = ExecuteRemoteBatch(context.Background(), "host:"+remoteDir, remote[:1], false, nil)
+	if errs[0] == nil {
+		t.Error("Expected the file to fail when ssh fails")
+	}
+}
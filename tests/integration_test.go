@@ -5,6 +5,7 @@ import (
 	"filekeeper/internal/backup"
 	"filekeeper/internal/config"
 	"filekeeper/internal/logger"
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"